@@ -0,0 +1,11 @@
+// Package api holds the OpenAPI 3 description of the HTTP API.
+package api
+
+import _ "embed"
+
+// Spec is the OpenAPI document of the HTTP API, served at /openapi.json. It
+// must be updated together with the routes registered in cmd/api and the
+// request and response types of the handler package.
+//
+//go:embed openapi.json
+var Spec []byte
@@ -1,25 +1,48 @@
 // Package main starts the uniswap-estimator HTTP service.
 //
-// It wires configuration, logging, Ethereum RPC client, and HTTP handlers
-// to expose a GET /estimate endpoint for Uniswap V2 swap estimations.
+// It wires configuration, logging, a pool of RPC clients per chain, and HTTP
+// handlers to expose a GET /v1/estimate endpoint for Uniswap V2 swap
+// estimations, a GET /v1/estimate/history endpoint for backtesting over block
+// ranges, a POST /v1/simulate endpoint for what-if sequences of swaps,
+// mints and burns, and GET /v1/quotes/stream for live quotes over
+// Server-Sent Events or WebSocket. GET /v1/tokens searches the chains' token
+// lists, whose symbols the estimation endpoints accept in place of token
+// addresses. GET /healthz and GET /readyz serve liveness and readiness
+// probes, GET /metrics exposes Prometheus metrics and GET /openapi.json
+// describes the API. When API keys are configured, API requests must carry
+// one and are metered against its rate and daily quota. Each client address
+// may be rate limited, and estimates, simulations, history queries, gRPC
+// calls and quote stream polls share a concurrency cap that queues and then
+// sheds excess requests. Requests are traced with
+// OpenTelemetry when an OTLP endpoint is configured.
+// When GRPC_ADDR is set, the same estimates are also served over gRPC on
+// that address, and both listeners shut down together.
+// SIGHUP or a change of the config file reloads the chains, RPC pools, fees
+// and limits without restarting the listeners.
 package main
 
 import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/gofiber/fiber/v3"
 	"github.com/joho/godotenv"
+	"github.com/nulln0ne/uniswap-estimator/internal/buildinfo"
 	"github.com/nulln0ne/uniswap-estimator/internal/config"
 	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/grpcapi"
 	"github.com/nulln0ne/uniswap-estimator/internal/handler"
+	"github.com/nulln0ne/uniswap-estimator/internal/indexer"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
 	"github.com/nulln0ne/uniswap-estimator/internal/logging"
 	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
 )
 
 // main is the entrypoint that invokes run and exits with a non-zero status
@@ -36,49 +59,173 @@ func main() {
 func run() error {
 	_ = godotenv.Load()
 
-	cfg, err := config.FromEnv()
+	configPath := os.Getenv("CONFIG_FILE")
+	cfg, err := config.Load(configPath)
 	if err != nil {
 		return err
 	}
 
-	app := fiber.New()
-	logger := logging.NewLogger(cfg.LogLevel)
+	app := fiber.New(fiber.Config{ErrorHandler: handler.ErrorHandler})
+	logger, logLevel := logging.NewLeveledLogger(cfg.LogLevel)
 	slog.SetDefault(logger)
 
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
-	ethereumClient, err := eth.Dial(ctx, cfg.RPCEndpoint)
+
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Endpoint:    cfg.OTLPEndpoint,
+		SampleRatio: cfg.TraceSampleRatio,
+		Version:     buildinfo.Get().Version,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	// The mempool watcher and the indexer run for the whole process on the
+	// chain that is the default at startup; changing them needs a restart.
+	shared := sharedDeps{chain: cfg.Chains[0].Name}
+	if cfg.MempoolRPCEndpoint != "" {
+		mempoolClient, err := eth.DialTimeout(ctx, cfg.MempoolRPCEndpoint, cfg.RPCDialTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to connect to mempool RPC endpoint: %w", err)
+		}
+		defer mempoolClient.Close()
+
+		shared.mempool = service.NewMempool(logger, common.HexToAddress(cfg.RouterAddress))
+		go shared.mempool.Run(ctx, mempoolClient)
+	}
+
+	if cfg.IndexerDBPath != "" && len(cfg.IndexerPools) > 0 {
+		store, err := indexer.OpenStore(cfg.IndexerDBPath)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		limiter := newLimiter(cfg)
+		indexerPool, err := eth.DialPool(ctx, logger, cfg.RPCEndpoints, eth.PoolConfig{
+			HealthInterval: cfg.RPCHealthInterval,
+			Limiter:        limiter,
+			DialTimeout:    cfg.RPCDialTimeout,
+			Chain:          shared.chain,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s node: %w", shared.chain, err)
+		}
+		defer indexerPool.Close()
+		go indexerPool.Run(ctx)
+
+		indexed := make([]common.Address, 0, len(cfg.IndexerPools))
+		for _, p := range cfg.IndexerPools {
+			indexed = append(indexed, common.HexToAddress(p))
+		}
+		ix := indexer.New(logger, indexerPool, store, indexer.Config{
+			Pools:         indexed,
+			StartBlock:    cfg.IndexerStartBlock,
+			ChunkSize:     cfg.IndexerChunkSize,
+			Confirmations: cfg.IndexerConfirmations,
+			PollInterval:  cfg.IndexerPollInterval,
+		})
+		go ix.Run(ctx)
+		shared.store, shared.limiter = store, limiter
+	}
+
+	reloads, err := newReloader(ctx, logger, logLevel, configPath, cfg, shared)
 	if err != nil {
-		return fmt.Errorf("failed to connect to Ethereum node: %w", err)
+		return err
 	}
+	defer reloads.Close()
 
-	estimateService := service.NewEstimateService(logger, *ethereumClient)
-	estimateHandler := handler.NewEstimateHandler(logger, estimateService)
-	app.Get("/estimate", estimateHandler.Handle())
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go reloads.Run(ctx, hup)
 
-	errCh := make(chan error, 1)
+	// The concurrency cap is shared by the HTTP and gRPC APIs.
+	gate := limits.NewGate(logger, limits.ConcurrencyConfig{
+		Limit:        cfg.EstimateConcurrency,
+		Queue:        cfg.EstimateQueue,
+		QueueTimeout: cfg.EstimateQueueTimeout,
+	})
+
+	app.Use(handler.Tracing())
+	app.Use(handler.Metrics())
+	registerRoutes(app, handlers{
+		estimate: handler.NewChainEstimateHandler(logger, reloads.chains).WithResponseCache(handler.NewResponseCache(handler.ResponseCacheConfig{
+			MaxEntries:  cfg.ResponseCacheEntries,
+			HeadRefresh: cfg.ResponseCacheHeadRefresh,
+		})),
+		history:  handler.NewChainHistoryHandler(logger, reloads.chains).WithGate(gate),
+		simulate: handler.NewChainSimulateHandler(logger, reloads.chains),
+		health:   handler.NewHealthHandler(logger, reloads.chains, cfg.ReadyMaxHeadLag),
+		stream: handler.NewStreamHandler(logger, reloads.chains, handler.StreamConfig{
+			MaxSubscriptions: cfg.StreamMaxSubscriptions,
+			PollInterval:     cfg.QuotePollInterval,
+			Gate:             gate,
+		}),
+		tokens: handler.NewTokensHandler(logger, reloads.chains),
+	}, guards{
+		client: handler.ClientLimit(logger, handler.ClientLimitConfig{
+			RatePerSec:     cfg.ClientRatePerSec,
+			Burst:          cfg.ClientBurst,
+			TrustedProxies: cfg.TrustedProxies,
+		}),
+		apiKey:      handler.APIKey(logger, reloads.keys),
+		concurrency: handler.Concurrency(gate),
+	}, cfg.RequestTimeout)
+
+	var grpcServer *grpcapi.Server
+	var grpcListener net.Listener
+	if cfg.GRPCAddr != "" {
+		grpcListener, err = net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on gRPC address: %w", err)
+		}
+		grpcServer = grpcapi.New(logger, reloads.chains, grpcapi.Config{
+			RequestTimeout: cfg.RequestTimeout,
+			PollInterval:   cfg.QuotePollInterval,
+			Keys:           reloads.keys,
+			Gate:           gate,
+		})
+	}
+
+	errCh := make(chan error, 2)
 	go func() {
 		errCh <- app.Listen(cfg.Addr)
 	}()
+	if grpcServer != nil {
+		logger.Info("serving gRPC", "addr", grpcListener.Addr().String())
+		go func() {
+			errCh <- grpcServer.Serve(grpcListener)
+		}()
+	}
+
+	// shutdown stops both listeners, letting in-flight requests finish until
+	// shutdownCtx ends.
+	shutdown := func(shutdownCtx context.Context) {
+		_ = app.Shutdown()
+		if grpcServer != nil {
+			_ = grpcServer.Shutdown(shutdownCtx)
+		}
+	}
 
 	select {
 	case <-ctx.Done():
 	case err := <-errCh:
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		shutdown(shutdownCtx)
 		if err != nil {
-			_ = app.Shutdown()
-			ethereumClient.Close()
 			return fmt.Errorf("server error: %w", err)
 		}
-		ethereumClient.Close()
 		return nil
 	}
 
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
 	defer cancel()
 
-	_ = app.Shutdown()
-
-	ethereumClient.Close()
+	shutdown(shutdownCtx)
+	_ = shutdownTracing(shutdownCtx)
 
 	<-shutdownCtx.Done()
 	return nil
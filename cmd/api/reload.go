@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/nulln0ne/uniswap-estimator/internal/auth"
+	"github.com/nulln0ne/uniswap-estimator/internal/config"
+	"github.com/nulln0ne/uniswap-estimator/internal/logging"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// reloadDebounce coalesces the burst of file events an editor or a config map
+// update produces into one reload.
+const reloadDebounce = 250 * time.Millisecond
+
+// reloader owns the current chainRuntime and replaces it when the
+// configuration changes. Handlers see the change through chains, whose
+// services are swapped atomically, and keys; the HTTP listener is never
+// touched. A replaced runtime is released once the last request using one
+// of its services finished.
+type reloader struct {
+	logger *slog.Logger
+	level  *slog.LevelVar
+	path   string
+	shared sharedDeps
+	chains *service.ChainSet
+	keys   *auth.Keys
+
+	// watcher reports changes in the config file's directory; nil without a
+	// config file or if watching is unavailable.
+	watcher *fsnotify.Watcher
+
+	// reloading serializes reloads. It is held while new pools are dialed,
+	// which mu is not, so that requests are never blocked by a reload.
+	reloading sync.Mutex
+
+	mu      sync.Mutex
+	cfg     *config.Config
+	rt      *chainRuntime
+	digest  [sha256.Size]byte
+	closed  bool
+	retired []*chainRuntime
+	// done is closed by Close to stop waiting for retired runtimes.
+	done chan struct{}
+}
+
+// newReloader builds the initial runtime from cfg, which was loaded from path.
+func newReloader(ctx context.Context, logger *slog.Logger, level *slog.LevelVar, path string, cfg *config.Config, shared sharedDeps) (*reloader, error) {
+	rt, err := newChainRuntime(ctx, logger, cfg, shared, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	chains, err := service.NewChainSet(rt.services...)
+	if err != nil {
+		rt.close()
+		return nil, err
+	}
+	r := &reloader{
+		logger: logger,
+		level:  level,
+		path:   path,
+		shared: shared,
+		chains: chains,
+		keys:   auth.NewKeys(authKeys(cfg)),
+		cfg:    cfg,
+		rt:     rt,
+		done:   make(chan struct{}),
+	}
+	r.digest, _ = fileDigest(path)
+	r.watcher = r.watch()
+	return r, nil
+}
+
+// watch starts watching the directory of the config file. Watching the
+// directory also catches editors and config map updates that replace the file
+// instead of writing it.
+func (r *reloader) watch() *fsnotify.Watcher {
+	if r.path == "" {
+		return nil
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		r.logger.Error("config file watch unavailable", "err", err)
+		return nil
+	}
+	if err := w.Add(filepath.Dir(r.path)); err != nil {
+		_ = w.Close()
+		r.logger.Error("config file watch unavailable", "err", err)
+		return nil
+	}
+	return w
+}
+
+// Reload loads the configuration again and swaps in a runtime built from it.
+// Chains whose settings did not change keep their pools and services; the
+// others are dialed before the swap. If the configuration is invalid or the
+// new pools cannot be built, the current runtime is kept and the error is
+// logged and returned.
+func (r *reloader) Reload(ctx context.Context) error {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	r.mu.Lock()
+	closed, prev, prevCfg := r.closed, r.rt, r.cfg
+	r.mu.Unlock()
+	if closed {
+		return nil
+	}
+
+	cfg, err := config.Load(r.path)
+	if err != nil {
+		r.logger.Error("config reload failed, keeping current configuration", "err", err)
+		return err
+	}
+	digest, _ := fileDigest(r.path)
+	r.mu.Lock()
+	r.digest = digest
+	r.mu.Unlock()
+	r.warnRestartOnly(prevCfg, cfg)
+
+	rt, err := newChainRuntime(ctx, r.logger, cfg, r.shared, prev, prevCfg)
+	if err != nil {
+		r.logger.Error("config reload failed, keeping current configuration", "err", err)
+		return err
+	}
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		rt.close()
+		return nil
+	}
+	released, err := r.chains.Replace(rt.services...)
+	if err != nil {
+		r.mu.Unlock()
+		rt.release()
+		r.logger.Error("config reload failed, keeping current configuration", "err", err)
+		return err
+	}
+	r.cfg, r.rt = cfg, rt
+	r.retired = append(r.retired, prev)
+	r.mu.Unlock()
+
+	logging.SetLevel(r.level, cfg.LogLevel)
+	r.keys.Replace(authKeys(cfg))
+	go r.retire(prev, released)
+
+	names := make([]string, len(cfg.Chains))
+	redialed := 0
+	for i, c := range cfg.Chains {
+		names[i] = c.Name
+		if !slices.Contains(prev.conns, rt.conns[i]) {
+			redialed++
+		}
+	}
+	r.logger.Info("configuration reloaded", "chains", names, "redialed", redialed, "api_keys", len(cfg.APIKeys))
+	return nil
+}
+
+// retire releases old once no request holds its services any more, which
+// closes the pools no newer runtime shares.
+func (r *reloader) retire(old *chainRuntime, released <-chan struct{}) {
+	select {
+	case <-released:
+	case <-r.done:
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i := slices.Index(r.retired, old); i >= 0 {
+		r.retired = slices.Delete(r.retired, i, i+1)
+		old.release()
+	}
+}
+
+// warnRestartOnly logs settings that changed from old to cfg but only take
+// effect on restart.
+func (r *reloader) warnRestartOnly(old, cfg *config.Config) {
+	changed := func(name string, differ bool) {
+		if differ {
+			r.logger.Warn("config setting changed but requires a restart", "setting", name)
+		}
+	}
+	changed("server.addr", old.Addr != cfg.Addr)
+	changed("server.shutdown_timeout", old.ShutdownTimeout != cfg.ShutdownTimeout)
+	changed("server.request_timeout", old.RequestTimeout != cfg.RequestTimeout)
+	changed("server.grpc_addr", old.GRPCAddr != cfg.GRPCAddr)
+	changed("server.quote_poll_interval", old.QuotePollInterval != cfg.QuotePollInterval)
+	changed("server.ready_max_head_lag", old.ReadyMaxHeadLag != cfg.ReadyMaxHeadLag)
+	changed("server.trusted_proxies", !slices.Equal(old.TrustedProxies, cfg.TrustedProxies))
+	changed("limits.stream_subscriptions", old.StreamMaxSubscriptions != cfg.StreamMaxSubscriptions)
+	changed("limits.client_rps", old.ClientRatePerSec != cfg.ClientRatePerSec || old.ClientBurst != cfg.ClientBurst)
+	changed("limits.estimate_concurrency", old.EstimateConcurrency != cfg.EstimateConcurrency ||
+		old.EstimateQueue != cfg.EstimateQueue ||
+		old.EstimateQueueTimeout != cfg.EstimateQueueTimeout)
+	changed("cache.responses", old.ResponseCacheEntries != cfg.ResponseCacheEntries ||
+		old.ResponseCacheHeadRefresh != cfg.ResponseCacheHeadRefresh)
+	changed("tracing", old.OTLPEndpoint != cfg.OTLPEndpoint || old.TraceSampleRatio != cfg.TraceSampleRatio)
+	changed("mempool", old.MempoolRPCEndpoint != cfg.MempoolRPCEndpoint || old.RouterAddress != cfg.RouterAddress)
+	changed("indexer", old.IndexerDBPath != cfg.IndexerDBPath ||
+		!slices.Equal(old.IndexerPools, cfg.IndexerPools) ||
+		old.IndexerStartBlock != cfg.IndexerStartBlock ||
+		old.IndexerChunkSize != cfg.IndexerChunkSize ||
+		old.IndexerConfirmations != cfg.IndexerConfirmations ||
+		old.IndexerPollInterval != cfg.IndexerPollInterval)
+}
+
+// Run reloads the configuration on every value received from hup and, when a
+// config file is used, whenever its content changes. It returns when ctx is
+// canceled.
+func (r *reloader) Run(ctx context.Context, hup <-chan os.Signal) {
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if r.watcher != nil {
+		events, errs = r.watcher.Events, r.watcher.Errors
+	}
+
+	debounce := time.NewTimer(time.Hour)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("reloading configuration on SIGHUP")
+			_ = r.Reload(ctx)
+		case _, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			debounce.Reset(reloadDebounce)
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			r.logger.Warn("config file watch error", "err", err)
+		case <-debounce.C:
+			if r.fileChanged() {
+				r.logger.Info("reloading configuration after file change", "path", r.path)
+				_ = r.Reload(ctx)
+			}
+		}
+	}
+}
+
+// fileChanged reports whether the config file content differs from the last
+// loaded one, so that unrelated events in its directory are ignored.
+func (r *reloader) fileChanged() bool {
+	d, err := fileDigest(r.path)
+	if err != nil {
+		// A missing file is likely mid-replace; the next event retries.
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return d != r.digest
+}
+
+// Close stops watching the config file and closes the current runtime and
+// any retired one still in use.
+func (r *reloader) Close() {
+	if r.watcher != nil {
+		_ = r.watcher.Close()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	close(r.done)
+	r.rt.close()
+	for _, old := range r.retired {
+		old.close()
+	}
+	r.retired = nil
+}
+
+func fileDigest(path string) ([sha256.Size]byte, error) {
+	if path == "" {
+		return [sha256.Size]byte{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/nulln0ne/uniswap-estimator/internal/config"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+type fakeEth struct{}
+
+func (fakeEth) BlockNumber(context.Context) (hexutil.Uint64, error) { return 1, nil }
+
+func newRPCServer(t *testing.T) string {
+	t.Helper()
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fakeEth{}); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	hs := httptest.NewServer(srv)
+	t.Cleanup(func() {
+		hs.Close()
+		srv.Stop()
+	})
+	return hs.URL
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// startReloader builds a reloader from the config file at path and runs it
+// until the test ends. Without watch, only SIGHUP and Reload reload.
+func startReloader(t *testing.T, path string, watch bool) (*reloader, *slog.LevelVar, chan<- os.Signal) {
+	t.Helper()
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	level := new(slog.LevelVar)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	r, err := newReloader(ctx, logger, level, path, cfg, sharedDeps{chain: "ethereum"})
+	if err != nil {
+		cancel()
+		t.Fatalf("newReloader: %v", err)
+	}
+	if !watch && r.watcher != nil {
+		_ = r.watcher.Close()
+		r.watcher = nil
+	}
+	hup := make(chan os.Signal, 1)
+	go r.Run(ctx, hup)
+	t.Cleanup(func() {
+		cancel()
+		r.Close()
+	})
+	return r, level, hup
+}
+
+func TestReloader(t *testing.T) {
+	url := newRPCServer(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "chains:\n  - name: ethereum\n    rpc_urls: ["+url+"]\n")
+	r, level, _ := startReloader(t, path, true)
+	eth := r.chains.Default()
+
+	// Editing the file adds a chain, a factory fee, a log level and an API key.
+	writeFile(t, path, `
+server:
+  log_level: debug
+auth:
+  keys:
+    - name: partner
+      key: partner-secret-0001
+chains:
+  - name: ethereum
+    rpc_urls: [`+url+`]
+    default_fee_bps: 25
+  - name: bsc
+    rpc_urls: [`+url+`]
+`)
+	waitFor(t, func() bool {
+		_, err := r.chains.Resolve("bsc", 0)
+		return err == nil
+	})
+	if r.chains.Default() == eth || r.chains.Default().Chain().DefaultFeeBps != 25 {
+		t.Fatalf("default chain not replaced")
+	}
+	if level.Level() != slog.LevelDebug {
+		t.Fatalf("log level not applied: %v", level.Level())
+	}
+	if name, err := r.keys.Allow("partner-secret-0001"); err != nil || name != "partner" {
+		t.Fatalf("api key not applied: %q, %v", name, err)
+	}
+
+	// An invalid configuration is rejected and the current one kept.
+	writeFile(t, path, "chains:\n  - name: ethereum\n    rpc_urls: [ftp://node]\n")
+	if err := r.Reload(context.Background()); err == nil {
+		t.Fatalf("expected reload error")
+	}
+	if _, err := r.chains.Resolve("bsc", 0); err != nil {
+		t.Fatalf("configuration not rolled back: %v", err)
+	}
+}
+
+func TestReloader_Release(t *testing.T) {
+	url := newRPCServer(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, `
+auth:
+  keys:
+    - name: partner
+      key: partner-secret-0001
+chains:
+  - name: ethereum
+    rpc_urls: [`+url+`]
+  - name: bsc
+    rpc_urls: [`+url+`]
+`)
+	r, _, _ := startReloader(t, path, false)
+	eth, bsc := r.rt.conns[0], r.rt.conns[1]
+
+	// Removing a chain keeps the unchanged one and leaves the removed one
+	// open until the request holding it is done.
+	_, release, err := r.chains.Acquire("bsc", 0)
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	writeFile(t, path, "chains:\n  - name: ethereum\n    rpc_urls: ["+url+"]\n  - name: polygon\n    rpc_urls: ["+url+"]\n")
+	if err := r.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if _, err := r.chains.Resolve("polygon", 137); err != nil {
+		t.Fatalf("added chain not resolved: %v", err)
+	}
+	if _, err := r.chains.Resolve("bsc", 0); err != service.ErrUnknownChain {
+		t.Fatalf("expected removed chain to be unknown, got %v", err)
+	}
+	if r.chains.Default() != eth.svc {
+		t.Fatalf("unchanged chain not reused")
+	}
+	if r.keys.Enabled() {
+		t.Fatalf("removed api keys still enabled")
+	}
+	if n := bsc.refs.Load(); n != 1 {
+		t.Fatalf("held chain refs = %d, want 1", n)
+	}
+
+	release()
+	waitFor(t, func() bool { return bsc.refs.Load() == 0 && eth.refs.Load() == 1 })
+}
+
+func TestReloader_SIGHUP(t *testing.T) {
+	url := newRPCServer(t)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "chains:\n  - name: ethereum\n    rpc_urls: ["+url+"]\n")
+	_, level, hup := startReloader(t, path, false)
+
+	// SIGHUP reloads although the file did not change, picking up the
+	// environment overrides.
+	t.Setenv("LOG_LEVEL", "error")
+	hup <- syscall.SIGHUP
+	waitFor(t, func() bool { return level.Level() == slog.LevelError })
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/api"
+	"github.com/nulln0ne/uniswap-estimator/internal/handler"
+)
+
+// apiVersion prefixes the routes of the current API version.
+const apiVersion = "/v1"
+
+// handlers are the HTTP handlers served by the API.
+type handlers struct {
+	estimate *handler.EstimateHandler
+	history  *handler.HistoryHandler
+	simulate *handler.SimulateHandler
+	health   *handler.HealthHandler
+	stream   *handler.StreamHandler
+	tokens   *handler.TokensHandler
+}
+
+// guards are the middleware protecting the API endpoints, in the order they
+// run: the per-client rate limit, the API key check and, for estimates and
+// simulations, the concurrency cap. History queries take their slot in the
+// handler, as it must be held until the stream ends.
+type guards struct {
+	client      fiber.Handler
+	apiKey      fiber.Handler
+	concurrency fiber.Handler
+}
+
+// registerRoutes mounts the API on app. The estimation endpoints live under
+// apiVersion; those that predate it are also served at their unversioned
+// paths, which are deprecated. They run behind g. Probes, metrics and the
+// OpenAPI document are not versioned and not guarded.
+func registerRoutes(app *fiber.App, h handlers, g guards, requestTimeout time.Duration) {
+	app.Get("/metrics", handler.MetricsHandler())
+	app.Get("/healthz", h.health.Healthz())
+	app.Get("/readyz", h.health.Readyz())
+	app.Get("/openapi.json", handler.OpenAPI(api.Spec))
+
+	v1 := app.Group(apiVersion)
+	for _, r := range []fiber.Router{v1, app} {
+		r.Get("/estimate", g.client, g.apiKey, handler.Deadline(requestTimeout), g.concurrency, h.estimate.Handle())
+		r.Get("/estimate/history", g.client, g.apiKey, h.history.Handle())
+		r.Post("/simulate", g.client, g.apiKey, handler.Deadline(requestTimeout), g.concurrency, h.simulate.Handle())
+	}
+	v1.Get("/quotes/stream", g.client, g.apiKey, h.stream.Handle())
+	v1.Get("/tokens", g.client, g.apiKey, h.tokens.Handle())
+}
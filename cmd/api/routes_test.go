@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/api"
+	"github.com/nulln0ne/uniswap-estimator/internal/buildinfo"
+	"github.com/nulln0ne/uniswap-estimator/internal/handler"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// openAPIDoc is the part of an OpenAPI document checked against the router.
+type openAPIDoc struct {
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Parameters map[string]openAPIParameter `json:"parameters"`
+		Schemas    map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Enum       []string                   `json:"enum"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Parameters []openAPIParameter `json:"parameters"`
+}
+
+type openAPIParameter struct {
+	Ref  string `json:"$ref"`
+	Name string `json:"name"`
+	In   string `json:"in"`
+}
+
+// newTestApp returns the API without chains. Guards left nil in g let every
+// request through.
+func newTestApp(g guards) *fiber.App {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	next := func(c fiber.Ctx) error { return c.Next() }
+	for _, h := range []*fiber.Handler{&g.client, &g.apiKey, &g.concurrency} {
+		if *h == nil {
+			*h = next
+		}
+	}
+	app := fiber.New(fiber.Config{ErrorHandler: handler.ErrorHandler})
+	registerRoutes(app, handlers{
+		estimate: handler.NewChainEstimateHandler(logger, nil),
+		history:  handler.NewChainHistoryHandler(logger, nil),
+		simulate: handler.NewChainSimulateHandler(logger, nil),
+		health:   handler.NewHealthHandler(logger, nil, 0),
+		stream:   handler.NewStreamHandler(logger, nil, handler.StreamConfig{}),
+		tokens:   handler.NewTokensHandler(logger, nil),
+	}, g, 0)
+	return app
+}
+
+func loadSpec(t *testing.T) openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(api.Spec, &doc); err != nil {
+		t.Fatalf("parse openapi.json: %v", err)
+	}
+	return doc
+}
+
+// queryNames returns the query tags of the fields of v, skipping the names in
+// skip and descending into embedded structs.
+func queryNames(t reflect.Type, skip ...string) []string {
+	var names []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Anonymous {
+			names = append(names, queryNames(f.Type, skip...)...)
+			continue
+		}
+		if name := f.Tag.Get("query"); name != "" && !slices.Contains(skip, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// jsonNames returns the JSON member names of the fields of t.
+func jsonNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	doc := loadSpec(t)
+
+	var routed []string
+	for _, r := range newTestApp(guards{}).GetRoutes(true) {
+		if r.Method != fiber.MethodHead {
+			routed = append(routed, r.Method+" "+r.Path)
+		}
+	}
+	var documented []string
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+	slices.Sort(routed)
+	slices.Sort(documented)
+	if !slices.Equal(routed, documented) {
+		t.Fatalf("routes and spec differ:\nrouted     %v\ndocumented %v", routed, documented)
+	}
+
+	// Query parameters parsed by each endpoint, keyed by unversioned path.
+	// timeout_ms is read by the Deadline middleware; history ignores mode.
+	params := map[string][]string{
+		"/estimate":         append(queryNames(reflect.TypeFor[handler.EstimateRequest]()), "timeout_ms"),
+		"/estimate/history": queryNames(reflect.TypeFor[handler.HistoryRequest](), "mode"),
+		"/simulate":         {"timeout_ms"},
+		"/quotes/stream":    queryNames(reflect.TypeFor[handler.StreamRequest]()),
+		"/tokens":           queryNames(reflect.TypeFor[handler.TokensRequest]()),
+	}
+	for path, ops := range doc.Paths {
+		for method, op := range ops {
+			var got []string
+			for _, p := range op.Parameters {
+				if p.Ref != "" {
+					p = doc.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+				}
+				if p.In != "query" || p.Name == "" {
+					t.Errorf("%s %s: unresolved parameter %+v", method, path, p)
+				}
+				got = append(got, p.Name)
+			}
+			want := slices.Clone(params[strings.TrimPrefix(path, apiVersion)])
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Errorf("%s %s: documented parameters %v, handler parses %v", method, path, got, want)
+			}
+		}
+	}
+}
+
+func TestOpenAPISchemasMatchTypes(t *testing.T) {
+	doc := loadSpec(t)
+
+	types := map[string]reflect.Type{
+		"Problem":            reflect.TypeFor[handler.ProblemDetails](),
+		"Estimate":           reflect.TypeFor[handler.EstimateResponse](),
+		"PendingEstimate":    reflect.TypeFor[handler.PendingEstimateResponse](),
+		"HistoryLine":        reflect.TypeFor[handler.HistoryLine](),
+		"StreamEvent":        reflect.TypeFor[handler.StreamEvent](),
+		"StreamCommand":      reflect.TypeFor[handler.StreamCommand](),
+		"SimulateRequest":    reflect.TypeFor[handler.SimulateRequest](),
+		"SimulateStep":       reflect.TypeFor[handler.SimulateStep](),
+		"SimulateResponse":   reflect.TypeFor[handler.SimulateResponse](),
+		"SimulateStepResult": reflect.TypeFor[handler.SimulateStepResult](),
+		"SimulatePoolState":  reflect.TypeFor[handler.SimulatePoolState](),
+		"Health":             reflect.TypeFor[handler.HealthResponse](),
+		"Ready":              reflect.TypeFor[handler.ReadyResponse](),
+		"ChainReadiness":     reflect.TypeFor[handler.ChainReadiness](),
+		"TokenList":          reflect.TypeFor[handler.TokensResponse](),
+		"Token":              reflect.TypeFor[handler.TokenInfo](),
+		"BuildInfo":          reflect.TypeFor[buildinfo.Info](),
+	}
+	for name, typ := range types {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+		got, want := sortedKeys(schema.Properties), jsonNames(typ)
+		slices.Sort(want)
+		if !slices.Equal(got, want) {
+			t.Errorf("schema %s has properties %v, %s has %v", name, got, typ, want)
+		}
+	}
+
+	codes := doc.Components.Schemas["ErrorCode"].Enum
+	for _, err := range []error{
+		handler.ErrInvalidQueryParameters, handler.ErrAmountRequired, handler.ErrInvalidRequestBody,
+		handler.ErrSameTokenBadRequest, handler.ErrPoolNotFound, handler.ErrPairMismatchBadRequest,
+		handler.ErrEmptyReservesBadRequest, handler.ErrPoolNotFromFactoryBadRequest,
+		handler.ErrPendingUnavailableNotImplemented, handler.ErrInvalidStepType,
+		handler.ErrUnknownChainBadRequest, handler.ErrChainMismatchBadRequest, handler.ErrNotERC20BadRequest,
+		handler.ErrRPCRateLimited, handler.ErrQuorumNotReachedUnavailable, handler.ErrRPCUnavailable,
+		handler.ErrDeadlineExceeded, handler.ErrRequestCanceled, handler.NewSubscriptionLimit(1),
+		handler.ErrAPIKeyRequired, handler.ErrAPIKeyQuotaExceeded, handler.ErrClientRateLimited, handler.ErrOverloaded,
+	} {
+		if code := err.(*handler.Problem).Code; !slices.Contains(codes, code) {
+			t.Errorf("error code %s is not documented", code)
+		}
+	}
+	for _, code := range []service.Code{
+		service.CodeInsufficientInput, service.CodeInvalidSimulation, service.CodeInvalidBlockRange,
+		service.CodeUnknownToken, service.CodeAmbiguousSymbol,
+	} {
+		if !slices.Contains(codes, string(code)) {
+			t.Errorf("error code %s is not documented", code)
+		}
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	resp, err := newTestApp(guards{}).Test(httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(fiber.HeaderContentType) != fiber.MIMEApplicationJSON {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != string(api.Spec) {
+		t.Fatalf("served document differs from api.Spec")
+	}
+}
+
+func TestGuardsSkipProbes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := newTestApp(guards{client: handler.ClientLimit(logger, handler.ClientLimitConfig{RatePerSec: 0.001, Burst: 1})})
+
+	for _, target := range []string{"/healthz", "/healthz", "/openapi.json", "/v1/estimate", "/v1/estimate/history", "/estimate"} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close()
+		limited := resp.StatusCode == http.StatusTooManyRequests
+		if want := target != "/v1/estimate" && strings.Contains(target, "estimate"); limited != want {
+			t.Fatalf("GET %s: status %d, rate limited %v, want %v", target, resp.StatusCode, limited, want)
+		}
+	}
+}
+
+func TestConcurrencyGuardRoutes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	gate := limits.NewGate(logger, limits.ConcurrencyConfig{Limit: 1})
+	app := newTestApp(guards{concurrency: handler.Concurrency(gate)})
+
+	// With the only slot taken, e.g. by a gRPC call, the capped routes shed.
+	// History queries are capped by their handler, see TestHistoryGate.
+	release, err := gate.Acquire(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release()
+	for _, r := range []struct {
+		method, target string
+		shed           bool
+	}{
+		{http.MethodGet, "/v1/estimate", true},
+		{http.MethodPost, "/v1/simulate", true},
+		{http.MethodGet, "/estimate", true},
+		{http.MethodGet, "/openapi.json", false},
+		{http.MethodGet, "/healthz", false},
+	} {
+		resp, err := app.Test(httptest.NewRequest(r.method, r.target, nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		resp.Body.Close()
+		if shed := resp.StatusCode == http.StatusServiceUnavailable; shed != r.shed {
+			t.Fatalf("%s %s: status %d, shed %v, want %v", r.method, r.target, resp.StatusCode, shed, r.shed)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/auth"
+	"github.com/nulln0ne/uniswap-estimator/internal/config"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"github.com/nulln0ne/uniswap-estimator/internal/tokenlist"
+)
+
+// sharedDeps are the components started once per process. They belong to the
+// chain that was the default at startup and are handed to its service in
+// every runtime.
+type sharedDeps struct {
+	chain   string
+	mempool *service.Mempool
+	store   service.ReserveSource
+	// limiter is the indexer's compute-unit budget, shared with the chain's
+	// pool until a reload changes the limits.
+	limiter *eth.Limiter
+}
+
+// chainRuntime holds the RPC pools and estimate services built from one
+// configuration. A reload builds a new runtime and swaps it in.
+type chainRuntime struct {
+	conns    []*chainConn
+	services []*service.EstimateService
+	released sync.Once
+}
+
+// chainConn is the RPC pool and estimate service of one chain. Runtimes share
+// the chainConn of a chain whose settings a reload left unchanged, so that it
+// keeps its connections, caches and health state. It is closed when the last
+// runtime holding it is released.
+type chainConn struct {
+	chain   config.Chain
+	lists   [sha256.Size]byte
+	limiter *eth.Limiter
+	pool    *eth.Pool
+	svc     *service.EstimateService
+	stop    context.CancelFunc
+
+	refs   atomic.Int32
+	closed sync.Once
+}
+
+// newChainRuntime builds the services of every chain in cfg. A chain whose
+// settings did not change since prevCfg reuses its chainConn of prev; the
+// others load their token lists and dial their endpoints. Limiters of prev
+// are reused when the limits did not change, so that compute units spent
+// before a reload still count.
+func newChainRuntime(ctx context.Context, logger *slog.Logger, cfg *config.Config, shared sharedDeps, prev *chainRuntime, prevCfg *config.Config) (*chainRuntime, error) {
+	rt := &chainRuntime{}
+	reuseLimiters := prev != nil && sameLimits(prevCfg, cfg)
+	for i, chain := range cfg.Chains {
+		lists, err := listsDigest(chain.TokenLists)
+		if err != nil {
+			rt.release()
+			return nil, fmt.Errorf("failed to load %s token lists: %w", chain.Name, err)
+		}
+		if c := prev.reusable(prevCfg, cfg, i, lists); c != nil {
+			c.refs.Add(1)
+			rt.conns = append(rt.conns, c)
+			rt.services = append(rt.services, c.svc)
+			continue
+		}
+
+		limiter := limiterFor(chain.Name, cfg, shared, prev, reuseLimiters)
+		c, err := dialChain(ctx, logger, cfg, i, shared, limiter)
+		if err != nil {
+			rt.release()
+			return nil, err
+		}
+		c.lists = lists
+		rt.conns = append(rt.conns, c)
+		rt.services = append(rt.services, c.svc)
+	}
+	return rt, nil
+}
+
+// dialChain loads the token lists and dials the endpoints of the i-th chain
+// of cfg and builds its service.
+func dialChain(ctx context.Context, logger *slog.Logger, cfg *config.Config, i int, shared sharedDeps, limiter *eth.Limiter) (*chainConn, error) {
+	chain := cfg.Chains[i]
+	var list *tokenlist.List
+	if len(chain.TokenLists) > 0 {
+		var err error
+		if list, err = tokenlist.Load(logger.With("chain", chain.Name), chain.ID, chain.TokenLists...); err != nil {
+			return nil, fmt.Errorf("failed to load %s token lists: %w", chain.Name, err)
+		}
+		logger.Info("token lists loaded", "chain", chain.Name, "tokens", list.Len())
+	}
+
+	ctx, stop := context.WithCancel(ctx)
+	pool, err := eth.DialPool(ctx, logger.With("chain", chain.Name), chain.RPCEndpoints, eth.PoolConfig{
+		HealthInterval: cfg.RPCHealthInterval,
+		HedgeDelay:     cfg.RPCHedgeDelay,
+		MaxAttempts:    cfg.RPCMaxAttempts,
+		Limiter:        limiter,
+		DialTimeout:    cfg.RPCDialTimeout,
+		Chain:          chain.Name,
+	})
+	if err != nil {
+		stop()
+		return nil, fmt.Errorf("failed to connect to %s node: %w", chain.Name, err)
+	}
+	c := &chainConn{chain: chain, limiter: limiter, pool: pool, stop: stop}
+	c.refs.Store(1)
+
+	opts := []service.Option{
+		service.WithChain(serviceChain(chain)),
+		service.WithHistoryLimits(cfg.HistoryConcurrency, cfg.HistoryReadsPerSec),
+		service.WithStaleFallback(cfg.StaleQuoteMaxAge),
+	}
+	if list != nil {
+		opts = append(opts, service.WithTokenList(list))
+	}
+	if chain.Name == shared.chain {
+		if shared.mempool != nil {
+			opts = append(opts, service.WithMempool(shared.mempool))
+		}
+		if shared.store != nil {
+			opts = append(opts, service.WithReserveSource(shared.store))
+		}
+	}
+	if i == 0 && cfg.RPCQuorumSize > 0 {
+		quorum, err := eth.NewQuorum(logger, pool, cfg.RPCQuorumSize, cfg.RPCQuorumThreshold)
+		if err != nil {
+			c.close()
+			return nil, err
+		}
+		opts = append(opts, service.WithQuorum(quorum))
+	}
+	c.svc = service.NewEstimateService(logger, pool, opts...)
+
+	go pool.Run(ctx)
+	return c, nil
+}
+
+// reusable returns the chainConn of rt for the i-th chain of cfg if neither
+// the chain nor the settings its pool and service are built from changed
+// since prevCfg, or nil if the chain has to be dialed again.
+func (rt *chainRuntime) reusable(prevCfg, cfg *config.Config, i int, lists [sha256.Size]byte) *chainConn {
+	if rt == nil {
+		return nil
+	}
+	chain := cfg.Chains[i]
+	j := slices.IndexFunc(rt.conns, func(c *chainConn) bool { return c.chain.Name == chain.Name })
+	if j < 0 {
+		return nil
+	}
+	c := rt.conns[j]
+	switch {
+	case !sameChain(c.chain, chain), c.lists != lists, (i == 0) != (j == 0):
+		return nil
+	case i == 0 && (prevCfg.RPCQuorumSize != cfg.RPCQuorumSize || prevCfg.RPCQuorumThreshold != cfg.RPCQuorumThreshold):
+		return nil
+	case !sameLimits(prevCfg, cfg):
+		return nil
+	}
+	same := prevCfg.RPCHealthInterval == cfg.RPCHealthInterval &&
+		prevCfg.RPCHedgeDelay == cfg.RPCHedgeDelay &&
+		prevCfg.RPCMaxAttempts == cfg.RPCMaxAttempts &&
+		prevCfg.RPCDialTimeout == cfg.RPCDialTimeout &&
+		prevCfg.HistoryConcurrency == cfg.HistoryConcurrency &&
+		prevCfg.HistoryReadsPerSec == cfg.HistoryReadsPerSec &&
+		prevCfg.StaleQuoteMaxAge == cfg.StaleQuoteMaxAge
+	if !same {
+		return nil
+	}
+	return c
+}
+
+// limiterFor returns the limiter of chain: the one of prev when reuse is set,
+// the indexer's for the shared chain at startup, or a new one.
+func limiterFor(chain string, cfg *config.Config, shared sharedDeps, prev *chainRuntime, reuse bool) *eth.Limiter {
+	l, ok := prev.limiter(chain)
+	switch {
+	case ok && reuse:
+		return l
+	case prev == nil && chain == shared.chain && shared.limiter != nil:
+		return shared.limiter
+	default:
+		return newLimiter(cfg)
+	}
+}
+
+func (rt *chainRuntime) limiter(chain string) (*eth.Limiter, bool) {
+	if rt == nil {
+		return nil, false
+	}
+	for _, c := range rt.conns {
+		if c.chain.Name == chain {
+			return c.limiter, true
+		}
+	}
+	return nil, false
+}
+
+// release lets go of the chainConns of rt, closing those no other runtime
+// holds. Calls after the first do nothing.
+func (rt *chainRuntime) release() {
+	rt.released.Do(func() {
+		for _, c := range rt.conns {
+			c.release()
+		}
+	})
+}
+
+// close closes every chainConn of rt, including those shared with other
+// runtimes. It is used on shutdown.
+func (rt *chainRuntime) close() {
+	for _, c := range rt.conns {
+		c.close()
+	}
+}
+
+func (c *chainConn) release() {
+	if c.refs.Add(-1) == 0 {
+		c.close()
+	}
+}
+
+// close stops the health checks and closes the pool.
+func (c *chainConn) close() {
+	c.closed.Do(func() {
+		c.stop()
+		c.pool.Close()
+	})
+}
+
+// sameChain reports whether a and b describe the same chain with the same
+// endpoints.
+func sameChain(a, b config.Chain) bool {
+	return a.Name == b.Name && a.ID == b.ID &&
+		a.DefaultFeeBps == b.DefaultFeeBps &&
+		a.BlockTime == b.BlockTime &&
+		slices.Equal(a.RPCEndpoints, b.RPCEndpoints) &&
+		slices.Equal(a.Factories, b.Factories) &&
+		slices.Equal(a.BaseTokens, b.BaseTokens) &&
+		slices.Equal(a.TokenLists, b.TokenLists)
+}
+
+// listsDigest hashes the content of the token list files at paths, so that a
+// reload picks up lists edited in place.
+func listsDigest(paths []string) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		h.Write(data)
+	}
+	return [sha256.Size]byte(h.Sum(nil)), nil
+}
+
+func newLimiter(cfg *config.Config) *eth.Limiter {
+	return eth.NewLimiter(eth.LimiterConfig{
+		UnitsPerSecond: cfg.RPCUnitsPerSecond,
+		Burst:          cfg.RPCBurst,
+		DailyBudget:    cfg.RPCDailyBudget,
+		MaxWait:        cfg.RPCMaxWait,
+		Weights:        cfg.RPCMethodWeights,
+	})
+}
+
+// sameLimits reports whether a and b configure identical RPC limiters.
+func sameLimits(a, b *config.Config) bool {
+	return a.RPCUnitsPerSecond == b.RPCUnitsPerSecond &&
+		a.RPCBurst == b.RPCBurst &&
+		a.RPCDailyBudget == b.RPCDailyBudget &&
+		a.RPCMaxWait == b.RPCMaxWait &&
+		maps.Equal(a.RPCMethodWeights, b.RPCMethodWeights)
+}
+
+// serviceChain converts a configured chain to its service description.
+func serviceChain(c config.Chain) service.Chain {
+	out := service.Chain{Name: c.Name, ID: c.ID, DefaultFeeBps: c.DefaultFeeBps, BlockTime: c.BlockTime}
+	for _, f := range c.Factories {
+		out.Factories = append(out.Factories, service.Factory{
+			Name:         f.Name,
+			Address:      common.HexToAddress(f.Address),
+			InitCodeHash: common.HexToHash(f.InitCodeHash),
+			FeeBps:       f.FeeBps,
+		})
+	}
+	for _, t := range c.BaseTokens {
+		out.BaseTokens = append(out.BaseTokens, common.HexToAddress(t))
+	}
+	return out
+}
+
+// authKeys converts the configured API keys to those of the auth package.
+func authKeys(cfg *config.Config) []auth.Key {
+	keys := make([]auth.Key, len(cfg.APIKeys))
+	for i, k := range cfg.APIKeys {
+		keys[i] = auth.Key(k)
+	}
+	return keys
+}
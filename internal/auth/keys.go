@@ -0,0 +1,167 @@
+// Package auth authenticates API clients by key and meters their use. Each
+// key has its own request rate and daily quota, shared by the HTTP and gRPC
+// APIs.
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// ErrMissingKey is returned when a request carries no API key.
+	ErrMissingKey = errors.New("api key required")
+	// ErrInvalidKey is returned when a request carries an unknown API key.
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrLimited is matched by every LimitError.
+	ErrLimited = errors.New("api key limit exceeded")
+)
+
+// LimitError is returned when a request would exceed the rate or the daily
+// quota of its key.
+type LimitError struct {
+	Key string
+	// RetryAfter is when the key is expected to be allowed again.
+	RetryAfter time.Duration
+	// Daily is set when the daily quota, not the rate, is exhausted.
+	Daily bool
+}
+
+func (e *LimitError) Error() string {
+	if e.Daily {
+		return fmt.Sprintf("api key %s: daily quota exhausted, retry after %s", e.Key, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("api key %s: rate limit exceeded, retry after %s", e.Key, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *LimitError) Unwrap() error { return ErrLimited }
+
+// Key is an API key and its limits. Only the SHA-256 digest of the secret is
+// kept.
+type Key struct {
+	// Name identifies the key's owner in logs and metrics.
+	Name string
+	Hash [sha256.Size]byte
+	// RatePerSec is the sustained request rate; zero disables rate limiting.
+	RatePerSec float64
+	// Burst is the token bucket size. Defaults to one second of requests.
+	Burst int
+	// DailyQuota caps the requests per UTC day; zero means unlimited.
+	DailyQuota uint64
+}
+
+// Hash returns the digest under which secret is stored.
+func Hash(secret string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(secret))
+}
+
+// Keys is the set of accepted API keys. An empty set disables
+// authentication: Allow accepts every request.
+type Keys struct {
+	now func() time.Time
+
+	mu     sync.RWMutex
+	byHash map[[sha256.Size]byte]*meter
+}
+
+// meter tracks the use of one key.
+type meter struct {
+	key    Key
+	bucket *rate.Limiter
+
+	mu   sync.Mutex
+	day  time.Time
+	used uint64
+}
+
+func newMeter(k Key) *meter {
+	limit, burst := rate.Inf, 0
+	if k.RatePerSec > 0 {
+		limit = rate.Limit(k.RatePerSec)
+		burst = k.Burst
+		if burst <= 0 {
+			burst = max(int(k.RatePerSec), 1)
+		}
+	}
+	return &meter{key: k, bucket: rate.NewLimiter(limit, burst)}
+}
+
+// NewKeys builds a Keys accepting keys.
+func NewKeys(keys []Key) *Keys {
+	k := &Keys{now: time.Now}
+	k.Replace(keys)
+	return k
+}
+
+// Replace swaps in a new set of keys. A key whose name and limits are
+// unchanged keeps its rate and today's usage, even if its secret was rotated.
+func (k *Keys) Replace(keys []Key) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	old := make(map[string]*meter, len(k.byHash))
+	for _, m := range k.byHash {
+		old[m.key.Name] = m
+	}
+	k.byHash = make(map[[sha256.Size]byte]*meter, len(keys))
+	for _, key := range keys {
+		m, ok := old[key.Name]
+		if !ok || m.key.RatePerSec != key.RatePerSec || m.key.Burst != key.Burst || m.key.DailyQuota != key.DailyQuota {
+			m = newMeter(key)
+		}
+		k.byHash[key.Hash] = m
+	}
+}
+
+// Enabled reports whether requests must carry a key.
+func (k *Keys) Enabled() bool {
+	if k == nil {
+		return false
+	}
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.byHash) > 0
+}
+
+// Allow authenticates secret and charges one request to its key, returning
+// the key's name. It returns ErrMissingKey or ErrInvalidKey when the request
+// must be rejected as unauthenticated, and a *LimitError when the key is over
+// its rate or quota; refused requests are not charged.
+func (k *Keys) Allow(secret string) (string, error) {
+	if secret == "" {
+		return "", ErrMissingKey
+	}
+	k.mu.RLock()
+	m, ok := k.byHash[Hash(secret)]
+	k.mu.RUnlock()
+	if !ok {
+		return "", ErrInvalidKey
+	}
+	return m.key.Name, m.allow(k.now())
+}
+
+// allow charges one request at now.
+func (m *meter) allow(now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !day.Equal(m.day) {
+		m.day, m.used = day, 0
+	}
+	if m.key.DailyQuota > 0 && m.used >= m.key.DailyQuota {
+		return &LimitError{Key: m.key.Name, RetryAfter: m.day.AddDate(0, 0, 1).Sub(now), Daily: true}
+	}
+
+	// The bucket holds at least one token, so the reservation is always OK.
+	r := m.bucket.ReserveN(now, 1)
+	if delay := r.DelayFrom(now); delay > 0 {
+		r.CancelAt(now)
+		return &LimitError{Key: m.key.Name, RetryAfter: delay}
+	}
+	m.used++
+	return nil
+}
@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestKeys_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	k := NewKeys([]Key{{Name: "partner", Hash: Hash("secret")}})
+	if !k.Enabled() {
+		t.Fatal("keys not enabled")
+	}
+	if name, err := k.Allow("secret"); err != nil || name != "partner" {
+		t.Fatalf("valid key: got %q, %v", name, err)
+	}
+	if _, err := k.Allow(""); !errors.Is(err, ErrMissingKey) {
+		t.Fatalf("missing key: got %v", err)
+	}
+	if _, err := k.Allow("other"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("unknown key: got %v", err)
+	}
+
+	if NewKeys(nil).Enabled() || (*Keys)(nil).Enabled() {
+		t.Fatal("empty keys enabled")
+	}
+}
+
+func TestKeys_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	k := NewKeys([]Key{{Name: "partner", Hash: Hash("secret"), RatePerSec: 2, Burst: 2}})
+	k.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if _, err := k.Allow("secret"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	_, err := k.Allow("secret")
+	var le *LimitError
+	if !errors.As(err, &le) || !errors.Is(err, ErrLimited) {
+		t.Fatalf("expected LimitError, got %v", err)
+	}
+	if le.Key != "partner" || le.Daily || le.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("unexpected limit error: %+v", le)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if _, err := k.Allow("secret"); err != nil {
+		t.Fatalf("request after refill: %v", err)
+	}
+}
+
+func TestKeys_DailyQuota(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	k := NewKeys([]Key{{Name: "partner", Hash: Hash("secret"), DailyQuota: 2}})
+	k.now = func() time.Time { return now }
+
+	for i := range 2 {
+		if _, err := k.Allow("secret"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	_, err := k.Allow("secret")
+	var le *LimitError
+	if !errors.As(err, &le) || !le.Daily || le.RetryAfter != time.Hour {
+		t.Fatalf("expected daily quota error retrying in 1h, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := k.Allow("secret"); err != nil {
+		t.Fatalf("request after rollover: %v", err)
+	}
+}
+
+func TestKeys_ReplaceKeepsUsage(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	k := NewKeys([]Key{{Name: "partner", Hash: Hash("old"), DailyQuota: 1}})
+	k.now = func() time.Time { return now }
+	if _, err := k.Allow("old"); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+
+	// A rotated secret keeps today's usage.
+	k.Replace([]Key{{Name: "partner", Hash: Hash("new"), DailyQuota: 1}})
+	if _, err := k.Allow("old"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("old secret: got %v", err)
+	}
+	if _, err := k.Allow("new"); !errors.Is(err, ErrLimited) {
+		t.Fatalf("rotated secret: expected quota error, got %v", err)
+	}
+
+	// Changed limits start over.
+	k.Replace([]Key{{Name: "partner", Hash: Hash("new"), DailyQuota: 2}})
+	if _, err := k.Allow("new"); err != nil {
+		t.Fatalf("raised quota: %v", err)
+	}
+}
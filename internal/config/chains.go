@@ -0,0 +1,218 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// uniswapV2InitCodeHash is the pair init code hash shared by Uniswap V2
+// deployments and forks that kept its bytecode, such as QuickSwap.
+const uniswapV2InitCodeHash = "0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f"
+
+// Factory describes a Uniswap V2 style pair factory.
+type Factory struct {
+	Name         string
+	Address      string
+	InitCodeHash string
+	FeeBps       uint32
+}
+
+// Chain describes a network the service quotes on.
+type Chain struct {
+	Name          string
+	ID            uint64
+	RPCEndpoints  []string
+	Factories     []Factory
+	DefaultFeeBps uint32
+	BaseTokens    []string
+	// BlockTime is the expected interval between blocks; zero if unknown.
+	BlockTime time.Duration
+	// TokenLists are paths of token list files whose symbols requests may
+	// use instead of token addresses.
+	TokenLists []string
+}
+
+// chainPresets holds the built-in chain descriptions, without RPC endpoints.
+var chainPresets = map[string]Chain{
+	"ethereum": {
+		Name: "ethereum",
+		ID:   1,
+		Factories: []Factory{
+			{Name: "uniswap-v2", Address: "0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f", InitCodeHash: uniswapV2InitCodeHash, FeeBps: 30},
+		},
+		DefaultFeeBps: 30,
+		BlockTime:     12 * time.Second,
+		BaseTokens: []string{
+			"0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2", // WETH
+			"0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48", // USDC
+			"0xdAC17F958D2ee523a2206206994597C13D831ec7", // USDT
+			"0x6B175474E89094C44Da98b954EedeAC495271d0F", // DAI
+		},
+	},
+	"bsc": {
+		Name: "bsc",
+		ID:   56,
+		Factories: []Factory{
+			{Name: "pancakeswap-v2", Address: "0xcA143Ce32Fe78f1f7019d7d551a6402fC5350c73", InitCodeHash: "0x00fb7f630766e6a796048ea87d01acd3068e8ff67d078148a3fa3f4a84f69bd5", FeeBps: 25},
+		},
+		DefaultFeeBps: 25,
+		BlockTime:     750 * time.Millisecond,
+		BaseTokens: []string{
+			"0xbb4CdB9CBd36B01bD1cBaEBF2De08d9173bc095c", // WBNB
+			"0xe9e7CEA3DedcA5984780Bafc599bD69ADd087D56", // BUSD
+			"0x55d398326f99059fF775485246999027B3197955", // USDT
+		},
+	},
+	"polygon": {
+		Name: "polygon",
+		ID:   137,
+		Factories: []Factory{
+			{Name: "quickswap", Address: "0x5757371414417b8C6CAad45bAeF941aBc7d3Ab32", InitCodeHash: uniswapV2InitCodeHash, FeeBps: 30},
+			{Name: "uniswap-v2", Address: "0x9e5A52f57b3038F1B8EeE45F28b3C1967e22799C", InitCodeHash: uniswapV2InitCodeHash, FeeBps: 30},
+		},
+		DefaultFeeBps: 30,
+		BlockTime:     2 * time.Second,
+		BaseTokens: []string{
+			"0x0d500B1d8E8eF31E21C99d1Db9A6444d3ADf1270", // WMATIC
+			"0x7ceB23fD6bC0adD59E62ac25578270cFf1b9f619", // WETH
+			"0x2791Bca1f2de4661ED88A30C99A7a9449Aa84174", // USDC.e
+		},
+	},
+	"arbitrum": {
+		Name: "arbitrum",
+		ID:   42161,
+		Factories: []Factory{
+			{Name: "uniswap-v2", Address: "0xf1D7CC64Fb4452F05c498126312eBE29f30Fbcf9", InitCodeHash: uniswapV2InitCodeHash, FeeBps: 30},
+		},
+		DefaultFeeBps: 30,
+		BlockTime:     250 * time.Millisecond,
+		BaseTokens: []string{
+			"0x82aF49447D8a07e3bd95BD0d56f35241523fBab1", // WETH
+			"0xaf88d065e77c8cC2239327C5EDb3A432268e5831", // USDC
+			"0xFd086bC7CD5C481DCC9C85ebE478A1C0b69FCbb9", // USDT
+		},
+	},
+	"base": {
+		Name: "base",
+		ID:   8453,
+		Factories: []Factory{
+			{Name: "uniswap-v2", Address: "0x8909Dc15e40173Ff4699343b6eB8132c65e18eC6", InitCodeHash: uniswapV2InitCodeHash, FeeBps: 30},
+		},
+		DefaultFeeBps: 30,
+		BlockTime:     2 * time.Second,
+		BaseTokens: []string{
+			"0x4200000000000000000000000000000000000006", // WETH
+			"0x833589fCD6eDb6E08f4c7C32D4f71b54bdA02913", // USDC
+		},
+	},
+}
+
+// ChainPreset returns a copy of the built-in description of the named chain.
+func ChainPreset(name string) (Chain, bool) {
+	c, ok := chainPresets[strings.ToLower(name)]
+	if !ok {
+		return Chain{}, false
+	}
+	c.Factories = append([]Factory(nil), c.Factories...)
+	c.BaseTokens = append([]string(nil), c.BaseTokens...)
+	return c, true
+}
+
+// chainsFromEnv applies the chain environment variables to base, the chains
+// from the config file or the defaults. CHAINS replaces the list of enabled
+// chains, taking each from base or, failing that, from the presets. The
+// ethereum chain uses the ETH_RPC_URL/ETH_RPC_URLS endpoints in ethURLs; any
+// other chain reads <NAME>_RPC_URLS. Either replaces the endpoints of base.
+func chainsFromEnv(base []Chain, ethURLs []string) ([]Chain, error) {
+	byName := make(map[string]Chain, len(base))
+	names := make([]string, 0, len(base))
+	for _, c := range base {
+		byName[c.Name] = c
+		names = append(names, c.Name)
+	}
+	if v := os.Getenv("CHAINS"); v != "" {
+		names = nil
+		for _, n := range strings.Split(v, ",") {
+			names = append(names, strings.ToLower(strings.TrimSpace(n)))
+		}
+	}
+
+	chains := make([]Chain, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		c, ok := byName[name]
+		if !ok {
+			c, ok = ChainPreset(name)
+		}
+		if !ok || seen[name] {
+			return nil, ErrInvalidChains
+		}
+		seen[name] = true
+
+		if name == "ethereum" {
+			if len(ethURLs) > 0 {
+				c.RPCEndpoints = ethURLs
+			}
+			if len(c.RPCEndpoints) == 0 {
+				return nil, ErrMissingRPCEndpoint
+			}
+		} else {
+			urls, err := urlListEnv(chainEnvPrefix(name) + "_RPC_URLS")
+			if err != nil {
+				return nil, err
+			}
+			if len(urls) > 0 {
+				c.RPCEndpoints = urls
+			}
+			if len(c.RPCEndpoints) == 0 {
+				return nil, ErrMissingChainRPCEndpoint
+			}
+		}
+		if v := os.Getenv(chainEnvPrefix(name) + "_TOKEN_LISTS"); v != "" {
+			c.TokenLists = nil
+			for _, p := range strings.Split(v, ",") {
+				p = strings.TrimSpace(p)
+				if p == "" {
+					return nil, ErrInvalidTokenLists
+				}
+				c.TokenLists = append(c.TokenLists, p)
+			}
+		}
+		chains = append(chains, c)
+	}
+
+	if def := os.Getenv("DEFAULT_CHAIN"); def != "" {
+		i := slices.IndexFunc(chains, func(c Chain) bool { return c.Name == strings.ToLower(def) })
+		if i < 0 {
+			return nil, ErrInvalidChains
+		}
+		// The default chain is listed first.
+		chains[0], chains[i] = chains[i], chains[0]
+	}
+	return chains, nil
+}
+
+// chainEnvPrefix returns the environment variable prefix of a chain, e.g.
+// "POLYGON" for "polygon" and "MY_FORK" for "my-fork".
+func chainEnvPrefix(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// urlListEnv parses a comma-separated list of URLs, rejecting empty entries.
+func urlListEnv(name string) ([]string, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil, nil
+	}
+	var urls []string
+	for _, u := range strings.Split(v, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			return nil, ErrInvalidRPCEndpoints
+		}
+		urls = append(urls, u)
+	}
+	return urls, nil
+}
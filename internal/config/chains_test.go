@@ -0,0 +1,117 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChainPreset(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		id        uint64
+		fee       uint32
+		factories int
+		blockTime time.Duration
+	}{
+		{"ethereum", 1, 30, 1, 12 * time.Second},
+		{"BSC", 56, 25, 1, 750 * time.Millisecond},
+		{"polygon", 137, 30, 2, 2 * time.Second},
+		{"arbitrum", 42161, 30, 1, 250 * time.Millisecond},
+		{"base", 8453, 30, 1, 2 * time.Second},
+	} {
+		c, ok := ChainPreset(tc.name)
+		if !ok {
+			t.Fatalf("ChainPreset(%q) not found", tc.name)
+		}
+		if c.Name != strings.ToLower(tc.name) || c.ID != tc.id || c.DefaultFeeBps != tc.fee ||
+			len(c.Factories) != tc.factories || c.BlockTime != tc.blockTime || len(c.BaseTokens) == 0 {
+			t.Errorf("ChainPreset(%q) = %+v", tc.name, c)
+		}
+		if len(c.RPCEndpoints) != 0 {
+			t.Errorf("ChainPreset(%q) has endpoints %v", tc.name, c.RPCEndpoints)
+		}
+	}
+
+	if _, ok := ChainPreset("solana"); ok {
+		t.Fatal("ChainPreset(solana) found")
+	}
+
+	// Presets are copies: changing one does not change the next lookup.
+	c, _ := ChainPreset("ethereum")
+	c.Factories[0].FeeBps = 1
+	c.BaseTokens[0] = "0x0"
+	if again, _ := ChainPreset("ethereum"); again.Factories[0].FeeBps != 30 || again.BaseTokens[0] == "0x0" {
+		t.Fatalf("preset modified through a copy: %+v", again)
+	}
+}
+
+func TestChainsFromEnv(t *testing.T) {
+	fork := Chain{Name: "my-fork", ID: 31337, RPCEndpoints: []string{"http://fork.file"}, DefaultFeeBps: 25}
+	bsc, _ := ChainPreset("bsc")
+	bsc.RPCEndpoints = []string{"https://bsc.file"}
+	eth, _ := ChainPreset("ethereum")
+
+	cases := []struct {
+		name    string
+		base    []Chain
+		ethURLs []string
+		env     map[string]string
+		// want lists the chains as name=endpoints, default chain first.
+		want string
+		err  error
+	}{
+		{"file chains", []Chain{eth, fork}, []string{"https://eth.env"}, nil, "ethereum=https://eth.env my-fork=http://fork.file", nil},
+		{"preset", nil, []string{"https://eth.env"}, map[string]string{"CHAINS": "ethereum, BSC", "BSC_RPC_URLS": "https://bsc.env"}, "ethereum=https://eth.env bsc=https://bsc.env", nil},
+		{"endpoint override", []Chain{eth, bsc}, []string{"https://eth.env"}, map[string]string{"BSC_RPC_URLS": "https://a.env,https://b.env"}, "ethereum=https://eth.env bsc=https://a.env,https://b.env", nil},
+		{"file endpoints kept", []Chain{eth, bsc}, []string{"https://eth.env"}, nil, "ethereum=https://eth.env bsc=https://bsc.file", nil},
+		{"dashed name", []Chain{fork}, nil, map[string]string{"MY_FORK_RPC_URLS": "http://fork.env"}, "my-fork=http://fork.env", nil},
+		{"selects file chain", []Chain{eth, bsc, fork}, []string{"https://eth.env"}, map[string]string{"CHAINS": "my-fork"}, "my-fork=http://fork.file", nil},
+		{"default chain", nil, []string{"https://eth.env"}, map[string]string{"CHAINS": "ethereum,bsc", "BSC_RPC_URLS": "https://bsc.env", "DEFAULT_CHAIN": "BSC"}, "bsc=https://bsc.env ethereum=https://eth.env", nil},
+		{"unknown chain", nil, []string{"https://eth.env"}, map[string]string{"CHAINS": "ethereum,solana"}, "", ErrInvalidChains},
+		{"duplicate chain", nil, []string{"https://eth.env"}, map[string]string{"CHAINS": "ethereum,ethereum"}, "", ErrInvalidChains},
+		{"unknown default chain", nil, []string{"https://eth.env"}, map[string]string{"CHAINS": "ethereum", "DEFAULT_CHAIN": "bsc"}, "", ErrInvalidChains},
+		{"no ethereum endpoint", nil, nil, map[string]string{"CHAINS": "ethereum"}, "", ErrMissingRPCEndpoint},
+		{"no chain endpoint", nil, []string{"https://eth.env"}, map[string]string{"CHAINS": "ethereum,polygon"}, "", ErrMissingChainRPCEndpoint},
+		{"empty endpoint", []Chain{eth, bsc}, []string{"https://eth.env"}, map[string]string{"BSC_RPC_URLS": "https://a.env,"}, "", ErrInvalidRPCEndpoints},
+		{"empty token list", []Chain{eth}, []string{"https://eth.env"}, map[string]string{"ETHEREUM_TOKEN_LISTS": "a.json,,b.json"}, "", ErrInvalidTokenLists},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"CHAINS", "DEFAULT_CHAIN", "BSC_RPC_URLS", "POLYGON_RPC_URLS", "MY_FORK_RPC_URLS", "ETHEREUM_TOKEN_LISTS"} {
+				t.Setenv(k, tc.env[k])
+			}
+
+			chains, err := chainsFromEnv(tc.base, tc.ethURLs)
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("error = %v, want %v", err, tc.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("chainsFromEnv: %v", err)
+			}
+			got := make([]string, len(chains))
+			for i, c := range chains {
+				got[i] = c.Name + "=" + strings.Join(c.RPCEndpoints, ",")
+			}
+			if strings.Join(got, " ") != tc.want {
+				t.Fatalf("chains = %s, want %s", strings.Join(got, " "), tc.want)
+			}
+		})
+	}
+
+	// A chain taken from the file keeps its settings; a preset brings its own.
+	t.Setenv("CHAINS", "my-fork,bsc")
+	t.Setenv("BSC_RPC_URLS", "https://bsc.env")
+	chains, err := chainsFromEnv([]Chain{fork}, nil)
+	if err != nil {
+		t.Fatalf("chainsFromEnv: %v", err)
+	}
+	if chains[0].ID != 31337 || chains[0].DefaultFeeBps != 25 || chains[1].ID != 56 || chains[1].DefaultFeeBps != 25 || len(chains[1].Factories) != 1 {
+		t.Fatalf("unexpected chains: %+v", chains)
+	}
+}
@@ -1,47 +1,650 @@
-// Package config loads and validates service configuration from environment
-// variables.
+// Package config loads and validates service configuration from an optional
+// YAML or TOML file and environment variables.
 package config
 
-import "os"
+import (
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// defaultRouterAddress is the Uniswap V2 Router02 deployment on Ethereum
+// mainnet.
+const defaultRouterAddress = "0x7a250d5630B4cF539739dF2C5dAcb4c659F2488D"
 
 // Config holds runtime configuration values for the service.
 type Config struct {
 	Addr        string
 	RPCEndpoint string
 	LogLevel    string
+	// ShutdownTimeout bounds the graceful shutdown of the HTTP server.
+	ShutdownTimeout time.Duration
+	// ReadyMaxHeadLag is the age of the latest block beyond which /readyz
+	// reports a chain's node as stuck. Zero disables the check.
+	ReadyMaxHeadLag time.Duration
+	// RequestTimeout bounds the work of each estimate and simulation
+	// request. Zero disables the deadline.
+	RequestTimeout time.Duration
+	// GRPCAddr is the listen address of the gRPC server, which is disabled
+	// when empty.
+	GRPCAddr string
+	// QuotePollInterval is how often streamed quotes check for a new block.
+	QuotePollInterval time.Duration
+	// TrustedProxies are the proxies whose X-Forwarded-For entries identify
+	// clients. Clients are identified by the peer address otherwise.
+	TrustedProxies []netip.Prefix
+
+	// RPCEndpoints lists every RPC URL of the endpoint pool, starting with
+	// RPCEndpoint. Reads are routed to the healthiest endpoint and retried on
+	// the others.
+	RPCEndpoints      []string
+	RPCDialTimeout    time.Duration
+	RPCHealthInterval time.Duration
+	// RPCHedgeDelay enables hedged reads when positive.
+	RPCHedgeDelay  time.Duration
+	RPCMaxAttempts int
+	// RPCQuorumSize endpoints must be read for every quote, of which
+	// RPCQuorumThreshold must agree. Quorum mode is disabled when zero.
+	RPCQuorumSize      int
+	RPCQuorumThreshold int
+
+	// RPC compute-unit limits. RPCUnitsPerSecond and RPCDailyBudget disable
+	// their limit when zero. RPCMethodWeights overrides the default cost of
+	// individual methods.
+	RPCUnitsPerSecond float64
+	RPCBurst          int
+	RPCDailyBudget    uint64
+	RPCMaxWait        time.Duration
+	RPCMethodWeights  map[string]int
+	// StaleQuoteMaxAge is how old a pool state may be to still be served when
+	// RPC reads are rate limited. Zero disables the fallback.
+	StaleQuoteMaxAge time.Duration
+	// ResponseCacheEntries bounds the /estimate responses cached per chain
+	// for its latest block; the cache is disabled when zero. The latest
+	// block is read again once ResponseCacheHeadRefresh old.
+	ResponseCacheEntries     int
+	ResponseCacheHeadRefresh time.Duration
+
+	// OTLPEndpoint is the OTLP/HTTP collector URL traces are exported to.
+	// Tracing export is disabled when empty.
+	OTLPEndpoint string
+	// TraceSampleRatio is the fraction of new traces that are sampled.
+	TraceSampleRatio float64
+
+	// MempoolRPCEndpoint is a subscription-capable (WebSocket or IPC) RPC URL
+	// used for pending-block estimates. Pending mode is disabled when empty.
+	MempoolRPCEndpoint string
+	RouterAddress      string
+
+	// HistoryConcurrency and HistoryReadsPerSec bound the storage reads
+	// issued by /estimate/history.
+	HistoryConcurrency int
+	HistoryReadsPerSec float64
+
+	// StreamMaxSubscriptions caps the quote subscriptions of one streaming
+	// connection.
+	StreamMaxSubscriptions int
+
+	// ClientRatePerSec and ClientBurst bound the API requests of each client
+	// address. The limit is disabled when ClientRatePerSec is zero.
+	ClientRatePerSec float64
+	ClientBurst      int
+	// EstimateConcurrency caps the estimate, simulation and history
+	// requests, gRPC calls and quote stream polls served at once; the cap is
+	// disabled when zero. Up to EstimateQueue more wait
+	// for at most EstimateQueueTimeout, zero meaning their deadline, and
+	// the rest are shed.
+	EstimateConcurrency  int
+	EstimateQueue        int
+	EstimateQueueTimeout time.Duration
+
+	// Indexer settings. The indexer is enabled when IndexerDBPath and
+	// IndexerPools are both set.
+	IndexerDBPath        string
+	IndexerPools         []string
+	IndexerStartBlock    uint64
+	IndexerChunkSize     uint64
+	IndexerConfirmations uint64
+	IndexerPollInterval  time.Duration
+
+	// APIKeys are the keys API requests must carry, those of APIKeysFile
+	// included. Authentication is disabled when empty.
+	APIKeys     []APIKey
+	APIKeysFile string
+
+	// Chains lists the networks quotes are served on, the default chain
+	// first. RPCEndpoint and RPCEndpoints are those of the default chain,
+	// which also hosts the mempool watcher, quorum and indexer.
+	Chains []Chain
 }
 
 // FromEnv reads configuration from environment variables and returns a
 // populated Config. It applies sensible defaults for optional settings and
 // validates required values.
 //
-// Required:
+// Required when the ethereum chain is enabled (at least one):
 //   - ETH_RPC_URL: Ethereum node RPC URL
+//   - ETH_RPC_URLS: comma-separated additional RPC URLs forming a failover
+//     pool together with ETH_RPC_URL
 //
 // Optional:
+//   - CHAINS (default "ethereum"): comma-separated built-in chains to serve,
+//     any of ethereum, bsc, polygon, arbitrum and base
+//   - <CHAIN>_RPC_URLS: comma-separated RPC URLs of a non-ethereum chain,
+//     e.g. BSC_RPC_URLS; required for every such chain in CHAINS
+//   - <CHAIN>_TOKEN_LISTS: comma-separated paths of token list files of a
+//     chain, e.g. ETHEREUM_TOKEN_LISTS, replacing those of the config file
+//   - DEFAULT_CHAIN (default first of CHAINS): chain used when a request
+//     names none
 //   - ADDR (default ":1337"): listen address for the HTTP server
+//   - SHUTDOWN_TIMEOUT (default 3s): graceful shutdown deadline
+//   - REQUEST_TIMEOUT (default 10s): deadline of estimate and simulation
+//     requests, which timeout_ms may shorten; 0 disables it
+//   - GRPC_ADDR: listen address of the gRPC server, e.g. ":9090"; the gRPC
+//     API is disabled when empty
+//   - QUOTE_POLL_INTERVAL (default 2s): how often streamed quotes check for a
+//     new block
+//   - READY_MAX_HEAD_LAG (default 2m): age of the latest block beyond which
+//     /readyz fails; 0 disables the check
+//   - RPC_DIAL_TIMEOUT (default 15s): timeout for connecting to an endpoint
+//   - RPC_HEALTH_INTERVAL (default 10s): delay between endpoint health checks
+//   - RPC_HEDGE_DELAY (default 0): send a read to the next endpoint when the
+//     current one is slower than this; 0 disables hedging
+//   - RPC_MAX_ATTEMPTS (default 0): endpoints tried per read; 0 means all
+//   - RPC_QUORUM_SIZE (default 0): endpoints read at the same block hash for
+//     every quote; 0 disables quorum mode
+//   - RPC_QUORUM_THRESHOLD (default simple majority): identical answers
+//     required out of RPC_QUORUM_SIZE
 //   - LOG_LEVEL (default "info"): one of debug, info, warn, error
+//   - ETH_WS_URL: subscription-capable RPC URL enabling pending estimates
+//   - RPC_RATE_LIMIT (default 0): compute units per second sent to the RPC
+//     endpoints; 0 disables the limit
+//   - RPC_RATE_BURST (default one second of units): token bucket size
+//   - RPC_DAILY_BUDGET (default 0): compute units per UTC day; 0 is unlimited
+//   - RPC_RATE_MAX_WAIT (default 250ms): how long a read may queue for tokens
+//   - RPC_METHOD_WEIGHTS: comma-separated method=units overrides, e.g.
+//     "eth_getStorageAt=17,eth_getProof=21"
+//   - STALE_QUOTE_MAX_AGE (default 30s): serve quotes from pool state this old
+//     when rate limited instead of failing; 0 disables
+//   - RESPONSE_CACHE_ENTRIES (default 10000): /estimate responses cached per
+//     chain for its latest block; 0 disables the response cache
+//   - RESPONSE_CACHE_HEAD_REFRESH (default 1s): how often the latest block
+//     is read to expire cached responses
+//   - OTEL_EXPORTER_OTLP_ENDPOINT: OTLP/HTTP collector URL, e.g.
+//     http://localhost:4318; enables trace export
+//   - TRACE_SAMPLE_RATIO (default 1): fraction of new traces sampled
+//   - ROUTER_ADDRESS (default Uniswap V2 Router02 on mainnet): router whose
+//     pending swaps are applied in pending mode
+//   - HISTORY_CONCURRENCY (default 8): blocks read concurrently per history
+//     query
+//   - HISTORY_RPS (default 25): storage reads per second across history
+//     queries; 0 disables the limit
+//   - STREAM_MAX_SUBSCRIPTIONS (default 10): quote subscriptions per
+//     streaming connection
+//   - TRUSTED_PROXIES: comma-separated IP addresses and CIDR ranges of the
+//     proxies whose X-Forwarded-For entries identify clients
+//   - CLIENT_RPS (default 0): API requests per second of each client
+//     address; 0 disables the limit
+//   - CLIENT_BURST (default one second of requests): token bucket size of
+//     each client
+//   - ESTIMATE_CONCURRENCY (default 0): estimate, simulation and history
+//     requests, gRPC calls and quote stream polls served at once; 0
+//     disables the cap
+//   - ESTIMATE_QUEUE (default 0): requests waiting for the concurrency cap;
+//     further requests are shed with 503
+//   - ESTIMATE_QUEUE_TIMEOUT (default 1s): longest wait in the queue; 0
+//     leaves only the request deadline
+//   - API_KEYS_FILE: YAML or TOML file listing API keys with their rate
+//     limits and daily quotas; requests must carry one of them when set
+//   - INDEXER_DB_PATH: file of the embedded reserve history store
+//   - INDEXER_POOLS: comma-separated pair addresses to index
+//   - INDEXER_START_BLOCK (default 0): first block indexed for new pools
+//   - INDEXER_CHUNK_SIZE (default 2000): block span per eth_getLogs request
+//   - INDEXER_CONFIRMATIONS (default 12): blocks kept behind the head
+//   - INDEXER_POLL_INTERVAL (default 12s): delay between tail iterations
 func FromEnv() (*Config, error) {
+	return fromEnv(defaults())
+}
+
+// defaults returns the configuration used when neither a config file nor an
+// environment variable sets a value.
+func defaults() *Config {
+	ethereum, _ := ChainPreset("ethereum")
+	return &Config{
+		Addr:            ":1337",
+		LogLevel:        "info",
+		ShutdownTimeout: 3 * time.Second,
+		ReadyMaxHeadLag: 2 * time.Minute,
+		RequestTimeout:  10 * time.Second,
+		RouterAddress:   defaultRouterAddress,
+
+		QuotePollInterval: 2 * time.Second,
+
+		HistoryConcurrency: 8,
+		HistoryReadsPerSec: 25,
+
+		StreamMaxSubscriptions: 10,
+
+		EstimateQueueTimeout: time.Second,
+
+		IndexerChunkSize:     2000,
+		IndexerConfirmations: 12,
+		IndexerPollInterval:  12 * time.Second,
+
+		RPCDialTimeout:    15 * time.Second,
+		RPCHealthInterval: 10 * time.Second,
+		RPCMaxWait:        250 * time.Millisecond,
+		StaleQuoteMaxAge:  30 * time.Second,
+		TraceSampleRatio:  1,
+
+		ResponseCacheEntries:     10000,
+		ResponseCacheHeadRefresh: time.Second,
+
+		Chains: []Chain{ethereum},
+	}
+}
+
+// fromEnv returns a copy of base with the values of every environment
+// variable documented on FromEnv applied, then validates the result.
+func fromEnv(base *Config) (*Config, error) {
 	addr := os.Getenv("ADDR")
 	if addr == "" {
-		addr = ":1337"
+		addr = base.Addr
 	}
 
-	rpcURL := os.Getenv("ETH_RPC_URL")
-	if rpcURL == "" {
-		return nil, ErrMissingRPCEndpoint
+	var rpcURLs []string
+	if v := os.Getenv("ETH_RPC_URL"); v != "" {
+		rpcURLs = append(rpcURLs, v)
+	}
+	if v := os.Getenv("ETH_RPC_URLS"); v != "" {
+		for _, u := range strings.Split(v, ",") {
+			u = strings.TrimSpace(u)
+			if u == "" {
+				return nil, ErrInvalidRPCEndpoints
+			}
+			if !slices.Contains(rpcURLs, u) {
+				rpcURLs = append(rpcURLs, u)
+			}
+		}
+	}
+	chains, err := chainsFromEnv(base.Chains, rpcURLs)
+	if err != nil {
+		return nil, err
+	}
+	// The pool settings below apply to every chain; RPCEndpoints mirrors the
+	// default chain.
+	rpcURLs = chains[0].RPCEndpoints
+
+	rpcDialTimeout, err := durationEnv("RPC_DIAL_TIMEOUT", base.RPCDialTimeout)
+	if err != nil || rpcDialTimeout <= 0 {
+		return nil, ErrInvalidRPCSetting
+	}
+	rpcHealthInterval, err := durationEnv("RPC_HEALTH_INTERVAL", base.RPCHealthInterval)
+	if err != nil || rpcHealthInterval <= 0 {
+		return nil, ErrInvalidRPCSetting
+	}
+	rpcHedgeDelay, err := durationEnv("RPC_HEDGE_DELAY", base.RPCHedgeDelay)
+	if err != nil || rpcHedgeDelay < 0 {
+		return nil, ErrInvalidRPCSetting
+	}
+	rpcMaxAttempts := base.RPCMaxAttempts
+	if v := os.Getenv("RPC_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidRPCSetting
+		}
+		rpcMaxAttempts = n
+	}
+
+	quorumSize, err := uintEnv("RPC_QUORUM_SIZE", uint64(base.RPCQuorumSize))
+	if err != nil || quorumSize > uint64(len(rpcURLs)) {
+		return nil, ErrInvalidRPCQuorum
+	}
+	defThreshold := uint64(base.RPCQuorumThreshold)
+	if defThreshold == 0 || os.Getenv("RPC_QUORUM_SIZE") != "" {
+		defThreshold = quorumSize/2 + 1
+	}
+	quorumThreshold, err := uintEnv("RPC_QUORUM_THRESHOLD", defThreshold)
+	if err != nil || (quorumSize > 0 && (quorumThreshold <= quorumSize/2 || quorumThreshold > quorumSize)) {
+		return nil, ErrInvalidRPCQuorum
+	}
+
+	rpcRate := base.RPCUnitsPerSecond
+	if v := os.Getenv("RPC_RATE_LIMIT"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return nil, ErrInvalidRPCLimit
+		}
+		rpcRate = f
+	}
+	rpcBurst, err := uintEnv("RPC_RATE_BURST", uint64(base.RPCBurst))
+	if err != nil {
+		return nil, ErrInvalidRPCLimit
+	}
+	rpcBudget, err := uintEnv("RPC_DAILY_BUDGET", base.RPCDailyBudget)
+	if err != nil {
+		return nil, ErrInvalidRPCLimit
+	}
+	rpcMaxWait, err := durationEnv("RPC_RATE_MAX_WAIT", base.RPCMaxWait)
+	if err != nil || rpcMaxWait < 0 {
+		return nil, ErrInvalidRPCLimit
+	}
+	rpcWeights := base.RPCMethodWeights
+	if v := os.Getenv("RPC_METHOD_WEIGHTS"); v != "" {
+		if rpcWeights, err = parseMethodWeights(v); err != nil {
+			return nil, err
+		}
+	}
+	staleMaxAge, err := durationEnv("STALE_QUOTE_MAX_AGE", base.StaleQuoteMaxAge)
+	if err != nil || staleMaxAge < 0 {
+		return nil, ErrInvalidRPCLimit
+	}
+	responseEntries := base.ResponseCacheEntries
+	if v := os.Getenv("RESPONSE_CACHE_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidResponseCache
+		}
+		responseEntries = n
+	}
+	headRefresh, err := durationEnv("RESPONSE_CACHE_HEAD_REFRESH", base.ResponseCacheHeadRefresh)
+	if err != nil || headRefresh <= 0 {
+		return nil, ErrInvalidResponseCache
+	}
+
+	shutdownTimeout, err := durationEnv("SHUTDOWN_TIMEOUT", base.ShutdownTimeout)
+	if err != nil || shutdownTimeout <= 0 {
+		return nil, ErrInvalidShutdownTimeout
+	}
+
+	requestTimeout, err := durationEnv("REQUEST_TIMEOUT", base.RequestTimeout)
+	if err != nil || requestTimeout < 0 {
+		return nil, ErrInvalidRequestTimeout
+	}
+
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = base.GRPCAddr
+	}
+
+	quotePollInterval, err := durationEnv("QUOTE_POLL_INTERVAL", base.QuotePollInterval)
+	if err != nil || quotePollInterval <= 0 {
+		return nil, ErrInvalidQuotePollInterval
+	}
+
+	readyMaxHeadLag, err := durationEnv("READY_MAX_HEAD_LAG", base.ReadyMaxHeadLag)
+	if err != nil || readyMaxHeadLag < 0 {
+		return nil, ErrInvalidReadyMaxHeadLag
 	}
 
 	logLevel := os.Getenv("LOG_LEVEL")
 	if logLevel == "" {
-		logLevel = "info"
+		logLevel = base.LogLevel
+	}
+
+	mempoolURL := os.Getenv("ETH_WS_URL")
+	if mempoolURL == "" {
+		mempoolURL = base.MempoolRPCEndpoint
+	}
+	router := os.Getenv("ROUTER_ADDRESS")
+	if router == "" {
+		router = base.RouterAddress
+	}
+	if !common.IsHexAddress(router) {
+		return nil, ErrInvalidRouterAddress
+	}
+
+	historyConcurrency := base.HistoryConcurrency
+	if v := os.Getenv("HISTORY_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, ErrInvalidHistoryConcurrency
+		}
+		historyConcurrency = n
+	}
+
+	historyRPS := base.HistoryReadsPerSec
+	if v := os.Getenv("HISTORY_RPS"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return nil, ErrInvalidHistoryRPS
+		}
+		historyRPS = f
+	}
+
+	streamMaxSubscriptions := base.StreamMaxSubscriptions
+	if v := os.Getenv("STREAM_MAX_SUBSCRIPTIONS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, ErrInvalidStreamMaxSubscriptions
+		}
+		streamMaxSubscriptions = n
+	}
+
+	trustedProxies := base.TrustedProxies
+	if v := os.Getenv("TRUSTED_PROXIES"); v != "" {
+		trustedProxies = nil
+		for _, s := range strings.Split(v, ",") {
+			p, err := parseProxy(strings.TrimSpace(s))
+			if err != nil {
+				return nil, ErrInvalidTrustedProxies
+			}
+			trustedProxies = append(trustedProxies, p)
+		}
+	}
+
+	clientRate := base.ClientRatePerSec
+	if v := os.Getenv("CLIENT_RPS"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return nil, ErrInvalidClientLimit
+		}
+		clientRate = f
+	}
+	clientBurst := base.ClientBurst
+	if v := os.Getenv("CLIENT_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidClientLimit
+		}
+		clientBurst = n
+	}
+
+	estimateConcurrency := base.EstimateConcurrency
+	if v := os.Getenv("ESTIMATE_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidEstimateConcurrency
+		}
+		estimateConcurrency = n
+	}
+	estimateQueue := base.EstimateQueue
+	if v := os.Getenv("ESTIMATE_QUEUE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidEstimateConcurrency
+		}
+		estimateQueue = n
+	}
+	estimateQueueTimeout, err := durationEnv("ESTIMATE_QUEUE_TIMEOUT", base.EstimateQueueTimeout)
+	if err != nil || estimateQueueTimeout < 0 {
+		return nil, ErrInvalidEstimateConcurrency
+	}
+
+	apiKeysFile := os.Getenv("API_KEYS_FILE")
+	if apiKeysFile == "" {
+		apiKeysFile = base.APIKeysFile
+	}
+	apiKeys := base.APIKeys
+	if apiKeysFile != "" {
+		if apiKeys, err = loadAPIKeys(apiKeysFile, base.APIKeys); err != nil {
+			return nil, err
+		}
+	}
+
+	otlpEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+	if otlpEndpoint == "" {
+		otlpEndpoint = base.OTLPEndpoint
+	}
+	sampleRatio := base.TraceSampleRatio
+	if v := os.Getenv("TRACE_SAMPLE_RATIO"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil, ErrInvalidTraceSampleRatio
+		}
+		sampleRatio = f
+	}
+
+	indexerDB := os.Getenv("INDEXER_DB_PATH")
+	if indexerDB == "" {
+		indexerDB = base.IndexerDBPath
+	}
+	indexerPools := base.IndexerPools
+	if v := os.Getenv("INDEXER_POOLS"); v != "" {
+		indexerPools = nil
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			if !common.IsHexAddress(p) {
+				return nil, ErrInvalidIndexerPools
+			}
+			indexerPools = append(indexerPools, p)
+		}
+	}
+
+	indexerStart, err := uintEnv("INDEXER_START_BLOCK", base.IndexerStartBlock)
+	if err != nil {
+		return nil, err
+	}
+	indexerChunk, err := uintEnv("INDEXER_CHUNK_SIZE", base.IndexerChunkSize)
+	if err != nil || indexerChunk == 0 {
+		return nil, ErrInvalidIndexerSetting
+	}
+	indexerConfirmations, err := uintEnv("INDEXER_CONFIRMATIONS", base.IndexerConfirmations)
+	if err != nil {
+		return nil, err
+	}
+
+	indexerPoll, err := durationEnv("INDEXER_POLL_INTERVAL", base.IndexerPollInterval)
+	if err != nil || indexerPoll <= 0 {
+		return nil, ErrInvalidIndexerSetting
 	}
 
 	cfg := &Config{
-		Addr:        addr,
-		RPCEndpoint: rpcURL,
-		LogLevel:    logLevel,
+		Addr:               addr,
+		RPCEndpoint:        rpcURLs[0],
+		LogLevel:           logLevel,
+		ShutdownTimeout:    shutdownTimeout,
+		ReadyMaxHeadLag:    readyMaxHeadLag,
+		RequestTimeout:     requestTimeout,
+		GRPCAddr:           grpcAddr,
+		QuotePollInterval:  quotePollInterval,
+		TrustedProxies:     trustedProxies,
+		MempoolRPCEndpoint: mempoolURL,
+		RouterAddress:      router,
+		HistoryConcurrency: historyConcurrency,
+		HistoryReadsPerSec: historyRPS,
+
+		StreamMaxSubscriptions: streamMaxSubscriptions,
+
+		ClientRatePerSec:     clientRate,
+		ClientBurst:          clientBurst,
+		EstimateConcurrency:  estimateConcurrency,
+		EstimateQueue:        estimateQueue,
+		EstimateQueueTimeout: estimateQueueTimeout,
+
+		IndexerDBPath:        indexerDB,
+		IndexerPools:         indexerPools,
+		IndexerStartBlock:    indexerStart,
+		IndexerChunkSize:     indexerChunk,
+		IndexerConfirmations: indexerConfirmations,
+		IndexerPollInterval:  indexerPoll,
+
+		RPCEndpoints:      rpcURLs,
+		RPCDialTimeout:    rpcDialTimeout,
+		RPCHealthInterval: rpcHealthInterval,
+		RPCHedgeDelay:     rpcHedgeDelay,
+		RPCMaxAttempts:    rpcMaxAttempts,
+
+		RPCQuorumSize:      int(quorumSize),
+		RPCQuorumThreshold: int(quorumThreshold),
+
+		RPCUnitsPerSecond: rpcRate,
+		RPCBurst:          int(rpcBurst),
+		RPCDailyBudget:    rpcBudget,
+		RPCMaxWait:        rpcMaxWait,
+		RPCMethodWeights:  rpcWeights,
+		StaleQuoteMaxAge:  staleMaxAge,
+		OTLPEndpoint:      otlpEndpoint,
+		TraceSampleRatio:  sampleRatio,
+
+		ResponseCacheEntries:     responseEntries,
+		ResponseCacheHeadRefresh: headRefresh,
+
+		APIKeys:     apiKeys,
+		APIKeysFile: apiKeysFile,
+
+		Chains: chains,
 	}
 
 	return cfg, nil
 }
+
+// uintEnv parses an unsigned integer environment variable, returning def when
+// it is unset.
+func uintEnv(name string, def uint64) (uint64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidIndexerSetting
+	}
+	return n, nil
+}
+
+// durationEnv parses a duration environment variable, returning def when it is
+// unset.
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// parseProxy parses a trusted proxy, an IP address or a CIDR range.
+func parseProxy(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// parseMethodWeights parses comma-separated method=units pairs.
+func parseMethodWeights(v string) (map[string]int, error) {
+	if v == "" {
+		return nil, nil
+	}
+	weights := make(map[string]int)
+	for _, pair := range strings.Split(v, ",") {
+		method, units, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		n, err := strconv.Atoi(units)
+		if !ok || method == "" || err != nil || n <= 0 {
+			return nil, ErrInvalidRPCMethodWeights
+		}
+		weights[method] = n
+	}
+	return weights, nil
+}
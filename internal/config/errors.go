@@ -2,6 +2,103 @@ package config
 
 import "errors"
 
-// ErrMissingRPCEndpoint indicates that the required ETH_RPC_URL variable is
-// not set in the environment.
+// ErrUnsupportedConfigFormat indicates that the config file extension is not
+// .yaml, .yml or .toml.
+var ErrUnsupportedConfigFormat = errors.New("unsupported config file format, want .yaml, .yml or .toml")
+
+// ErrMissingRPCEndpoint indicates that neither ETH_RPC_URL nor ETH_RPC_URLS
+// is set in the environment.
 var ErrMissingRPCEndpoint = errors.New("missing ETH_RPC_URL environment variable")
+
+// ErrInvalidRPCEndpoints indicates that ETH_RPC_URLS contains an empty entry.
+var ErrInvalidRPCEndpoints = errors.New("invalid ETH_RPC_URLS environment variable")
+
+// ErrInvalidChains indicates that CHAINS names an unknown or duplicate chain,
+// or that DEFAULT_CHAIN is not one of them.
+var ErrInvalidChains = errors.New("invalid CHAINS or DEFAULT_CHAIN environment variable")
+
+// ErrMissingChainRPCEndpoint indicates that a chain listed in CHAINS has no
+// <CHAIN>_RPC_URLS set.
+var ErrMissingChainRPCEndpoint = errors.New("missing <CHAIN>_RPC_URLS environment variable")
+
+// ErrInvalidTokenLists indicates that a <CHAIN>_TOKEN_LISTS variable contains
+// an empty entry.
+var ErrInvalidTokenLists = errors.New("invalid <CHAIN>_TOKEN_LISTS environment variable")
+
+// ErrInvalidRPCSetting indicates that one of the RPC_* pool variables could
+// not be parsed.
+var ErrInvalidRPCSetting = errors.New("invalid RPC_* environment variable")
+
+// ErrInvalidRPCQuorum indicates that RPC_QUORUM_SIZE exceeds the number of
+// endpoints or RPC_QUORUM_THRESHOLD is not a majority of it.
+var ErrInvalidRPCQuorum = errors.New("invalid RPC_QUORUM_SIZE or RPC_QUORUM_THRESHOLD environment variable")
+
+// ErrInvalidRPCLimit indicates that one of RPC_RATE_LIMIT, RPC_RATE_BURST,
+// RPC_DAILY_BUDGET, RPC_RATE_MAX_WAIT or STALE_QUOTE_MAX_AGE could not be
+// parsed.
+var ErrInvalidRPCLimit = errors.New("invalid RPC rate limit environment variable")
+
+// ErrInvalidResponseCache indicates that RESPONSE_CACHE_ENTRIES is not a
+// non-negative integer or RESPONSE_CACHE_HEAD_REFRESH is not a positive
+// duration.
+var ErrInvalidResponseCache = errors.New("invalid RESPONSE_CACHE_ENTRIES or RESPONSE_CACHE_HEAD_REFRESH environment variable")
+
+// ErrInvalidRPCMethodWeights indicates that RPC_METHOD_WEIGHTS is not a list
+// of method=units pairs with positive units.
+var ErrInvalidRPCMethodWeights = errors.New("invalid RPC_METHOD_WEIGHTS environment variable")
+
+// ErrInvalidShutdownTimeout indicates that SHUTDOWN_TIMEOUT is not a positive
+// duration.
+var ErrInvalidShutdownTimeout = errors.New("invalid SHUTDOWN_TIMEOUT environment variable")
+
+// ErrInvalidRequestTimeout indicates that REQUEST_TIMEOUT is not a
+// non-negative duration.
+var ErrInvalidRequestTimeout = errors.New("invalid REQUEST_TIMEOUT environment variable")
+
+// ErrInvalidQuotePollInterval indicates that QUOTE_POLL_INTERVAL is not a
+// positive duration.
+var ErrInvalidQuotePollInterval = errors.New("invalid QUOTE_POLL_INTERVAL environment variable")
+
+// ErrInvalidReadyMaxHeadLag indicates that READY_MAX_HEAD_LAG is not a
+// non-negative duration.
+var ErrInvalidReadyMaxHeadLag = errors.New("invalid READY_MAX_HEAD_LAG environment variable")
+
+// ErrInvalidRouterAddress indicates that ROUTER_ADDRESS is not a valid hex
+// address.
+var ErrInvalidRouterAddress = errors.New("invalid ROUTER_ADDRESS environment variable")
+
+// ErrInvalidHistoryConcurrency indicates that HISTORY_CONCURRENCY is not a
+// positive integer.
+var ErrInvalidHistoryConcurrency = errors.New("invalid HISTORY_CONCURRENCY environment variable")
+
+// ErrInvalidHistoryRPS indicates that HISTORY_RPS is not a non-negative
+// number.
+var ErrInvalidHistoryRPS = errors.New("invalid HISTORY_RPS environment variable")
+
+// ErrInvalidStreamMaxSubscriptions indicates that STREAM_MAX_SUBSCRIPTIONS is
+// not a positive integer.
+var ErrInvalidStreamMaxSubscriptions = errors.New("invalid STREAM_MAX_SUBSCRIPTIONS environment variable")
+
+// ErrInvalidTrustedProxies indicates that TRUSTED_PROXIES contains an entry
+// that is neither an IP address nor a CIDR range.
+var ErrInvalidTrustedProxies = errors.New("invalid TRUSTED_PROXIES environment variable")
+
+// ErrInvalidClientLimit indicates that CLIENT_RPS or CLIENT_BURST is not a
+// non-negative number.
+var ErrInvalidClientLimit = errors.New("invalid CLIENT_RPS or CLIENT_BURST environment variable")
+
+// ErrInvalidEstimateConcurrency indicates that ESTIMATE_CONCURRENCY,
+// ESTIMATE_QUEUE or ESTIMATE_QUEUE_TIMEOUT is not a non-negative number.
+var ErrInvalidEstimateConcurrency = errors.New("invalid ESTIMATE_CONCURRENCY, ESTIMATE_QUEUE or ESTIMATE_QUEUE_TIMEOUT environment variable")
+
+// ErrInvalidIndexerPools indicates that INDEXER_POOLS contains an entry that
+// is not a valid hex address.
+var ErrInvalidIndexerPools = errors.New("invalid INDEXER_POOLS environment variable")
+
+// ErrInvalidIndexerSetting indicates that one of the numeric INDEXER_*
+// variables could not be parsed.
+var ErrInvalidIndexerSetting = errors.New("invalid INDEXER_* environment variable")
+
+// ErrInvalidTraceSampleRatio indicates that TRACE_SAMPLE_RATIO is not a number
+// between 0 and 1.
+var ErrInvalidTraceSampleRatio = errors.New("invalid TRACE_SAMPLE_RATIO environment variable")
@@ -0,0 +1,645 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ethereum/go-ethereum/common"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the schema of the configuration file, in YAML or TOML. Keys use
+// snake_case; durations are strings such as "250ms" or "10s". Omitted keys
+// keep their defaults, which are the same as those of FromEnv. See
+// config.example.yaml for a complete file.
+type File struct {
+	Server ServerFile `yaml:"server" toml:"server"`
+	RPC    RPCFile    `yaml:"rpc" toml:"rpc"`
+	Cache  CacheFile  `yaml:"cache" toml:"cache"`
+	Limits LimitsFile `yaml:"limits" toml:"limits"`
+	// DefaultChain names the chain used by requests that name none. Defaults
+	// to the first of Chains.
+	DefaultChain string      `yaml:"default_chain" toml:"default_chain"`
+	Chains       []ChainFile `yaml:"chains" toml:"chains"`
+	Mempool      MempoolFile `yaml:"mempool" toml:"mempool"`
+	Indexer      IndexerFile `yaml:"indexer" toml:"indexer"`
+	Tracing      TracingFile `yaml:"tracing" toml:"tracing"`
+	Auth         AuthFile    `yaml:"auth" toml:"auth"`
+}
+
+// ServerFile configures the HTTP server.
+type ServerFile struct {
+	Addr string `yaml:"addr" toml:"addr"`
+	// LogLevel is one of debug, info, warn and error.
+	LogLevel        string        `yaml:"log_level" toml:"log_level"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	// RequestTimeout bounds estimate and simulation requests; zero disables
+	// the deadline.
+	RequestTimeout time.Duration `yaml:"request_timeout" toml:"request_timeout"`
+	// ReadyMaxHeadLag is the age of the latest block beyond which /readyz
+	// fails; zero disables the check.
+	ReadyMaxHeadLag time.Duration `yaml:"ready_max_head_lag" toml:"ready_max_head_lag"`
+	// GRPCAddr enables the gRPC server on this address when set.
+	GRPCAddr          string        `yaml:"grpc_addr" toml:"grpc_addr"`
+	QuotePollInterval time.Duration `yaml:"quote_poll_interval" toml:"quote_poll_interval"`
+	// TrustedProxies lists the IP addresses and CIDR ranges of the proxies
+	// whose X-Forwarded-For entries identify clients.
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+// RPCFile configures the endpoint pools of every chain.
+type RPCFile struct {
+	DialTimeout    time.Duration `yaml:"dial_timeout" toml:"dial_timeout"`
+	HealthInterval time.Duration `yaml:"health_interval" toml:"health_interval"`
+	// HedgeDelay enables hedged reads when positive.
+	HedgeDelay time.Duration `yaml:"hedge_delay" toml:"hedge_delay"`
+	// MaxAttempts bounds the endpoints tried per read; zero means all.
+	MaxAttempts int           `yaml:"max_attempts" toml:"max_attempts"`
+	Quorum      QuorumFile    `yaml:"quorum" toml:"quorum"`
+	RateLimit   RateLimitFile `yaml:"rate_limit" toml:"rate_limit"`
+}
+
+// QuorumFile configures quorum mode on the default chain. A zero Size
+// disables it; a zero Threshold means a simple majority.
+type QuorumFile struct {
+	Size      int `yaml:"size" toml:"size"`
+	Threshold int `yaml:"threshold" toml:"threshold"`
+}
+
+// RateLimitFile configures the compute-unit limiter of each chain. Zero
+// UnitsPerSecond and DailyBudget disable their limit.
+type RateLimitFile struct {
+	UnitsPerSecond float64        `yaml:"units_per_second" toml:"units_per_second"`
+	Burst          int            `yaml:"burst" toml:"burst"`
+	DailyBudget    uint64         `yaml:"daily_budget" toml:"daily_budget"`
+	MaxWait        time.Duration  `yaml:"max_wait" toml:"max_wait"`
+	MethodWeights  map[string]int `yaml:"method_weights" toml:"method_weights"`
+}
+
+// CacheFile configures cached pool state and estimate responses.
+type CacheFile struct {
+	// StaleQuoteMaxAge is how old a pool state may be to still be served
+	// when rate limited; zero disables the fallback.
+	StaleQuoteMaxAge time.Duration `yaml:"stale_quote_max_age" toml:"stale_quote_max_age"`
+	// Responses is the number of /estimate responses kept per chain for
+	// its latest block; zero disables the response cache.
+	Responses int `yaml:"responses" toml:"responses"`
+	// HeadRefresh is how long a chain's latest block is trusted before it
+	// is read again to check for a new one.
+	HeadRefresh time.Duration `yaml:"head_refresh" toml:"head_refresh"`
+}
+
+// TracingFile configures OpenTelemetry trace export.
+type TracingFile struct {
+	// OTLPEndpoint is the OTLP/HTTP collector URL; empty disables export.
+	OTLPEndpoint string `yaml:"otlp_endpoint" toml:"otlp_endpoint"`
+	// SampleRatio is the fraction of new traces that are sampled.
+	SampleRatio float64 `yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+// LimitsFile bounds the work of clients, history queries and quote streams.
+type LimitsFile struct {
+	HistoryConcurrency int `yaml:"history_concurrency" toml:"history_concurrency"`
+	// HistoryRPS is the storage reads per second across history queries;
+	// zero disables the limit.
+	HistoryRPS float64 `yaml:"history_rps" toml:"history_rps"`
+	// StreamSubscriptions caps the quote subscriptions of one streaming
+	// connection.
+	StreamSubscriptions int `yaml:"stream_subscriptions" toml:"stream_subscriptions"`
+	// ClientRPS is the API requests per second of each client address; zero
+	// disables the limit. A zero ClientBurst means one second of requests.
+	ClientRPS   float64 `yaml:"client_rps" toml:"client_rps"`
+	ClientBurst int     `yaml:"client_burst" toml:"client_burst"`
+	// EstimateConcurrency caps the estimate, simulation and history
+	// requests, gRPC calls and quote stream polls served at once; zero
+	// disables the cap. Up to EstimateQueue more wait for at
+	// most EstimateQueueTimeout, and the rest are shed.
+	EstimateConcurrency  int           `yaml:"estimate_concurrency" toml:"estimate_concurrency"`
+	EstimateQueue        int           `yaml:"estimate_queue" toml:"estimate_queue"`
+	EstimateQueueTimeout time.Duration `yaml:"estimate_queue_timeout" toml:"estimate_queue_timeout"`
+}
+
+// ChainFile describes a chain. When Name is a built-in chain (see
+// ChainPreset), omitted fields are taken from the preset; other chains must
+// set ID.
+type ChainFile struct {
+	Name    string   `yaml:"name" toml:"name"`
+	ID      uint64   `yaml:"id" toml:"id"`
+	RPCURLs []string `yaml:"rpc_urls" toml:"rpc_urls"`
+	// DefaultFeeBps applies to pools of unknown factories. Zero means the
+	// preset's fee, or 30 bps.
+	DefaultFeeBps uint32        `yaml:"default_fee_bps" toml:"default_fee_bps"`
+	Factories     []FactoryFile `yaml:"factories" toml:"factories"`
+	BaseTokens    []string      `yaml:"base_tokens" toml:"base_tokens"`
+	// BlockTime is the expected interval between blocks, which bounds how
+	// long clients may cache estimates. Zero means the preset's, if any.
+	BlockTime time.Duration `yaml:"block_time" toml:"block_time"`
+	// TokenLists are paths of Uniswap token list JSON files, relative to the
+	// working directory.
+	TokenLists []string `yaml:"token_lists" toml:"token_lists"`
+}
+
+// FactoryFile describes a pair factory. An empty InitCodeHash skips pair
+// address verification; a zero FeeBps means the chain's default fee.
+type FactoryFile struct {
+	Name         string `yaml:"name" toml:"name"`
+	Address      string `yaml:"address" toml:"address"`
+	InitCodeHash string `yaml:"init_code_hash" toml:"init_code_hash"`
+	FeeBps       uint32 `yaml:"fee_bps" toml:"fee_bps"`
+}
+
+// MempoolFile configures pending-block estimates on the default chain.
+type MempoolFile struct {
+	WSURL  string `yaml:"ws_url" toml:"ws_url"`
+	Router string `yaml:"router" toml:"router"`
+}
+
+// IndexerFile configures the reserve history indexer on the default chain.
+type IndexerFile struct {
+	DBPath        string        `yaml:"db_path" toml:"db_path"`
+	Pools         []string      `yaml:"pools" toml:"pools"`
+	StartBlock    uint64        `yaml:"start_block" toml:"start_block"`
+	ChunkSize     uint64        `yaml:"chunk_size" toml:"chunk_size"`
+	Confirmations uint64        `yaml:"confirmations" toml:"confirmations"`
+	PollInterval  time.Duration `yaml:"poll_interval" toml:"poll_interval"`
+}
+
+// FieldError reports an invalid value in the configuration file.
+type FieldError struct {
+	// Field is the dotted path of the value, e.g. "chains[1].factories[0].address".
+	Field  string
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Reason
+}
+
+// maxFeeBps is the largest accepted swap fee, 100%.
+const maxFeeBps = 10_000
+
+var (
+	chainNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	logLevels        = []string{"debug", "info", "warn", "error"}
+)
+
+// Load reads the configuration file at path, then applies the environment
+// variables documented on FromEnv, which take precedence over file values.
+// The format is chosen by extension: .yaml, .yml or .toml. Unknown keys are
+// rejected and every invalid value is reported as a *FieldError. An empty
+// path is the same as FromEnv.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		return FromEnv()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+	f, err := decodeFile(filepath.Ext(path), data)
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	base, err := f.config()
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+	return fromEnv(base)
+}
+
+// decodeFile strictly decodes a configuration file over the defaults.
+func decodeFile(ext string, data []byte) (*File, error) {
+	f := defaultFile()
+	if err := decodeStrict(ext, data, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// decodeStrict decodes a YAML or TOML document into v, chosen by the file
+// extension ext, and rejects unknown keys.
+func decodeStrict(ext string, data []byte, v any) error {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		// An empty file is valid and keeps every default.
+		if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+	case ".toml":
+		md, err := toml.NewDecoder(bytes.NewReader(data)).Decode(v)
+		if err != nil {
+			return err
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return fmt.Errorf("unknown keys: %s", strings.Join(keys, ", "))
+		}
+	default:
+		return ErrUnsupportedConfigFormat
+	}
+	return nil
+}
+
+// defaultFile returns the File equivalent of defaults.
+func defaultFile() *File {
+	d := defaults()
+	f := &File{
+		Server: ServerFile{Addr: d.Addr, LogLevel: d.LogLevel, ShutdownTimeout: d.ShutdownTimeout, RequestTimeout: d.RequestTimeout, ReadyMaxHeadLag: d.ReadyMaxHeadLag, GRPCAddr: d.GRPCAddr, QuotePollInterval: d.QuotePollInterval},
+		RPC: RPCFile{
+			DialTimeout:    d.RPCDialTimeout,
+			HealthInterval: d.RPCHealthInterval,
+			RateLimit:      RateLimitFile{MaxWait: d.RPCMaxWait},
+		},
+		Cache:   CacheFile{StaleQuoteMaxAge: d.StaleQuoteMaxAge, Responses: d.ResponseCacheEntries, HeadRefresh: d.ResponseCacheHeadRefresh},
+		Tracing: TracingFile{SampleRatio: d.TraceSampleRatio},
+		Limits: LimitsFile{
+			HistoryConcurrency:  d.HistoryConcurrency,
+			HistoryRPS:          d.HistoryReadsPerSec,
+			StreamSubscriptions: d.StreamMaxSubscriptions,
+
+			EstimateQueueTimeout: d.EstimateQueueTimeout,
+		},
+		Mempool: MempoolFile{Router: d.RouterAddress},
+		Indexer: IndexerFile{
+			ChunkSize:     d.IndexerChunkSize,
+			Confirmations: d.IndexerConfirmations,
+			PollInterval:  d.IndexerPollInterval,
+		},
+	}
+	for _, c := range d.Chains {
+		f.Chains = append(f.Chains, ChainFile{Name: c.Name})
+	}
+	return f
+}
+
+// config validates f and converts it to a Config. All invalid values are
+// reported together.
+func (f *File) config() (*Config, error) {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+
+	if f.Server.Addr == "" {
+		fail("server.addr", "must not be empty")
+	}
+	if !slices.Contains(logLevels, f.Server.LogLevel) {
+		fail("server.log_level", "must be one of %s", strings.Join(logLevels, ", "))
+	}
+	if f.Server.ShutdownTimeout <= 0 {
+		fail("server.shutdown_timeout", "must be positive")
+	}
+	if f.Server.RequestTimeout < 0 {
+		fail("server.request_timeout", "must not be negative")
+	}
+	if f.Server.ReadyMaxHeadLag < 0 {
+		fail("server.ready_max_head_lag", "must not be negative")
+	}
+	if f.Server.QuotePollInterval <= 0 {
+		fail("server.quote_poll_interval", "must be positive")
+	}
+	trustedProxies := make([]netip.Prefix, 0, len(f.Server.TrustedProxies))
+	for i, s := range f.Server.TrustedProxies {
+		p, err := parseProxy(s)
+		if err != nil {
+			fail(fmt.Sprintf("server.trusted_proxies[%d]", i), "must be an IP address or CIDR range, got %q", s)
+			continue
+		}
+		trustedProxies = append(trustedProxies, p)
+	}
+
+	if f.RPC.DialTimeout <= 0 {
+		fail("rpc.dial_timeout", "must be positive")
+	}
+	if f.RPC.HealthInterval <= 0 {
+		fail("rpc.health_interval", "must be positive")
+	}
+	if f.RPC.HedgeDelay < 0 {
+		fail("rpc.hedge_delay", "must not be negative")
+	}
+	if f.RPC.MaxAttempts < 0 {
+		fail("rpc.max_attempts", "must not be negative")
+	}
+	q := f.RPC.Quorum
+	if q.Size < 0 {
+		fail("rpc.quorum.size", "must not be negative")
+	}
+	if q.Threshold != 0 && (q.Threshold <= q.Size/2 || q.Threshold > q.Size) {
+		fail("rpc.quorum.threshold", "must be a majority of rpc.quorum.size (%d..%d)", q.Size/2+1, q.Size)
+	}
+	rl := f.RPC.RateLimit
+	if rl.UnitsPerSecond < 0 {
+		fail("rpc.rate_limit.units_per_second", "must not be negative")
+	}
+	if rl.Burst < 0 {
+		fail("rpc.rate_limit.burst", "must not be negative")
+	}
+	if rl.MaxWait < 0 {
+		fail("rpc.rate_limit.max_wait", "must not be negative")
+	}
+	for m, w := range rl.MethodWeights {
+		if w <= 0 {
+			fail("rpc.rate_limit.method_weights."+m, "must be positive")
+		}
+	}
+
+	if f.Cache.StaleQuoteMaxAge < 0 {
+		fail("cache.stale_quote_max_age", "must not be negative")
+	}
+	if f.Cache.Responses < 0 {
+		fail("cache.responses", "must not be negative")
+	}
+	if f.Cache.HeadRefresh <= 0 {
+		fail("cache.head_refresh", "must be positive")
+	}
+	if f.Tracing.OTLPEndpoint != "" {
+		if u, err := url.Parse(f.Tracing.OTLPEndpoint); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			fail("tracing.otlp_endpoint", "must be an http or https URL")
+		}
+	}
+	if f.Tracing.SampleRatio < 0 || f.Tracing.SampleRatio > 1 {
+		fail("tracing.sample_ratio", "must be between 0 and 1")
+	}
+	if f.Limits.HistoryConcurrency <= 0 {
+		fail("limits.history_concurrency", "must be positive")
+	}
+	if f.Limits.HistoryRPS < 0 {
+		fail("limits.history_rps", "must not be negative")
+	}
+	if f.Limits.StreamSubscriptions <= 0 {
+		fail("limits.stream_subscriptions", "must be positive")
+	}
+	if f.Limits.ClientRPS < 0 {
+		fail("limits.client_rps", "must not be negative")
+	}
+	if f.Limits.ClientBurst < 0 {
+		fail("limits.client_burst", "must not be negative")
+	}
+	if f.Limits.EstimateConcurrency < 0 {
+		fail("limits.estimate_concurrency", "must not be negative")
+	}
+	if f.Limits.EstimateQueue < 0 {
+		fail("limits.estimate_queue", "must not be negative")
+	}
+	if f.Limits.EstimateQueueTimeout < 0 {
+		fail("limits.estimate_queue_timeout", "must not be negative")
+	}
+
+	if f.Mempool.WSURL != "" {
+		if err := checkURL(f.Mempool.WSURL); err != nil {
+			fail("mempool.ws_url", "%v", err)
+		}
+	}
+	if err := checkAddress(f.Mempool.Router); err != nil {
+		fail("mempool.router", "%v", err)
+	}
+	for i, p := range f.Indexer.Pools {
+		if err := checkAddress(p); err != nil {
+			fail(fmt.Sprintf("indexer.pools[%d]", i), "%v", err)
+		}
+	}
+	if f.Indexer.ChunkSize == 0 {
+		fail("indexer.chunk_size", "must be positive")
+	}
+	if f.Indexer.PollInterval <= 0 {
+		fail("indexer.poll_interval", "must be positive")
+	}
+
+	chains := f.chains(fail)
+	// Quorum mode reads the endpoints of the default chain. A chain without
+	// rpc_urls takes them from the environment, which is checked later.
+	if len(chains) > 0 && len(chains[0].RPCEndpoints) > 0 && q.Size > len(chains[0].RPCEndpoints) {
+		i := slices.IndexFunc(f.Chains, func(cf ChainFile) bool { return cf.Name == chains[0].Name })
+		fail("rpc.quorum.size", "must not exceed the %d endpoints of the default chain at chains[%d].rpc_urls", len(chains[0].RPCEndpoints), i)
+	}
+	apiKeys := apiKeys("auth.keys", f.Auth.Keys, nil, fail)
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	threshold := q.Threshold
+	if threshold == 0 {
+		threshold = q.Size/2 + 1
+	}
+	return &Config{
+		Addr:               f.Server.Addr,
+		LogLevel:           f.Server.LogLevel,
+		ShutdownTimeout:    f.Server.ShutdownTimeout,
+		ReadyMaxHeadLag:    f.Server.ReadyMaxHeadLag,
+		RequestTimeout:     f.Server.RequestTimeout,
+		GRPCAddr:           f.Server.GRPCAddr,
+		QuotePollInterval:  f.Server.QuotePollInterval,
+		TrustedProxies:     trustedProxies,
+		MempoolRPCEndpoint: f.Mempool.WSURL,
+		RouterAddress:      f.Mempool.Router,
+		HistoryConcurrency: f.Limits.HistoryConcurrency,
+		HistoryReadsPerSec: f.Limits.HistoryRPS,
+
+		StreamMaxSubscriptions: f.Limits.StreamSubscriptions,
+
+		ClientRatePerSec:     f.Limits.ClientRPS,
+		ClientBurst:          f.Limits.ClientBurst,
+		EstimateConcurrency:  f.Limits.EstimateConcurrency,
+		EstimateQueue:        f.Limits.EstimateQueue,
+		EstimateQueueTimeout: f.Limits.EstimateQueueTimeout,
+
+		IndexerDBPath:        f.Indexer.DBPath,
+		IndexerPools:         f.Indexer.Pools,
+		IndexerStartBlock:    f.Indexer.StartBlock,
+		IndexerChunkSize:     f.Indexer.ChunkSize,
+		IndexerConfirmations: f.Indexer.Confirmations,
+		IndexerPollInterval:  f.Indexer.PollInterval,
+
+		RPCDialTimeout:    f.RPC.DialTimeout,
+		RPCHealthInterval: f.RPC.HealthInterval,
+		RPCHedgeDelay:     f.RPC.HedgeDelay,
+		RPCMaxAttempts:    f.RPC.MaxAttempts,
+
+		RPCQuorumSize:      q.Size,
+		RPCQuorumThreshold: threshold,
+
+		RPCUnitsPerSecond: rl.UnitsPerSecond,
+		RPCBurst:          rl.Burst,
+		RPCDailyBudget:    rl.DailyBudget,
+		RPCMaxWait:        rl.MaxWait,
+		RPCMethodWeights:  rl.MethodWeights,
+		StaleQuoteMaxAge:  f.Cache.StaleQuoteMaxAge,
+		OTLPEndpoint:      f.Tracing.OTLPEndpoint,
+		TraceSampleRatio:  f.Tracing.SampleRatio,
+
+		ResponseCacheEntries:     f.Cache.Responses,
+		ResponseCacheHeadRefresh: f.Cache.HeadRefresh,
+
+		APIKeys:     apiKeys,
+		APIKeysFile: f.Auth.KeysFile,
+
+		Chains: chains,
+	}, nil
+}
+
+// chains validates the chains section, filling omitted fields of built-in
+// chains from their presets. The default chain is moved first.
+func (f *File) chains(fail func(field, format string, args ...any)) []Chain {
+	if len(f.Chains) == 0 {
+		fail("chains", "must list at least one chain")
+		return nil
+	}
+
+	chains := make([]Chain, 0, len(f.Chains))
+	names := make(map[string]bool, len(f.Chains))
+	ids := make(map[uint64]bool, len(f.Chains))
+	for i, cf := range f.Chains {
+		field := fmt.Sprintf("chains[%d]", i)
+		if !chainNamePattern.MatchString(cf.Name) {
+			fail(field+".name", "must be lowercase letters, digits and dashes, got %q", cf.Name)
+			continue
+		}
+		if names[cf.Name] {
+			fail(field+".name", "duplicate chain %q", cf.Name)
+			continue
+		}
+		names[cf.Name] = true
+
+		c, preset := ChainPreset(cf.Name)
+		c.Name = cf.Name
+		if cf.ID != 0 {
+			c.ID = cf.ID
+		}
+		if c.ID == 0 {
+			fail(field+".id", "is required for chain %q, which has no preset", cf.Name)
+		} else if ids[c.ID] {
+			fail(field+".id", "duplicate chain id %d", c.ID)
+		}
+		ids[c.ID] = true
+
+		for j, u := range cf.RPCURLs {
+			if err := checkURL(u); err != nil {
+				fail(fmt.Sprintf("%s.rpc_urls[%d]", field, j), "%v", err)
+			}
+		}
+		c.RPCEndpoints = cf.RPCURLs
+
+		if cf.DefaultFeeBps != 0 {
+			c.DefaultFeeBps = cf.DefaultFeeBps
+		}
+		if c.DefaultFeeBps == 0 {
+			c.DefaultFeeBps = 30
+		}
+		if c.DefaultFeeBps >= maxFeeBps {
+			fail(field+".default_fee_bps", "must be below %d", maxFeeBps)
+		}
+
+		if cf.Factories != nil || !preset {
+			c.Factories = nil
+			for j, ff := range cf.Factories {
+				ffield := fmt.Sprintf("%s.factories[%d]", field, j)
+				if err := checkAddress(ff.Address); err != nil {
+					fail(ffield+".address", "%v", err)
+				}
+				if ff.InitCodeHash != "" && !isHash(ff.InitCodeHash) {
+					fail(ffield+".init_code_hash", "must be a 0x-prefixed 32-byte hex string")
+				}
+				if ff.FeeBps >= maxFeeBps {
+					fail(ffield+".fee_bps", "must be below %d", maxFeeBps)
+				}
+				if ff.FeeBps == 0 {
+					ff.FeeBps = c.DefaultFeeBps
+				}
+				c.Factories = append(c.Factories, Factory(ff))
+			}
+		}
+
+		if cf.BaseTokens != nil {
+			for j, t := range cf.BaseTokens {
+				if err := checkAddress(t); err != nil {
+					fail(fmt.Sprintf("%s.base_tokens[%d]", field, j), "%v", err)
+				}
+			}
+			c.BaseTokens = cf.BaseTokens
+		}
+
+		if cf.BlockTime < 0 {
+			fail(field+".block_time", "must not be negative")
+		} else if cf.BlockTime != 0 {
+			c.BlockTime = cf.BlockTime
+		}
+
+		for j, p := range cf.TokenLists {
+			if strings.TrimSpace(p) == "" {
+				fail(fmt.Sprintf("%s.token_lists[%d]", field, j), "must not be empty")
+			}
+		}
+		c.TokenLists = cf.TokenLists
+		chains = append(chains, c)
+	}
+
+	if f.DefaultChain != "" {
+		i := slices.IndexFunc(chains, func(c Chain) bool { return c.Name == f.DefaultChain })
+		if i < 0 {
+			fail("default_chain", "unknown chain %q", f.DefaultChain)
+			return chains
+		}
+		chains[0], chains[i] = chains[i], chains[0]
+	}
+	return chains
+}
+
+// checkAddress accepts a 0x-prefixed hex address. Mixed-case addresses must
+// carry a valid EIP-55 checksum.
+func checkAddress(s string) error {
+	if !strings.HasPrefix(s, "0x") || !common.IsHexAddress(s) {
+		return fmt.Errorf("invalid address %q", s)
+	}
+	hex := s[2:]
+	if hex != strings.ToLower(hex) && hex != strings.ToUpper(hex) && common.HexToAddress(s).Hex() != s {
+		return fmt.Errorf("bad checksum in address %q", s)
+	}
+	return nil
+}
+
+func isHash(s string) bool {
+	if len(s) != 66 || !strings.HasPrefix(s, "0x") {
+		return false
+	}
+	for _, r := range s[2:] {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkURL accepts http(s) and ws(s) URLs and IPC socket paths. The URL is
+// not quoted in errors since RPC URLs often embed API keys.
+func checkURL(s string) error {
+	if strings.HasPrefix(s, "/") {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid URL")
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+		return nil
+	default:
+		return fmt.Errorf("unsupported URL scheme %q", u.Scheme)
+	}
+}
@@ -0,0 +1,328 @@
+package config
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+const yamlConfig = `
+server:
+  addr: ":8080"
+  shutdown_timeout: 5s
+  trusted_proxies: ["10.0.0.0/8", "192.168.1.1"]
+rpc:
+  dial_timeout: 2s
+  hedge_delay: 300ms
+  rate_limit:
+    units_per_second: 300
+    method_weights:
+      eth_call: 30
+default_chain: bsc
+chains:
+  - name: ethereum
+    rpc_urls: ["https://eth.example"]
+  - name: bsc
+    rpc_urls: ["https://bsc.example"]
+    token_lists: ["lists/bsc.json"]
+  - name: my-fork
+    id: 31337
+    rpc_urls: ["http://localhost:8545"]
+    default_fee_bps: 25
+    block_time: 5s
+    factories:
+      - name: fork-v2
+        address: "0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"
+limits:
+  history_rps: 0
+  client_rps: 5
+  estimate_concurrency: 32
+`
+
+const tomlConfig = `
+default_chain = "bsc"
+
+[server]
+addr = ":8080"
+shutdown_timeout = "5s"
+trusted_proxies = ["10.0.0.0/8", "192.168.1.1"]
+
+[rpc]
+dial_timeout = "2s"
+hedge_delay = "300ms"
+
+[rpc.rate_limit]
+units_per_second = 300.0
+method_weights = { eth_call = 30 }
+
+[limits]
+history_rps = 0.0
+client_rps = 5.0
+estimate_concurrency = 32
+
+[[chains]]
+name = "ethereum"
+rpc_urls = ["https://eth.example"]
+
+[[chains]]
+name = "bsc"
+rpc_urls = ["https://bsc.example"]
+token_lists = ["lists/bsc.json"]
+
+[[chains]]
+name = "my-fork"
+id = 31337
+rpc_urls = ["http://localhost:8545"]
+default_fee_bps = 25
+block_time = "5s"
+
+[[chains.factories]]
+name = "fork-v2"
+address = "0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"
+`
+
+func TestLoad_Formats(t *testing.T) {
+	for name, content := range map[string]string{"config.yaml": yamlConfig, "config.toml": tomlConfig} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, name, content))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.Addr != ":8080" || cfg.ShutdownTimeout != 5*time.Second || cfg.RPCDialTimeout != 2*time.Second || cfg.RPCHedgeDelay != 300*time.Millisecond {
+				t.Fatalf("unexpected server/rpc settings: %+v", cfg)
+			}
+			if cfg.RPCUnitsPerSecond != 300 || cfg.RPCMethodWeights["eth_call"] != 30 {
+				t.Fatalf("unexpected rate limit: %v %v", cfg.RPCUnitsPerSecond, cfg.RPCMethodWeights)
+			}
+			// Omitted keys keep their defaults; explicit zeros are kept.
+			if cfg.LogLevel != "info" || cfg.StaleQuoteMaxAge != 30*time.Second || cfg.HistoryReadsPerSec != 0 ||
+				cfg.ResponseCacheEntries != 10000 || cfg.ResponseCacheHeadRefresh != time.Second {
+				t.Fatalf("unexpected defaults: %+v", cfg)
+			}
+			if fmt.Sprint(cfg.TrustedProxies) != "[10.0.0.0/8 192.168.1.1/32]" || cfg.ClientRatePerSec != 5 ||
+				cfg.EstimateConcurrency != 32 || cfg.EstimateQueueTimeout != time.Second {
+				t.Fatalf("unexpected traffic limits: %v %v %v %v", cfg.TrustedProxies, cfg.ClientRatePerSec, cfg.EstimateConcurrency, cfg.EstimateQueueTimeout)
+			}
+
+			if len(cfg.Chains) != 3 || cfg.Chains[0].Name != "bsc" || cfg.RPCEndpoint != "https://bsc.example" {
+				t.Fatalf("default chain not first: %+v", cfg.Chains)
+			}
+			bsc := cfg.Chains[0]
+			if bsc.ID != 56 || bsc.DefaultFeeBps != 25 || len(bsc.Factories) != 1 || bsc.BlockTime != 750*time.Millisecond {
+				t.Fatalf("bsc preset not applied: %+v", bsc)
+			}
+			if fmt.Sprint(bsc.TokenLists) != "[lists/bsc.json]" {
+				t.Fatalf("unexpected bsc token lists: %v", bsc.TokenLists)
+			}
+			fork := cfg.Chains[2]
+			if fork.ID != 31337 || len(fork.Factories) != 1 || fork.Factories[0].FeeBps != 25 || fork.BlockTime != 5*time.Second {
+				t.Fatalf("unexpected custom chain: %+v", fork)
+			}
+		})
+	}
+}
+
+func TestLoad_EnvOverridesFile(t *testing.T) {
+	t.Setenv("ADDR", ":9090")
+	t.Setenv("ETH_RPC_URL", "https://eth.env")
+	t.Setenv("BSC_RPC_URLS", "https://bsc-a.env,https://bsc-b.env")
+	t.Setenv("DEFAULT_CHAIN", "ethereum")
+	t.Setenv("RPC_RATE_LIMIT", "50")
+	t.Setenv("TRUSTED_PROXIES", "172.16.0.0/12, ::1")
+	t.Setenv("BSC_TOKEN_LISTS", "a.json, b.json")
+
+	cfg, err := Load(writeConfig(t, "config.yaml", yamlConfig))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Addr != ":9090" || cfg.RPCUnitsPerSecond != 50 || fmt.Sprint(cfg.TrustedProxies) != "[172.16.0.0/12 ::1/128]" {
+		t.Fatalf("env not applied: addr %q rate %v proxies %v", cfg.Addr, cfg.RPCUnitsPerSecond, cfg.TrustedProxies)
+	}
+	if cfg.Chains[0].Name != "ethereum" || cfg.RPCEndpoint != "https://eth.env" {
+		t.Fatalf("unexpected default chain: %+v", cfg.Chains[0])
+	}
+	for _, c := range cfg.Chains {
+		if c.Name == "bsc" && (strings.Join(c.RPCEndpoints, ",") != "https://bsc-a.env,https://bsc-b.env" ||
+			strings.Join(c.TokenLists, ",") != "a.json,b.json") {
+			t.Fatalf("unexpected bsc endpoints %v or token lists %v", c.RPCEndpoints, c.TokenLists)
+		}
+	}
+	// Values the environment does not set still come from the file.
+	if cfg.RPCHedgeDelay != 300*time.Millisecond {
+		t.Fatalf("file value lost: %v", cfg.RPCHedgeDelay)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	cases := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+	}{
+		{"unknown_yaml_key", "c.yaml", "server:\n  adr: \":1\"\n", []string{"field adr not found"}},
+		{"unknown_toml_key", "c.toml", "[server]\nadr = \":1\"\n", []string{"unknown keys: server.adr"}},
+		{"bad_duration", "c.yaml", "rpc:\n  dial_timeout: soon\n", []string{"line 2", "time.Duration"}},
+		{
+			"field_errors", "c.yaml", `
+server:
+  log_level: loud
+  trusted_proxies: ["10.0.0.0/33"]
+limits:
+  estimate_queue: -1
+cache:
+  responses: -1
+  head_refresh: 0s
+rpc:
+  quorum: {size: 3, threshold: 1}
+chains:
+  - name: Ethereum
+  - name: fork
+    rpc_urls: ["ftp://x"]
+    block_time: -1s
+    token_lists: ["lists/fork.json", " "]
+    factories:
+      - address: "0x5c69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f"
+        init_code_hash: "0x1234"
+`,
+			[]string{
+				"server.log_level: must be one of debug, info, warn, error",
+				`server.trusted_proxies[0]: must be an IP address or CIDR range, got "10.0.0.0/33"`,
+				"limits.estimate_queue: must not be negative",
+				"cache.responses: must not be negative",
+				"cache.head_refresh: must be positive",
+				"rpc.quorum.threshold: must be a majority of rpc.quorum.size (2..3)",
+				`chains[0].name: must be lowercase letters, digits and dashes, got "Ethereum"`,
+				`chains[1].id: is required for chain "fork", which has no preset`,
+				`chains[1].rpc_urls[0]: unsupported URL scheme "ftp"`,
+				"chains[1].block_time: must not be negative",
+				"chains[1].token_lists[1]: must not be empty",
+				"chains[1].factories[0].address: bad checksum",
+				"chains[1].factories[0].init_code_hash: must be a 0x-prefixed 32-byte hex string",
+			},
+		},
+		{"unknown_default_chain", "c.yaml", "default_chain: base\n", []string{`default_chain: unknown chain "base"`}},
+		{
+			"quorum_above_endpoints", "c.yaml",
+			"rpc:\n  quorum: {size: 3}\ndefault_chain: bsc\nchains:\n  - name: ethereum\n    rpc_urls: [\"https://a\", \"https://b\", \"https://c\"]\n  - name: bsc\n    rpc_urls: [\"https://a\", \"https://b\"]\n",
+			[]string{"rpc.quorum.size: must not exceed the 2 endpoints of the default chain at chains[1].rpc_urls"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Load(writeConfig(t, tc.file, tc.content))
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+
+	_, err := Load(writeConfig(t, "c.json", "{}"))
+	if !errors.Is(err, ErrUnsupportedConfigFormat) {
+		t.Fatalf("expected ErrUnsupportedConfigFormat, got %v", err)
+	}
+
+	var fe *FieldError
+	_, err = Load(writeConfig(t, "c.yaml", "limits:\n  history_concurrency: 0\n"))
+	if !errors.As(err, &fe) || fe.Field != "limits.history_concurrency" {
+		t.Fatalf("expected FieldError for limits.history_concurrency, got %v", err)
+	}
+}
+
+func TestLoad_APIKeys(t *testing.T) {
+	t.Setenv("ETH_RPC_URL", "https://eth.env")
+	keysPath := writeConfig(t, "keys.toml", `
+[[keys]]
+name = "partner-b"
+key_sha256 = "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+daily_quota = 1000
+`)
+	cfg, err := Load(writeConfig(t, "config.yaml", `
+auth:
+  keys_file: `+keysPath+`
+  keys:
+    - name: partner-a
+      key: 0123456789abcdef
+      rate: 10
+      burst: 20
+`))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(cfg.APIKeys) != 2 {
+		t.Fatalf("unexpected keys: %+v", cfg.APIKeys)
+	}
+	a, b := cfg.APIKeys[0], cfg.APIKeys[1]
+	if a.Name != "partner-a" || a.Hash != sha256.Sum256([]byte("0123456789abcdef")) || a.RatePerSec != 10 || a.Burst != 20 {
+		t.Fatalf("unexpected inline key: %+v", a)
+	}
+	// The digest is that of "secret".
+	if b.Name != "partner-b" || b.Hash != sha256.Sum256([]byte("secret")) || b.DailyQuota != 1000 {
+		t.Fatalf("unexpected file key: %+v", b)
+	}
+
+	// API_KEYS_FILE replaces the file named in the config.
+	dup := writeConfig(t, "keys.yaml", "keys:\n  - name: partner-a\n    key: fedcba9876543210\n")
+	t.Setenv("API_KEYS_FILE", dup)
+	_, err = Load(writeConfig(t, "config.yaml", "auth:\n  keys:\n    - name: partner-a\n      key: 0123456789abcdef\n"))
+	if err == nil || !strings.Contains(err.Error(), `keys[0].name: duplicate key name "partner-a"`) {
+		t.Fatalf("expected duplicate name error, got %v", err)
+	}
+}
+
+func TestLoad_InvalidAPIKeys(t *testing.T) {
+	_, err := Load(writeConfig(t, "config.yaml", `
+auth:
+  keys:
+    - name: "bad name"
+      key: short
+    - name: both
+      key: 0123456789abcdef
+      key_sha256: "00"
+    - name: hashed
+      key_sha256: "xyz"
+    - name: negative
+      key: 0123456789abcdef
+      rate: -1
+    - name: copy
+      key: 0123456789abcdef
+`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{
+		`auth.keys[0].name: must be letters, digits, dots, dashes and underscores, got "bad name"`,
+		"auth.keys[0].key: must be at least 16 characters",
+		"auth.keys[1]: must set exactly one of key and key_sha256",
+		"auth.keys[2].key_sha256: must be a 64-character hex SHA-256 digest",
+		"auth.keys[3].rate: must not be negative",
+		"auth.keys[4]: duplicate key",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("error %q does not contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "short") {
+		t.Fatalf("error leaks the key: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// minAPIKeyLength is the shortest accepted plaintext API key.
+const minAPIKeyLength = 16
+
+// keyNamePattern restricts key names, which label metrics.
+var keyNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// APIKey is an API key accepted by the service and its limits.
+type APIKey struct {
+	// Name identifies the key's owner in logs and metrics.
+	Name string
+	// Hash is the SHA-256 digest of the key.
+	Hash [sha256.Size]byte
+	// RatePerSec is the sustained request rate; zero disables rate limiting.
+	RatePerSec float64
+	// Burst is the token bucket size; zero means one second of requests.
+	Burst int
+	// DailyQuota caps the requests per UTC day; zero means unlimited.
+	DailyQuota uint64
+}
+
+// AuthFile configures API key authentication, which is enabled when any key
+// is listed here or in KeysFile.
+type AuthFile struct {
+	// KeysFile is a YAML or TOML file with a keys list of its own, so that
+	// secrets can live apart from the rest of the configuration.
+	KeysFile string       `yaml:"keys_file" toml:"keys_file"`
+	Keys     []APIKeyFile `yaml:"keys" toml:"keys"`
+}
+
+// APIKeyFile describes an API key. Exactly one of Key and KeySHA256 must be
+// set; KeySHA256 keeps the secret itself out of the file.
+type APIKeyFile struct {
+	Name      string `yaml:"name" toml:"name"`
+	Key       string `yaml:"key" toml:"key"`
+	KeySHA256 string `yaml:"key_sha256" toml:"key_sha256"`
+	// Rate is the sustained requests per second; zero disables the limit.
+	Rate  float64 `yaml:"rate" toml:"rate"`
+	Burst int     `yaml:"burst" toml:"burst"`
+	// DailyQuota is the requests per UTC day; zero means unlimited.
+	DailyQuota uint64 `yaml:"daily_quota" toml:"daily_quota"`
+}
+
+// keysFile is the schema of an API keys file.
+type keysFile struct {
+	Keys []APIKeyFile `yaml:"keys" toml:"keys"`
+}
+
+// loadAPIKeys reads the keys file at path and returns them after existing.
+// Names and keys must be unique across both.
+func loadAPIKeys(path string, existing []APIKey) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("api keys file: %w", err)
+	}
+	var f keysFile
+	if err := decodeStrict(filepath.Ext(path), data, &f); err != nil {
+		return nil, fmt.Errorf("api keys file %s: %w", path, err)
+	}
+
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, &FieldError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+	keys := apiKeys("keys", f.Keys, existing, fail)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("api keys file %s: %w", path, errors.Join(errs...))
+	}
+	return keys, nil
+}
+
+// apiKeys validates the keys listed under field and returns them after
+// existing, whose names and keys they must not repeat.
+func apiKeys(field string, files []APIKeyFile, existing []APIKey, fail func(field, format string, args ...any)) []APIKey {
+	keys := slices.Clone(existing)
+	names := make(map[string]bool, len(existing)+len(files))
+	hashes := make(map[[sha256.Size]byte]bool, len(existing)+len(files))
+	for _, k := range existing {
+		names[k.Name], hashes[k.Hash] = true, true
+	}
+
+	for i, kf := range files {
+		kfield := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case !keyNamePattern.MatchString(kf.Name):
+			fail(kfield+".name", "must be letters, digits, dots, dashes and underscores, got %q", kf.Name)
+		case names[kf.Name]:
+			fail(kfield+".name", "duplicate key name %q", kf.Name)
+		}
+		names[kf.Name] = true
+
+		var hash [sha256.Size]byte
+		switch {
+		case (kf.Key == "") == (kf.KeySHA256 == ""):
+			fail(kfield, "must set exactly one of key and key_sha256")
+			continue
+		case kf.Key != "":
+			// The key is not quoted in errors since it is a secret.
+			if len(kf.Key) < minAPIKeyLength || strings.TrimSpace(kf.Key) != kf.Key {
+				fail(kfield+".key", "must be at least %d characters without surrounding spaces", minAPIKeyLength)
+				continue
+			}
+			hash = sha256.Sum256([]byte(kf.Key))
+		default:
+			b, err := hex.DecodeString(kf.KeySHA256)
+			if err != nil || len(b) != sha256.Size {
+				fail(kfield+".key_sha256", "must be a 64-character hex SHA-256 digest")
+				continue
+			}
+			copy(hash[:], b)
+		}
+		if hashes[hash] {
+			fail(kfield, "duplicate key")
+		}
+		hashes[hash] = true
+
+		if kf.Rate < 0 {
+			fail(kfield+".rate", "must not be negative")
+		}
+		if kf.Burst < 0 {
+			fail(kfield+".burst", "must not be negative")
+		}
+		keys = append(keys, APIKey{
+			Name:       kf.Name,
+			Hash:       hash,
+			RatePerSec: kf.Rate,
+			Burst:      kf.Burst,
+			DailyQuota: kf.DailyQuota,
+		})
+	}
+	return keys
+}
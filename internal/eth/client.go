@@ -8,10 +8,19 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+// DefaultDialTimeout bounds the dialing process of Dial.
+const DefaultDialTimeout = 15 * time.Second
+
 // Dial connects to the Ethereum RPC endpoint at the given URL using the
-// provided context. A 15-second timeout is applied to the dialing process.
+// provided context. A DefaultDialTimeout timeout is applied to the dialing
+// process.
 func Dial(ctx context.Context, url string) (*ethclient.Client, error) {
-	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	return DialTimeout(ctx, url, DefaultDialTimeout)
+}
+
+// DialTimeout is like Dial with a custom timeout.
+func DialTimeout(ctx context.Context, url string, timeout time.Duration) (*ethclient.Client, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	return ethclient.DialContext(ctx, url)
@@ -0,0 +1,195 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is matched by every RateLimitError.
+var ErrRateLimited = errors.New("rpc rate limit exceeded")
+
+// RateLimitError is returned when a call would exceed the per-second rate or
+// the daily compute-unit budget of a Limiter.
+type RateLimitError struct {
+	Method string
+	// RetryAfter is when enough units are expected to be available again.
+	RetryAfter time.Duration
+	// Daily is set when the daily budget, not the rate, is exhausted.
+	Daily bool
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Daily {
+		return fmt.Sprintf("%s: daily rpc budget exhausted, retry after %s", e.Method, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("%s: rpc rate limit exceeded, retry after %s", e.Method, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+// DefaultMethodWeights are the compute-unit costs of RPC methods, modeled on
+// common provider pricing. Methods without a weight cost defaultMethodWeight.
+var DefaultMethodWeights = map[string]int{
+	"eth_blockNumber":      10,
+	"eth_getStorageAt":     17,
+	"eth_getBlockByNumber": 16,
+	"eth_getProof":         21,
+	"eth_call":             26,
+	"eth_getLogs":          75,
+}
+
+const defaultMethodWeight = 20
+
+// LimiterConfig configures a Limiter.
+type LimiterConfig struct {
+	// UnitsPerSecond is the sustained compute-unit rate. Zero disables rate
+	// limiting.
+	UnitsPerSecond float64
+	// Burst is the token bucket size. Defaults to one second of units.
+	Burst int
+	// DailyBudget caps the compute units spent per UTC day. Zero means
+	// unlimited.
+	DailyBudget uint64
+	// MaxWait is how long a call may wait for tokens before failing with a
+	// RateLimitError.
+	MaxWait time.Duration
+	// Weights overrides DefaultMethodWeights per method.
+	Weights map[string]int
+}
+
+// Limiter is a token bucket metering RPC calls in compute units with a daily
+// budget. A nil *Limiter allows every call.
+type Limiter struct {
+	cfg     LimiterConfig
+	weights map[string]int
+	bucket  *rate.Limiter
+	now     func() time.Time
+
+	mu   sync.Mutex
+	day  time.Time
+	used uint64
+}
+
+// NewLimiter builds a Limiter from cfg.
+func NewLimiter(cfg LimiterConfig) *Limiter {
+	weights := make(map[string]int, len(DefaultMethodWeights)+len(cfg.Weights))
+	for m, w := range DefaultMethodWeights {
+		weights[m] = w
+	}
+	for m, w := range cfg.Weights {
+		weights[m] = w
+	}
+
+	limit, burst := rate.Inf, 0
+	if cfg.UnitsPerSecond > 0 {
+		limit = rate.Limit(cfg.UnitsPerSecond)
+		burst = cfg.Burst
+		if burst <= 0 {
+			burst = max(int(cfg.UnitsPerSecond), 1)
+		}
+	}
+	return &Limiter{
+		cfg:     cfg,
+		weights: weights,
+		bucket:  rate.NewLimiter(limit, burst),
+		now:     time.Now,
+	}
+}
+
+// Cost returns the compute units charged for calls requests of method.
+func (l *Limiter) Cost(method string, calls int) uint64 {
+	w, ok := l.weights[method]
+	if !ok {
+		w = defaultMethodWeight
+	}
+	return uint64(w) * uint64(calls)
+}
+
+// Usage returns the compute units spent today and the daily budget.
+func (l *Limiter) Usage() (used, budget uint64) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(l.now())
+	return l.used, l.cfg.DailyBudget
+}
+
+// Acquire charges calls requests of method, waiting up to MaxWait for the
+// bucket to refill. It returns a *RateLimitError when the call must not be
+// sent. A call costing more than the bucket holds takes the whole bucket, so
+// it waits for a full bucket instead of being refused forever; the daily
+// budget is still charged its full cost.
+func (l *Limiter) Acquire(ctx context.Context, method string, calls int) error {
+	if l == nil {
+		return nil
+	}
+	cost := l.Cost(method, calls)
+	now := l.now()
+
+	if err := l.charge(method, cost, now); err != nil {
+		return err
+	}
+
+	tokens := int(cost)
+	if l.bucket.Limit() != rate.Inf {
+		tokens = min(tokens, l.bucket.Burst())
+	}
+	r := l.bucket.ReserveN(now, tokens)
+	if !r.OK() {
+		l.refund(cost)
+		return &RateLimitError{Method: method, RetryAfter: time.Second}
+	}
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return nil
+	}
+	if delay > l.cfg.MaxWait {
+		r.CancelAt(now)
+		l.refund(cost)
+		return &RateLimitError{Method: method, RetryAfter: delay}
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		r.Cancel()
+		l.refund(cost)
+		return ctx.Err()
+	}
+}
+
+// charge adds cost to today's usage unless that would exceed the budget.
+func (l *Limiter) charge(method string, cost uint64, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rollover(now)
+	if l.cfg.DailyBudget > 0 && l.used+cost > l.cfg.DailyBudget {
+		return &RateLimitError{Method: method, RetryAfter: l.day.AddDate(0, 0, 1).Sub(now), Daily: true}
+	}
+	l.used += cost
+	return nil
+}
+
+func (l *Limiter) refund(cost uint64) {
+	l.mu.Lock()
+	l.used -= min(cost, l.used)
+	l.mu.Unlock()
+}
+
+// rollover resets the usage at the start of a new UTC day. l.mu must be held.
+func (l *Limiter) rollover(now time.Time) {
+	day := now.UTC().Truncate(24 * time.Hour)
+	if !day.Equal(l.day) {
+		l.day, l.used = day, 0
+	}
+}
@@ -0,0 +1,123 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_CostUsesWeights(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(LimiterConfig{Weights: map[string]int{"eth_getStorageAt": 5}})
+	if got := l.Cost("eth_getStorageAt", 3); got != 15 {
+		t.Fatalf("override weight: got %d want 15", got)
+	}
+	if got := l.Cost("eth_getProof", 1); got != 21 {
+		t.Fatalf("default weight: got %d want 21", got)
+	}
+	if got := l.Cost("eth_unknown", 2); got != 2*defaultMethodWeight {
+		t.Fatalf("unknown method: got %d", got)
+	}
+}
+
+func TestLimiter_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	// 17 units per second with a bucket of two storage reads.
+	l := NewLimiter(LimiterConfig{UnitsPerSecond: 17, Burst: 34})
+	ctx := context.Background()
+	for i := range 2 {
+		if err := l.Acquire(ctx, "eth_getStorageAt", 1); err != nil {
+			t.Fatalf("acquire %d: %v", i, err)
+		}
+	}
+	err := l.Acquire(ctx, "eth_getStorageAt", 1)
+	var rl *RateLimitError
+	if !errors.As(err, &rl) || !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected RateLimitError, got %v", err)
+	}
+	if rl.Daily || rl.RetryAfter <= 0 || rl.RetryAfter > time.Second {
+		t.Fatalf("unexpected rate limit error: %+v", rl)
+	}
+	// Refused calls are not charged against the daily usage.
+	if used, _ := l.Usage(); used != 34 {
+		t.Fatalf("unexpected usage: %d", used)
+	}
+}
+
+func TestLimiter_CostAboveBurst(t *testing.T) {
+	t.Parallel()
+
+	// A bucket of one storage read cannot hold an eth_getLogs call, which
+	// takes the whole bucket instead of being refused.
+	l := NewLimiter(LimiterConfig{UnitsPerSecond: 17})
+	ctx := context.Background()
+	if err := l.Acquire(ctx, "eth_getLogs", 1); err != nil {
+		t.Fatalf("acquire above burst: %v", err)
+	}
+	err := l.Acquire(ctx, "eth_getStorageAt", 1)
+	var rl *RateLimitError
+	if !errors.As(err, &rl) || rl.RetryAfter <= 0 || rl.RetryAfter > time.Second {
+		t.Fatalf("expected RateLimitError until the bucket refills, got %v", err)
+	}
+	// The daily usage is charged the full cost.
+	if used, _ := l.Usage(); used != 75 {
+		t.Fatalf("unexpected usage: %d", used)
+	}
+}
+
+func TestLimiter_DailyBudget(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 5, 1, 23, 0, 0, 0, time.UTC)
+	l := NewLimiter(LimiterConfig{DailyBudget: 30})
+	l.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if err := l.Acquire(ctx, "eth_getStorageAt", 1); err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+	err := l.Acquire(ctx, "eth_getStorageAt", 1)
+	var rl *RateLimitError
+	if !errors.As(err, &rl) || !rl.Daily || rl.RetryAfter != time.Hour {
+		t.Fatalf("expected daily budget error retrying in 1h, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	if err := l.Acquire(ctx, "eth_getStorageAt", 1); err != nil {
+		t.Fatalf("acquire after rollover: %v", err)
+	}
+	if used, budget := l.Usage(); used != 17 || budget != 30 {
+		t.Fatalf("unexpected usage: %d/%d", used, budget)
+	}
+}
+
+func TestLimiter_NilAllowsAll(t *testing.T) {
+	t.Parallel()
+
+	var l *Limiter
+	if err := l.Acquire(context.Background(), "eth_getLogs", 1000); err != nil {
+		t.Fatalf("nil limiter refused call: %v", err)
+	}
+}
+
+func TestPool_ChargesLimiterPerAttempt(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(LimiterConfig{DailyBudget: 3 * 17})
+	p := newTestPool(t, PoolConfig{Limiter: l}, &fakeEth{fail: true}, &fakeEth{})
+
+	// The failed attempt and its retry are both charged.
+	if got := readServer(t, p); got != 2 {
+		t.Fatalf("expected answer from second endpoint, got %d", got)
+	}
+	if used, _ := l.Usage(); used != 34 {
+		t.Fatalf("unexpected usage after retry: %d", used)
+	}
+
+	if _, err := p.BatchStorageAt(context.Background(), []StorageRequest{{Account: testAccount, Key: testSlot}, {Account: testAccount, Key: testSlot}}, nil); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited for batch over budget, got %v", err)
+	}
+}
@@ -0,0 +1,16 @@
+package eth
+
+import (
+	"context"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+// SubscribePendingTransactions subscribes to full pending transactions using
+// the eth_subscribe "newPendingTransactions" stream with full transaction
+// bodies. The endpoint must support subscriptions (WebSocket or IPC).
+func SubscribePendingTransactions(ctx context.Context, ec *ethclient.Client, ch chan<- *types.Transaction) (ethereum.Subscription, error) {
+	return ec.Client().EthSubscribe(ctx, ch, "newPendingTransactions", true)
+}
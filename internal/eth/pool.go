@@ -0,0 +1,467 @@
+package eth
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrNoEndpoints is returned when a Pool is built without any endpoint.
+var ErrNoEndpoints = errors.New("rpc pool: no endpoints")
+
+const (
+	// unhealthyAfter is the number of consecutive failures after which an
+	// endpoint is only tried once every healthier endpoint has failed.
+	unhealthyAfter = 3
+	// failurePenalty and lagPenalty convert failures and blocks behind the
+	// best known head into latency so endpoints can be ranked on one scale.
+	failurePenalty = 250 * time.Millisecond
+	lagPenalty     = 500 * time.Millisecond
+	// latencyWeight is the weight of a new sample in the latency average.
+	latencyWeight = 0.2
+)
+
+// PoolConfig configures a Pool.
+type PoolConfig struct {
+	// HealthInterval is the delay between active health checks. Defaults to
+	// 10 seconds.
+	HealthInterval time.Duration
+	// HedgeDelay, when positive, sends a duplicate request to the next
+	// endpoint if the current one has not answered within the delay. The
+	// first successful response wins.
+	HedgeDelay time.Duration
+	// MaxAttempts bounds the endpoints tried per request. Zero means all.
+	MaxAttempts int
+	// Limiter, if set, meters every request sent to an endpoint, including
+	// retries and hedged duplicates.
+	Limiter *Limiter
+	// DialTimeout bounds dialing each endpoint in DialPool. Defaults to
+	// DefaultDialTimeout.
+	DialTimeout time.Duration
+	// Chain names the pool's chain in metrics.
+	Chain string
+}
+
+// Endpoint is a named RPC client managed by a Pool.
+type Endpoint struct {
+	Name   string
+	Client *ethclient.Client
+}
+
+// EndpointStatus is a snapshot of the health of a pool endpoint.
+type EndpointStatus struct {
+	Name     string
+	Healthy  bool
+	Latency  time.Duration
+	Block    uint64
+	Failures int
+}
+
+// endpoint tracks the health of a single RPC client. Latency is an
+// exponentially weighted moving average of successful calls.
+type endpoint struct {
+	Endpoint
+
+	mu       sync.Mutex
+	latency  time.Duration
+	failures int
+	block    uint64
+}
+
+func (e *endpoint) observe(d time.Duration, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err != nil {
+		e.failures++
+		return
+	}
+	e.failures = 0
+	if e.latency == 0 {
+		e.latency = d
+		return
+	}
+	e.latency = time.Duration(latencyWeight*float64(d) + (1-latencyWeight)*float64(e.latency))
+}
+
+func (e *endpoint) setBlock(block uint64) {
+	e.mu.Lock()
+	e.block = block
+	e.mu.Unlock()
+}
+
+func (e *endpoint) status() EndpointStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return EndpointStatus{
+		Name:     e.Name,
+		Healthy:  e.failures < unhealthyAfter,
+		Latency:  e.latency,
+		Block:    e.block,
+		Failures: e.failures,
+	}
+}
+
+// score ranks an endpoint; lower is better.
+func (s EndpointStatus) score(head uint64) time.Duration {
+	score := s.Latency + time.Duration(s.Failures)*failurePenalty
+	if !s.Healthy {
+		score += time.Hour
+	}
+	if s.Block > 0 && head > s.Block {
+		score += time.Duration(head-s.Block) * lagPenalty
+	}
+	return score
+}
+
+// Pool is a StateReader spreading reads over several RPC endpoints. Reads go
+// to the healthiest endpoint and are retried on the next one when they fail.
+// Health is scored from call latency, consecutive failures and how far an
+// endpoint lags behind the best known head, refreshed passively on every call
+// and actively by Run.
+type Pool struct {
+	logger    *slog.Logger
+	endpoints []*endpoint
+	cfg       PoolConfig
+}
+
+var (
+	_ StateReader   = (*Pool)(nil)
+	_ SyncReader    = (*Pool)(nil)
+	_ CallReader    = (*Pool)(nil)
+	_ LogReader     = (*Pool)(nil)
+	_ MeteredReader = (*Pool)(nil)
+)
+
+// NewPool builds a Pool over the given endpoints, which are preferred in
+// order until health information is available.
+func NewPool(logger *slog.Logger, endpoints []Endpoint, cfg PoolConfig) (*Pool, error) {
+	if len(endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+	if cfg.HealthInterval <= 0 {
+		cfg.HealthInterval = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 || cfg.MaxAttempts > len(endpoints) {
+		cfg.MaxAttempts = len(endpoints)
+	}
+	p := &Pool{logger: logger, cfg: cfg}
+	for _, ep := range endpoints {
+		p.endpoints = append(p.endpoints, &endpoint{Endpoint: ep})
+	}
+	return p, nil
+}
+
+// DialPool dials every URL and builds a Pool from the endpoints that could be
+// reached. It fails only if none could.
+func DialPool(ctx context.Context, logger *slog.Logger, urls []string, cfg PoolConfig) (*Pool, error) {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultDialTimeout
+	}
+	var endpoints []Endpoint
+	for _, u := range urls {
+		name := endpointName(u)
+		client, err := DialTimeout(ctx, u, cfg.DialTimeout)
+		if err != nil {
+			logger.Warn("rpc endpoint unavailable", "endpoint", name, "err", err)
+			continue
+		}
+		endpoints = append(endpoints, Endpoint{Name: name, Client: client})
+	}
+	return NewPool(logger, endpoints, cfg)
+}
+
+// endpointName strips the path and credentials from an RPC URL, which often
+// embed API keys, so it can be logged.
+func endpointName(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return "endpoint"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Unmetered implements MeteredReader. The returned Pool shares the endpoints
+// and their health with p but does not charge the Limiter.
+func (p *Pool) Unmetered() StateReader {
+	u := *p
+	u.cfg.Limiter = nil
+	return &u
+}
+
+// Close closes every endpoint client.
+func (p *Pool) Close() {
+	for _, ep := range p.endpoints {
+		ep.Client.Close()
+	}
+}
+
+// Status returns the health of every endpoint in configuration order.
+func (p *Pool) Status() []EndpointStatus {
+	out := make([]EndpointStatus, len(p.endpoints))
+	for i, ep := range p.endpoints {
+		out[i] = ep.status()
+	}
+	return out
+}
+
+// Run health-checks all endpoints every HealthInterval until ctx is canceled.
+func (p *Pool) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.cfg.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		p.CheckHealth(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckHealth queries the head block of every endpoint concurrently and
+// updates their health.
+func (p *Pool) CheckHealth(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.HealthInterval)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, ep := range p.endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			block, err := ep.Client.BlockNumber(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			ep.observe(time.Since(start), err)
+			if err != nil {
+				p.logger.Warn("rpc health check failed", "endpoint", ep.Name, "err", err)
+				return
+			}
+			ep.setBlock(block)
+			metrics.SetHeadBlock(p.cfg.Chain, ep.Name, block)
+		}()
+	}
+	wg.Wait()
+}
+
+// ranked returns the endpoints from healthiest to least healthy. Ties keep
+// configuration order.
+func (p *Pool) ranked() []*endpoint {
+	statuses := make(map[*endpoint]EndpointStatus, len(p.endpoints))
+	var head uint64
+	for _, ep := range p.endpoints {
+		s := ep.status()
+		statuses[ep] = s
+		head = max(head, s.Block)
+	}
+	ranked := slices.Clone(p.endpoints)
+	slices.SortStableFunc(ranked, func(a, b *endpoint) int {
+		return cmp.Compare(statuses[a].score(head), statuses[b].score(head))
+	})
+	return ranked
+}
+
+// BlockNumber implements StateReader.
+func (p *Pool) BlockNumber(ctx context.Context) (uint64, error) {
+	return poolCall(ctx, p, "eth_blockNumber", 1, func(ctx context.Context, c *ethclient.Client) (uint64, error) {
+		return c.BlockNumber(ctx)
+	})
+}
+
+// StorageAt implements StateReader.
+func (p *Pool) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	return poolCall(ctx, p, "eth_getStorageAt", 1, func(ctx context.Context, c *ethclient.Client) ([]byte, error) {
+		return c.StorageAt(ctx, account, key, blockNumber)
+	})
+}
+
+// BatchStorageAt implements StateReader. The whole batch is retried on the
+// next endpoint if any element fails.
+func (p *Pool) BatchStorageAt(ctx context.Context, reqs []StorageRequest, blockNumber *big.Int) ([][]byte, error) {
+	return poolCall(ctx, p, "eth_getStorageAt", len(reqs), func(ctx context.Context, c *ethclient.Client) ([][]byte, error) {
+		return NewClientReader(c).BatchStorageAt(ctx, reqs, blockNumber)
+	})
+}
+
+// HeaderByNumber implements StateReader.
+func (p *Pool) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return poolCall(ctx, p, "eth_getBlockByNumber", 1, func(ctx context.Context, c *ethclient.Client) (*types.Header, error) {
+		return c.HeaderByNumber(ctx, number)
+	})
+}
+
+// SyncProgress implements SyncReader.
+func (p *Pool) SyncProgress(ctx context.Context) (*ethereum.SyncProgress, error) {
+	return poolCall(ctx, p, "eth_syncing", 1, func(ctx context.Context, c *ethclient.Client) (*ethereum.SyncProgress, error) {
+		return c.SyncProgress(ctx)
+	})
+}
+
+// FilterLogs implements LogReader.
+func (p *Pool) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return poolCall(ctx, p, "eth_getLogs", 1, func(ctx context.Context, c *ethclient.Client) ([]types.Log, error) {
+		return c.FilterLogs(ctx, q)
+	})
+}
+
+// CallContract implements CallReader. A reverted call is an answer, not an
+// endpoint failure, so it is neither retried nor held against the endpoint.
+func (p *Pool) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	type result struct {
+		out    []byte
+		revert error
+	}
+	r, err := poolCall(ctx, p, "eth_call", 1, func(ctx context.Context, c *ethclient.Client) (result, error) {
+		out, err := NewClientReader(c).CallContract(ctx, msg, blockNumber)
+		if errors.Is(err, ErrExecutionReverted) {
+			return result{revert: err}, nil
+		}
+		return result{out: out}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.out, r.revert
+}
+
+// startSpan starts the client span of one RPC attempt to endpoint.
+func (p *Pool) startSpan(ctx context.Context, method, endpoint string, calls int) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+			attribute.String("server.address", endpoint),
+			attribute.String("chain", p.cfg.Chain),
+			attribute.Int("rpc.calls", calls),
+		))
+}
+
+// acquire charges calls requests of method on the Limiter, counting refusals.
+func (p *Pool) acquire(ctx context.Context, method string, calls int) error {
+	err := p.cfg.Limiter.Acquire(ctx, method, calls)
+	if errors.Is(err, ErrRateLimited) {
+		metrics.RPCRateLimited(p.cfg.Chain, method)
+	}
+	return err
+}
+
+// poolCall runs fn against the ranked endpoints until one succeeds or
+// MaxAttempts endpoints have failed. With hedging enabled, the next endpoint
+// is also tried whenever the in-flight attempts are slower than HedgeDelay.
+// Every attempt is charged calls requests of method on the Limiter; once it
+// refuses, no further attempts are started.
+func poolCall[T any](ctx context.Context, p *Pool, method string, calls int, fn func(context.Context, *ethclient.Client) (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+		ep    *endpoint
+	}
+
+	ranked := p.ranked()[:p.cfg.MaxAttempts]
+	callCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan result, len(ranked))
+	next, inflight := 0, 0
+	launch := func() {
+		ep := ranked[next]
+		next++
+		inflight++
+		go func() {
+			ctx, span := p.startSpan(callCtx, method, ep.Name, calls)
+			start := time.Now()
+			v, err := fn(ctx, ep.Client)
+			// Attempts abandoned because another one won are not failures.
+			abandoned := callCtx.Err() != nil
+			if !abandoned {
+				ep.observe(time.Since(start), err)
+			}
+			metrics.ObserveRPC(p.cfg.Chain, method, ep.Name, time.Since(start), err, abandoned)
+			span.SetAttributes(attribute.Bool("rpc.abandoned", abandoned))
+			tracing.End(span, err)
+			results <- result{value: v, err: err, ep: ep}
+		}()
+	}
+
+	var hedge *time.Timer
+	var hedgeC <-chan time.Time
+	armHedge := func() {
+		if p.cfg.HedgeDelay <= 0 || next >= len(ranked) {
+			hedgeC = nil
+			return
+		}
+		if hedge == nil {
+			hedge = time.NewTimer(p.cfg.HedgeDelay)
+		} else {
+			hedge.Reset(p.cfg.HedgeDelay)
+		}
+		hedgeC = hedge.C
+	}
+	defer func() {
+		if hedge != nil {
+			hedge.Stop()
+		}
+	}()
+
+	var zero T
+	if err := p.acquire(ctx, method, calls); err != nil {
+		return zero, err
+	}
+	launch()
+	armHedge()
+
+	var errs []error
+	for inflight > 0 {
+		select {
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				return r.value, nil
+			}
+			if ctx.Err() != nil {
+				return zero, ctx.Err()
+			}
+			p.logger.Warn("rpc call failed", "method", method, "endpoint", r.ep.Name, "err", r.err)
+			errs = append(errs, fmt.Errorf("%s: %w", r.ep.Name, r.err))
+			if next < len(ranked) {
+				if err := p.acquire(ctx, method, calls); err != nil {
+					errs = append(errs, err)
+					next = len(ranked)
+					continue
+				}
+				launch()
+				armHedge()
+			}
+		case <-hedgeC:
+			if err := p.acquire(ctx, method, calls); err != nil {
+				p.logger.Debug("rpc call not hedged", "method", method, "err", err)
+				hedgeC = nil
+				continue
+			}
+			p.logger.Debug("hedging slow rpc call", "method", method, "endpoint", ranked[next].Name)
+			launch()
+			armHedge()
+		}
+	}
+	return zero, fmt.Errorf("%s failed on %d endpoints: %w", method, len(errs), errors.Join(errs...))
+}
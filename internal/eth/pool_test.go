@@ -0,0 +1,171 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+var (
+	testAccount = common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	testSlot    = common.BigToHash(big.NewInt(8))
+)
+
+// newTestPool starts one in-process RPC server per fake, each holding a value
+// in testSlot that identifies it.
+func newTestPool(t *testing.T, cfg PoolConfig, fakes ...*fakeEth) *Pool {
+	t.Helper()
+	endpoints := make([]Endpoint, len(fakes))
+	for i, fe := range fakes {
+		if fe.storage == nil {
+			fe.storage = map[common.Hash][]byte{testSlot: common.LeftPadBytes([]byte{byte(i + 1)}, 32)}
+		}
+		endpoints[i] = Endpoint{Name: string(rune('a' + i)), Client: newInprocReader(t, fe).client}
+	}
+	p, err := NewPool(slog.New(slog.NewTextHandler(io.Discard, nil)), endpoints, cfg)
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	return p
+}
+
+func readServer(t *testing.T, p *Pool) byte {
+	t.Helper()
+	v, err := p.StorageAt(context.Background(), testAccount, testSlot, nil)
+	if err != nil {
+		t.Fatalf("StorageAt: %v", err)
+	}
+	return v[31]
+}
+
+func TestPool_FailsOverToNextEndpoint(t *testing.T) {
+	t.Parallel()
+
+	a, b := &fakeEth{fail: true}, &fakeEth{}
+	p := newTestPool(t, PoolConfig{}, a, b)
+
+	if got := readServer(t, p); got != 2 {
+		t.Fatalf("expected answer from second endpoint, got %d", got)
+	}
+	if st := p.Status(); st[0].Failures != 1 || st[1].Failures != 0 {
+		t.Fatalf("unexpected failure counts: %+v", st)
+	}
+
+	// The failed endpoint now ranks last and is not tried first.
+	if got := readServer(t, p); got != 2 {
+		t.Fatalf("expected answer from second endpoint, got %d", got)
+	}
+	if a.calls != 1 {
+		t.Fatalf("failed endpoint retried first: %d calls", a.calls)
+	}
+
+	// Batched reads fail over as a whole.
+	vals, err := p.BatchStorageAt(context.Background(), []StorageRequest{{Account: testAccount, Key: testSlot}}, big.NewInt(1))
+	if err != nil || vals[0][31] != 2 {
+		t.Fatalf("BatchStorageAt: %x, %v", vals, err)
+	}
+}
+
+func TestPool_Unmetered(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(LimiterConfig{DailyBudget: 10})
+	p := newTestPool(t, PoolConfig{Limiter: l}, &fakeEth{blockNumber: 7})
+
+	for range 3 {
+		if n, err := p.Unmetered().BlockNumber(context.Background()); err != nil || n != 7 {
+			t.Fatalf("BlockNumber = %d, %v", n, err)
+		}
+	}
+	if used, _ := l.Usage(); used != 0 {
+		t.Fatalf("unmetered reads charged %d units", used)
+	}
+	if _, err := p.BlockNumber(context.Background()); err != nil {
+		t.Fatalf("BlockNumber: %v", err)
+	}
+	if used, _ := l.Usage(); used != 10 {
+		t.Fatalf("metered read charged %d units, want 10", used)
+	}
+}
+
+func TestPool_AllEndpointsFail(t *testing.T) {
+	t.Parallel()
+
+	p := newTestPool(t, PoolConfig{}, &fakeEth{fail: true}, &fakeEth{fail: true})
+	if _, err := p.StorageAt(context.Background(), testAccount, testSlot, nil); err == nil {
+		t.Fatalf("expected error when every endpoint fails")
+	}
+}
+
+func TestPool_CallRevertIsAnAnswer(t *testing.T) {
+	t.Parallel()
+
+	a, b, c := &fakeEth{fail: true}, &fakeEth{}, &fakeEth{}
+	p := newTestPool(t, PoolConfig{}, a, b, c)
+
+	msg := ethereum.CallMsg{To: &testAccount}
+	if _, err := p.CallContract(context.Background(), msg, nil); !errors.Is(err, ErrExecutionReverted) {
+		t.Fatalf("expected ErrExecutionReverted, got %v", err)
+	}
+	// The revert of the second endpoint is not retried on the third nor
+	// counted as a failure.
+	if st := p.Status(); st[0].Failures != 1 || st[1].Failures != 0 || c.calls != 0 {
+		t.Fatalf("unexpected failures %+v, %d calls to the third endpoint", st, c.calls)
+	}
+}
+
+func TestPool_HealthCheckPrefersSyncedEndpoint(t *testing.T) {
+	t.Parallel()
+
+	lagging, synced := &fakeEth{blockNumber: 90}, &fakeEth{blockNumber: 100}
+	p := newTestPool(t, PoolConfig{}, lagging, synced)
+	p.CheckHealth(context.Background())
+
+	st := p.Status()
+	if st[0].Block != 90 || st[1].Block != 100 || !st[0].Healthy || !st[1].Healthy {
+		t.Fatalf("unexpected status: %+v", st)
+	}
+	if got := readServer(t, p); got != 2 {
+		t.Fatalf("expected synced endpoint to be preferred, got %d", got)
+	}
+
+	// Repeated failed checks mark an endpoint unhealthy.
+	synced.mu.Lock()
+	synced.fail = true
+	synced.mu.Unlock()
+	for range unhealthyAfter {
+		p.CheckHealth(context.Background())
+	}
+	if st := p.Status(); st[1].Healthy {
+		t.Fatalf("expected failing endpoint to be unhealthy: %+v", st)
+	}
+	if got := readServer(t, p); got != 1 {
+		t.Fatalf("expected lagging but healthy endpoint, got %d", got)
+	}
+}
+
+func TestPool_HedgesSlowRequests(t *testing.T) {
+	t.Parallel()
+
+	slow, fast := &fakeEth{delay: 2 * time.Second}, &fakeEth{}
+	p := newTestPool(t, PoolConfig{HedgeDelay: 20 * time.Millisecond}, slow, fast)
+
+	start := time.Now()
+	if got := readServer(t, p); got != 2 {
+		t.Fatalf("expected hedged answer from second endpoint, got %d", got)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("hedged request took %s", d)
+	}
+	// The abandoned attempt is not counted as a failure.
+	if st := p.Status(); st[0].Failures != 0 {
+		t.Fatalf("abandoned attempt counted as failure: %+v", st)
+	}
+}
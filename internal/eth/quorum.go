@@ -0,0 +1,156 @@
+package eth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
+)
+
+// ErrInvalidQuorum is returned by NewQuorum when the threshold is not a
+// majority of the quorum size or the size exceeds the pool.
+var ErrInvalidQuorum = errors.New("quorum threshold must be a majority of at most the pool size")
+
+// ErrQuorumNotReached is returned when fewer endpoints than the threshold
+// returned identical values.
+var ErrQuorumNotReached = errors.New("rpc endpoints did not reach quorum")
+
+// Quorum reads the same storage slots at the same block hash from several
+// pool endpoints and only returns values a majority agrees on. It guards
+// against lagging or forked nodes serving stale state.
+type Quorum struct {
+	logger    *slog.Logger
+	pool      *Pool
+	size      int
+	threshold int
+}
+
+// NewQuorum builds a Quorum asking the size healthiest endpoints of pool and
+// requiring threshold identical answers, which must be more than half of size.
+func NewQuorum(logger *slog.Logger, pool *Pool, size, threshold int) (*Quorum, error) {
+	if size < 1 || size > len(pool.endpoints) || threshold <= size/2 || threshold > size {
+		return nil, ErrInvalidQuorum
+	}
+	return &Quorum{
+		logger:    logger,
+		pool:      pool,
+		size:      size,
+		threshold: threshold,
+	}, nil
+}
+
+// BatchStorageAt resolves blockNumber to a block hash on the healthiest
+// endpoint and reads reqs at that hash from the quorum endpoints. It returns
+// the values at least threshold endpoints agree on, or an error wrapping
+// ErrQuorumNotReached.
+func (q *Quorum) BatchStorageAt(ctx context.Context, reqs []StorageRequest, blockNumber *big.Int) ([][]byte, error) {
+	header, err := q.pool.HeaderByNumber(ctx, blockNumber)
+	if err != nil {
+		return nil, fmt.Errorf("resolve block hash: %w", err)
+	}
+	blockHash := header.Hash()
+
+	type vote struct {
+		ep     *endpoint
+		values [][]byte
+		err    error
+	}
+	endpoints := q.pool.ranked()[:q.size]
+	if err := q.pool.acquire(ctx, "eth_getStorageAt", len(reqs)*len(endpoints)); err != nil {
+		return nil, err
+	}
+	votes := make([]vote, len(endpoints))
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, span := q.pool.startSpan(ctx, "eth_getStorageAt", ep.Name, len(reqs))
+			start := time.Now()
+			values, err := NewClientReader(ep.Client).BatchStorageAtHash(ctx, reqs, blockHash)
+			canceled := ctx.Err() != nil
+			if !canceled {
+				ep.observe(time.Since(start), err)
+			}
+			metrics.ObserveRPC(q.pool.cfg.Chain, "eth_getStorageAt", ep.Name, time.Since(start), err, canceled)
+			tracing.End(span, err)
+			votes[i] = vote{ep: ep, values: values, err: err}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Group identical answers; the largest group is the candidate result.
+	var groups [][]int
+	for i, v := range votes {
+		if v.err != nil {
+			continue
+		}
+		placed := false
+		for g, members := range groups {
+			if equalValues(votes[members[0]].values, v.values) {
+				groups[g] = append(members, i)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			groups = append(groups, []int{i})
+		}
+	}
+	var best []int
+	for _, members := range groups {
+		if len(members) > len(best) {
+			best = members
+		}
+	}
+
+	reached := len(best) >= q.threshold
+	for i, v := range votes {
+		agreed := slices.Contains(best, i)
+		if !agreed {
+			q.logger.Warn("rpc endpoint diverged from quorum",
+				"endpoint", v.ep.Name, "block", blockNumber, "hash", blockHash.Hex(), "err", v.err)
+		}
+		q.record(v.ep.Name, agreed, reached)
+	}
+	if !reached {
+		return nil, fmt.Errorf("%w: %d of %d agree at %s, need %d", ErrQuorumNotReached,
+			len(best), q.size, blockHash.Hex(), q.threshold)
+	}
+	return votes[best[0]].values, nil
+}
+
+// record counts the vote of endpoint in a read that reached quorum or not.
+func (q *Quorum) record(endpoint string, agreed, reached bool) {
+	result := metrics.QuorumAgreed
+	switch {
+	case !reached:
+		result = metrics.QuorumNotReached
+	case !agreed:
+		result = metrics.QuorumDiverged
+	}
+	metrics.QuorumVote(q.pool.cfg.Chain, endpoint, result)
+}
+
+func equalValues(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
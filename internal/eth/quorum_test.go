@@ -0,0 +1,115 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+)
+
+// quorumVotes returns the quorum vote counters of chain, one line per
+// endpoint and result, as scraped from the metrics handler.
+func quorumVotes(t *testing.T, chain string) []string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	var lines []string
+	for line := range strings.Lines(rec.Body.String()) {
+		if strings.HasPrefix(line, `uniswap_estimator_rpc_quorum_votes_total{chain="`+chain+`"`) {
+			lines = append(lines, strings.TrimSpace(line))
+		}
+	}
+	return lines
+}
+
+func TestQuorum_MajorityWins(t *testing.T) {
+	t.Parallel()
+
+	agreed := map[common.Hash][]byte{testSlot: common.LeftPadBytes([]byte{7}, 32)}
+	stale := map[common.Hash][]byte{testSlot: common.LeftPadBytes([]byte{6}, 32)}
+	a, b, c := &fakeEth{blockNumber: 100, storage: agreed}, &fakeEth{blockNumber: 100, storage: stale}, &fakeEth{blockNumber: 100, storage: agreed}
+	p := newTestPool(t, PoolConfig{Chain: "majority"}, a, b, c)
+
+	q, err := NewQuorum(slog.New(slog.NewTextHandler(io.Discard, nil)), p, 3, 2)
+	if err != nil {
+		t.Fatalf("NewQuorum: %v", err)
+	}
+	vals, err := q.BatchStorageAt(context.Background(), []StorageRequest{{Account: testAccount, Key: testSlot}}, big.NewInt(100))
+	if err != nil {
+		t.Fatalf("BatchStorageAt: %v", err)
+	}
+	if vals[0][31] != 7 {
+		t.Fatalf("expected majority value 7, got %d", vals[0][31])
+	}
+
+	// Every endpoint was asked at the same block hash.
+	hash := (&types.Header{Number: big.NewInt(100), Difficulty: big.NewInt(0)}).Hash()
+	for _, fe := range []*fakeEth{a, b, c} {
+		if got := fe.blocks[len(fe.blocks)-1]; got != hash.Hex() {
+			t.Fatalf("read at %s, want block hash %s", got, hash.Hex())
+		}
+	}
+
+	want := []string{
+		`uniswap_estimator_rpc_quorum_votes_total{chain="majority",endpoint="a",result="agreed"} 1`,
+		`uniswap_estimator_rpc_quorum_votes_total{chain="majority",endpoint="b",result="diverged"} 1`,
+		`uniswap_estimator_rpc_quorum_votes_total{chain="majority",endpoint="c",result="agreed"} 1`,
+	}
+	if got := quorumVotes(t, "majority"); !slices.Equal(got, want) {
+		t.Fatalf("unexpected quorum votes:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestQuorum_NotReached(t *testing.T) {
+	t.Parallel()
+
+	// The second endpoint errors (e.g. it does not know the block hash) and
+	// the third returns stale data, leaving a single vote for each value.
+	a := &fakeEth{blockNumber: 100}
+	b := &fakeEth{blockNumber: 100}
+	c := &fakeEth{blockNumber: 100}
+	p := newTestPool(t, PoolConfig{Chain: "not_reached"}, a, b, c)
+	b.fail = true
+
+	q, err := NewQuorum(slog.New(slog.NewTextHandler(io.Discard, nil)), p, 3, 2)
+	if err != nil {
+		t.Fatalf("NewQuorum: %v", err)
+	}
+	_, err = q.BatchStorageAt(context.Background(), []StorageRequest{{Account: testAccount, Key: testSlot}}, big.NewInt(100))
+	if !errors.Is(err, ErrQuorumNotReached) {
+		t.Fatalf("expected ErrQuorumNotReached, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "1 of 3") {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+	want := []string{
+		`uniswap_estimator_rpc_quorum_votes_total{chain="not_reached",endpoint="a",result="not_reached"} 1`,
+		`uniswap_estimator_rpc_quorum_votes_total{chain="not_reached",endpoint="b",result="not_reached"} 1`,
+		`uniswap_estimator_rpc_quorum_votes_total{chain="not_reached",endpoint="c",result="not_reached"} 1`,
+	}
+	if got := quorumVotes(t, "not_reached"); !slices.Equal(got, want) {
+		t.Fatalf("unexpected quorum votes:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestNewQuorum_RequiresMajority(t *testing.T) {
+	t.Parallel()
+
+	p := newTestPool(t, PoolConfig{}, &fakeEth{}, &fakeEth{}, &fakeEth{})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for _, tc := range []struct{ size, threshold int }{{3, 1}, {2, 1}, {4, 3}, {3, 4}, {0, 0}} {
+		if _, err := NewQuorum(logger, p, tc.size, tc.threshold); !errors.Is(err, ErrInvalidQuorum) {
+			t.Fatalf("size %d threshold %d: expected ErrInvalidQuorum, got %v", tc.size, tc.threshold, err)
+		}
+	}
+}
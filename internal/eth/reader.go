@@ -0,0 +1,185 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// StorageRequest identifies a single storage slot of an account.
+type StorageRequest struct {
+	Account common.Address
+	Key     common.Hash
+}
+
+// StateReader is the read-only view of chain state used by the estimator.
+// Implementations may add caching, proofs, failover or serve an offline
+// snapshot. A nil blockNumber means the latest block.
+type StateReader interface {
+	// BlockNumber returns the most recent block number.
+	BlockNumber(ctx context.Context) (uint64, error)
+	// StorageAt returns the 32-byte value of key in account's storage.
+	StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+	// BatchStorageAt reads several slots at the same block, returning values
+	// in request order.
+	BatchStorageAt(ctx context.Context, reqs []StorageRequest, blockNumber *big.Int) ([][]byte, error)
+	// HeaderByNumber returns the header of the given block.
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+}
+
+// SyncReader is implemented by readers that can tell whether their node is
+// still catching up with the chain.
+type SyncReader interface {
+	// SyncProgress returns the sync status of the node, or nil if it is not
+	// syncing.
+	SyncProgress(ctx context.Context) (*ethereum.SyncProgress, error)
+}
+
+// MeteredReader is implemented by readers that charge their reads on a rate
+// limiter.
+type MeteredReader interface {
+	// Unmetered returns a reader of the same nodes whose reads are not
+	// charged, for probes that must not spend the budget of requests.
+	Unmetered() StateReader
+}
+
+// LogReader is implemented by readers that can filter event logs.
+type LogReader interface {
+	// FilterLogs returns the logs matching q.
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// ErrExecutionReverted is matched by the error of a contract call that the
+// node executed and that reverted, e.g. because the contract has no such
+// function.
+var ErrExecutionReverted = errors.New("execution reverted")
+
+// CallReader is implemented by readers that can execute read-only contract
+// calls.
+type CallReader interface {
+	// CallContract executes msg against the state at blockNumber and returns
+	// the call's return data. A reverted call fails with
+	// ErrExecutionReverted.
+	CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error)
+}
+
+// ClientReader is the default StateReader backed by a go-ethereum client.
+// Batched reads are sent as a single JSON-RPC batch request.
+type ClientReader struct {
+	client *ethclient.Client
+}
+
+var (
+	_ StateReader = (*ClientReader)(nil)
+	_ SyncReader  = (*ClientReader)(nil)
+	_ CallReader  = (*ClientReader)(nil)
+	_ LogReader   = (*ClientReader)(nil)
+)
+
+// NewClientReader wraps ec as a StateReader.
+func NewClientReader(ec *ethclient.Client) *ClientReader {
+	return &ClientReader{client: ec}
+}
+
+// BlockNumber implements StateReader.
+func (r *ClientReader) BlockNumber(ctx context.Context) (uint64, error) {
+	return r.client.BlockNumber(ctx)
+}
+
+// StorageAt implements StateReader.
+func (r *ClientReader) StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error) {
+	return r.client.StorageAt(ctx, account, key, blockNumber)
+}
+
+// BatchStorageAt implements StateReader.
+func (r *ClientReader) BatchStorageAt(ctx context.Context, reqs []StorageRequest, blockNumber *big.Int) ([][]byte, error) {
+	return r.batchStorageAt(ctx, reqs, blockNumberArg(blockNumber))
+}
+
+// BatchStorageAtHash reads several slots at the block with the given hash
+// (EIP-1898), so that every value is guaranteed to come from the same block
+// even across endpoints.
+func (r *ClientReader) BatchStorageAtHash(ctx context.Context, reqs []StorageRequest, blockHash common.Hash) ([][]byte, error) {
+	return r.batchStorageAt(ctx, reqs, rpc.BlockNumberOrHashWithHash(blockHash, false))
+}
+
+func (r *ClientReader) batchStorageAt(ctx context.Context, reqs []StorageRequest, block any) ([][]byte, error) {
+	results := make([]hexutil.Bytes, len(reqs))
+	elems := make([]rpc.BatchElem, len(reqs))
+	for i, req := range reqs {
+		elems[i] = rpc.BatchElem{
+			Method: "eth_getStorageAt",
+			Args:   []any{req.Account, req.Key, block},
+			Result: &results[i],
+		}
+	}
+
+	if err := r.client.Client().BatchCallContext(ctx, elems); err != nil {
+		return nil, err
+	}
+
+	out := make([][]byte, len(reqs))
+	for i, el := range elems {
+		if el.Error != nil {
+			return nil, fmt.Errorf("storage %s slot %s: %w", reqs[i].Account.Hex(), reqs[i].Key.Hex(), el.Error)
+		}
+		out[i] = results[i]
+	}
+	return out, nil
+}
+
+// HeaderByNumber implements StateReader.
+func (r *ClientReader) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return r.client.HeaderByNumber(ctx, number)
+}
+
+// SyncProgress implements SyncReader.
+func (r *ClientReader) SyncProgress(ctx context.Context) (*ethereum.SyncProgress, error) {
+	return r.client.SyncProgress(ctx)
+}
+
+// FilterLogs implements LogReader.
+func (r *ClientReader) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	return r.client.FilterLogs(ctx, q)
+}
+
+// CallContract implements CallReader.
+func (r *ClientReader) CallContract(ctx context.Context, msg ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	out, err := r.client.CallContract(ctx, msg, blockNumber)
+	if err != nil && isRevert(err) {
+		return nil, fmt.Errorf("%w: %v", ErrExecutionReverted, err)
+	}
+	return out, err
+}
+
+// isRevert reports whether err is a node reporting a reverted call rather
+// than a failure to execute it. Geth reports reverts with code 3; other
+// nodes only say so in the message.
+func isRevert(err error) bool {
+	var re rpc.Error
+	if errors.As(err, &re) && re.ErrorCode() == 3 {
+		return true
+	}
+	return strings.Contains(err.Error(), "execution reverted")
+}
+
+// blockNumberArg encodes a block number the way ethclient does: nil is the
+// latest block and negative values are the special rpc.BlockNumber tags.
+func blockNumberArg(number *big.Int) string {
+	if number == nil {
+		return "latest"
+	}
+	if number.Sign() >= 0 {
+		return hexutil.EncodeBig(number)
+	}
+	return rpc.BlockNumber(number.Int64()).String()
+}
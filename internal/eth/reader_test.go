@@ -0,0 +1,130 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+)
+
+// fakeEth serves a single account's storage. When fail is set every call
+// errors; delay is applied before storage reads.
+type fakeEth struct {
+	mu          sync.Mutex
+	blockNumber uint64
+	storage     map[common.Hash][]byte
+	blocks      []string
+	fail        bool
+	delay       time.Duration
+	calls       int
+}
+
+func (f *fakeEth) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return 0, errors.New("node unavailable")
+	}
+	return hexutil.Uint64(f.blockNumber), nil
+}
+
+func (f *fakeEth) GetBlockByNumber(ctx context.Context, number gethrpc.BlockNumber, full bool) (*types.Header, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return nil, errors.New("node unavailable")
+	}
+	n := f.blockNumber
+	if number >= 0 {
+		n = uint64(number)
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(n), Difficulty: big.NewInt(0)}, nil
+}
+
+func (f *fakeEth) GetStorageAt(ctx context.Context, addr common.Address, position common.Hash, block gethrpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	f.mu.Lock()
+	f.calls++
+	f.blocks = append(f.blocks, block.String())
+	fail, delay := f.fail, f.delay
+	f.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if fail {
+		return nil, errors.New("node unavailable")
+	}
+	v, ok := f.storage[position]
+	if !ok {
+		return nil, errors.New("missing slot")
+	}
+	return v, nil
+}
+
+// Call reverts every contract call, like one to a contract without the
+// function called.
+func (f *fakeEth) Call(ctx context.Context, args map[string]any, block string) (hexutil.Bytes, error) {
+	f.mu.Lock()
+	f.calls++
+	fail := f.fail
+	f.mu.Unlock()
+	if fail {
+		return nil, errors.New("node unavailable")
+	}
+	return nil, errors.New("execution reverted")
+}
+
+func newInprocReader(t *testing.T, fe *fakeEth) *ClientReader {
+	t.Helper()
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	c := gethrpc.DialInProc(srv)
+	t.Cleanup(c.Close)
+	return NewClientReader(ethclient.NewClient(c))
+}
+
+func TestClientReader_BatchStorageAt(t *testing.T) {
+	slot := func(n int64) common.Hash { return common.BigToHash(big.NewInt(n)) }
+	fe := &fakeEth{storage: map[common.Hash][]byte{
+		slot(1): common.LeftPadBytes([]byte{1}, 32),
+		slot(2): common.LeftPadBytes([]byte{2}, 32),
+	}}
+	r := newInprocReader(t, fe)
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	got, err := r.BatchStorageAt(context.Background(), []StorageRequest{
+		{Account: pool, Key: slot(2)},
+		{Account: pool, Key: slot(1)},
+	}, big.NewInt(42))
+	if err != nil {
+		t.Fatalf("BatchStorageAt: %v", err)
+	}
+	if len(got) != 2 || got[0][31] != 2 || got[1][31] != 1 {
+		t.Fatalf("unexpected values: %x", got)
+	}
+	if fe.blocks[0] != "0x2a" {
+		t.Fatalf("unexpected block argument: %s", fe.blocks[0])
+	}
+
+	_, err = r.BatchStorageAt(context.Background(), []StorageRequest{{Account: pool, Key: slot(3)}}, nil)
+	if err == nil {
+		t.Fatalf("expected error for failing batch element")
+	}
+	if fe.blocks[len(fe.blocks)-1] != "latest" {
+		t.Fatalf("unexpected block argument: %s", fe.blocks[len(fe.blocks)-1])
+	}
+}
@@ -0,0 +1,95 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/nulln0ne/uniswap-estimator/internal/auth"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// APIKeyMetadata is the metadata key carrying the API key of a call. A
+// bearer token in the authorization metadata is accepted as well.
+const APIKeyMetadata = "x-api-key"
+
+// authenticate checks the API key of unary calls like the HTTP middleware
+// does for requests, and logs the calls it allows under the key's name.
+func (s *Server) authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if !s.cfg.Keys.Enabled() {
+		return handler(ctx, req)
+	}
+	start := time.Now()
+	name, err := s.allow(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := handler(ctx, req)
+	s.logger.Info("api request", "api_key", name, "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return resp, err
+}
+
+// authenticateStream checks the API key of streaming calls. A stream is
+// charged once, when it opens.
+func (s *Server) authenticateStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if !s.cfg.Keys.Enabled() {
+		return handler(srv, ss)
+	}
+	start := time.Now()
+	name, err := s.allow(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	err = handler(srv, ss)
+	s.logger.Info("api request", "api_key", name, "method", info.FullMethod, "code", status.Code(err).String(), "duration", time.Since(start))
+	return err
+}
+
+// allow charges a call of method to the API key in the metadata of ctx and
+// returns the key's name, or the status error refusing the call.
+func (s *Server) allow(ctx context.Context, method string) (string, error) {
+	name, err := s.cfg.Keys.Allow(apiKeySecret(ctx))
+	if err == nil {
+		metrics.APIKeyRequest(name, metrics.APIKeyAllowed)
+		return name, nil
+	}
+
+	var le *auth.LimitError
+	switch {
+	case errors.Is(err, auth.ErrMissingKey):
+		metrics.APIKeyRequest("", metrics.APIKeyMissing)
+		return "", newStatus(codes.Unauthenticated, errAPIKeyRequired, 0)
+	case errors.As(err, &le):
+		s.logger.Warn("api key over limit", "api_key", name, "method", method, "err", err)
+		if le.Daily {
+			metrics.APIKeyRequest(name, metrics.APIKeyQuotaExceeded)
+			return "", newStatus(codes.ResourceExhausted, errAPIKeyQuotaExceeded, roundRetry(le.RetryAfter))
+		}
+		metrics.APIKeyRequest(name, metrics.APIKeyRateLimited)
+		return "", newStatus(codes.ResourceExhausted, errAPIKeyRateLimited, roundRetry(le.RetryAfter))
+	default:
+		s.logger.Warn("invalid api key", "method", method)
+		metrics.APIKeyRequest("", metrics.APIKeyInvalid)
+		return "", newStatus(codes.Unauthenticated, errInvalidAPIKey, 0)
+	}
+}
+
+// apiKeySecret returns the API key in the incoming metadata of ctx.
+func apiKeySecret(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(APIKeyMetadata); len(v) > 0 && v[0] != "" {
+		return v[0]
+	}
+	if v := md.Get("authorization"); len(v) > 0 {
+		scheme, token, ok := strings.Cut(v[0], " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return ""
+}
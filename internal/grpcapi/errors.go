@@ -0,0 +1,158 @@
+package grpcapi
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// ErrorDomain is the domain of the google.rpc.ErrorInfo detail attached to
+// failed calls. Its reason is the error code.
+const ErrorDomain = "uniswap-estimator"
+
+// CodeOverloaded is the error code of calls shed by the concurrency cap, the
+// same as over HTTP.
+const CodeOverloaded service.Code = "OVERLOADED"
+
+// Errors reported by the Estimator service besides those of the service
+// layer. They carry the same codes as their HTTP counterparts.
+var (
+	errInvalidBatchSize   = &service.Error{Code: service.CodeInvalidParameter, Message: "batch must have between 1 and 100 requests"}
+	errRateLimited        = &service.Error{Code: service.CodeRateLimited, Message: "rpc rate limit exceeded, retry later"}
+	errQuorumNotReached   = &service.Error{Code: service.CodeQuorumNotReached, Message: "rpc providers disagree on pool state"}
+	errRPCUnavailable     = &service.Error{Code: service.CodeRPCUnavailable, Message: "rpc endpoints unavailable"}
+	errDeadlineExceeded   = &service.Error{Code: service.CodeDeadlineExceeded, Message: "request deadline exceeded"}
+	errRequestCanceled    = &service.Error{Code: service.CodeRequestCanceled, Message: "request canceled"}
+	errServerShuttingDown = &service.Error{Code: service.CodeRequestCanceled, Message: "server is shutting down"}
+	errOverloaded         = &service.Error{Code: CodeOverloaded, Message: limits.ErrOverloaded.Error()}
+
+	errAPIKeyRequired      = &service.Error{Code: service.CodeUnauthorized, Message: "api key required"}
+	errInvalidAPIKey       = &service.Error{Code: service.CodeUnauthorized, Message: "invalid api key"}
+	errAPIKeyRateLimited   = &service.Error{Code: service.CodeRateLimited, Message: "api key rate limit exceeded, retry later"}
+	errAPIKeyQuotaExceeded = &service.Error{Code: service.CodeQuotaExceeded, Message: "api key daily quota exhausted, retry tomorrow"}
+)
+
+// missingField returns the error of a required request field left empty.
+func missingField(field string) *service.Error {
+	return &service.Error{Code: service.CodeMissingParameter, Message: field + " is required"}
+}
+
+// invalidField returns the error of a request field that does not parse.
+func invalidField(field, want string) *service.Error {
+	return &service.Error{Code: service.CodeInvalidParameter, Message: "invalid " + field + ": want " + want}
+}
+
+// statusCodes maps error codes to gRPC status codes. Codes that are not
+// listed are reported as InvalidArgument: they all reject the request itself.
+var statusCodes = map[service.Code]codes.Code{
+	service.CodePoolNotFound:          codes.NotFound,
+	service.CodeInsufficientLiquidity: codes.FailedPrecondition,
+	service.CodeInsufficientInput:     codes.FailedPrecondition,
+	service.CodePendingUnavailable:    codes.Unimplemented,
+	service.CodeRateLimited:           codes.ResourceExhausted,
+	service.CodeQuorumNotReached:      codes.Unavailable,
+	service.CodeRPCUnavailable:        codes.Unavailable,
+	service.CodeDeadlineExceeded:      codes.DeadlineExceeded,
+	service.CodeRequestCanceled:       codes.Canceled,
+	service.CodeUnauthorized:          codes.Unauthenticated,
+	service.CodeQuotaExceeded:         codes.ResourceExhausted,
+	CodeOverloaded:                    codes.Unavailable,
+}
+
+// apiError returns the error reported to clients for err. Errors of the RPC
+// endpoints get a generic message so endpoint details do not leak.
+func apiError(err error) *service.Error {
+	if errors.Is(err, limits.ErrOverloaded) {
+		return errOverloaded
+	}
+	switch code := service.ErrorCode(err); code {
+	case service.CodeRateLimited:
+		return errRateLimited
+	case service.CodeQuorumNotReached:
+		return errQuorumNotReached
+	case service.CodeRPCUnavailable:
+		return errRPCUnavailable
+	case service.CodeDeadlineExceeded:
+		return errDeadlineExceeded
+	case service.CodeRequestCanceled:
+		if errors.Is(err, errServerShuttingDown) {
+			return errServerShuttingDown
+		}
+		return errRequestCanceled
+	default:
+		return &service.Error{Code: code, Message: err.Error()}
+	}
+}
+
+// statusError logs err and converts it to a gRPC status carrying an
+// ErrorInfo detail, and a RetryInfo detail when the call was rate limited.
+// op names the failed operation in logs.
+func statusError(logger *slog.Logger, op string, err error) error {
+	e := apiError(err)
+	switch e {
+	case errDeadlineExceeded, errRequestCanceled:
+		logger.Warn(op+" did not finish", "err", err)
+	case errRateLimited:
+		logger.Warn(op+" rate limited", "err", err)
+	case errQuorumNotReached:
+		logger.Warn(op+" quorum not reached", "err", err)
+	case errRPCUnavailable:
+		logger.Error("service "+op+" failed", "err", err)
+	}
+
+	c, ok := statusCodes[e.Code]
+	switch {
+	case e == errServerShuttingDown:
+		// Clients reconnect on Unavailable, as for any server going away.
+		c = codes.Unavailable
+	case !ok:
+		c = codes.InvalidArgument
+	}
+	var retry time.Duration
+	switch e {
+	case errRateLimited:
+		retry = retryDelay(err)
+	case errOverloaded:
+		retry = time.Second
+	}
+	return newStatus(c, e, retry)
+}
+
+// newStatus returns a gRPC status error for e with an ErrorInfo detail, and a
+// RetryInfo detail when retry is positive.
+func newStatus(c codes.Code, e *service.Error, retry time.Duration) error {
+	st := status.New(c, e.Message)
+	info := &errdetails.ErrorInfo{Reason: string(e.Code), Domain: ErrorDomain}
+	detailed, derr := st.WithDetails(info)
+	if retry > 0 {
+		detailed, derr = st.WithDetails(info, &errdetails.RetryInfo{RetryDelay: durationpb.New(retry)})
+	}
+	if derr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// retryDelay returns when a rate-limited call may be retried, rounded up to
+// whole seconds like the HTTP Retry-After header.
+func retryDelay(err error) time.Duration {
+	var rl *eth.RateLimitError
+	if errors.As(err, &rl) {
+		return roundRetry(rl.RetryAfter)
+	}
+	return time.Second
+}
+
+// roundRetry rounds a retry delay up to whole seconds.
+func roundRetry(d time.Duration) time.Duration {
+	return time.Duration(max(math.Ceil(d.Seconds()), 1)) * time.Second
+}
@@ -0,0 +1,600 @@
+// Estimator is the gRPC API of uniswap-estimator. It serves the same quotes
+// as the HTTP API. Amounts are decimal strings in raw token units and
+// addresses are 0x-prefixed hex strings.
+//
+// Failed calls carry a google.rpc.ErrorInfo detail whose reason is the same
+// stable error code the HTTP API returns, e.g. PAIR_MISMATCH, and whose
+// domain is "uniswap-estimator". Rate-limited calls also carry a
+// google.rpc.RetryInfo detail.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: api/estimator/v1/estimator.proto
+
+package grpcapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type EstimateRequest struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Pool     string                 `protobuf:"bytes,1,opt,name=pool,proto3" json:"pool,omitempty"`
+	Src      string                 `protobuf:"bytes,2,opt,name=src,proto3" json:"src,omitempty"`
+	Dst      string                 `protobuf:"bytes,3,opt,name=dst,proto3" json:"dst,omitempty"`
+	AmountIn string                 `protobuf:"bytes,4,opt,name=amount_in,json=amountIn,proto3" json:"amount_in,omitempty"`
+	// chain and chain_id select the chain by name or ID; the default chain is
+	// used when both are empty.
+	Chain         string `protobuf:"bytes,5,opt,name=chain,proto3" json:"chain,omitempty"`
+	ChainId       uint64 `protobuf:"varint,6,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EstimateRequest) Reset() {
+	*x = EstimateRequest{}
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EstimateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstimateRequest) ProtoMessage() {}
+
+func (x *EstimateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstimateRequest.ProtoReflect.Descriptor instead.
+func (*EstimateRequest) Descriptor() ([]byte, []int) {
+	return file_api_estimator_v1_estimator_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *EstimateRequest) GetPool() string {
+	if x != nil {
+		return x.Pool
+	}
+	return ""
+}
+
+func (x *EstimateRequest) GetSrc() string {
+	if x != nil {
+		return x.Src
+	}
+	return ""
+}
+
+func (x *EstimateRequest) GetDst() string {
+	if x != nil {
+		return x.Dst
+	}
+	return ""
+}
+
+func (x *EstimateRequest) GetAmountIn() string {
+	if x != nil {
+		return x.AmountIn
+	}
+	return ""
+}
+
+func (x *EstimateRequest) GetChain() string {
+	if x != nil {
+		return x.Chain
+	}
+	return ""
+}
+
+func (x *EstimateRequest) GetChainId() uint64 {
+	if x != nil {
+		return x.ChainId
+	}
+	return 0
+}
+
+type EstimateInRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Pool          string                 `protobuf:"bytes,1,opt,name=pool,proto3" json:"pool,omitempty"`
+	Src           string                 `protobuf:"bytes,2,opt,name=src,proto3" json:"src,omitempty"`
+	Dst           string                 `protobuf:"bytes,3,opt,name=dst,proto3" json:"dst,omitempty"`
+	AmountOut     string                 `protobuf:"bytes,4,opt,name=amount_out,json=amountOut,proto3" json:"amount_out,omitempty"`
+	Chain         string                 `protobuf:"bytes,5,opt,name=chain,proto3" json:"chain,omitempty"`
+	ChainId       uint64                 `protobuf:"varint,6,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EstimateInRequest) Reset() {
+	*x = EstimateInRequest{}
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EstimateInRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstimateInRequest) ProtoMessage() {}
+
+func (x *EstimateInRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstimateInRequest.ProtoReflect.Descriptor instead.
+func (*EstimateInRequest) Descriptor() ([]byte, []int) {
+	return file_api_estimator_v1_estimator_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *EstimateInRequest) GetPool() string {
+	if x != nil {
+		return x.Pool
+	}
+	return ""
+}
+
+func (x *EstimateInRequest) GetSrc() string {
+	if x != nil {
+		return x.Src
+	}
+	return ""
+}
+
+func (x *EstimateInRequest) GetDst() string {
+	if x != nil {
+		return x.Dst
+	}
+	return ""
+}
+
+func (x *EstimateInRequest) GetAmountOut() string {
+	if x != nil {
+		return x.AmountOut
+	}
+	return ""
+}
+
+func (x *EstimateInRequest) GetChain() string {
+	if x != nil {
+		return x.Chain
+	}
+	return ""
+}
+
+func (x *EstimateInRequest) GetChainId() uint64 {
+	if x != nil {
+		return x.ChainId
+	}
+	return 0
+}
+
+type Quote struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// block is the block whose reserves the quote is based on.
+	Block         uint64 `protobuf:"varint,1,opt,name=block,proto3" json:"block,omitempty"`
+	AmountIn      string `protobuf:"bytes,2,opt,name=amount_in,json=amountIn,proto3" json:"amount_in,omitempty"`
+	AmountOut     string `protobuf:"bytes,3,opt,name=amount_out,json=amountOut,proto3" json:"amount_out,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Quote) Reset() {
+	*x = Quote{}
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Quote) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Quote) ProtoMessage() {}
+
+func (x *Quote) ProtoReflect() protoreflect.Message {
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Quote.ProtoReflect.Descriptor instead.
+func (*Quote) Descriptor() ([]byte, []int) {
+	return file_api_estimator_v1_estimator_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Quote) GetBlock() uint64 {
+	if x != nil {
+		return x.Block
+	}
+	return 0
+}
+
+func (x *Quote) GetAmountIn() string {
+	if x != nil {
+		return x.AmountIn
+	}
+	return ""
+}
+
+func (x *Quote) GetAmountOut() string {
+	if x != nil {
+		return x.AmountOut
+	}
+	return ""
+}
+
+type EstimateBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Requests      []*EstimateRequest     `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EstimateBatchRequest) Reset() {
+	*x = EstimateBatchRequest{}
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EstimateBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstimateBatchRequest) ProtoMessage() {}
+
+func (x *EstimateBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstimateBatchRequest.ProtoReflect.Descriptor instead.
+func (*EstimateBatchRequest) Descriptor() ([]byte, []int) {
+	return file_api_estimator_v1_estimator_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *EstimateBatchRequest) GetRequests() []*EstimateRequest {
+	if x != nil {
+		return x.Requests
+	}
+	return nil
+}
+
+type EstimateBatchResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// results holds one result per request, in request order.
+	Results       []*EstimateResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EstimateBatchResponse) Reset() {
+	*x = EstimateBatchResponse{}
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EstimateBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstimateBatchResponse) ProtoMessage() {}
+
+func (x *EstimateBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstimateBatchResponse.ProtoReflect.Descriptor instead.
+func (*EstimateBatchResponse) Descriptor() ([]byte, []int) {
+	return file_api_estimator_v1_estimator_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EstimateBatchResponse) GetResults() []*EstimateResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type EstimateResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Result:
+	//
+	//	*EstimateResult_Quote
+	//	*EstimateResult_Error
+	Result        isEstimateResult_Result `protobuf_oneof:"result"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EstimateResult) Reset() {
+	*x = EstimateResult{}
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EstimateResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EstimateResult) ProtoMessage() {}
+
+func (x *EstimateResult) ProtoReflect() protoreflect.Message {
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EstimateResult.ProtoReflect.Descriptor instead.
+func (*EstimateResult) Descriptor() ([]byte, []int) {
+	return file_api_estimator_v1_estimator_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EstimateResult) GetResult() isEstimateResult_Result {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *EstimateResult) GetQuote() *Quote {
+	if x != nil {
+		if x, ok := x.Result.(*EstimateResult_Quote); ok {
+			return x.Quote
+		}
+	}
+	return nil
+}
+
+func (x *EstimateResult) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Result.(*EstimateResult_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+type isEstimateResult_Result interface {
+	isEstimateResult_Result()
+}
+
+type EstimateResult_Quote struct {
+	Quote *Quote `protobuf:"bytes,1,opt,name=quote,proto3,oneof"`
+}
+
+type EstimateResult_Error struct {
+	Error *Error `protobuf:"bytes,2,opt,name=error,proto3,oneof"`
+}
+
+func (*EstimateResult_Quote) isEstimateResult_Result() {}
+
+func (*EstimateResult_Error) isEstimateResult_Result() {}
+
+type Error struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// code is the stable error code, e.g. POOL_NOT_FOUND.
+	Code          string `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message       string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_api_estimator_v1_estimator_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_api_estimator_v1_estimator_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_api_estimator_v1_estimator_proto protoreflect.FileDescriptor
+
+const file_api_estimator_v1_estimator_proto_rawDesc = "" +
+	"\n" +
+	" api/estimator/v1/estimator.proto\x12\festimator.v1\"\x97\x01\n" +
+	"\x0fEstimateRequest\x12\x12\n" +
+	"\x04pool\x18\x01 \x01(\tR\x04pool\x12\x10\n" +
+	"\x03src\x18\x02 \x01(\tR\x03src\x12\x10\n" +
+	"\x03dst\x18\x03 \x01(\tR\x03dst\x12\x1b\n" +
+	"\tamount_in\x18\x04 \x01(\tR\bamountIn\x12\x14\n" +
+	"\x05chain\x18\x05 \x01(\tR\x05chain\x12\x19\n" +
+	"\bchain_id\x18\x06 \x01(\x04R\achainId\"\x9b\x01\n" +
+	"\x11EstimateInRequest\x12\x12\n" +
+	"\x04pool\x18\x01 \x01(\tR\x04pool\x12\x10\n" +
+	"\x03src\x18\x02 \x01(\tR\x03src\x12\x10\n" +
+	"\x03dst\x18\x03 \x01(\tR\x03dst\x12\x1d\n" +
+	"\n" +
+	"amount_out\x18\x04 \x01(\tR\tamountOut\x12\x14\n" +
+	"\x05chain\x18\x05 \x01(\tR\x05chain\x12\x19\n" +
+	"\bchain_id\x18\x06 \x01(\x04R\achainId\"Y\n" +
+	"\x05Quote\x12\x14\n" +
+	"\x05block\x18\x01 \x01(\x04R\x05block\x12\x1b\n" +
+	"\tamount_in\x18\x02 \x01(\tR\bamountIn\x12\x1d\n" +
+	"\n" +
+	"amount_out\x18\x03 \x01(\tR\tamountOut\"Q\n" +
+	"\x14EstimateBatchRequest\x129\n" +
+	"\brequests\x18\x01 \x03(\v2\x1d.estimator.v1.EstimateRequestR\brequests\"O\n" +
+	"\x15EstimateBatchResponse\x126\n" +
+	"\aresults\x18\x01 \x03(\v2\x1c.estimator.v1.EstimateResultR\aresults\"t\n" +
+	"\x0eEstimateResult\x12+\n" +
+	"\x05quote\x18\x01 \x01(\v2\x13.estimator.v1.QuoteH\x00R\x05quote\x12+\n" +
+	"\x05error\x18\x02 \x01(\v2\x13.estimator.v1.ErrorH\x00R\x05errorB\b\n" +
+	"\x06result\"5\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage2\xad\x02\n" +
+	"\tEstimator\x12>\n" +
+	"\bEstimate\x12\x1d.estimator.v1.EstimateRequest\x1a\x13.estimator.v1.Quote\x12B\n" +
+	"\n" +
+	"EstimateIn\x12\x1f.estimator.v1.EstimateInRequest\x1a\x13.estimator.v1.Quote\x12X\n" +
+	"\rEstimateBatch\x12\".estimator.v1.EstimateBatchRequest\x1a#.estimator.v1.EstimateBatchResponse\x12B\n" +
+	"\n" +
+	"WatchQuote\x12\x1d.estimator.v1.EstimateRequest\x1a\x13.estimator.v1.Quote0\x01B8Z6github.com/nulln0ne/uniswap-estimator/internal/grpcapib\x06proto3"
+
+var (
+	file_api_estimator_v1_estimator_proto_rawDescOnce sync.Once
+	file_api_estimator_v1_estimator_proto_rawDescData []byte
+)
+
+func file_api_estimator_v1_estimator_proto_rawDescGZIP() []byte {
+	file_api_estimator_v1_estimator_proto_rawDescOnce.Do(func() {
+		file_api_estimator_v1_estimator_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_estimator_v1_estimator_proto_rawDesc), len(file_api_estimator_v1_estimator_proto_rawDesc)))
+	})
+	return file_api_estimator_v1_estimator_proto_rawDescData
+}
+
+var file_api_estimator_v1_estimator_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_api_estimator_v1_estimator_proto_goTypes = []any{
+	(*EstimateRequest)(nil),       // 0: estimator.v1.EstimateRequest
+	(*EstimateInRequest)(nil),     // 1: estimator.v1.EstimateInRequest
+	(*Quote)(nil),                 // 2: estimator.v1.Quote
+	(*EstimateBatchRequest)(nil),  // 3: estimator.v1.EstimateBatchRequest
+	(*EstimateBatchResponse)(nil), // 4: estimator.v1.EstimateBatchResponse
+	(*EstimateResult)(nil),        // 5: estimator.v1.EstimateResult
+	(*Error)(nil),                 // 6: estimator.v1.Error
+}
+var file_api_estimator_v1_estimator_proto_depIdxs = []int32{
+	0, // 0: estimator.v1.EstimateBatchRequest.requests:type_name -> estimator.v1.EstimateRequest
+	5, // 1: estimator.v1.EstimateBatchResponse.results:type_name -> estimator.v1.EstimateResult
+	2, // 2: estimator.v1.EstimateResult.quote:type_name -> estimator.v1.Quote
+	6, // 3: estimator.v1.EstimateResult.error:type_name -> estimator.v1.Error
+	0, // 4: estimator.v1.Estimator.Estimate:input_type -> estimator.v1.EstimateRequest
+	1, // 5: estimator.v1.Estimator.EstimateIn:input_type -> estimator.v1.EstimateInRequest
+	3, // 6: estimator.v1.Estimator.EstimateBatch:input_type -> estimator.v1.EstimateBatchRequest
+	0, // 7: estimator.v1.Estimator.WatchQuote:input_type -> estimator.v1.EstimateRequest
+	2, // 8: estimator.v1.Estimator.Estimate:output_type -> estimator.v1.Quote
+	2, // 9: estimator.v1.Estimator.EstimateIn:output_type -> estimator.v1.Quote
+	4, // 10: estimator.v1.Estimator.EstimateBatch:output_type -> estimator.v1.EstimateBatchResponse
+	2, // 11: estimator.v1.Estimator.WatchQuote:output_type -> estimator.v1.Quote
+	8, // [8:12] is the sub-list for method output_type
+	4, // [4:8] is the sub-list for method input_type
+	4, // [4:4] is the sub-list for extension type_name
+	4, // [4:4] is the sub-list for extension extendee
+	0, // [0:4] is the sub-list for field type_name
+}
+
+func init() { file_api_estimator_v1_estimator_proto_init() }
+func file_api_estimator_v1_estimator_proto_init() {
+	if File_api_estimator_v1_estimator_proto != nil {
+		return
+	}
+	file_api_estimator_v1_estimator_proto_msgTypes[5].OneofWrappers = []any{
+		(*EstimateResult_Quote)(nil),
+		(*EstimateResult_Error)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_estimator_v1_estimator_proto_rawDesc), len(file_api_estimator_v1_estimator_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_estimator_v1_estimator_proto_goTypes,
+		DependencyIndexes: file_api_estimator_v1_estimator_proto_depIdxs,
+		MessageInfos:      file_api_estimator_v1_estimator_proto_msgTypes,
+	}.Build()
+	File_api_estimator_v1_estimator_proto = out.File
+	file_api_estimator_v1_estimator_proto_goTypes = nil
+	file_api_estimator_v1_estimator_proto_depIdxs = nil
+}
@@ -0,0 +1,264 @@
+// Estimator is the gRPC API of uniswap-estimator. It serves the same quotes
+// as the HTTP API. Amounts are decimal strings in raw token units and
+// addresses are 0x-prefixed hex strings.
+//
+// Failed calls carry a google.rpc.ErrorInfo detail whose reason is the same
+// stable error code the HTTP API returns, e.g. PAIR_MISMATCH, and whose
+// domain is "uniswap-estimator". Rate-limited calls also carry a
+// google.rpc.RetryInfo detail.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: api/estimator/v1/estimator.proto
+
+package grpcapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Estimator_Estimate_FullMethodName      = "/estimator.v1.Estimator/Estimate"
+	Estimator_EstimateIn_FullMethodName    = "/estimator.v1.Estimator/EstimateIn"
+	Estimator_EstimateBatch_FullMethodName = "/estimator.v1.Estimator/EstimateBatch"
+	Estimator_WatchQuote_FullMethodName    = "/estimator.v1.Estimator/WatchQuote"
+)
+
+// EstimatorClient is the client API for Estimator service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type EstimatorClient interface {
+	// Estimate returns the output of swapping amount_in of src to dst at the
+	// latest block.
+	Estimate(ctx context.Context, in *EstimateRequest, opts ...grpc.CallOption) (*Quote, error)
+	// EstimateIn returns the input of src needed to receive amount_out of dst
+	// at the latest block.
+	EstimateIn(ctx context.Context, in *EstimateInRequest, opts ...grpc.CallOption) (*Quote, error)
+	// EstimateBatch runs up to 100 estimates. Each one succeeds or fails on its
+	// own; the call fails only if the batch itself is invalid.
+	EstimateBatch(ctx context.Context, in *EstimateBatchRequest, opts ...grpc.CallOption) (*EstimateBatchResponse, error)
+	// WatchQuote streams a quote of the request for every new block, starting
+	// with the current one, until the client cancels.
+	WatchQuote(ctx context.Context, in *EstimateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Quote], error)
+}
+
+type estimatorClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEstimatorClient(cc grpc.ClientConnInterface) EstimatorClient {
+	return &estimatorClient{cc}
+}
+
+func (c *estimatorClient) Estimate(ctx context.Context, in *EstimateRequest, opts ...grpc.CallOption) (*Quote, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Quote)
+	err := c.cc.Invoke(ctx, Estimator_Estimate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *estimatorClient) EstimateIn(ctx context.Context, in *EstimateInRequest, opts ...grpc.CallOption) (*Quote, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Quote)
+	err := c.cc.Invoke(ctx, Estimator_EstimateIn_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *estimatorClient) EstimateBatch(ctx context.Context, in *EstimateBatchRequest, opts ...grpc.CallOption) (*EstimateBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EstimateBatchResponse)
+	err := c.cc.Invoke(ctx, Estimator_EstimateBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *estimatorClient) WatchQuote(ctx context.Context, in *EstimateRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Quote], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Estimator_ServiceDesc.Streams[0], Estimator_WatchQuote_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EstimateRequest, Quote]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Estimator_WatchQuoteClient = grpc.ServerStreamingClient[Quote]
+
+// EstimatorServer is the server API for Estimator service.
+// All implementations must embed UnimplementedEstimatorServer
+// for forward compatibility.
+type EstimatorServer interface {
+	// Estimate returns the output of swapping amount_in of src to dst at the
+	// latest block.
+	Estimate(context.Context, *EstimateRequest) (*Quote, error)
+	// EstimateIn returns the input of src needed to receive amount_out of dst
+	// at the latest block.
+	EstimateIn(context.Context, *EstimateInRequest) (*Quote, error)
+	// EstimateBatch runs up to 100 estimates. Each one succeeds or fails on its
+	// own; the call fails only if the batch itself is invalid.
+	EstimateBatch(context.Context, *EstimateBatchRequest) (*EstimateBatchResponse, error)
+	// WatchQuote streams a quote of the request for every new block, starting
+	// with the current one, until the client cancels.
+	WatchQuote(*EstimateRequest, grpc.ServerStreamingServer[Quote]) error
+	mustEmbedUnimplementedEstimatorServer()
+}
+
+// UnimplementedEstimatorServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEstimatorServer struct{}
+
+func (UnimplementedEstimatorServer) Estimate(context.Context, *EstimateRequest) (*Quote, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Estimate not implemented")
+}
+func (UnimplementedEstimatorServer) EstimateIn(context.Context, *EstimateInRequest) (*Quote, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EstimateIn not implemented")
+}
+func (UnimplementedEstimatorServer) EstimateBatch(context.Context, *EstimateBatchRequest) (*EstimateBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EstimateBatch not implemented")
+}
+func (UnimplementedEstimatorServer) WatchQuote(*EstimateRequest, grpc.ServerStreamingServer[Quote]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchQuote not implemented")
+}
+func (UnimplementedEstimatorServer) mustEmbedUnimplementedEstimatorServer() {}
+func (UnimplementedEstimatorServer) testEmbeddedByValue()                   {}
+
+// UnsafeEstimatorServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EstimatorServer will
+// result in compilation errors.
+type UnsafeEstimatorServer interface {
+	mustEmbedUnimplementedEstimatorServer()
+}
+
+func RegisterEstimatorServer(s grpc.ServiceRegistrar, srv EstimatorServer) {
+	// If the following call pancis, it indicates UnimplementedEstimatorServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Estimator_ServiceDesc, srv)
+}
+
+func _Estimator_Estimate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EstimateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EstimatorServer).Estimate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Estimator_Estimate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EstimatorServer).Estimate(ctx, req.(*EstimateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Estimator_EstimateIn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EstimateInRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EstimatorServer).EstimateIn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Estimator_EstimateIn_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EstimatorServer).EstimateIn(ctx, req.(*EstimateInRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Estimator_EstimateBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EstimateBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EstimatorServer).EstimateBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Estimator_EstimateBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EstimatorServer).EstimateBatch(ctx, req.(*EstimateBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Estimator_WatchQuote_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(EstimateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(EstimatorServer).WatchQuote(m, &grpc.GenericServerStream[EstimateRequest, Quote]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Estimator_WatchQuoteServer = grpc.ServerStreamingServer[Quote]
+
+// Estimator_ServiceDesc is the grpc.ServiceDesc for Estimator service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Estimator_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "estimator.v1.Estimator",
+	HandlerType: (*EstimatorServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Estimate",
+			Handler:    _Estimator_Estimate_Handler,
+		},
+		{
+			MethodName: "EstimateIn",
+			Handler:    _Estimator_EstimateIn_Handler,
+		},
+		{
+			MethodName: "EstimateBatch",
+			Handler:    _Estimator_EstimateBatch_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchQuote",
+			Handler:       _Estimator_WatchQuote_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/estimator/v1/estimator.proto",
+}
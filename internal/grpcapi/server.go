@@ -0,0 +1,308 @@
+// Package grpcapi serves the Estimator gRPC API described by
+// api/estimator/v1/estimator.proto. It is backed by the same EstimateService
+// instances as the HTTP API and reports failures with the same error codes.
+package grpcapi
+
+//go:generate protoc -I ../.. --go_out=../.. --go_opt=module=github.com/nulln0ne/uniswap-estimator --go-grpc_out=../.. --go-grpc_opt=module=github.com/nulln0ne/uniswap-estimator api/estimator/v1/estimator.proto
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/auth"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the fully qualified name of the Estimator service.
+const ServiceName = "estimator.v1.Estimator"
+
+// Full method names of the Estimator service.
+const (
+	EstimateMethod      = Estimator_Estimate_FullMethodName
+	EstimateInMethod    = Estimator_EstimateIn_FullMethodName
+	EstimateBatchMethod = Estimator_EstimateBatch_FullMethodName
+	WatchQuoteMethod    = Estimator_WatchQuote_FullMethodName
+)
+
+// MaxBatchSize caps the number of requests of one EstimateBatch call.
+const MaxBatchSize = 100
+
+// batchConcurrency caps how many requests of a batch are estimated at once.
+const batchConcurrency = 8
+
+// Config holds the settings of a Server.
+type Config struct {
+	// RequestTimeout bounds every unary call, like REQUEST_TIMEOUT bounds HTTP
+	// requests. Zero means no limit besides the client's deadline.
+	RequestTimeout time.Duration
+	// PollInterval is how often WatchQuote checks for a new block.
+	PollInterval time.Duration
+	// Keys are the API keys calls must carry in their metadata. Every call
+	// is allowed while it is nil or empty.
+	Keys *auth.Keys
+	// Gate is the concurrency cap shared with the HTTP API. Every estimate,
+	// each request of a batch and every WatchQuote poll take one of its
+	// slots. A nil Gate admits everything.
+	Gate *limits.Gate
+}
+
+// Server is the gRPC server of the Estimator service.
+type Server struct {
+	UnimplementedEstimatorServer
+
+	logger *slog.Logger
+	chains *service.ChainSet
+	cfg    Config
+	grpc   *grpc.Server
+
+	// stopping is closed by Shutdown to end WatchQuote streams, which would
+	// otherwise keep a graceful stop waiting until its deadline.
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+// New constructs a Server routing each call to the service of the chain it
+// names.
+func New(logger *slog.Logger, chains *service.ChainSet, cfg Config) *Server {
+	s := &Server{
+		logger:   logger,
+		chains:   chains,
+		cfg:      cfg,
+		stopping: make(chan struct{}),
+	}
+	s.grpc = grpc.NewServer(
+		grpc.ChainUnaryInterceptor(s.authenticate, s.deadline),
+		grpc.StreamInterceptor(s.authenticateStream),
+	)
+	RegisterEstimatorServer(s.grpc, s)
+	return s
+}
+
+// Serve accepts connections on lis until Shutdown is called.
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Shutdown ends WatchQuote streams and waits for the other calls to finish.
+// Calls still running when ctx ends are aborted.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stopping) })
+
+	done := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.grpc.Stop()
+		return ctx.Err()
+	}
+}
+
+// deadline applies Config.RequestTimeout to unary calls. A shorter client
+// deadline still wins.
+func (s *Server) deadline(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.cfg.RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.RequestTimeout)
+		defer cancel()
+	}
+	return handler(ctx, req)
+}
+
+// Estimate implements EstimatorServer.
+func (s *Server) Estimate(ctx context.Context, req *EstimateRequest) (*Quote, error) {
+	q, err := s.quote(ctx, req)
+	if err != nil {
+		return nil, statusError(s.logger, "estimate", err)
+	}
+	return q, nil
+}
+
+// quote validates req and estimates it.
+func (s *Server) quote(ctx context.Context, req *EstimateRequest) (*Quote, error) {
+	p, err := s.parse(req.Pool, req.Src, req.Dst, "amount_in", req.AmountIn, req.Chain, req.ChainId)
+	if err != nil {
+		return nil, err
+	}
+	defer p.release()
+	done, err := s.cfg.Gate.Acquire(ctx, EstimateMethod)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+	q, err := p.svc.Quote(ctx, p.pool, p.src, p.dst, p.amount)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Debug("estimate computed", "pool", req.Pool, "src", req.Src, "dst", req.Dst, "in", q.AmountIn.String(), "out", q.AmountOut.String())
+	return quoteMessage(q), nil
+}
+
+// EstimateIn implements EstimatorServer.
+func (s *Server) EstimateIn(ctx context.Context, req *EstimateInRequest) (*Quote, error) {
+	p, err := s.parse(req.Pool, req.Src, req.Dst, "amount_out", req.AmountOut, req.Chain, req.ChainId)
+	if err != nil {
+		return nil, statusError(s.logger, "estimate", err)
+	}
+	defer p.release()
+	done, err := s.cfg.Gate.Acquire(ctx, EstimateInMethod)
+	if err != nil {
+		return nil, statusError(s.logger, "estimate", err)
+	}
+	defer done()
+	q, err := p.svc.QuoteIn(ctx, p.pool, p.src, p.dst, p.amount)
+	if err != nil {
+		return nil, statusError(s.logger, "estimate", err)
+	}
+	s.logger.Debug("exact-out estimate computed", "pool", req.Pool, "src", req.Src, "dst", req.Dst, "in", q.AmountIn.String(), "out", q.AmountOut.String())
+	return quoteMessage(q), nil
+}
+
+// EstimateBatch implements EstimatorServer. The requests are estimated
+// concurrently; a failed request is reported in its result and does not fail
+// the call.
+func (s *Server) EstimateBatch(ctx context.Context, req *EstimateBatchRequest) (*EstimateBatchResponse, error) {
+	if len(req.Requests) == 0 || len(req.Requests) > MaxBatchSize {
+		return nil, statusError(s.logger, "estimate batch", errInvalidBatchSize)
+	}
+
+	results := make([]*EstimateResult, len(req.Requests))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, r := range req.Requests {
+		sem <- struct{}{}
+		wg.Go(func() {
+			defer func() { <-sem }()
+			q, err := s.quote(ctx, r)
+			if err != nil {
+				e := apiError(err)
+				if e.Code == service.CodeRPCUnavailable {
+					s.logger.Error("service estimate failed", "err", err)
+				}
+				results[i] = &EstimateResult{Result: &EstimateResult_Error{Error: &Error{Code: string(e.Code), Message: e.Message}}}
+				return
+			}
+			results[i] = &EstimateResult{Result: &EstimateResult_Quote{Quote: q}}
+		})
+	}
+	wg.Wait()
+
+	// A batch cut by its deadline fails as a whole rather than returning a
+	// deadline error for every remaining request.
+	if err := ctx.Err(); err != nil {
+		return nil, statusError(s.logger, "estimate batch", err)
+	}
+	return &EstimateBatchResponse{Results: results}, nil
+}
+
+// WatchQuote implements EstimatorServer. It streams a quote for every new
+// block until the client cancels, the quote fails for good or the server
+// shuts down.
+func (s *Server) WatchQuote(req *EstimateRequest, stream grpc.ServerStreamingServer[Quote]) error {
+	ctx, cancel := context.WithCancelCause(stream.Context())
+	defer cancel(nil)
+	go func() {
+		select {
+		case <-s.stopping:
+			cancel(errServerShuttingDown)
+		case <-ctx.Done():
+		}
+	}()
+
+	p, err := s.parse(req.Pool, req.Src, req.Dst, "amount_in", req.AmountIn, req.Chain, req.ChainId)
+	if err != nil {
+		return statusError(s.logger, "watch quote", err)
+	}
+	// The stream outlives reloads, so every poll resolves the chain again
+	// rather than keeping the service parse returned.
+	chainID := p.svc.Chain().ID
+	p.release()
+
+	admit := func(ctx context.Context) (func(), error) {
+		return s.cfg.Gate.Acquire(ctx, WatchQuoteMethod)
+	}
+	var sendErr error
+	err = s.chains.WatchQuote(ctx, chainID, p.pool, p.src, p.dst, p.amount, s.cfg.PollInterval, admit, func(q *service.Quote) error {
+		sendErr = stream.Send(quoteMessage(q))
+		return sendErr
+	})
+	switch {
+	case sendErr != nil:
+		// The stream is broken; its error already carries a status.
+		return sendErr
+	case errors.Is(context.Cause(ctx), errServerShuttingDown):
+		err = errServerShuttingDown
+	}
+	return statusError(s.logger, "watch quote", err)
+}
+
+// quoteParams are the validated fields of a request. The service is held
+// until release is called.
+type quoteParams struct {
+	svc            *service.EstimateService
+	release        func()
+	pool, src, dst common.Address
+	amount         *big.Int
+}
+
+// parse validates the fields shared by all requests. amountField names the
+// amount in errors.
+func (s *Server) parse(pool, src, dst, amountField, amount, chain string, chainID uint64) (*quoteParams, error) {
+	var p quoteParams
+	for _, f := range []struct {
+		name  string
+		value string
+		addr  *common.Address
+	}{
+		{"pool", pool, &p.pool},
+		{"src", src, &p.src},
+		{"dst", dst, &p.dst},
+	} {
+		if f.value == "" {
+			return nil, missingField(f.name)
+		}
+		if !common.IsHexAddress(f.value) {
+			return nil, invalidField(f.name, "a hex address")
+		}
+		*f.addr = common.HexToAddress(f.value)
+	}
+	if p.src == p.dst {
+		return nil, service.ErrSameToken
+	}
+
+	if amount == "" {
+		return nil, missingField(amountField)
+	}
+	n, ok := new(big.Int).SetString(amount, 10)
+	if !ok || n.Sign() <= 0 {
+		return nil, invalidField(amountField, "a positive base-10 integer")
+	}
+	p.amount = n
+
+	svc, release, err := s.chains.Acquire(chain, chainID)
+	if err != nil {
+		return nil, err
+	}
+	p.svc, p.release = svc, release
+	return &p, nil
+}
+
+func quoteMessage(q *service.Quote) *Quote {
+	return &Quote{
+		Block:     q.Block.Uint64(),
+		AmountIn:  q.AmountIn.String(),
+		AmountOut: q.AmountOut.String(),
+	}
+}
@@ -0,0 +1,403 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/nulln0ne/uniswap-estimator/internal/auth"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var (
+	token0     = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1     = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool       = common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	emptyPool  = common.HexToAddress("0x0000000000000000000000000000000000000def")
+	brokenPool = common.HexToAddress("0x0000000000000000000000000000000000000bad")
+)
+
+// poolReader serves the storage of pool at any block. Reads of brokenPool
+// fail like an unreachable endpoint.
+type poolReader struct {
+	head atomic.Uint64
+}
+
+func (r *poolReader) BlockNumber(context.Context) (uint64, error) { return r.head.Load(), nil }
+
+func (r *poolReader) StorageAt(_ context.Context, account common.Address, key common.Hash, _ *big.Int) ([]byte, error) {
+	if account == brokenPool {
+		return nil, errors.New("dial tcp 10.0.0.1:8545: connection refused")
+	}
+	if account != pool {
+		return make([]byte, 32), nil
+	}
+	switch key {
+	case common.BigToHash(big.NewInt(6)):
+		return common.LeftPadBytes(token0.Bytes(), 32), nil
+	case common.BigToHash(big.NewInt(7)):
+		return common.LeftPadBytes(token1.Bytes(), 32), nil
+	case common.BigToHash(big.NewInt(8)):
+		// reserve0 = 1,000,000 and reserve1 = 2,000,000, packed above a zero
+		// timestamp.
+		v := new(big.Int).Lsh(big.NewInt(2_000_000), 112)
+		v.Or(v, big.NewInt(1_000_000))
+		return common.LeftPadBytes(v.Bytes(), 32), nil
+	}
+	return make([]byte, 32), nil
+}
+
+func (r *poolReader) BatchStorageAt(ctx context.Context, reqs []eth.StorageRequest, bn *big.Int) ([][]byte, error) {
+	out := make([][]byte, len(reqs))
+	for i, req := range reqs {
+		v, err := r.StorageAt(ctx, req.Account, req.Key, bn)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (r *poolReader) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	return &types.Header{Number: new(big.Int).SetUint64(r.head.Load())}, nil
+}
+
+// newTestServer serves a Server accepting keys over bufconn and returns a
+// client of it.
+func newTestServer(t *testing.T, reader *poolReader, keys *auth.Keys) (*Server, EstimatorClient) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	chains, err := service.NewChainSet(service.NewEstimateService(logger, reader, service.WithChain(service.Chain{Name: "ethereum", ID: 1, DefaultFeeBps: 30})))
+	if err != nil {
+		t.Fatalf("NewChainSet error: %v", err)
+	}
+	srv := New(logger, chains, Config{RequestTimeout: 5 * time.Second, PollInterval: 10 * time.Millisecond, Keys: keys})
+
+	lis := bufconn.Listen(1 << 20)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("grpc.NewClient error: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return srv, NewEstimatorClient(conn)
+}
+
+// checkStatus fails the test unless err is a status with code c whose
+// ErrorInfo reason is reason.
+func checkStatus(t *testing.T, err error, c codes.Code, reason service.Code) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	if !ok || st.Code() != c {
+		t.Fatalf("unexpected error: got %v want code %s", err, c)
+	}
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			if info.Reason != string(reason) || info.Domain != ErrorDomain {
+				t.Fatalf("unexpected error info: %v", info)
+			}
+			return
+		}
+	}
+	t.Fatalf("status %v has no ErrorInfo detail", st)
+}
+
+func TestEstimate(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	_, client := newTestServer(t, reader, nil)
+
+	valid := func() *EstimateRequest {
+		return &EstimateRequest{Pool: pool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"}
+	}
+	with := func(edit func(*EstimateRequest)) *EstimateRequest {
+		req := valid()
+		edit(req)
+		return req
+	}
+
+	tests := []struct {
+		name   string
+		req    *EstimateRequest
+		code   codes.Code
+		reason service.Code
+	}{
+		{name: "success", req: valid(), code: codes.OK},
+		{name: "chain by id", req: with(func(r *EstimateRequest) { r.ChainId = 1 }), code: codes.OK},
+		{name: "missing pool", req: with(func(r *EstimateRequest) { r.Pool = "" }), code: codes.InvalidArgument, reason: service.CodeMissingParameter},
+		{name: "invalid src", req: with(func(r *EstimateRequest) { r.Src = "0x123" }), code: codes.InvalidArgument, reason: service.CodeInvalidParameter},
+		{name: "zero amount", req: with(func(r *EstimateRequest) { r.AmountIn = "0" }), code: codes.InvalidArgument, reason: service.CodeInvalidParameter},
+		{name: "same token", req: with(func(r *EstimateRequest) { r.Dst = r.Src }), code: codes.InvalidArgument, reason: service.CodeSameToken},
+		{name: "unknown chain", req: with(func(r *EstimateRequest) { r.Chain = "base" }), code: codes.InvalidArgument, reason: service.CodeUnknownChain},
+		{name: "pair mismatch", req: with(func(r *EstimateRequest) { r.Dst = pool.Hex() }), code: codes.InvalidArgument, reason: service.CodePairMismatch},
+		{name: "pool not found", req: with(func(r *EstimateRequest) { r.Pool = emptyPool.Hex() }), code: codes.NotFound, reason: service.CodePoolNotFound},
+		{name: "rpc unavailable", req: with(func(r *EstimateRequest) { r.Pool = brokenPool.Hex() }), code: codes.Unavailable, reason: service.CodeRPCUnavailable},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := client.Estimate(context.Background(), tc.req)
+			if tc.code != codes.OK {
+				checkStatus(t, err, tc.code, tc.reason)
+				if status.Convert(err).Message() == "" || tc.code == codes.Unavailable && status.Convert(err).Message() != errRPCUnavailable.Message {
+					t.Fatalf("unexpected message: %q", status.Convert(err).Message())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Estimate error: %v", err)
+			}
+			if q.Block != 42 || q.AmountIn != "1000" || q.AmountOut != "1992" {
+				t.Fatalf("unexpected quote: %v", q)
+			}
+		})
+	}
+}
+
+func TestEstimateIn(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	_, client := newTestServer(t, reader, nil)
+
+	req := &EstimateInRequest{Pool: pool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountOut: "1992"}
+	q, err := client.EstimateIn(context.Background(), req)
+	if err != nil {
+		t.Fatalf("EstimateIn error: %v", err)
+	}
+	if q.Block != 42 || q.AmountIn != "1000" || q.AmountOut != "1992" {
+		t.Fatalf("unexpected quote: %v", q)
+	}
+
+	req.AmountOut = "2000000"
+	_, err = client.EstimateIn(context.Background(), req)
+	checkStatus(t, err, codes.FailedPrecondition, service.CodeInsufficientLiquidity)
+
+	req.AmountOut = ""
+	_, err = client.EstimateIn(context.Background(), req)
+	checkStatus(t, err, codes.InvalidArgument, service.CodeMissingParameter)
+	if msg := status.Convert(err).Message(); msg != "amount_out is required" {
+		t.Fatalf("unexpected message: %q", msg)
+	}
+}
+
+func TestEstimateBatch(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	_, client := newTestServer(t, reader, nil)
+
+	req := &EstimateBatchRequest{Requests: []*EstimateRequest{
+		{Pool: pool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"},
+		{Pool: emptyPool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"},
+		{Pool: pool.Hex(), Src: token1.Hex(), Dst: token0.Hex(), AmountIn: "abc"},
+		{Pool: pool.Hex(), Src: token1.Hex(), Dst: token0.Hex(), AmountIn: "2000"},
+	}}
+	resp, err := client.EstimateBatch(context.Background(), req)
+	if err != nil {
+		t.Fatalf("EstimateBatch error: %v", err)
+	}
+	if len(resp.Results) != len(req.Requests) {
+		t.Fatalf("unexpected result count: got %d want %d", len(resp.Results), len(req.Requests))
+	}
+	if q := resp.Results[0].GetQuote(); q == nil || q.AmountOut != "1992" {
+		t.Fatalf("unexpected result 0: %v", resp.Results[0])
+	}
+	if e := resp.Results[1].GetError(); e == nil || e.Code != string(service.CodePoolNotFound) {
+		t.Fatalf("unexpected result 1: %v", resp.Results[1])
+	}
+	if e := resp.Results[2].GetError(); e == nil || e.Code != string(service.CodeInvalidParameter) {
+		t.Fatalf("unexpected result 2: %v", resp.Results[2])
+	}
+	if q := resp.Results[3].GetQuote(); q == nil || q.AmountOut != "996" {
+		t.Fatalf("unexpected result 3: %v", resp.Results[3])
+	}
+
+	_, err = client.EstimateBatch(context.Background(), &EstimateBatchRequest{})
+	checkStatus(t, err, codes.InvalidArgument, service.CodeInvalidParameter)
+}
+
+func TestGate(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	srv, client := newTestServer(t, reader, nil)
+	gate := limits.NewGate(slog.New(slog.NewTextHandler(io.Discard, nil)), limits.ConcurrencyConfig{Limit: 1})
+	srv.cfg.Gate = gate
+
+	// With the only slot held, e.g. by an HTTP request, calls are shed.
+	release, err := gate.Acquire(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	req := &EstimateRequest{Pool: pool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"}
+	_, err = client.Estimate(context.Background(), req)
+	checkStatus(t, err, codes.Unavailable, CodeOverloaded)
+	resp, err := client.EstimateBatch(context.Background(), &EstimateBatchRequest{Requests: []*EstimateRequest{req}})
+	if err != nil {
+		t.Fatalf("EstimateBatch error: %v", err)
+	}
+	if e := resp.Results[0].GetError(); e == nil || e.Code != string(CodeOverloaded) {
+		t.Fatalf("unexpected batch result: %v", resp.Results[0])
+	}
+
+	release()
+	if _, err := client.Estimate(context.Background(), req); err != nil {
+		t.Fatalf("Estimate error after release: %v", err)
+	}
+}
+
+func TestWatchQuote(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	srv, client := newTestServer(t, reader, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchQuote(ctx, &EstimateRequest{Pool: pool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"})
+	if err != nil {
+		t.Fatalf("WatchQuote error: %v", err)
+	}
+
+	for _, block := range []uint64{42, 43} {
+		q, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv error: %v", err)
+		}
+		if q.Block != block || q.AmountOut != "1992" {
+			t.Fatalf("unexpected quote: got %v want block %d", q, block)
+		}
+		reader.head.Add(1)
+	}
+
+	// Shutting down ends the stream instead of waiting for the client.
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown error: %v", err)
+	}
+	for {
+		if _, err = stream.Recv(); err != nil {
+			break
+		}
+	}
+	checkStatus(t, err, codes.Unavailable, service.CodeRequestCanceled)
+}
+
+func TestWatchQuoteInvalid(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	_, client := newTestServer(t, reader, nil)
+
+	stream, err := client.WatchQuote(context.Background(), &EstimateRequest{Pool: emptyPool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"})
+	if err != nil {
+		t.Fatalf("WatchQuote error: %v", err)
+	}
+	_, err = stream.Recv()
+	checkStatus(t, err, codes.NotFound, service.CodePoolNotFound)
+}
+
+func TestWatchQuoteFollowsReload(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	srv, client := newTestServer(t, reader, nil)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := client.WatchQuote(ctx, &EstimateRequest{Pool: pool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"})
+	if err != nil {
+		t.Fatalf("WatchQuote error: %v", err)
+	}
+	if q, err := stream.Recv(); err != nil || q.Block != 42 {
+		t.Fatalf("Recv = %v, %v", q, err)
+	}
+
+	// A reload replacing the chain's service moves the stream to the new one.
+	next := &poolReader{}
+	next.head.Store(100)
+	if _, err := srv.chains.Replace(service.NewEstimateService(logger, next, service.WithChain(service.Chain{Name: "ethereum", ID: 1, DefaultFeeBps: 30}))); err != nil {
+		t.Fatalf("Replace error: %v", err)
+	}
+	if q, err := stream.Recv(); err != nil || q.Block != 100 {
+		t.Fatalf("Recv = %v, %v", q, err)
+	}
+
+	// A reload removing the chain ends the stream with an error.
+	if _, err := srv.chains.Replace(service.NewEstimateService(logger, next, service.WithChain(service.Chain{Name: "bsc", ID: 56}))); err != nil {
+		t.Fatalf("Replace error: %v", err)
+	}
+	_, err = stream.Recv()
+	checkStatus(t, err, codes.InvalidArgument, service.CodeUnknownChain)
+}
+
+func TestAPIKey(t *testing.T) {
+	t.Parallel()
+
+	reader := &poolReader{}
+	reader.head.Store(42)
+	_, client := newTestServer(t, reader, auth.NewKeys([]auth.Key{{Name: "partner", Hash: auth.Hash("secret"), DailyQuota: 2}}))
+
+	req := &EstimateRequest{Pool: pool.Hex(), Src: token0.Hex(), Dst: token1.Hex(), AmountIn: "1000"}
+	call := func(md ...string) error {
+		ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs(md...))
+		_, err := client.Estimate(ctx, req)
+		return err
+	}
+	checkStatus(t, call(), codes.Unauthenticated, service.CodeUnauthorized)
+	checkStatus(t, call(APIKeyMetadata, "nope"), codes.Unauthenticated, service.CodeUnauthorized)
+	if err := call(APIKeyMetadata, "secret"); err != nil {
+		t.Fatalf("key metadata: %v", err)
+	}
+
+	// Streams are charged when they open.
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	stream, err := client.WatchQuote(ctx, req)
+	if err != nil {
+		t.Fatalf("WatchQuote error: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv error: %v", err)
+	}
+
+	err = call(APIKeyMetadata, "secret")
+	checkStatus(t, err, codes.ResourceExhausted, service.CodeQuotaExceeded)
+	for _, d := range status.Convert(err).Details() {
+		if ri, ok := d.(*errdetails.RetryInfo); ok && ri.RetryDelay.AsDuration() > 0 {
+			return
+		}
+	}
+	t.Fatalf("status %v has no RetryInfo detail", err)
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/auth"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// APIKeyHeader carries the API key of a request. A bearer token in the
+// Authorization header is accepted as well.
+const APIKeyHeader = "X-API-Key"
+
+// apiKeyChallenge is the WWW-Authenticate header of 401 responses.
+const apiKeyChallenge = `Bearer realm="uniswap-estimator"`
+
+// APIKey returns a middleware that authenticates requests by API key and
+// charges them to the key's rate and daily quota. Allowed requests are
+// attributed to the key's name in the request log, the metrics and the
+// request's span. Every request is allowed while keys is empty.
+func APIKey(logger *slog.Logger, keys *auth.Keys) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		if !keys.Enabled() {
+			return c.Next()
+		}
+		start := time.Now()
+		name, err := keys.Allow(apiKeySecret(c))
+		if err != nil {
+			return apiKeyError(logger, c, name, err)
+		}
+		metrics.APIKeyRequest(name, metrics.APIKeyAllowed)
+		trace.SpanFromContext(requestContext(c)).SetAttributes(attribute.String("api_key.name", name))
+
+		err = c.Next()
+		logger.Info("api request", "api_key", name, "method", c.Method(), "path", c.Path(),
+			"status", responseStatus(c, err), "duration", time.Since(start))
+		return err
+	}
+}
+
+// apiKeySecret returns the API key of c, from APIKeyHeader or a bearer token.
+func apiKeySecret(c fiber.Ctx) string {
+	if key := c.Get(APIKeyHeader); key != "" {
+		return key
+	}
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// apiKeyError records and logs a request refused by the key check and
+// returns its API error. name is the key's name if the key was valid.
+func apiKeyError(logger *slog.Logger, c fiber.Ctx, name string, err error) error {
+	var le *auth.LimitError
+	switch {
+	case errors.Is(err, auth.ErrMissingKey):
+		metrics.APIKeyRequest("", metrics.APIKeyMissing)
+		c.Set(fiber.HeaderWWWAuthenticate, apiKeyChallenge)
+		return ErrAPIKeyRequired
+	case errors.As(err, &le):
+		logger.Warn("api key over limit", "api_key", name, "method", c.Method(), "path", c.Path(), "err", err)
+		setRetryAfter(c, le.RetryAfter)
+		if le.Daily {
+			metrics.APIKeyRequest(name, metrics.APIKeyQuotaExceeded)
+			return ErrAPIKeyQuotaExceeded
+		}
+		metrics.APIKeyRequest(name, metrics.APIKeyRateLimited)
+		return ErrAPIKeyRateLimited
+	default:
+		logger.Warn("invalid api key", "ip", c.IP(), "method", c.Method(), "path", c.Path())
+		metrics.APIKeyRequest("", metrics.APIKeyInvalid)
+		c.Set(fiber.HeaderWWWAuthenticate, apiKeyChallenge)
+		return ErrInvalidAPIKey
+	}
+}
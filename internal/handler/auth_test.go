@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/auth"
+)
+
+func TestAPIKey(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	keys := auth.NewKeys([]auth.Key{
+		{Name: "authtest-rate", Hash: auth.Hash("rate-secret"), RatePerSec: 0.5, Burst: 1},
+		{Name: "authtest-quota", Hash: auth.Hash("quota-secret"), DailyQuota: 1},
+	})
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/metrics", MetricsHandler())
+	app.Get("/estimate", APIKey(logger, keys), func(c fiber.Ctx) error { return c.SendString("ok") })
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		status     int
+		code       string
+		retryAfter string
+	}{
+		{name: "missing key", status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "invalid key", header: APIKeyHeader, value: "nope", status: http.StatusUnauthorized, code: CodeUnauthorized},
+		{name: "key header", header: APIKeyHeader, value: "rate-secret", status: http.StatusOK},
+		{name: "rate limited", header: APIKeyHeader, value: "rate-secret", status: http.StatusTooManyRequests, code: CodeRateLimited, retryAfter: "2"},
+		{name: "bearer token", header: fiber.HeaderAuthorization, value: "Bearer quota-secret", status: http.StatusOK},
+		{name: "quota exceeded", header: fiber.HeaderAuthorization, value: "bearer quota-secret", status: http.StatusTooManyRequests, code: CodeQuotaExceeded},
+		{name: "other scheme", header: fiber.HeaderAuthorization, value: "Basic quota-secret", status: http.StatusUnauthorized, code: CodeUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/estimate", nil)
+			if tc.header != "" {
+				req.Header.Set(tc.header, tc.value)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("unexpected status %d, want %d", resp.StatusCode, tc.status)
+			}
+			if tc.code == "" {
+				return
+			}
+			var p ProblemDetails
+			if err := json.NewDecoder(resp.Body).Decode(&p); err != nil || p.Code != tc.code {
+				t.Fatalf("unexpected problem %+v (%v), want code %s", p, err, tc.code)
+			}
+			switch tc.status {
+			case http.StatusUnauthorized:
+				if resp.Header.Get(fiber.HeaderWWWAuthenticate) == "" {
+					t.Fatal("missing WWW-Authenticate header")
+				}
+			case http.StatusTooManyRequests:
+				if got := resp.Header.Get(fiber.HeaderRetryAfter); got == "" || (tc.retryAfter != "" && got != tc.retryAfter) {
+					t.Fatalf("unexpected Retry-After %q, want %q", got, tc.retryAfter)
+				}
+			}
+		})
+	}
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`uniswap_estimator_auth_requests_total{key="authtest-rate",result="allowed"} 1`,
+		`uniswap_estimator_auth_requests_total{key="authtest-rate",result="rate_limited"} 1`,
+		`uniswap_estimator_auth_requests_total{key="authtest-quota",result="quota_exceeded"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+func TestAPIKeyDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", APIKey(logger, auth.NewKeys(nil)), func(c fiber.Ctx) error { return c.SendString("ok") })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/estimate", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d without configured keys", resp.StatusCode)
+	}
+}
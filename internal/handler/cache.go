@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// ResponseCacheConfig configures a ResponseCache.
+type ResponseCacheConfig struct {
+	// MaxEntries bounds the responses kept per chain; zero disables the
+	// cache.
+	MaxEntries int
+	// HeadRefresh is how long the latest block of a chain is trusted before
+	// it is read again to look for a new one.
+	HeadRefresh time.Duration
+}
+
+// ResponseCache holds /estimate responses computed at the latest block of
+// each chain, keyed by the normalized request. A chain's responses are
+// dropped as soon as a new block is seen. A nil *ResponseCache caches
+// nothing.
+type ResponseCache struct {
+	cfg ResponseCacheConfig
+
+	mu     sync.Mutex
+	chains map[string]*chainResponses
+}
+
+// chainResponses are the cached responses of one chain at head.
+type chainResponses struct {
+	head    *service.Head
+	checked time.Time
+	bodies  map[string]string
+}
+
+// NewResponseCache returns a ResponseCache configured by cfg, or nil when
+// cfg.MaxEntries is zero.
+func NewResponseCache(cfg ResponseCacheConfig) *ResponseCache {
+	if cfg.MaxEntries <= 0 {
+		return nil
+	}
+	return &ResponseCache{cfg: cfg, chains: make(map[string]*chainResponses)}
+}
+
+// head returns the latest block of svc's chain, reading it when the known
+// one is older than HeadRefresh. A block with a new hash invalidates the
+// chain's responses; a node answering with an older block than the known
+// one does not move the head back.
+func (rc *ResponseCache) head(ctx context.Context, svc *service.EstimateService) (*service.Head, error) {
+	name := svc.Chain().Name
+	rc.mu.Lock()
+	if cr := rc.chains[name]; cr != nil && time.Since(cr.checked) < rc.cfg.HeadRefresh {
+		head := cr.head
+		rc.mu.Unlock()
+		return head, nil
+	}
+	rc.mu.Unlock()
+
+	head, err := svc.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	cr := rc.chains[name]
+	if cr == nil {
+		cr = &chainResponses{}
+		rc.chains[name] = cr
+	}
+	if cr.head == nil || (head.Hash != cr.head.Hash && head.Number.Cmp(cr.head.Number) >= 0) {
+		cr.head = head
+		cr.bodies = make(map[string]string)
+	}
+	cr.checked = time.Now()
+	return cr.head, nil
+}
+
+// expire makes the next lookup on chain read its latest block again.
+func (rc *ResponseCache) expire(chain string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if cr := rc.chains[chain]; cr != nil {
+		cr.checked = time.Time{}
+	}
+}
+
+// get returns the response to key on chain computed at the block hash.
+func (rc *ResponseCache) get(chain string, hash common.Hash, key string) (string, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	cr := rc.chains[chain]
+	if cr == nil || cr.head.Hash != hash {
+		return "", false
+	}
+	body, ok := cr.bodies[key]
+	return body, ok
+}
+
+// put stores the response to key on chain computed at the block hash,
+// unless the chain has moved past it.
+func (rc *ResponseCache) put(chain string, hash common.Hash, key, body string) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	cr := rc.chains[chain]
+	if cr == nil || cr.head.Hash != hash {
+		return
+	}
+	if _, ok := cr.bodies[key]; !ok && len(cr.bodies) >= rc.cfg.MaxEntries {
+		for k := range cr.bodies {
+			delete(cr.bodies, k)
+			break
+		}
+	}
+	cr.bodies[key] = body
+}
+
+// estimateKey normalizes an estimate request: the chain is the resolved
+// name, whichever way the request selected it, and addresses and amount are
+// in canonical form.
+func estimateKey(chain string, pool, src, dst common.Address, amountIn *big.Int) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s", chain, pool.Hex(), src.Hex(), dst.Hex(), amountIn)
+}
+
+// entityTag returns the strong ETag of the response to key at the block
+// hash.
+func entityTag(key string, hash common.Hash) string {
+	sum := sha256.Sum256(append([]byte(key), hash.Bytes()...))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchesETag reports whether the If-None-Match header of c lists etag.
+// Weak tags compare equal to strong ones, as RFC 9110 requires for
+// If-None-Match. "*" matches nothing: the tag is checked before the request
+// is answered, so it cannot tell whether an estimate exists.
+func matchesETag(c fiber.Ctx, etag string) bool {
+	header := c.Get(fiber.HeaderIfNoneMatch)
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// setCacheHeaders marks the response as computed at head: clients may reuse
+// it until the next block is expected, blockTime after head, and revalidate
+// it with etag afterwards. An unknown block time allows no reuse without
+// revalidation.
+func setCacheHeaders(c fiber.Ctx, etag string, head *service.Head, blockTime time.Duration) {
+	maxAge := max(time.Until(head.Time.Add(blockTime)), 0)
+	c.Set(fiber.HeaderETag, etag)
+	c.Set(fiber.HeaderCacheControl, fmt.Sprintf("private, max-age=%d", int(maxAge/time.Second)))
+}
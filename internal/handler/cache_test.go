@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// headerEth is a fakeEth serving a latest header that tests can advance. It
+// counts the storage reads of quotes.
+type headerEth struct {
+	*fakeEth
+	head     atomic.Uint64
+	headTime atomic.Int64
+	reads    atomic.Int64
+}
+
+func (f *headerEth) BlockNumber(context.Context) (hexutil.Uint64, error) {
+	return hexutil.Uint64(f.head.Load()), nil
+}
+
+func (f *headerEth) GetBlockByNumber(ctx context.Context, number gethrpc.BlockNumber, full bool) (*types.Header, error) {
+	return &types.Header{Number: new(big.Int).SetUint64(f.head.Load()), Difficulty: big.NewInt(0), Time: uint64(f.headTime.Load())}, nil
+}
+
+func (f *headerEth) GetStorageAt(ctx context.Context, addr common.Address, position common.Hash, block gethrpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	f.reads.Add(1)
+	return f.fakeEth.GetStorageAt(ctx, addr, position, block)
+}
+
+func TestEstimateResponseCache(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &headerEth{fakeEth: &fakeEth{storage: map[common.Address]map[common.Hash][]byte{pool: {
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}}
+	fe.head.Store(42)
+	fe.headTime.Store(time.Now().Unix())
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	client := gethrpc.DialInProc(srv)
+	t.Cleanup(client.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ethclient.NewClient(client)),
+		service.WithChain(service.Chain{Name: "ethereum", ID: 1, BlockTime: 12 * time.Second}))
+	// A zero HeadRefresh reads the head on every request, so new blocks are
+	// seen at once.
+	h := NewEstimateHandler(logger, svc).WithResponseCache(NewResponseCache(ResponseCacheConfig{MaxEntries: 10}))
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", h.Handle())
+
+	query := "/estimate?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex()
+	get := func(t *testing.T, target, ifNoneMatch string) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if ifNoneMatch != "" {
+			req.Header.Set(fiber.HeaderIfNoneMatch, ifNoneMatch)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, want := get(t, query+"&src_amount=1000", "")
+	etag := resp.Header.Get(fiber.HeaderETag)
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("unexpected response %d %q, ETag %q", resp.StatusCode, want, etag)
+	}
+	// The head is stamped with whole seconds, up to a second before now, and
+	// the request may take another second to be answered.
+	cc := resp.Header.Get(fiber.HeaderCacheControl)
+	age, ok := strings.CutPrefix(cc, "private, max-age=")
+	if n, err := strconv.Atoi(age); !ok || err != nil || n < 10 || n > 12 {
+		t.Fatalf("unexpected Cache-Control %q", cc)
+	}
+	reads := fe.reads.Load()
+
+	t.Run("hit", func(t *testing.T) {
+		// The same request, selecting the chain by ID and padding the amount.
+		resp, body := get(t, query+"&chain_id=1&src_amount=01000", "")
+		if resp.StatusCode != http.StatusOK || body != want || resp.Header.Get(fiber.HeaderETag) != etag {
+			t.Fatalf("unexpected response %d %q, ETag %q", resp.StatusCode, body, resp.Header.Get(fiber.HeaderETag))
+		}
+		if fe.reads.Load() != reads {
+			t.Fatal("cached response was computed again")
+		}
+	})
+
+	t.Run("other request", func(t *testing.T) {
+		resp, _ := get(t, query+"&src_amount=2000", "")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get(fiber.HeaderETag) == etag {
+			t.Fatalf("unexpected response %d, ETag %q", resp.StatusCode, resp.Header.Get(fiber.HeaderETag))
+		}
+		reads = fe.reads.Load()
+	})
+
+	for name, header := range map[string]string{"strong": etag, "weak": "W/" + etag, "list": `"other", ` + etag} {
+		t.Run("not modified "+name, func(t *testing.T) {
+			resp, body := get(t, query+"&src_amount=1000", header)
+			if resp.StatusCode != http.StatusNotModified || body != "" || resp.Header.Get(fiber.HeaderETag) != etag {
+				t.Fatalf("unexpected response %d %q, ETag %q", resp.StatusCode, body, resp.Header.Get(fiber.HeaderETag))
+			}
+		})
+	}
+	if fe.reads.Load() != reads {
+		t.Fatal("not modified response was computed")
+	}
+
+	t.Run("any", func(t *testing.T) {
+		// "*" revalidates nothing, not even a request that cannot be answered.
+		if resp, body := get(t, query+"&src_amount=1000", "*"); resp.StatusCode != http.StatusOK || body != want {
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+		}
+		missing := common.HexToAddress("0x0000000000000000000000000000000000000def")
+		target := "/estimate?pool=" + missing.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000"
+		if resp, _ := get(t, target, "*"); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("unexpected status %d for an unknown pool", resp.StatusCode)
+		}
+		reads = fe.reads.Load()
+	})
+
+	t.Run("new head", func(t *testing.T) {
+		fe.head.Add(1)
+		resp, body := get(t, query+"&src_amount=1000", etag)
+		if resp.StatusCode != http.StatusOK || body != want {
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+		}
+		if tag := resp.Header.Get(fiber.HeaderETag); tag == "" || tag == etag {
+			t.Fatalf("ETag %q not renewed", tag)
+		}
+		if fe.reads.Load() == reads {
+			t.Fatal("response of the previous block served")
+		}
+	})
+
+	t.Run("late block", func(t *testing.T) {
+		fe.headTime.Store(time.Now().Add(-time.Minute).Unix())
+		resp, _ := get(t, query+"&src_amount=3000", "")
+		if cc := resp.Header.Get(fiber.HeaderCacheControl); !strings.HasSuffix(cc, "max-age=0") {
+			t.Fatalf("unexpected Cache-Control %q for a late block", cc)
+		}
+	})
+}
+
+func TestEstimateKey(t *testing.T) {
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	src := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	dst := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	key := estimateKey("ethereum", pool, src, dst, big.NewInt(1000))
+	for name, other := range map[string]string{
+		"chain":     estimateKey("bsc", pool, src, dst, big.NewInt(1000)),
+		"direction": estimateKey("ethereum", pool, dst, src, big.NewInt(1000)),
+		"amount":    estimateKey("ethereum", pool, src, dst, big.NewInt(1001)),
+	} {
+		if other == key {
+			t.Errorf("%s not part of the key %q", name, key)
+		}
+	}
+	if entityTag(key, common.Hash{1}) == entityTag(key, common.Hash{2}) {
+		t.Error("ETag does not depend on the block")
+	}
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// Deadline returns a middleware that bounds the work of the request by
+// timeout. The optional timeout_ms query parameter shortens the deadline but
+// cannot extend it past timeout; a zero timeout leaves only timeout_ms. The
+// request context is also canceled when the server shuts down. Handlers
+// receive the bounded context through requestContext and map its expiry to
+// ErrDeadlineExceeded.
+//
+// fasthttp does not report client disconnects, so the deadline is what stops
+// work for a client that went away.
+func Deadline(timeout time.Duration) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		d := timeout
+		if v := c.Query("timeout_ms"); v != "" {
+			ms, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || ms == 0 {
+				return ErrInvalidTimeout
+			}
+			if t := time.Duration(ms) * time.Millisecond; d <= 0 || t < d {
+				d = t
+			}
+		}
+
+		var ctx context.Context
+		var cancel context.CancelFunc
+		if d > 0 {
+			ctx, cancel = context.WithTimeout(requestContext(c), d)
+		} else {
+			ctx, cancel = context.WithCancel(requestContext(c))
+		}
+		defer cancel()
+		stop := context.AfterFunc(c.RequestCtx(), cancel)
+		defer stop()
+
+		c.Locals(requestContextKey{}, ctx)
+		return c.Next()
+	}
+}
@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// slowEth delays every storage read.
+type slowEth struct {
+	*fakeEth
+	delay time.Duration
+}
+
+func (f *slowEth) GetStorageAt(ctx context.Context, addr common.Address, position common.Hash, block gethrpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return f.fakeEth.GetStorageAt(ctx, addr, position, block)
+}
+
+func TestDeadline(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	target := "/estimate?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000"
+
+	// newHandler serves the estimate from a node answering storage reads
+	// after delay.
+	newHandler := func(t *testing.T, delay time.Duration) *EstimateHandler {
+		fe := &slowEth{delay: delay, fakeEth: &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {
+			common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+			common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+			common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+		}}}}
+		srv := gethrpc.NewServer()
+		if err := srv.RegisterName("eth", fe); err != nil {
+			t.Fatalf("register rpc service: %v", err)
+		}
+		rc := gethrpc.DialInProc(srv)
+		t.Cleanup(rc.Close)
+		return NewEstimateHandler(logger, service.NewEstimateService(logger, eth.NewClientReader(ethclient.NewClient(rc))))
+	}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		query   string
+		status  int
+		body    string
+	}{
+		{name: "within deadline", timeout: 5 * time.Second, status: http.StatusOK},
+		{name: "configured deadline", timeout: 20 * time.Millisecond, status: http.StatusGatewayTimeout, body: ErrDeadlineExceeded.Message},
+		{name: "timeout_ms shortens", timeout: time.Minute, query: "&timeout_ms=20", status: http.StatusGatewayTimeout, body: ErrDeadlineExceeded.Message},
+		{name: "timeout_ms cannot extend", timeout: 20 * time.Millisecond, query: "&timeout_ms=60000", status: http.StatusGatewayTimeout, body: ErrDeadlineExceeded.Message},
+		{name: "timeout_ms without configured deadline", query: "&timeout_ms=20", status: http.StatusGatewayTimeout, body: ErrDeadlineExceeded.Message},
+		{name: "invalid timeout_ms", timeout: 5 * time.Second, query: "&timeout_ms=0", status: http.StatusBadRequest, body: ErrInvalidTimeout.Message},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// Reads that should be cut never answer before the test's own
+			// timeout, so only the deadline can end the request.
+			delay := time.Duration(0)
+			if tc.status == http.StatusGatewayTimeout {
+				delay = time.Hour
+			}
+			h := newHandler(t, delay)
+
+			var ctxErr error
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/estimate", Deadline(tc.timeout), func(c fiber.Ctx) error {
+				err := c.Next()
+				ctxErr = requestContext(c).Err()
+				return err
+			}, h.Handle())
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, target+tc.query, nil), fiber.TestConfig{Timeout: 10 * time.Second})
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("unexpected status: got %d want %d", resp.StatusCode, tc.status)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if tc.body != "" && responseText(resp, body) != tc.body {
+				t.Fatalf("unexpected body: %q", body)
+			}
+			if tc.status == http.StatusGatewayTimeout && !errors.Is(ctxErr, context.DeadlineExceeded) {
+				t.Fatalf("handler context not cut at its deadline: %v", ctxErr)
+			}
+		})
+	}
+}
@@ -1,45 +1,237 @@
 package handler
 
-import "github.com/gofiber/fiber/v3"
+import (
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
 
 // ErrInvalidQueryParameters indicates that the request query string could not
 // be parsed into the expected structure.
-var ErrInvalidQueryParameters = fiber.NewError(fiber.StatusBadRequest, "invalid query parameters")
+var ErrInvalidQueryParameters = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid query parameters")
 
 // ErrSameAddresses is returned when src and dst addresses are identical.
-var ErrSameAddresses = fiber.NewError(fiber.StatusBadRequest, "src and dst addresses cannot be the same")
+var ErrSameAddresses = newProblem(fiber.StatusBadRequest, string(service.CodeSameToken), "src and dst addresses cannot be the same")
 
 // ErrAmountRequired is returned when the amount parameter is missing.
-var ErrAmountRequired = fiber.NewError(fiber.StatusBadRequest, "amount is required")
+var ErrAmountRequired = newProblem(fiber.StatusBadRequest, CodeMissingParameter, "amount is required")
 
 // ErrInvalidAmountFormat is returned when the amount cannot be parsed as a
 // base-10 integer.
-var ErrInvalidAmountFormat = fiber.NewError(fiber.StatusBadRequest, "invalid amount format")
+var ErrInvalidAmountFormat = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid amount format")
 
 // ErrAmountNonPositive is returned when the amount is zero or negative.
-var ErrAmountNonPositive = fiber.NewError(fiber.StatusBadRequest, "amount must be greater than zero")
+var ErrAmountNonPositive = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "amount must be greater than zero")
 
 // ErrSameTokenBadRequest maps a same-token validation failure to a 400 error.
-var ErrSameTokenBadRequest = fiber.NewError(fiber.StatusBadRequest, "src and dst tokens cannot be the same")
+var ErrSameTokenBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeSameToken), "src and dst tokens cannot be the same")
+
+// ErrPoolNotFound maps an address without a deployed pair to a 404 error.
+var ErrPoolNotFound = newProblem(fiber.StatusNotFound, string(service.CodePoolNotFound), "pool not found")
+
+// ErrPairMismatchBadRequest maps src/dst tokens that are not the pool's pair
+// to a 400 error.
+var ErrPairMismatchBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodePairMismatch), "src and dst are not the tokens of the pool")
 
 // ErrEmptyReservesBadRequest maps empty-reserve pool state to a 400 error.
-var ErrEmptyReservesBadRequest = fiber.NewError(fiber.StatusBadRequest, "pool has insufficient reserves")
+var ErrEmptyReservesBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeInsufficientLiquidity), "pool has insufficient reserves")
+
+// ErrInsufficientInputBadRequest maps an input amount too small to buy any
+// output to a 400 error.
+var ErrInsufficientInputBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeInsufficientInput), "input amount is too small")
 
-// ErrEstimationFailedInternal signals a generic server-side estimation error.
-var ErrEstimationFailedInternal = fiber.NewError(fiber.StatusInternalServerError, "estimation failed")
+// ErrRPCUnavailable signals an estimate or simulation that failed because the
+// RPC endpoints could not serve the reads.
+var ErrRPCUnavailable = newProblem(fiber.StatusBadGateway, CodeRPCUnavailable, "rpc endpoints unavailable")
 
 // NewInvalidAmountIn wraps an amount parsing error into a 400 Bad Request with
 // a descriptive message.
 func NewInvalidAmountIn(err error) error {
-	return fiber.NewError(fiber.StatusBadRequest, "invalid amount_in: "+err.Error())
+	return newProblem(fiber.StatusBadRequest, problemCode(err, CodeInvalidParameter), "invalid amount_in: "+err.Error())
+}
+
+// ErrAmountConflict is returned when an amount is given both in raw units
+// and in human units.
+var ErrAmountConflict = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "give either src_amount or src_amount_human")
+
+// NewInvalidHumanAmount wraps a human amount parsing error into a 400 Bad
+// Request with a descriptive message.
+func NewInvalidHumanAmount(err error) error {
+	return newProblem(fiber.StatusBadRequest, problemCode(err, CodeInvalidParameter), "invalid src_amount_human: "+err.Error())
 }
 
+// ErrNotERC20BadRequest is returned when the metadata of a token that is not
+// an ERC-20 is needed, e.g. to convert a human amount.
+var ErrNotERC20BadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeNotERC20), "token is not an ERC-20")
+
 // NewAddressRequired returns a 400 Bad Request for a missing address field.
 func NewAddressRequired(field string) error {
-	return fiber.NewError(fiber.StatusBadRequest, field+" address is required")
+	return newProblem(fiber.StatusBadRequest, CodeMissingParameter, field+" address is required")
+}
+
+// ErrInvalidLimit is returned when the limit parameter of /tokens is not an
+// integer between 1 and maxTokensLimit.
+var ErrInvalidLimit = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "limit must be an integer between 1 and "+strconv.Itoa(maxTokensLimit))
+
+// NewInvalidChecksum returns a 400 Bad Request for a mixed-case address
+// field whose EIP-55 checksum is wrong.
+func NewInvalidChecksum(field string) error {
+	return newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid checksum of "+field+" address")
+}
+
+// ErrUnknownTokenBadRequest maps a token symbol missing from the chain's token
+// list to a 400 error.
+var ErrUnknownTokenBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeUnknownToken), "unknown token symbol")
+
+// ErrAmbiguousSymbolBadRequest maps a token symbol shared by several listed
+// tokens to a 400 error.
+var ErrAmbiguousSymbolBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeAmbiguousSymbol), "ambiguous token symbol")
+
+// NewUnresolvedToken returns a 400 Bad Request for a token that the chain's
+// token list does not resolve or does not list, carrying the code and reason
+// of err.
+func NewUnresolvedToken(field string, err error) error {
+	return newProblem(fiber.StatusBadRequest, string(service.CodeOf(err)), "invalid "+field+": "+err.Error())
 }
 
 // NewInvalidAddress returns a 400 Bad Request for an invalid address format.
 func NewInvalidAddress(field string) error {
-	return fiber.NewError(fiber.StatusBadRequest, "invalid "+field+" address")
+	return newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid "+field+" address")
+}
+
+// ErrInvalidMode is returned when the mode parameter is not a supported value.
+var ErrInvalidMode = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "mode must be one of: latest, pending")
+
+// ErrPendingUnavailableNotImplemented maps a disabled pending mode to a 501
+// error.
+var ErrPendingUnavailableNotImplemented = newProblem(fiber.StatusNotImplemented, string(service.CodePendingUnavailable), "pending estimates are not enabled")
+
+// ErrInvalidRequestBody indicates that the request body could not be decoded
+// as the expected JSON document.
+var ErrInvalidRequestBody = newProblem(fiber.StatusBadRequest, CodeInvalidBody, "invalid request body")
+
+// ErrInvalidBlock is returned when a block number is not a non-negative
+// base-10 integer.
+var ErrInvalidBlock = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid block number")
+
+// ErrInvalidStepType is returned for simulation steps whose type is not swap,
+// mint or burn.
+var ErrInvalidStepType = newProblem(fiber.StatusBadRequest, string(service.CodeInvalidStep), "step type must be one of: swap, mint, burn")
+
+// ErrInvalidStepBadRequest maps an invalid simulation step to a 400 error.
+var ErrInvalidStepBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeInvalidStep), "invalid simulation step")
+
+// ErrQuorumNotReachedUnavailable maps a disagreement between RPC providers to
+// a 503 error.
+var ErrQuorumNotReachedUnavailable = newProblem(fiber.StatusServiceUnavailable, CodeQuorumNotReached, "rpc providers disagree on pool state")
+
+// ErrRPCRateLimited maps an exhausted RPC rate limit or daily budget to a 429
+// error.
+var ErrRPCRateLimited = newProblem(fiber.StatusTooManyRequests, CodeRateLimited, "rpc rate limit exceeded, retry later")
+
+// newRateLimited sets the Retry-After header from a rate limit error and
+// returns ErrRPCRateLimited.
+func newRateLimited(c fiber.Ctx, err error) error {
+	retryAfter := time.Second
+	var rl *eth.RateLimitError
+	if errors.As(err, &rl) {
+		retryAfter = rl.RetryAfter
+	}
+	setRetryAfter(c, retryAfter)
+	return ErrRPCRateLimited
+}
+
+// setRetryAfter sets the Retry-After header to d, rounded up to whole
+// seconds.
+func setRetryAfter(c fiber.Ctx, d time.Duration) {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(int(math.Ceil(d.Seconds())), 1)))
 }
+
+// ErrInvalidChainID is returned when chain_id is not a positive base-10
+// integer.
+var ErrInvalidChainID = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid chain_id")
+
+// ErrUnknownChainBadRequest is returned when the requested chain is not
+// configured.
+var ErrUnknownChainBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeUnknownChain), "unknown chain")
+
+// ErrChainMismatchBadRequest is returned when chain and chain_id name
+// different chains.
+var ErrChainMismatchBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodeChainMismatch), "chain and chain_id do not match")
+
+// ErrPoolNotFromFactoryBadRequest maps a pool whose address does not match
+// its factory's pair derivation to a 400 error.
+var ErrPoolNotFromFactoryBadRequest = newProblem(fiber.StatusBadRequest, string(service.CodePoolNotFromFactory), "pool was not deployed by its factory")
+
+// ErrInvalidTimeout is returned when timeout_ms is not a positive base-10
+// integer.
+var ErrInvalidTimeout = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "timeout_ms must be a positive integer")
+
+// ErrDeadlineExceeded maps an expired request deadline to a 504 error.
+var ErrDeadlineExceeded = newProblem(fiber.StatusGatewayTimeout, CodeDeadlineExceeded, "request deadline exceeded")
+
+// ErrRequestCanceled maps a request canceled by the server shutting down to a
+// 503 error.
+var ErrRequestCanceled = newProblem(fiber.StatusServiceUnavailable, CodeRequestCanceled, "request canceled")
+
+// ErrSubscriptionRequired is returned for a Server-Sent Events quote stream
+// without a sub parameter.
+var ErrSubscriptionRequired = newProblem(fiber.StatusBadRequest, CodeMissingParameter, "at least one sub is required")
+
+// ErrInvalidSubscription is returned when a sub parameter is not a
+// pool,src,dst,src_amount tuple.
+var ErrInvalidSubscription = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "sub must be pool,src,dst,src_amount")
+
+// ErrSubscriptionIDRequired is returned for a WebSocket command without an
+// id.
+var ErrSubscriptionIDRequired = newProblem(fiber.StatusBadRequest, CodeMissingParameter, "id is required")
+
+// ErrDuplicateSubscription is returned when a subscription reuses the id of
+// an active one on the same connection.
+var ErrDuplicateSubscription = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "subscription id already in use")
+
+// ErrUnknownSubscription is returned when unsubscribing an id that is not
+// subscribed.
+var ErrUnknownSubscription = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "unknown subscription id")
+
+// ErrInvalidStreamOp is returned for a WebSocket command whose op is not a
+// supported value.
+var ErrInvalidStreamOp = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "op must be one of: subscribe, unsubscribe")
+
+// ErrInvalidWebSocketHandshake is returned for an upgrade request that is
+// not a valid WebSocket handshake.
+var ErrInvalidWebSocketHandshake = newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid websocket handshake")
+
+// NewSubscriptionLimit returns a 400 Bad Request for a connection exceeding
+// max subscriptions.
+func NewSubscriptionLimit(max int) error {
+	return newProblem(fiber.StatusBadRequest, CodeSubscriptionLimit, "at most "+strconv.Itoa(max)+" subscriptions per connection")
+}
+
+// ErrAPIKeyRequired is returned for a request without an API key when
+// authentication is enabled.
+var ErrAPIKeyRequired = newProblem(fiber.StatusUnauthorized, CodeUnauthorized, "api key required")
+
+// ErrInvalidAPIKey is returned for a request whose API key is not accepted.
+var ErrInvalidAPIKey = newProblem(fiber.StatusUnauthorized, CodeUnauthorized, "invalid api key")
+
+// ErrAPIKeyRateLimited maps a request over the rate of its API key to a 429
+// error.
+var ErrAPIKeyRateLimited = newProblem(fiber.StatusTooManyRequests, CodeRateLimited, "api key rate limit exceeded, retry later")
+
+// ErrAPIKeyQuotaExceeded maps a request over the daily quota of its API key
+// to a 429 error.
+var ErrAPIKeyQuotaExceeded = newProblem(fiber.StatusTooManyRequests, CodeQuotaExceeded, "api key daily quota exhausted, retry tomorrow")
+
+// ErrClientRateLimited maps a request over the rate of its client address to
+// a 429 error.
+var ErrClientRateLimited = newProblem(fiber.StatusTooManyRequests, CodeRateLimited, "client rate limit exceeded, retry later")
+
+// ErrOverloaded is returned for a request shed because the concurrency cap
+// and its queue are full, or because it waited too long for a slot.
+var ErrOverloaded = newProblem(fiber.StatusServiceUnavailable, CodeOverloaded, "server overloaded, retry later")
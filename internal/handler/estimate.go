@@ -2,43 +2,120 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"math/big"
+	"strconv"
+	"strings"
 
 	"log/slog"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
 	"github.com/nulln0ne/uniswap-estimator/internal/service"
 )
 
 // EstimateHandler handles HTTP requests for Uniswap V2 swap estimations.
 type EstimateHandler struct {
 	BaseHandler
-	service *service.EstimateService
+	chains *service.ChainSet
+	cache  *ResponseCache
 }
 
 // NewEstimateHandler constructs an EstimateHandler with the provided logger and
 // estimate service.
 func NewEstimateHandler(logger *slog.Logger, svc *service.EstimateService) *EstimateHandler {
+	return NewChainEstimateHandler(logger, singleChain(svc))
+}
+
+// NewChainEstimateHandler constructs an EstimateHandler routing each request
+// to the service of the chain it names.
+func NewChainEstimateHandler(logger *slog.Logger, chains *service.ChainSet) *EstimateHandler {
 	return &EstimateHandler{
 		BaseHandler: BaseHandler{
 			logger: logger,
 		},
-		service: svc,
+		chains: chains,
 	}
 }
 
+// WithResponseCache makes h serve latest-block estimates through cache,
+// with ETag and Cache-Control headers. A nil cache disables it. It returns h.
+func (h *EstimateHandler) WithResponseCache(cache *ResponseCache) *EstimateHandler {
+	h.cache = cache
+	return h
+}
+
+// singleChain wraps svc in a ChainSet serving only its chain.
+func singleChain(svc *service.EstimateService) *service.ChainSet {
+	chains, _ := service.NewChainSet(svc)
+	return chains
+}
+
+// Supported values of the mode query parameter.
+const (
+	modeLatest  = "latest"
+	modePending = "pending"
+)
+
 // EstimateRequest represents the supported query parameters for the /estimate
-// endpoint.
+// endpoint. Src and Dst are token addresses or symbols of the chain's token
+// list.
 type EstimateRequest struct {
 	Pool     string `query:"pool"`
 	Src      string `query:"src"`
 	Dst      string `query:"dst"`
 	AmountIn string `query:"src_amount"`
+	// AmountInHuman is the amount in token units, such as 1.5, instead of
+	// raw units. It makes the response JSON with human amounts and symbols.
+	AmountInHuman string `query:"src_amount_human"`
+	Mode          string `query:"mode"`
+	// Chain and ChainID select the chain by name or numeric ID. The default
+	// chain is used when both are empty.
+	Chain   string `query:"chain"`
+	ChainID string `query:"chain_id"`
+}
+
+// EstimateResponse is the JSON body returned by /estimate when the amount is
+// given with src_amount_human. AmountOutHuman and the symbols are omitted
+// when the token metadata cannot be read.
+type EstimateResponse struct {
+	Block          string `json:"block"`
+	AmountIn       string `json:"amount_in"`
+	AmountOut      string `json:"amount_out"`
+	AmountInHuman  string `json:"amount_in_human"`
+	AmountOutHuman string `json:"amount_out_human,omitempty"`
+	SrcSymbol      string `json:"src_symbol,omitempty"`
+	DstSymbol      string `json:"dst_symbol,omitempty"`
+}
+
+// PendingEstimateResponse is the JSON body returned by /estimate when
+// mode=pending is requested. The human amounts and symbols are set when the
+// amount is given with src_amount_human.
+type PendingEstimateResponse struct {
+	Block        string `json:"block"`
+	Latest       string `json:"latest"`
+	Pending      string `json:"pending"`
+	PendingSwaps int    `json:"pending_swaps"`
+	LatestHuman  string `json:"latest_human,omitempty"`
+	PendingHuman string `json:"pending_human,omitempty"`
+	SrcSymbol    string `json:"src_symbol,omitempty"`
+	DstSymbol    string `json:"dst_symbol,omitempty"`
+}
+
+// estimateTokens is the metadata of the tokens of a request given in human
+// units. dst is nil when its metadata cannot be read.
+type estimateTokens struct {
+	src, dst *service.Token
 }
 
 // Handle returns a Fiber handler that validates input, delegates the
 // estimation to the service layer, and writes the result as a decimal string.
+// With mode=pending it responds with a JSON PendingEstimateResponse instead,
+// and with src_amount_human with a JSON EstimateResponse.
+// With a response cache, latest-block estimates carry an ETag and are
+// answered with 304 Not Modified when If-None-Match lists it.
 func (h *EstimateHandler) Handle() fiber.Handler {
 	return func(c fiber.Ctx) error {
 		req, err := h.parseAndValidateRequest(c)
@@ -46,23 +123,199 @@ func (h *EstimateHandler) Handle() fiber.Handler {
 			return err
 		}
 
+		var amountIn *big.Int
+		if req.AmountInHuman == "" {
+			amountIn, err = parseAmount(req.AmountIn)
+			if err != nil {
+				return NewInvalidAmountIn(err)
+			}
+		} else if req.AmountIn != "" {
+			return ErrAmountConflict
+		}
+
+		svc, release, err := resolveChain(h.chains, req)
+		if err != nil {
+			return err
+		}
+		defer release()
 		pool := common.HexToAddress(req.Pool)
-		src := common.HexToAddress(req.Src)
-		dst := common.HexToAddress(req.Dst)
+		src, dst, err := resolveTokens(svc, req)
+		if err != nil {
+			return err
+		}
+
+		var tokens *estimateTokens
+		if req.AmountInHuman != "" {
+			tokens, amountIn, err = h.humanAmount(c, svc, src, dst, req.AmountInHuman)
+			if err != nil {
+				return err
+			}
+		}
 
-		amountIn, err := h.parseAmount(req.AmountIn)
+		if req.Mode == modePending {
+			return h.handlePending(c, svc, pool, src, dst, amountIn, tokens)
+		}
+
+		if h.cache != nil {
+			return h.handleCached(c, svc, pool, src, dst, amountIn, tokens)
+		}
+		return h.handleLatest(c, svc, pool, src, dst, amountIn, tokens)
+	}
+}
+
+// humanAmount converts amount, given in units of src, to raw units. It
+// returns the metadata of src and, if it can be read, of dst.
+func (h *BaseHandler) humanAmount(c fiber.Ctx, svc *service.EstimateService, src, dst common.Address, amount string) (*estimateTokens, *big.Int, error) {
+	ctx := requestContext(c)
+	srcToken, err := svc.Token(ctx, src)
+	if err != nil {
+		return nil, nil, h.serviceError(c, "token metadata", err)
+	}
+	amountIn, err := service.ParseUnits(amount, srcToken.Decimals)
+	if err != nil {
+		return nil, nil, NewInvalidHumanAmount(err)
+	}
+	if amountIn.Sign() <= 0 {
+		return nil, nil, ErrAmountNonPositive
+	}
+	return &estimateTokens{src: srcToken, dst: h.optionalToken(ctx, svc, dst)}, amountIn, nil
+}
+
+// optionalToken returns the metadata of token, or nil if it cannot be read.
+// It is used for amounts that are reported in human units when possible.
+func (h *BaseHandler) optionalToken(ctx context.Context, svc *service.EstimateService, token common.Address) *service.Token {
+	t, err := svc.Token(ctx, token)
+	if err != nil {
+		h.logger.Debug("token metadata unavailable", "token", token.Hex(), "err", err)
+		return nil
+	}
+	return t
+}
+
+func (h *EstimateHandler) handleLatest(c fiber.Ctx, svc *service.EstimateService, pool, src, dst common.Address, amountIn *big.Int, tokens *estimateTokens) error {
+	if tokens != nil {
+		q, err := svc.Quote(requestContext(c), pool, src, dst, amountIn)
 		if err != nil {
-			return NewInvalidAmountIn(err)
+			return h.serviceError(c, "estimate", err)
+		}
+		h.logger.Debug("estimate computed", "pool", pool.Hex(), "src", src.Hex(), "dst", dst.Hex(), "in", amountIn.String(), "out", q.AmountOut.String(), "block", q.Block.String())
+		return c.JSON(newEstimateResponse(q, tokens))
+	}
+
+	amountOut, err := svc.Estimate(requestContext(c), pool, src, dst, amountIn)
+	if err != nil {
+		return h.serviceError(c, "estimate", err)
+	}
+
+	h.logger.Debug("estimate computed", "pool", pool.Hex(), "src", src.Hex(), "dst", dst.Hex(), "in", amountIn.String(), "out", amountOut.String())
+	return c.SendString(amountOut.String())
+}
+
+// newEstimateResponse reports q with the amounts in human units of tokens.
+func newEstimateResponse(q *service.Quote, tokens *estimateTokens) EstimateResponse {
+	resp := EstimateResponse{
+		Block:         q.Block.String(),
+		AmountIn:      q.AmountIn.String(),
+		AmountOut:     q.AmountOut.String(),
+		AmountInHuman: service.FormatUnits(q.AmountIn, tokens.src.Decimals),
+		SrcSymbol:     tokens.src.Symbol,
+	}
+	if tokens.dst != nil {
+		resp.AmountOutHuman = service.FormatUnits(q.AmountOut, tokens.dst.Decimals)
+		resp.DstSymbol = tokens.dst.Symbol
+	}
+	return resp
+}
+
+// handleCached serves a latest-block estimate through the response cache.
+// The ETag identifies the request and the block it is answered at, so it
+// stays valid until the chain moves on. Estimates that turn out to be
+// computed at another block, such as stale fallbacks, are sent uncached.
+func (h *EstimateHandler) handleCached(c fiber.Ctx, svc *service.EstimateService, pool, src, dst common.Address, amountIn *big.Int, tokens *estimateTokens) error {
+	ctx := requestContext(c)
+	head, err := h.cache.head(ctx, svc)
+	if err != nil {
+		h.logger.Debug("latest block unavailable, estimate not cached", "err", err)
+		return h.handleLatest(c, svc, pool, src, dst, amountIn, tokens)
+	}
+
+	chain := svc.Chain()
+	key := estimateKey(chain.Name, pool, src, dst, amountIn)
+	send := c.SendString
+	if tokens != nil {
+		// JSON responses are cached apart from plain-text ones.
+		key += "|json"
+		send = func(body string) error {
+			c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			return c.SendString(body)
 		}
+	}
+	etag := entityTag(key, head.Hash)
+	if matchesETag(c, etag) {
+		metrics.CacheLookup(metrics.CacheEstimateResponse, true)
+		setCacheHeaders(c, etag, head, chain.BlockTime)
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+	if body, ok := h.cache.get(chain.Name, head.Hash, key); ok {
+		metrics.CacheLookup(metrics.CacheEstimateResponse, true)
+		setCacheHeaders(c, etag, head, chain.BlockTime)
+		return send(body)
+	}
+	metrics.CacheLookup(metrics.CacheEstimateResponse, false)
 
-		amountOut, err := h.service.Estimate(context.Background(), pool, src, dst, amountIn)
+	q, err := svc.Quote(ctx, pool, src, dst, amountIn)
+	if err != nil {
+		return h.serviceError(c, "estimate", err)
+	}
+	h.logger.Debug("estimate computed", "pool", pool.Hex(), "src", src.Hex(), "dst", dst.Hex(), "in", amountIn.String(), "out", q.AmountOut.String(), "block", q.Block.String())
+	body := q.AmountOut.String()
+	if tokens != nil {
+		b, err := json.Marshal(newEstimateResponse(q, tokens))
 		if err != nil {
-			return h.handleServiceError(err)
+			return err
 		}
+		body = string(b)
+	}
+
+	switch {
+	case tokens != nil && tokens.dst == nil:
+		// The dst metadata is read again by the next request.
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	case q.Block.Cmp(head.Number) == 0:
+		h.cache.put(chain.Name, head.Hash, key, body)
+		setCacheHeaders(c, etag, head, chain.BlockTime)
+	case q.Block.Cmp(head.Number) > 0:
+		// The chain moved on since its head was read.
+		h.cache.expire(chain.Name)
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	default:
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+	}
+	return send(body)
+}
+
+func (h *EstimateHandler) handlePending(c fiber.Ctx, svc *service.EstimateService, pool, src, dst common.Address, amountIn *big.Int, tokens *estimateTokens) error {
+	est, err := svc.EstimatePending(requestContext(c), pool, src, dst, amountIn)
+	if err != nil {
+		return h.serviceError(c, "estimate", err)
+	}
 
-		h.logger.Debug("estimate computed", "pool", req.Pool, "src", req.Src, "dst", req.Dst, "in", amountIn.String(), "out", amountOut.String())
-		return c.SendString(amountOut.String())
+	h.logger.Debug("pending estimate computed", "pool", pool.Hex(), "latest", est.Latest.String(), "pending", est.Pending.String(), "swaps", est.AppliedSwaps)
+	resp := PendingEstimateResponse{
+		Block:        est.Block.String(),
+		Latest:       est.Latest.String(),
+		Pending:      est.Pending.String(),
+		PendingSwaps: est.AppliedSwaps,
 	}
+	if tokens != nil {
+		resp.SrcSymbol = tokens.src.Symbol
+		if tokens.dst != nil {
+			resp.LatestHuman = service.FormatUnits(est.Latest, tokens.dst.Decimals)
+			resp.PendingHuman = service.FormatUnits(est.Pending, tokens.dst.Decimals)
+			resp.DstSymbol = tokens.dst.Symbol
+		}
+	}
+	return c.JSON(resp)
 }
 
 func (h *EstimateHandler) parseAndValidateRequest(c fiber.Ctx) (*EstimateRequest, error) {
@@ -73,14 +326,24 @@ func (h *EstimateHandler) parseAndValidateRequest(c fiber.Ctx) (*EstimateRequest
 		return nil, ErrInvalidQueryParameters
 	}
 
-	if err := h.validateAddresses(&req); err != nil {
+	if err := validateAddresses(&req); err != nil {
 		return nil, err
 	}
 
+	switch req.Mode {
+	case "", modeLatest, modePending:
+	default:
+		return nil, ErrInvalidMode
+	}
+
 	return &req, nil
 }
 
-func (h *EstimateHandler) validateAddresses(req *EstimateRequest) error {
+// validateAddresses checks the pool address and the src and dst tokens of
+// req. Tokens not given by address are symbols, resolved by resolveTokens
+// once the chain is known. Mixed-case addresses must carry a valid EIP-55
+// checksum.
+func validateAddresses(req *EstimateRequest) error {
 	addresses := map[string]string{
 		"pool": req.Pool,
 		"src":  req.Src,
@@ -91,19 +354,97 @@ func (h *EstimateHandler) validateAddresses(req *EstimateRequest) error {
 		if addr == "" {
 			return NewAddressRequired(field)
 		}
+		if field != "pool" && isSymbol(addr) {
+			continue
+		}
 		if !common.IsHexAddress(addr) {
 			return NewInvalidAddress(field)
 		}
+		if !validChecksum(addr) {
+			return NewInvalidChecksum(field)
+		}
 	}
 
-	if req.Src == req.Dst {
+	if strings.EqualFold(req.Src, req.Dst) {
 		return ErrSameAddresses
 	}
 
 	return nil
 }
 
-func (h *EstimateHandler) parseAmount(amountStr string) (*big.Int, error) {
+// isSymbol reports whether a token is given by symbol rather than address.
+func isSymbol(token string) bool {
+	return !common.IsHexAddress(token) && !strings.HasPrefix(strings.ToLower(token), "0x")
+}
+
+// validChecksum reports whether the hex address addr is all lowercase, all
+// uppercase or checksummed as EIP-55 requires.
+func validChecksum(addr string) bool {
+	hex := strings.TrimPrefix(strings.TrimPrefix(addr, "0x"), "0X")
+	if hex == strings.ToLower(hex) || hex == strings.ToUpper(hex) {
+		return true
+	}
+	return common.HexToAddress(addr).Hex()[2:] == hex
+}
+
+// resolveTokens returns the addresses of the src and dst tokens of req,
+// looking symbols up in the token list of svc's chain.
+func resolveTokens(svc *service.EstimateService, req *EstimateRequest) (src, dst common.Address, err error) {
+	if src, err = resolveToken(svc, "src", req.Src); err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	if dst, err = resolveToken(svc, "dst", req.Dst); err != nil {
+		return common.Address{}, common.Address{}, err
+	}
+	if src == dst {
+		return common.Address{}, common.Address{}, ErrSameAddresses
+	}
+	return src, dst, nil
+}
+
+// resolveToken returns the address of token. Without a token list, a chain
+// only knows tokens by address; with one, it knows only the tokens listed.
+func resolveToken(svc *service.EstimateService, field, token string) (common.Address, error) {
+	if !isSymbol(token) {
+		addr := common.HexToAddress(token)
+		if err := svc.CheckListed(addr); err != nil {
+			return common.Address{}, NewUnresolvedToken(field, err)
+		}
+		return addr, nil
+	}
+	if svc.TokenList() == nil {
+		return common.Address{}, NewInvalidAddress(field)
+	}
+	addr, err := svc.ResolveSymbol(token)
+	if err != nil {
+		return common.Address{}, NewUnresolvedToken(field, err)
+	}
+	return addr, nil
+}
+
+// resolveChain returns the service of the chain selected by req, held until
+// release is called so that a reload does not close its pools meanwhile.
+func resolveChain(chains *service.ChainSet, req *EstimateRequest) (svc *service.EstimateService, release func(), err error) {
+	var id uint64
+	if req.ChainID != "" {
+		n, err := strconv.ParseUint(req.ChainID, 10, 64)
+		if err != nil || n == 0 {
+			return nil, nil, ErrInvalidChainID
+		}
+		id = n
+	}
+	svc, release, err = chains.Acquire(req.Chain, id)
+	switch {
+	case err == nil:
+		return svc, release, nil
+	case errors.Is(err, service.ErrChainMismatch):
+		return nil, nil, ErrChainMismatchBadRequest
+	default:
+		return nil, nil, ErrUnknownChainBadRequest
+	}
+}
+
+func parseAmount(amountStr string) (*big.Int, error) {
 	if amountStr == "" {
 		return nil, ErrAmountRequired
 	}
@@ -119,15 +460,3 @@ func (h *EstimateHandler) parseAmount(amountStr string) (*big.Int, error) {
 
 	return amount, nil
 }
-
-func (h *EstimateHandler) handleServiceError(err error) error {
-	switch err {
-	case service.ErrSameToken:
-		return ErrSameTokenBadRequest
-	case service.ErrEmptyReserves:
-		return ErrEmptyReservesBadRequest
-	default:
-		h.logger.Error("service estimate failed", "err", err)
-		return ErrEstimationFailedInternal
-	}
-}
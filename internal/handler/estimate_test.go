@@ -2,11 +2,14 @@ package handler
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"log/slog"
 	"math/big"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -14,7 +17,9 @@ import (
 	"github.com/ethereum/go-ethereum/ethclient"
 	gethrpc "github.com/ethereum/go-ethereum/rpc"
 	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
 	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
 )
 
 type fakeEth struct {
@@ -82,10 +87,10 @@ func TestEstimateHandler_OK(t *testing.T) {
 	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0)}}}
 	ec := newInprocEthClient(t, fe)
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	svc := service.NewEstimateService(logger, *ec)
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
 	h := NewEstimateHandler(logger, svc)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/estimate", h.Handle())
 
 	req := httptest.NewRequest(http.MethodGet, "/estimate?pool="+pool.Hex()+"&src="+token0.Hex()+"&dst="+token1.Hex()+"&src_amount=1000", nil)
@@ -102,10 +107,10 @@ func TestEstimateHandler_Validation(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{}}
 	ec := newInprocEthClient(t, fe)
-	svc := service.NewEstimateService(logger, *ec)
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
 	h := NewEstimateHandler(logger, svc)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/estimate", h.Handle())
 
 	req := httptest.NewRequest(http.MethodGet, "/estimate", nil)
@@ -119,10 +124,10 @@ func TestEstimateHandler_AddressRequiredAndInvalid(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{}}
 	ec := newInprocEthClient(t, fe)
-	svc := service.NewEstimateService(logger, *ec)
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
 	h := NewEstimateHandler(logger, svc)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/estimate", h.Handle())
 
 	token := common.HexToAddress("0x00000000000000000000000000000000000000aa")
@@ -154,7 +159,7 @@ func TestEstimateHandler_AddressRequiredAndInvalid(t *testing.T) {
 			}
 			b, _ := io.ReadAll(resp.Body)
 			_ = resp.Body.Close()
-			if got := string(b); got != tc.msg {
+			if got := responseText(resp, b); got != tc.msg {
 				t.Fatalf("unexpected body: got %q want %q", got, tc.msg)
 			}
 		})
@@ -165,10 +170,10 @@ func TestEstimateHandler_SameAddresses(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{}}
 	ec := newInprocEthClient(t, fe)
-	svc := service.NewEstimateService(logger, *ec)
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
 	h := NewEstimateHandler(logger, svc)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/estimate", h.Handle())
 
 	addr := common.HexToAddress("0x00000000000000000000000000000000000000aa")
@@ -184,7 +189,7 @@ func TestEstimateHandler_SameAddresses(t *testing.T) {
 	}
 	b, _ := io.ReadAll(resp.Body)
 	_ = resp.Body.Close()
-	if got, want := string(b), ErrSameAddresses.Message; got != want {
+	if got, want := responseText(resp, b), ErrSameAddresses.Message; got != want {
 		t.Fatalf("unexpected body: got %q want %q", got, want)
 	}
 }
@@ -193,10 +198,10 @@ func TestEstimateHandler_AmountErrors(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{}}
 	ec := newInprocEthClient(t, fe)
-	svc := service.NewEstimateService(logger, *ec)
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
 	h := NewEstimateHandler(logger, svc)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/estimate", h.Handle())
 
 	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
@@ -227,7 +232,7 @@ func TestEstimateHandler_AmountErrors(t *testing.T) {
 			}
 			b, _ := io.ReadAll(resp.Body)
 			_ = resp.Body.Close()
-			if got := string(b); got != tc.msg {
+			if got := responseText(resp, b); got != tc.msg {
 				t.Fatalf("unexpected body: got %q want %q", got, tc.msg)
 			}
 		})
@@ -244,10 +249,10 @@ func TestEstimateHandler_ServiceErrors(t *testing.T) {
 	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(0, 0, 0)}}}
 	ec := newInprocEthClient(t, fe)
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
-	svc := service.NewEstimateService(logger, *ec)
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
 	h := NewEstimateHandler(logger, svc)
 
-	app := fiber.New()
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
 	app.Get("/estimate", h.Handle())
 
 	// ErrEmptyReserves -> 400 with specific message
@@ -261,22 +266,297 @@ func TestEstimateHandler_ServiceErrors(t *testing.T) {
 	}
 	b1, _ := io.ReadAll(resp1.Body)
 	_ = resp1.Body.Close()
-	if got, want := string(b1), ErrEmptyReservesBadRequest.Message; got != want {
+	if got, want := responseText(resp1, b1), ErrEmptyReservesBadRequest.Message; got != want {
 		t.Fatalf("unexpected body: got %q want %q", got, want)
 	}
 
-	// Pair mismatch -> 500 internal mapping
+	// ErrPairMismatch -> 400 with its own code
 	req2 := httptest.NewRequest(http.MethodGet, "/estimate?pool="+pool.Hex()+"&src="+token0.Hex()+"&dst="+wrong.Hex()+"&src_amount=1", nil)
 	resp2, err := app.Test(req2)
 	if err != nil {
 		t.Fatalf("app.Test error: %v", err)
 	}
-	if resp2.StatusCode != http.StatusInternalServerError {
-		t.Fatalf("unexpected status: got %d want %d", resp2.StatusCode, http.StatusInternalServerError)
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Fatalf("unexpected status: got %d want %d", resp2.StatusCode, http.StatusBadRequest)
 	}
 	b2, _ := io.ReadAll(resp2.Body)
 	_ = resp2.Body.Close()
-	if got, want := string(b2), ErrEstimationFailedInternal.Message; got != want {
+	if got, want := responseText(resp2, b2), ErrPairMismatchBadRequest.Message; got != want {
 		t.Fatalf("unexpected body: got %q want %q", got, want)
 	}
 }
+
+func TestEstimateHandler_Mode(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0)}}}
+	ec := newInprocEthClient(t, fe)
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
+	h := NewEstimateHandler(logger, svc)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", h.Handle())
+
+	base := "/estimate?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000&mode="
+	cases := []struct {
+		name string
+		mode string
+		code int
+		msg  string
+	}{
+		{"invalid", "future", http.StatusBadRequest, ErrInvalidMode.Message},
+		{"pending_disabled", "pending", http.StatusNotImplemented, ErrPendingUnavailableNotImplemented.Message},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, base+tc.mode, nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			if resp.StatusCode != tc.code {
+				t.Fatalf("unexpected status: got %d want %d", resp.StatusCode, tc.code)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if got := responseText(resp, b); got != tc.msg {
+				t.Fatalf("unexpected body: got %q want %q", got, tc.msg)
+			}
+		})
+	}
+}
+
+func TestEstimateHandler_RateLimited(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// The bucket holds one estimate: a block number (10 units) and a batch of
+	// three storage reads (51 units). It refills at one unit per second.
+	limiter := eth.NewLimiter(eth.LimiterConfig{UnitsPerSecond: 1, Burst: 61})
+	rpcPool, err := eth.NewPool(logger, []eth.Endpoint{{Name: "node", Client: newInprocEthClient(t, fe)}}, eth.PoolConfig{Limiter: limiter})
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	h := NewEstimateHandler(logger, service.NewEstimateService(logger, rpcPool))
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", h.Handle())
+
+	target := "/estimate?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1"
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("first estimate: got status %d want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	// The second estimate would wait ten seconds for its block number read.
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("unexpected status: got %d want %d", resp.StatusCode, http.StatusTooManyRequests)
+	}
+	if got := resp.Header.Get(fiber.HeaderRetryAfter); got != "10" {
+		t.Fatalf("unexpected Retry-After: %q", got)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	if got, want := responseText(resp, b), ErrRPCRateLimited.Message; got != want {
+		t.Fatalf("unexpected body: got %q want %q", got, want)
+	}
+}
+
+func TestEstimateHandler_ChainRouting(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	newService := func(chain service.Chain, r0, r1 uint64) *service.EstimateService {
+		fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(r0, r1, 0)}}}
+		return service.NewEstimateService(logger, eth.NewClientReader(newInprocEthClient(t, fe)), service.WithChain(chain))
+	}
+	chains, err := service.NewChainSet(
+		newService(service.Chain{Name: "ethereum", ID: 1, DefaultFeeBps: 30}, 1_000_000, 2_000_000),
+		newService(service.Chain{Name: "bsc", ID: 56, DefaultFeeBps: 25}, 1_000_000, 4_000_000),
+	)
+	if err != nil {
+		t.Fatalf("NewChainSet: %v", err)
+	}
+	h := NewChainEstimateHandler(logger, chains)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", h.Handle())
+
+	var a, b big.Int
+	ethOut := uniswapv2.GetAmountOutFee(new(big.Int), &a, &b, big.NewInt(1000), big.NewInt(1_000_000), big.NewInt(2_000_000), uniswapv2.NewFee(30)).String()
+	bscOut := uniswapv2.GetAmountOutFee(new(big.Int), &a, &b, big.NewInt(1000), big.NewInt(1_000_000), big.NewInt(4_000_000), uniswapv2.NewFee(25)).String()
+
+	base := "/estimate?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000"
+	cases := []struct {
+		name  string
+		query string
+		code  int
+		body  string
+	}{
+		{"default", "", http.StatusOK, ethOut},
+		{"by_name", "&chain=BSC", http.StatusOK, bscOut},
+		{"by_id", "&chain_id=56", http.StatusOK, bscOut},
+		{"name_and_id", "&chain=bsc&chain_id=56", http.StatusOK, bscOut},
+		{"unknown", "&chain=solana", http.StatusBadRequest, ErrUnknownChainBadRequest.Message},
+		{"unknown_id", "&chain_id=10", http.StatusBadRequest, ErrUnknownChainBadRequest.Message},
+		{"mismatch", "&chain=ethereum&chain_id=56", http.StatusBadRequest, ErrChainMismatchBadRequest.Message},
+		{"invalid_id", "&chain_id=bsc", http.StatusBadRequest, ErrInvalidChainID.Message},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, base+tc.query, nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			if resp.StatusCode != tc.code {
+				t.Fatalf("unexpected status: got %d want %d", resp.StatusCode, tc.code)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if got := responseText(resp, b); got != tc.body {
+				t.Fatalf("unexpected body: got %q want %q", got, tc.body)
+			}
+		})
+	}
+}
+
+// tokenEth is a headerEth answering eth_call with the decimals() and
+// symbol() of the tokens it knows. Calls to other accounts revert.
+type tokenEth struct {
+	*headerEth
+	decimals map[common.Address]uint8
+	symbols  map[common.Address]string
+}
+
+func (f *tokenEth) Call(ctx context.Context, args map[string]any, block string) (hexutil.Bytes, error) {
+	to := common.HexToAddress(args["to"].(string))
+	input, _ := args["input"].(string)
+	decimals, ok := f.decimals[to]
+	if !ok {
+		return nil, errors.New("execution reverted")
+	}
+	if strings.HasPrefix(input, "0x313ce567") {
+		return u256Bytes(big.NewInt(int64(decimals))), nil
+	}
+	// A bytes32 symbol, as returned by MKR.
+	symbol := make([]byte, 32)
+	copy(symbol, f.symbols[to])
+	return symbol, nil
+}
+
+func TestEstimateHandler_HumanAmount(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &tokenEth{
+		headerEth: &headerEth{fakeEth: &fakeEth{storage: map[common.Address]map[common.Hash][]byte{pool: {
+			common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+			common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+			common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+		}}}},
+		decimals: map[common.Address]uint8{token0: 3, token1: 2},
+		symbols:  map[common.Address]string{token0: "AAA", token1: "BBB"},
+	}
+	fe.head.Store(42)
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	client := gethrpc.DialInProc(srv)
+	t.Cleanup(client.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ethclient.NewClient(client)))
+	cached := NewEstimateHandler(logger, svc).WithResponseCache(NewResponseCache(ResponseCacheConfig{MaxEntries: 10}))
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", NewEstimateHandler(logger, svc).Handle())
+	app.Get("/cached", cached.Handle())
+
+	var a, b big.Int
+	out := uniswapv2.GetAmountOut(new(big.Int), &a, &b, big.NewInt(1500), big.NewInt(1_000_000), big.NewInt(2_000_000))
+	want := EstimateResponse{
+		Block:          "42",
+		AmountIn:       "1500",
+		AmountOut:      out.String(),
+		AmountInHuman:  "1.5",
+		AmountOutHuman: service.FormatUnits(out, 2),
+		SrcSymbol:      "AAA",
+		DstSymbol:      "BBB",
+	}
+
+	query := "?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex()
+	for _, path := range []string{"/estimate", "/cached", "/cached"} {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, path+query+"&src_amount_human=1.5", nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		var got EstimateResponse
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatalf("%s: decode response: %v", path, err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) || got != want {
+			t.Fatalf("%s: unexpected response %d %s %+v", path, resp.StatusCode, resp.Header.Get(fiber.HeaderContentType), got)
+		}
+	}
+
+	// The raw amount gets the plain-text response, not the cached JSON one.
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/cached"+query+"&src_amount=1500", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if string(body) != out.String() {
+		t.Fatalf("unexpected raw response %q", body)
+	}
+
+	other := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	cases := []struct {
+		name  string
+		query string
+		code  string
+	}{
+		{"both amounts", query + "&src_amount=1500&src_amount_human=1.5", CodeInvalidParameter},
+		{"too precise", query + "&src_amount_human=1.0005", CodeInvalidParameter},
+		{"not a number", query + "&src_amount_human=1e3", CodeInvalidParameter},
+		{"zero", query + "&src_amount_human=0.0", CodeInvalidParameter},
+		{"not erc20", "?pool=" + pool.Hex() + "&src=" + other.Hex() + "&dst=" + token1.Hex() + "&src_amount_human=1", string(service.CodeNotERC20)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/estimate"+tc.query, nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			var p ProblemDetails
+			_ = json.NewDecoder(resp.Body).Decode(&p)
+			_ = resp.Body.Close()
+			if resp.StatusCode != http.StatusBadRequest || p.Code != tc.code {
+				t.Fatalf("unexpected response %d %+v", resp.StatusCode, p)
+			}
+		})
+	}
+}
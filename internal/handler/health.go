@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/buildinfo"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// readyTimeout bounds the RPC checks of a single readiness probe.
+const readyTimeout = 5 * time.Second
+
+// Values of the status field of health responses.
+const (
+	statusOK       = "ok"
+	statusReady    = "ready"
+	statusNotReady = "not_ready"
+)
+
+// HealthHandler serves the liveness and readiness probes.
+type HealthHandler struct {
+	BaseHandler
+	chains     *service.ChainSet
+	maxHeadLag time.Duration
+	build      buildinfo.Info
+}
+
+// NewHealthHandler constructs a HealthHandler checking every chain of chains.
+// Readiness depends on the default chain only. A chain whose latest block is
+// more than maxHeadLag old is not ready; zero disables the check.
+func NewHealthHandler(logger *slog.Logger, chains *service.ChainSet, maxHeadLag time.Duration) *HealthHandler {
+	return &HealthHandler{
+		BaseHandler: BaseHandler{
+			logger: logger,
+		},
+		chains:     chains,
+		maxHeadLag: maxHeadLag,
+		build:      buildinfo.Get(),
+	}
+}
+
+// HealthResponse is the JSON body returned by /healthz.
+type HealthResponse struct {
+	Status string         `json:"status"`
+	Build  buildinfo.Info `json:"build"`
+}
+
+// ReadyResponse is the JSON body returned by /readyz.
+type ReadyResponse struct {
+	Status string           `json:"status"`
+	Build  buildinfo.Info   `json:"build"`
+	Chains []ChainReadiness `json:"chains"`
+}
+
+// ChainReadiness is the readiness of one chain's node. Block, BlockTime and
+// HeadLagSeconds are omitted when the node did not answer.
+type ChainReadiness struct {
+	Chain          string  `json:"chain"`
+	ChainID        uint64  `json:"chain_id"`
+	Ready          bool    `json:"ready"`
+	Block          uint64  `json:"block,omitempty"`
+	BlockTime      string  `json:"block_time,omitempty"`
+	HeadLagSeconds float64 `json:"head_lag_seconds,omitempty"`
+	Syncing        bool    `json:"syncing,omitempty"`
+	Error          string  `json:"error,omitempty"`
+}
+
+// Healthz returns a Fiber handler reporting that the process is up. It does
+// not touch the network.
+func (h *HealthHandler) Healthz() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		return c.JSON(HealthResponse{Status: statusOK, Build: h.build})
+	}
+}
+
+// Readyz returns a Fiber handler that checks the node of every configured
+// chain. It responds 200 when the default chain's node answers, is not
+// syncing and has a recent head, and 503 otherwise, so that one failing
+// secondary chain does not take the instance out of service. The body reports
+// each chain either way. The checks are not charged on the RPC rate limiters.
+func (h *HealthHandler) Readyz() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(requestContext(c), readyTimeout)
+		defer cancel()
+
+		services, release := h.chains.AcquireAll()
+		defer release()
+		resp := ReadyResponse{Status: statusReady, Build: h.build, Chains: make([]ChainReadiness, len(services))}
+		var wg sync.WaitGroup
+		for i, svc := range services {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				resp.Chains[i] = h.check(ctx, svc)
+			}()
+		}
+		wg.Wait()
+
+		status := fiber.StatusOK
+		if !resp.Chains[0].Ready {
+			resp.Status = statusNotReady
+			status = fiber.StatusServiceUnavailable
+		}
+		return c.Status(status).JSON(resp)
+	}
+}
+
+func (h *HealthHandler) check(ctx context.Context, svc *service.EstimateService) ChainReadiness {
+	st, err := svc.Status(ctx, h.maxHeadLag)
+	cr := ChainReadiness{Chain: st.Chain, ChainID: st.ChainID, Ready: err == nil, Syncing: st.Syncing}
+	if st.Block > 0 {
+		cr.Block = st.Block
+		cr.BlockTime = st.BlockTime.Format(time.RFC3339)
+		cr.HeadLagSeconds = st.HeadLag.Seconds()
+	}
+	if err != nil {
+		cr.Error = readinessError(err)
+		h.logger.Warn("readiness check failed", "chain", st.Chain, "err", err)
+	}
+	return cr
+}
+
+// readinessError describes err without echoing RPC errors, which may contain
+// endpoint URLs.
+func readinessError(err error) string {
+	switch {
+	case errors.Is(err, service.ErrNodeSyncing), errors.Is(err, service.ErrStaleHead):
+		return err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		return "rpc endpoint timed out"
+	default:
+		return "rpc endpoint unavailable"
+	}
+}
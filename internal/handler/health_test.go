@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// fakeNode answers the RPC methods used by the readiness check.
+type fakeNode struct {
+	head     uint64
+	headTime time.Time
+	syncing  bool
+	down     bool
+}
+
+func (f *fakeNode) GetBlockByNumber(ctx context.Context, number gethrpc.BlockNumber, full bool) (*types.Header, error) {
+	if f.down {
+		return nil, errors.New("connection refused by https://secret.example")
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(f.head), Difficulty: big.NewInt(0), Time: uint64(f.headTime.Unix())}, nil
+}
+
+func (f *fakeNode) Syncing(ctx context.Context) (any, error) {
+	if !f.syncing {
+		return false, nil
+	}
+	return map[string]hexutil.Uint64{"startingBlock": 0, "currentBlock": hexutil.Uint64(f.head), "highestBlock": hexutil.Uint64(f.head + 100)}, nil
+}
+
+// chainNode is the fake node of a named chain.
+type chainNode struct {
+	name string
+	node *fakeNode
+}
+
+// newHealthApp serves the health probes of one chain per node; the first one
+// is the default chain.
+func newHealthApp(t *testing.T, nodes ...chainNode) *fiber.App {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	var services []*service.EstimateService
+	id := uint64(1)
+	for _, cn := range nodes {
+		name, node := cn.name, cn.node
+		srv := gethrpc.NewServer()
+		if err := srv.RegisterName("eth", node); err != nil {
+			t.Fatalf("register rpc service: %v", err)
+		}
+		c := gethrpc.DialInProc(srv)
+		t.Cleanup(c.Close)
+		reader := eth.NewClientReader(ethclient.NewClient(c))
+		services = append(services, service.NewEstimateService(logger, reader, service.WithChain(service.Chain{Name: name, ID: id})))
+		id++
+	}
+	chains, err := service.NewChainSet(services...)
+	if err != nil {
+		t.Fatalf("NewChainSet: %v", err)
+	}
+
+	h := NewHealthHandler(logger, chains, time.Minute)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/healthz", h.Healthz())
+	app.Get("/readyz", h.Readyz())
+	return app
+}
+
+func TestHealthHandler_Healthz(t *testing.T) {
+	app := newHealthApp(t, chainNode{"ethereum", &fakeNode{down: true}})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	var body HealthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Status != "ok" || body.Build.Version == "" || body.Build.GoVersion == "" {
+		t.Fatalf("unexpected response: %d %+v", resp.StatusCode, body)
+	}
+}
+
+func TestHealthHandler_Readyz(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		node    fakeNode
+		status  int
+		syncing bool
+		errMsg  string
+	}{
+		{name: "ready", node: fakeNode{head: 100, headTime: now.Add(-10 * time.Second)}, status: http.StatusOK},
+		{name: "syncing", node: fakeNode{head: 100, headTime: now.Add(-time.Second), syncing: true}, status: http.StatusServiceUnavailable, syncing: true, errMsg: service.ErrNodeSyncing.Error()},
+		{name: "stuck", node: fakeNode{head: 100, headTime: now.Add(-5 * time.Minute)}, status: http.StatusServiceUnavailable, errMsg: service.ErrStaleHead.Error()},
+		{name: "down", node: fakeNode{down: true}, status: http.StatusServiceUnavailable, errMsg: "rpc endpoint unavailable"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newHealthApp(t, chainNode{"ethereum", &tc.node})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			if resp.StatusCode != tc.status {
+				t.Fatalf("unexpected status: got %d want %d", resp.StatusCode, tc.status)
+			}
+			var body ReadyResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if len(body.Chains) != 1 {
+				t.Fatalf("unexpected chains: %+v", body.Chains)
+			}
+			cr := body.Chains[0]
+			if cr.Chain != "ethereum" || cr.Ready != (tc.status == http.StatusOK) || cr.Syncing != tc.syncing || cr.Error != tc.errMsg {
+				t.Fatalf("unexpected readiness: %+v", cr)
+			}
+			if !tc.node.down && (cr.Block != 100 || cr.BlockTime == "" || cr.HeadLagSeconds <= 0) {
+				t.Fatalf("head not reported: %+v", cr)
+			}
+		})
+	}
+}
+
+func TestHealthHandler_ReadyzDependsOnDefaultChain(t *testing.T) {
+	up := func() *fakeNode { return &fakeNode{head: 100, headTime: time.Now()} }
+	tests := []struct {
+		name   string
+		nodes  []chainNode
+		status int
+	}{
+		{"secondary down", []chainNode{{"ethereum", up()}, {"bsc", &fakeNode{down: true}}}, http.StatusOK},
+		{"default down", []chainNode{{"ethereum", &fakeNode{down: true}}, {"bsc", up()}}, http.StatusServiceUnavailable},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := newHealthApp(t, tc.nodes...)
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			var body ReadyResponse
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.StatusCode != tc.status || len(body.Chains) != 2 {
+				t.Fatalf("unexpected response: %d %+v", resp.StatusCode, body)
+			}
+			// Both chains are reported, whichever decides readiness.
+			if body.Chains[0].Ready == body.Chains[1].Ready {
+				t.Fatalf("unexpected chain readiness: %+v", body.Chains)
+			}
+		})
+	}
+}
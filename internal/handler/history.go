@@ -0,0 +1,223 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/big"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// HistoryHandler streams historical estimates over a block range.
+type HistoryHandler struct {
+	BaseHandler
+	chains *service.ChainSet
+	gate   *limits.Gate
+}
+
+// NewHistoryHandler constructs a HistoryHandler with the provided logger and
+// estimate service.
+func NewHistoryHandler(logger *slog.Logger, svc *service.EstimateService) *HistoryHandler {
+	return NewChainHistoryHandler(logger, singleChain(svc))
+}
+
+// NewChainHistoryHandler constructs a HistoryHandler routing each request to
+// the service of the chain it names.
+func NewChainHistoryHandler(logger *slog.Logger, chains *service.ChainSet) *HistoryHandler {
+	return &HistoryHandler{
+		BaseHandler: BaseHandler{
+			logger: logger,
+		},
+		chains: chains,
+	}
+}
+
+// WithGate makes h serve each query under a slot of gate, held until its
+// stream ends. A nil gate lets every query through. It returns h.
+func (h *HistoryHandler) WithGate(gate *limits.Gate) *HistoryHandler {
+	h.gate = gate
+	return h
+}
+
+// HistoryRequest represents the supported query parameters for the
+// /estimate/history endpoint.
+type HistoryRequest struct {
+	EstimateRequest
+	From string `query:"from"`
+	To   string `query:"to"`
+	Step string `query:"step"`
+}
+
+// HistoryLine is a single NDJSON record written by /estimate/history. Exactly
+// one of AmountOut and Error is set; Code is the error code that goes with
+// Error. AmountOutHuman is set with AmountOut when the amount is given with
+// src_amount_human.
+type HistoryLine struct {
+	Block          uint64 `json:"block"`
+	AmountOut      string `json:"amount_out,omitempty"`
+	AmountOutHuman string `json:"amount_out_human,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Code           string `json:"code,omitempty"`
+}
+
+// Handle returns a Fiber handler that validates the query and streams one
+// HistoryLine per sampled block as application/x-ndjson.
+func (h *HistoryHandler) Handle() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		// The slot is taken before the response is committed, so that a shed
+		// query gets a problem response, and is held by the stream writer: a
+		// middleware would give it back when the handler returns, before any
+		// point is read.
+		slot, err := acquireSlot(c, h.gate)
+		if err != nil {
+			return err
+		}
+		svc, release, q, tokens, err := h.parseQuery(c)
+		if err != nil {
+			slot()
+			return err
+		}
+
+		// The pool is read before the response is committed, so that an
+		// unknown pool or a pair mismatch gets a problem response rather than
+		// an error line.
+		ctx := requestContext(c)
+		hist, err := svc.PrepareHistory(ctx, q)
+		if err != nil {
+			release()
+			slot()
+			return h.serviceError(c, "history", err)
+		}
+
+		// c is released once the handler returns, before the body is written,
+		// so the stream keeps only the request context. The service and the
+		// slot are held until the stream ends.
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		return c.SendStreamWriter(func(w *bufio.Writer) {
+			defer slot()
+			defer release()
+			h.stream(ctx, w, hist, q, tokens)
+		})
+	}
+}
+
+// stream writes history points to w, flushing after each line so clients see
+// progress. A write failure (e.g. the client went away) cancels the query.
+func (h *HistoryHandler) stream(ctx context.Context, w *bufio.Writer, hist *service.History, q service.HistoryQuery, tokens *estimateTokens) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	enc := json.NewEncoder(w)
+	err := hist.Stream(ctx, func(p service.HistoryPoint) error {
+		line := HistoryLine{Block: p.Block}
+		if p.Err != nil {
+			line.Error = p.Err.Error()
+			line.Code = serviceProblem(p.Err).Code
+		} else {
+			line.AmountOut = p.AmountOut.String()
+			if tokens != nil && tokens.dst != nil {
+				line.AmountOutHuman = service.FormatUnits(p.AmountOut, tokens.dst.Decimals)
+			}
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+	if err != nil {
+		h.logger.Error("history stream aborted", "pool", q.Pool.Hex(), "err", err)
+		_ = enc.Encode(HistoryLine{Error: err.Error(), Code: serviceProblem(err).Code})
+		_ = w.Flush()
+	}
+}
+
+// parseQuery parses the history query of c. On success the chain's service
+// is held until release is called.
+func (h *HistoryHandler) parseQuery(c fiber.Ctx) (svc *service.EstimateService, release func(), q service.HistoryQuery, tokens *estimateTokens, err error) {
+	var req HistoryRequest
+	if err := c.Bind().Query(&req); err != nil {
+		h.logger.Debug("failed to bind query parameters", "err", err)
+		return nil, nil, q, nil, ErrInvalidQueryParameters
+	}
+
+	if err := validateAddresses(&req.EstimateRequest); err != nil {
+		return nil, nil, q, nil, err
+	}
+
+	svc, held, err := resolveChain(h.chains, &req.EstimateRequest)
+	if err != nil {
+		return nil, nil, q, nil, err
+	}
+	// Every failure below lets go of the service again.
+	defer func() {
+		if err != nil {
+			held()
+		}
+	}()
+	src, dst, err := resolveTokens(svc, &req.EstimateRequest)
+	if err != nil {
+		return nil, nil, q, nil, err
+	}
+
+	var amountIn *big.Int
+	switch {
+	case req.AmountInHuman == "":
+		amountIn, err = parseAmount(req.AmountIn)
+		if err != nil {
+			return nil, nil, q, nil, NewInvalidAmountIn(err)
+		}
+	case req.AmountIn != "":
+		return nil, nil, q, nil, ErrAmountConflict
+	default:
+		tokens, amountIn, err = h.humanAmount(c, svc, src, dst, req.AmountInHuman)
+		if err != nil {
+			return nil, nil, q, nil, err
+		}
+	}
+
+	from, err := parseBlockParam("from", req.From, "")
+	if err != nil {
+		return nil, nil, q, nil, err
+	}
+	to, err := parseBlockParam("to", req.To, "")
+	if err != nil {
+		return nil, nil, q, nil, err
+	}
+	step, err := parseBlockParam("step", req.Step, "1")
+	if err != nil {
+		return nil, nil, q, nil, err
+	}
+
+	return svc, held, service.HistoryQuery{
+		Pool:     common.HexToAddress(req.Pool),
+		Src:      src,
+		Dst:      dst,
+		AmountIn: amountIn,
+		From:     from,
+		To:       to,
+		Step:     step,
+	}, tokens, nil
+}
+
+// parseBlockParam parses a non-negative block number parameter, falling back
+// to def when the value is empty. An empty value without a default is an
+// error.
+func parseBlockParam(field, value, def string) (uint64, error) {
+	if value == "" {
+		value = def
+	}
+	if value == "" {
+		return 0, newProblem(fiber.StatusBadRequest, CodeMissingParameter, field+" is required")
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, newProblem(fiber.StatusBadRequest, CodeInvalidParameter, "invalid "+field)
+	}
+	return n, nil
+}
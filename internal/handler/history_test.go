@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+func TestHistoryHandler_StreamsNDJSON(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0)}}}
+	ec := newInprocEthClient(t, fe)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate/history", NewHistoryHandler(logger, svc).Handle())
+
+	base := "/estimate/history?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000"
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, base+"&from=10&to=14&step=2", nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("unexpected content type: %q", ct)
+	}
+
+	var lines []HistoryLine
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		var l HistoryLine
+		if err := json.Unmarshal(sc.Bytes(), &l); err != nil {
+			t.Fatalf("decode line %q: %v", sc.Text(), err)
+		}
+		lines = append(lines, l)
+	}
+	_ = resp.Body.Close()
+
+	if len(lines) != 3 {
+		t.Fatalf("unexpected line count: %d", len(lines))
+	}
+	for i, l := range lines {
+		if l.Block != uint64(10+2*i) || l.AmountOut != "1992" || l.Error != "" {
+			t.Fatalf("unexpected line %d: %+v", i, l)
+		}
+	}
+
+	// Failures found before any point is streamed get a problem response.
+	missing := common.HexToAddress("0x0000000000000000000000000000000000000def")
+	cases := []struct {
+		name   string
+		target string
+		status int
+		msg    string
+	}{
+		{"missing_from", base + "&to=10", http.StatusBadRequest, "from is required"},
+		{"invalid_to", base + "&from=1&to=x", http.StatusBadRequest, "invalid to"},
+		{"reversed", base + "&from=5&to=1", http.StatusBadRequest, service.ErrInvalidHistoryRange.Error()},
+		{"pool_not_found", "/estimate/history?pool=" + missing.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000&from=10&to=14", http.StatusNotFound, ErrPoolNotFound.Message},
+		{"pair_mismatch", "/estimate/history?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + pool.Hex() + "&src_amount=1000&from=10&to=14", http.StatusBadRequest, ErrPairMismatchBadRequest.Message},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			if resp.StatusCode != tc.status || resp.Header.Get(fiber.HeaderContentType) != MIMEApplicationProblemJSON {
+				t.Fatalf("unexpected response: got %d %q want %d problem", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType), tc.status)
+			}
+			b, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if got := responseText(resp, b); got != tc.msg {
+				t.Fatalf("unexpected body: got %q want %q", got, tc.msg)
+			}
+		})
+	}
+}
+
+// blockingEth is a fakeEth whose storage reads at block wait for release.
+// The first of them reports on entered.
+type blockingEth struct {
+	*fakeEth
+	block   gethrpc.BlockNumber
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (f *blockingEth) GetStorageAt(ctx context.Context, addr common.Address, position common.Hash, block gethrpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if n, ok := block.Number(); ok && n == f.block {
+		select {
+		case f.entered <- struct{}{}:
+		default:
+		}
+		<-f.release
+	}
+	return f.fakeEth.GetStorageAt(ctx, addr, position, block)
+}
+
+func TestHistoryGate(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	// Reads at block 10 hang, so a query starting there streams until
+	// released.
+	fe := &blockingEth{
+		fakeEth: &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0)}}},
+		block:   10,
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ethclient.NewClient(gethrpc.DialInProc(srv))))
+	gate := limits.NewGate(logger, limits.ConcurrencyConfig{Limit: 1})
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate/history", NewHistoryHandler(logger, svc).WithGate(gate).Handle())
+	target := "/estimate/history?pool=" + pool.Hex() + "&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000&from=10&to=12"
+
+	type result struct {
+		status int
+		lines  int
+	}
+	first := make(chan result, 1)
+	go func() {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil), fiber.TestConfig{Timeout: 5 * time.Second})
+		if err != nil {
+			t.Errorf("app.Test error: %v", err)
+			first <- result{}
+			return
+		}
+		defer resp.Body.Close()
+		var r result
+		r.status = resp.StatusCode
+		for sc := bufio.NewScanner(resp.Body); sc.Scan(); {
+			r.lines++
+		}
+		first <- r
+	}()
+
+	// The first query is streaming, its handler long returned, and still
+	// holds the only slot.
+	<-fe.entered
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	var p ProblemDetails
+	if err := json.Unmarshal(b, &p); err != nil || resp.StatusCode != http.StatusServiceUnavailable || p.Code != CodeOverloaded {
+		t.Fatalf("unexpected response to a second query: %d %s", resp.StatusCode, b)
+	}
+
+	// Once the stream ends, the slot is given back.
+	close(fe.release)
+	if r := <-first; r.status != http.StatusOK || r.lines != 3 {
+		t.Fatalf("unexpected first query: %+v", r)
+	}
+	release, err := gate.Acquire(context.Background(), "test")
+	if err != nil {
+		t.Fatalf("Acquire after the stream: %v", err)
+	}
+	release()
+}
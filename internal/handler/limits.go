@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+	"golang.org/x/time/rate"
+)
+
+// ClientLimitConfig configures ClientLimit.
+type ClientLimitConfig struct {
+	// RatePerSec is the requests per second allowed to each client address;
+	// zero disables the limit.
+	RatePerSec float64
+	// Burst is the token bucket size of each client. Defaults to one second
+	// of requests.
+	Burst int
+	// TrustedProxies are the proxies whose X-Forwarded-For entries are
+	// believed. Without any, clients are identified by the peer address.
+	TrustedProxies []netip.Prefix
+}
+
+// clientSweepInterval is the least time between two sweeps of idle client
+// buckets.
+const clientSweepInterval = time.Minute
+
+// ClientLimit returns a middleware that rate limits requests by client
+// address, see ClientAddr. Refused requests get ErrClientRateLimited with a
+// Retry-After header. IPv6 clients are limited by /64, the block a single
+// host usually owns.
+func ClientLimit(logger *slog.Logger, cfg ClientLimitConfig) fiber.Handler {
+	if cfg.RatePerSec <= 0 {
+		return func(c fiber.Ctx) error { return c.Next() }
+	}
+	clients := newClientBuckets(cfg.RatePerSec, cfg.Burst)
+	return func(c fiber.Ctx) error {
+		addr := ClientAddr(c, cfg.TrustedProxies)
+		if wait, ok := clients.allow(clientKey(addr), time.Now()); !ok {
+			logger.Warn("client rate limited", "ip", addr.String(), "method", c.Method(), "path", c.Path())
+			metrics.HTTPRejected(metrics.RejectClientRateLimited)
+			setRetryAfter(c, wait)
+			return ErrClientRateLimited
+		}
+		return c.Next()
+	}
+}
+
+// ClientAddr returns the address of the client that sent c. When the peer is
+// one of trusted, X-Forwarded-For is walked from the right, skipping trusted
+// proxies, and the first other address is the client: entries left of it
+// were written by the client itself and may be forged. A malformed entry
+// ends the walk at the proxy that appended it.
+func ClientAddr(c fiber.Ctx, trusted []netip.Prefix) netip.Addr {
+	addr, _ := netip.AddrFromSlice(c.RequestCtx().RemoteIP())
+	addr = addr.Unmap()
+	if !isTrusted(addr, trusted) {
+		return addr
+	}
+	headers := c.Request().Header.PeekAll(fiber.HeaderXForwardedFor)
+	for i := len(headers) - 1; i >= 0; i-- {
+		hops := strings.Split(string(headers[i]), ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			hop, ok := parseHop(hops[j])
+			if !ok {
+				return addr
+			}
+			addr = hop
+			if !isTrusted(addr, trusted) {
+				return addr
+			}
+		}
+	}
+	return addr
+}
+
+// parseHop parses an X-Forwarded-For entry, which some proxies write with a
+// port.
+func parseHop(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap(), true
+	}
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientKey returns the rate limit bucket of addr: the address itself, or
+// its /64 for IPv6.
+func clientKey(addr netip.Addr) netip.Addr {
+	if addr.Is6() {
+		if p, err := addr.Prefix(64); err == nil {
+			return p.Addr()
+		}
+	}
+	return addr
+}
+
+// clientBuckets holds a token bucket per client. Buckets idle long enough to
+// have refilled are dropped, as a new one would behave the same.
+type clientBuckets struct {
+	limit rate.Limit
+	burst int
+	// idle is how long an empty bucket takes to refill.
+	idle time.Duration
+
+	mu      sync.Mutex
+	buckets map[netip.Addr]*clientBucket
+	swept   time.Time
+}
+
+type clientBucket struct {
+	limiter *rate.Limiter
+	seen    time.Time
+}
+
+func newClientBuckets(perSec float64, burst int) *clientBuckets {
+	if burst <= 0 {
+		burst = max(int(perSec), 1)
+	}
+	return &clientBuckets{
+		limit:   rate.Limit(perSec),
+		burst:   burst,
+		idle:    time.Duration(float64(burst) / perSec * float64(time.Second)),
+		buckets: make(map[netip.Addr]*clientBucket),
+	}
+}
+
+// allow takes a token of key's bucket at now. If there is none, it returns
+// how long until there is.
+func (b *clientBuckets) allow(key netip.Addr, now time.Time) (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.swept) >= max(b.idle, clientSweepInterval) {
+		for k, cb := range b.buckets {
+			if now.Sub(cb.seen) >= b.idle {
+				delete(b.buckets, k)
+			}
+		}
+		b.swept = now
+	}
+
+	cb, ok := b.buckets[key]
+	if !ok {
+		cb = &clientBucket{limiter: rate.NewLimiter(b.limit, b.burst)}
+		b.buckets[key] = cb
+	}
+	cb.seen = now
+	r := cb.limiter.ReserveN(now, 1)
+	if d := r.DelayFrom(now); d > 0 {
+		r.CancelAt(now)
+		return d, false
+	}
+	return 0, true
+}
+
+// Concurrency returns a middleware serving requests under gate, which the
+// gRPC API and quote streams may share. Shed requests get ErrOverloaded with
+// a Retry-After header; a request whose deadline expires in the queue gets
+// ErrDeadlineExceeded. A nil gate lets every request through.
+func Concurrency(gate *limits.Gate) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		release, err := acquireSlot(c, gate)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return c.Next()
+	}
+}
+
+// acquireSlot takes a slot of gate for c and maps a refusal to the problem
+// reported to the client.
+func acquireSlot(c fiber.Ctx, gate *limits.Gate) (release func(), err error) {
+	release, err = gate.Acquire(requestContext(c), c.Method()+" "+c.Path())
+	switch {
+	case err == nil:
+		return release, nil
+	case errors.Is(err, limits.ErrOverloaded):
+		setRetryAfter(c, time.Second)
+		return nil, ErrOverloaded
+	case errors.Is(err, context.DeadlineExceeded):
+		return nil, ErrDeadlineExceeded
+	default:
+		return nil, ErrRequestCanceled
+	}
+}
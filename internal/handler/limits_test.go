@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+)
+
+// fiber's app.Test sends every request from 0.0.0.0.
+var testPeer = netip.MustParsePrefix("0.0.0.0/32")
+
+func TestClientLimit(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newApp := func(trusted ...netip.Prefix) *fiber.App {
+		app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		app.Get("/estimate", ClientLimit(logger, ClientLimitConfig{RatePerSec: 0.5, Burst: 1, TrustedProxies: trusted}),
+			func(c fiber.Ctx) error { return c.SendString(ClientAddr(c, trusted).String()) })
+		return app
+	}
+	get := func(t *testing.T, app *fiber.App, xff ...string) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/estimate", nil)
+		for _, v := range xff {
+			req.Header.Add(fiber.HeaderXForwardedFor, v)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	t.Run("untrusted peer", func(t *testing.T) {
+		app := newApp()
+		if resp, body := get(t, app, "203.0.113.7"); resp.StatusCode != http.StatusOK || body != "0.0.0.0" {
+			t.Fatalf("unexpected response %d %q", resp.StatusCode, body)
+		}
+		// The forwarded address is ignored, so this is the same client.
+		resp, body := get(t, app, "198.51.100.1")
+		if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get(fiber.HeaderRetryAfter) != "2" {
+			t.Fatalf("unexpected response %d %q, Retry-After %q", resp.StatusCode, body, resp.Header.Get(fiber.HeaderRetryAfter))
+		}
+		var p ProblemDetails
+		if err := json.Unmarshal([]byte(body), &p); err != nil || p.Code != CodeRateLimited {
+			t.Fatalf("unexpected problem %+v (%v)", p, err)
+		}
+	})
+
+	t.Run("trusted proxies", func(t *testing.T) {
+		app := newApp(testPeer, netip.MustParsePrefix("10.0.0.0/8"))
+		tests := []struct {
+			name   string
+			xff    []string
+			status int
+			client string
+		}{
+			{name: "forwarded client", xff: []string{"203.0.113.7"}, status: http.StatusOK, client: "203.0.113.7"},
+			{name: "same client", xff: []string{"203.0.113.7"}, status: http.StatusTooManyRequests},
+			{name: "forged entry", xff: []string{"198.51.100.1, 203.0.113.7, 10.1.2.3"}, status: http.StatusTooManyRequests},
+			{name: "proxy chain", xff: []string{"198.51.100.1", "10.1.2.3:8080"}, status: http.StatusOK, client: "198.51.100.1"},
+			{name: "ipv6 /64", xff: []string{"2001:db8::1"}, status: http.StatusOK, client: "2001:db8::1"},
+			{name: "same ipv6 /64", xff: []string{"2001:db8::2"}, status: http.StatusTooManyRequests},
+			{name: "malformed entry", xff: []string{"unknown, 10.1.2.3"}, status: http.StatusOK, client: "10.1.2.3"},
+			{name: "no header", status: http.StatusOK, client: "0.0.0.0"},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				resp, body := get(t, app, tc.xff...)
+				if resp.StatusCode != tc.status || (tc.client != "" && body != tc.client) {
+					t.Fatalf("unexpected response %d %q, want %d %q", resp.StatusCode, body, tc.status, tc.client)
+				}
+			})
+		}
+	})
+}
+
+func TestClientBucketsSweep(t *testing.T) {
+	b := newClientBuckets(1, 2)
+	now := time.Now()
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+		if _, ok := b.allow(netip.MustParseAddr(ip), now); !ok {
+			t.Fatalf("first request of %s refused", ip)
+		}
+	}
+	if _, ok := b.allow(netip.MustParseAddr("203.0.113.3"), now.Add(clientSweepInterval)); !ok {
+		t.Fatal("request after sweep refused")
+	}
+	if len(b.buckets) != 1 {
+		t.Fatalf("idle buckets not swept: %d left", len(b.buckets))
+	}
+}
+
+// concurrencyApp serves /estimate behind gate. Its handler reports each
+// request it starts on entered and blocks until release.
+func concurrencyApp(gate fiber.Handler) (app *fiber.App, entered chan string, release chan struct{}) {
+	entered, release = make(chan string), make(chan struct{})
+	app = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", Deadline(0), gate, func(c fiber.Ctx) error {
+		entered <- c.Query("id")
+		<-release
+		return c.SendString(c.Query("id"))
+	})
+	return app, entered, release
+}
+
+type gateResult struct {
+	status     int
+	code       string
+	retryAfter string
+}
+
+// sendAsync sends a request to app and delivers its outcome on the returned
+// channel.
+func sendAsync(t *testing.T, app *fiber.App, query string) <-chan gateResult {
+	done := make(chan gateResult, 1)
+	go func() {
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/estimate?"+query, nil), fiber.TestConfig{Timeout: 5 * time.Second})
+		if err != nil {
+			t.Errorf("app.Test error: %v", err)
+			done <- gateResult{}
+			return
+		}
+		defer resp.Body.Close()
+		var p ProblemDetails
+		_ = json.NewDecoder(resp.Body).Decode(&p)
+		done <- gateResult{resp.StatusCode, p.Code, resp.Header.Get(fiber.HeaderRetryAfter)}
+	}()
+	return done
+}
+
+// waitQueued waits until n requests are waiting for a slot of gate.
+func waitQueued(t *testing.T, gate *limits.Gate, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for gate.Queued() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests queued, want %d", gate.Queued(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	gate := limits.NewGate(logger, limits.ConcurrencyConfig{Limit: 1, Queue: 2})
+	app, entered, release := concurrencyApp(Concurrency(gate))
+
+	// The first request takes the only slot.
+	first := sendAsync(t, app, "id=1")
+	if id := <-entered; id != "1" {
+		t.Fatalf("request %s entered first", id)
+	}
+
+	// A queued request whose deadline expires stops waiting.
+	if r := <-sendAsync(t, app, "id=expiring&timeout_ms=20"); r.status != http.StatusGatewayTimeout || r.code != CodeDeadlineExceeded {
+		t.Fatalf("unexpected response %+v for an expired request", r)
+	}
+	waitQueued(t, gate, 0)
+
+	// Two more requests fill the queue, and the next one is shed at once.
+	queued := []<-chan gateResult{sendAsync(t, app, "id=2"), sendAsync(t, app, "id=3")}
+	waitQueued(t, gate, 2)
+	if r := <-sendAsync(t, app, "id=shed"); r.status != http.StatusServiceUnavailable || r.code != CodeOverloaded || r.retryAfter != "1" {
+		t.Fatalf("unexpected shed response %+v", r)
+	}
+
+	// Each released slot lets one queued request through.
+	for range queued {
+		release <- struct{}{}
+		if id := <-entered; id != "2" && id != "3" {
+			t.Fatalf("request %s entered instead of a queued one", id)
+		}
+	}
+	release <- struct{}{}
+	for i, done := range append(queued, first) {
+		if r := <-done; r.status != http.StatusOK {
+			t.Fatalf("request %d: unexpected response %+v", i, r)
+		}
+	}
+	waitQueued(t, gate, 0)
+}
+
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	app, entered, release := concurrencyApp(Concurrency(limits.NewGate(logger, limits.ConcurrencyConfig{Limit: 1, Queue: 4, QueueTimeout: 20 * time.Millisecond})))
+
+	first := sendAsync(t, app, "id=1")
+	<-entered
+	if r := <-sendAsync(t, app, "id=2"); r.status != http.StatusServiceUnavailable || r.code != CodeOverloaded {
+		t.Fatalf("unexpected response %+v for a request queued too long", r)
+	}
+	release <- struct{}{}
+	if r := <-first; r.status != http.StatusOK {
+		t.Fatalf("unexpected response %+v", r)
+	}
+}
+
+func TestGateSharedWithAcquire(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	gate := limits.NewGate(logger, limits.ConcurrencyConfig{Limit: 1})
+	app, entered, release := concurrencyApp(Concurrency(gate))
+
+	// A slot taken outside HTTP, e.g. by a gRPC call, sheds HTTP requests.
+	done, err := gate.Acquire(context.Background(), "grpc")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if r := <-sendAsync(t, app, "id=shed"); r.status != http.StatusServiceUnavailable || r.code != CodeOverloaded {
+		t.Fatalf("unexpected response %+v while the slot is taken", r)
+	}
+	done()
+
+	first := sendAsync(t, app, "id=1")
+	<-entered
+	if _, err := gate.Acquire(context.Background(), "grpc"); err != limits.ErrOverloaded {
+		t.Fatalf("Acquire while an HTTP request is served: %v, want ErrOverloaded", err)
+	}
+	release <- struct{}{}
+	if r := <-first; r.status != http.StatusOK {
+		t.Fatalf("unexpected response %+v", r)
+	}
+}
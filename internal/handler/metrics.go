@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gofiber/fiber/v3/middleware/adaptor"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+)
+
+// unmatchedRoute labels requests that matched no route, so that arbitrary
+// paths do not create new series.
+const unmatchedRoute = "unmatched"
+
+// Metrics returns a middleware recording the count and latency of every
+// request by route pattern, method and status code. Errors are counted with
+// the status the error handler will send.
+func Metrics() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		start := time.Now()
+		self := c.Route()
+		err := c.Next()
+		metrics.ObserveHTTP(routePattern(c, self), c.Method(), responseStatus(c, err), time.Since(start))
+		return err
+	}
+}
+
+// responseStatus returns the status code of the response to c. Errors are
+// counted with the status the error handler will send.
+func responseStatus(c fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	return asProblem(err).Status
+}
+
+// routePattern returns the pattern of the route that handled c, or
+// unmatchedRoute if the route is still self, the calling middleware's own.
+func routePattern(c fiber.Ctx, self *fiber.Route) string {
+	route := c.Route()
+	if route == self {
+		return unmatchedRoute
+	}
+	return route.Path
+}
+
+// MetricsHandler returns a Fiber handler serving the Prometheus metrics.
+func MetricsHandler() fiber.Handler {
+	return adaptor.HTTPHandler(metrics.Handler())
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+func TestMetrics(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rpcPool, err := eth.NewPool(logger, []eth.Endpoint{{Name: "inproc", Client: newInprocEthClient(t, fe)}}, eth.PoolConfig{Chain: "metricschain"})
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	svc := service.NewEstimateService(logger, rpcPool, service.WithChain(service.Chain{Name: "metricschain", ID: 7357, DefaultFeeBps: 30}))
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(Metrics())
+	app.Get("/metrics", MetricsHandler())
+	app.Get("/estimate", NewEstimateHandler(logger, svc).Handle())
+
+	get := func(target string, want int) string {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("GET %s: unexpected status %d", target, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+	get("/estimate?pool="+pool.Hex()+"&src="+token0.Hex()+"&dst="+token1.Hex()+"&src_amount=1000", http.StatusOK)
+	get("/estimate?pool="+pool.Hex()+"&src="+token0.Hex()+"&dst="+other.Hex()+"&src_amount=1000", http.StatusBadRequest)
+	get("/estimate?pool="+pool.Hex(), http.StatusBadRequest)
+	get("/no/such/route", http.StatusNotFound)
+
+	body := get("/metrics", http.StatusOK)
+	for _, want := range []string{
+		`uniswap_estimator_http_requests_total{method="GET",route="/estimate",status="200"} 1`,
+		`uniswap_estimator_http_requests_total{method="GET",route="/estimate",status="400"} 2`,
+		`uniswap_estimator_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`uniswap_estimator_http_request_duration_seconds_count{method="GET",route="/estimate",status="200"} 1`,
+		`uniswap_estimator_estimates_total{chain="metricschain",mode="latest",outcome="ok"} 1`,
+		`uniswap_estimator_estimates_total{chain="metricschain",mode="latest",outcome="pair_mismatch"} 1`,
+		`uniswap_estimator_rpc_calls_total{chain="metricschain",endpoint="inproc",method="eth_blockNumber",result="ok"}`,
+		`uniswap_estimator_rpc_call_duration_seconds_count{chain="metricschain",endpoint="inproc",method="eth_getStorageAt"}`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package handler
+
+import "github.com/gofiber/fiber/v3"
+
+// OpenAPI returns a Fiber handler serving the OpenAPI document spec as JSON.
+func OpenAPI(spec []byte) fiber.Handler {
+	return func(c fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(spec)
+	}
+}
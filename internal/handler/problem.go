@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// MIMEApplicationProblemJSON is the content type of error responses.
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Codes of the errors raised by the handlers themselves. Errors of the
+// service layer keep their service.Code.
+const (
+	CodeMissingParameter = string(service.CodeMissingParameter)
+	CodeInvalidParameter = string(service.CodeInvalidParameter)
+	CodeInvalidBody      = "INVALID_BODY"
+	// CodeSubscriptionLimit reports a quote stream with more subscriptions
+	// than one connection may hold.
+	CodeSubscriptionLimit = "SUBSCRIPTION_LIMIT"
+	// CodeOverloaded reports a request shed because too many are in flight.
+	CodeOverloaded       = "OVERLOADED"
+	CodeRateLimited      = string(service.CodeRateLimited)
+	CodeQuorumNotReached = string(service.CodeQuorumNotReached)
+	CodeRPCUnavailable   = string(service.CodeRPCUnavailable)
+	CodeDeadlineExceeded = string(service.CodeDeadlineExceeded)
+	CodeRequestCanceled  = string(service.CodeRequestCanceled)
+	CodeUnauthorized     = string(service.CodeUnauthorized)
+	CodeQuotaExceeded    = string(service.CodeQuotaExceeded)
+)
+
+// Problem is an API error: an HTTP status, a stable machine-readable code and
+// a human-readable message. ErrorHandler renders it as an RFC 7807 problem
+// detail.
+type Problem struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (p *Problem) Error() string {
+	return p.Message
+}
+
+func newProblem(status int, code, message string) *Problem {
+	return &Problem{Status: status, Code: code, Message: message}
+}
+
+// ProblemDetails is the application/problem+json body of error responses.
+// Type is always about:blank, so Title is the status text; Code identifies
+// the error.
+type ProblemDetails struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Code     string `json:"code"`
+	Instance string `json:"instance"`
+}
+
+// ErrorHandler is the Fiber error handler of the API. It renders every error
+// returned by a handler or middleware as a problem detail; errors that are
+// neither a *Problem nor a *fiber.Error are reported as a bare 500 without
+// their message.
+func ErrorHandler(c fiber.Ctx, err error) error {
+	p := asProblem(err)
+	return c.Status(p.Status).JSON(ProblemDetails{
+		Type:     "about:blank",
+		Title:    http.StatusText(p.Status),
+		Status:   p.Status,
+		Detail:   p.Message,
+		Code:     p.Code,
+		Instance: c.Path(),
+	}, MIMEApplicationProblemJSON)
+}
+
+// asProblem returns the Problem that ErrorHandler sends for err. A
+// *fiber.Error, e.g. an unmatched route, gets a code derived from its status
+// text, such as NOT_FOUND.
+func asProblem(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	status := fiber.StatusInternalServerError
+	message := http.StatusText(status)
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		status, message = fe.Code, fe.Message
+	}
+	return newProblem(status, statusCode(status), message)
+}
+
+// statusCode derives an error code from an HTTP status.
+func statusCode(status int) string {
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
+
+// problemCode returns the code of the Problem in err's tree, or fallback.
+func problemCode(err error, fallback string) string {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p.Code
+	}
+	return fallback
+}
+
+// serviceProblems maps every service.Code to its API error.
+var serviceProblems = map[service.Code]*Problem{
+	service.CodeSameToken:             ErrSameTokenBadRequest,
+	service.CodePoolNotFound:          ErrPoolNotFound,
+	service.CodePairMismatch:          ErrPairMismatchBadRequest,
+	service.CodeInsufficientLiquidity: ErrEmptyReservesBadRequest,
+	service.CodeInsufficientInput:     ErrInsufficientInputBadRequest,
+	service.CodePoolNotFromFactory:    ErrPoolNotFromFactoryBadRequest,
+	service.CodePendingUnavailable:    ErrPendingUnavailableNotImplemented,
+	service.CodeInvalidSimulation:     newProblem(fiber.StatusBadRequest, string(service.CodeInvalidSimulation), service.ErrInvalidSimulation.Error()),
+	service.CodeInvalidStep:           ErrInvalidStepBadRequest,
+	service.CodeInvalidBlockRange:     newProblem(fiber.StatusBadRequest, string(service.CodeInvalidBlockRange), service.ErrInvalidHistoryRange.Error()),
+	service.CodeUnknownChain:          ErrUnknownChainBadRequest,
+	service.CodeChainMismatch:         ErrChainMismatchBadRequest,
+	service.CodeNotERC20:              ErrNotERC20BadRequest,
+	service.CodeUnknownToken:          ErrUnknownTokenBadRequest,
+	service.CodeAmbiguousSymbol:       ErrAmbiguousSymbolBadRequest,
+	service.CodeMissingParameter:      newProblem(fiber.StatusBadRequest, CodeMissingParameter, "a required parameter is missing"),
+	service.CodeInvalidParameter:      ErrInvalidQueryParameters,
+	service.CodeRateLimited:           ErrRPCRateLimited,
+	service.CodeQuorumNotReached:      ErrQuorumNotReachedUnavailable,
+	service.CodeRPCUnavailable:        ErrRPCUnavailable,
+	service.CodeDeadlineExceeded:      ErrDeadlineExceeded,
+	service.CodeRequestCanceled:       ErrRequestCanceled,
+	service.CodeUnauthorized:          ErrInvalidAPIKey,
+	service.CodeQuotaExceeded:         ErrAPIKeyQuotaExceeded,
+}
+
+// errInternal is the API error of a service code missing from
+// serviceProblems, which is a bug rather than a failure of the RPC endpoints.
+var errInternal = newProblem(fiber.StatusInternalServerError, statusCode(fiber.StatusInternalServerError), http.StatusText(fiber.StatusInternalServerError))
+
+// serviceProblem returns the API error for an error of the service layer.
+func serviceProblem(err error) *Problem {
+	if p, ok := serviceProblems[service.ErrorCode(err)]; ok {
+		return p
+	}
+	return errInternal
+}
+
+// serviceError logs an error of the service layer and returns its API error.
+// op names the failed operation in logs.
+func (h *BaseHandler) serviceError(c fiber.Ctx, op string, err error) error {
+	p := serviceProblem(err)
+	switch p {
+	case ErrDeadlineExceeded, ErrRequestCanceled:
+		h.logger.Warn(op+" did not finish", "err", err)
+	case ErrRPCRateLimited:
+		h.logger.Warn(op+" rate limited", "err", err)
+		return newRateLimited(c, err)
+	case ErrQuorumNotReachedUnavailable:
+		h.logger.Warn(op+" quorum not reached", "err", err)
+	case ErrRPCUnavailable, errInternal:
+		h.logger.Error("service "+op+" failed", "err", err)
+	}
+	return p
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// responseText returns the detail of a problem response, or the raw body of
+// any other response.
+func responseText(resp *http.Response, body []byte) string {
+	if resp.Header.Get(fiber.HeaderContentType) != MIMEApplicationProblemJSON {
+		return string(body)
+	}
+	var p ProblemDetails
+	if err := json.Unmarshal(body, &p); err != nil {
+		return string(body)
+	}
+	return p.Detail
+}
+
+func TestErrorHandler(t *testing.T) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	empty := common.HexToAddress("0x0000000000000000000000000000000000000def")
+
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	// A node without the eth namespace fails every read.
+	down := gethrpc.DialInProc(gethrpc.NewServer())
+	t.Cleanup(down.Close)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", NewEstimateHandler(logger, service.NewEstimateService(logger, eth.NewClientReader(newInprocEthClient(t, fe)))).Handle())
+	app.Get("/down", NewEstimateHandler(logger, service.NewEstimateService(logger, eth.NewClientReader(ethclient.NewClient(down)))).Handle())
+	app.Get("/broken", func(fiber.Ctx) error { return errors.New("secret internal detail") })
+
+	query := func(p, src, dst common.Address) string {
+		return "?pool=" + p.Hex() + "&src=" + src.Hex() + "&dst=" + dst.Hex() + "&src_amount=1000"
+	}
+	cases := []struct {
+		name   string
+		target string
+		want   ProblemDetails
+	}{
+		{"pair_mismatch", "/estimate" + query(pool, token0, other), ProblemDetails{Title: "Bad Request", Status: http.StatusBadRequest, Detail: ErrPairMismatchBadRequest.Message, Code: "PAIR_MISMATCH", Instance: "/estimate"}},
+		{"pool_not_found", "/estimate" + query(empty, token0, token1), ProblemDetails{Title: "Not Found", Status: http.StatusNotFound, Detail: ErrPoolNotFound.Message, Code: "POOL_NOT_FOUND", Instance: "/estimate"}},
+		{"invalid_address", "/estimate?pool=0x1&src=" + token0.Hex() + "&dst=" + token1.Hex() + "&src_amount=1000", ProblemDetails{Title: "Bad Request", Status: http.StatusBadRequest, Code: "INVALID_PARAMETER", Instance: "/estimate"}},
+		{"rpc_unavailable", "/down" + query(pool, token0, token1), ProblemDetails{Title: "Bad Gateway", Status: http.StatusBadGateway, Detail: ErrRPCUnavailable.Message, Code: "RPC_UNAVAILABLE", Instance: "/down"}},
+		{"unmatched_route", "/no/such/route", ProblemDetails{Title: "Not Found", Status: http.StatusNotFound, Code: "NOT_FOUND", Instance: "/no/such/route"}},
+		{"plain_error", "/broken", ProblemDetails{Title: "Internal Server Error", Status: http.StatusInternalServerError, Detail: "Internal Server Error", Code: "INTERNAL_SERVER_ERROR", Instance: "/broken"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.want.Status {
+				t.Fatalf("unexpected status: got %d want %d", resp.StatusCode, tc.want.Status)
+			}
+			if ct := resp.Header.Get(fiber.HeaderContentType); ct != MIMEApplicationProblemJSON {
+				t.Fatalf("unexpected content type: %q", ct)
+			}
+			var got ProblemDetails
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			tc.want.Type = "about:blank"
+			if tc.want.Detail == "" {
+				tc.want.Detail = got.Detail
+			}
+			if got != tc.want {
+				t.Fatalf("unexpected problem:\n got %+v\nwant %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestServiceProblem(t *testing.T) {
+	codes := []service.Code{
+		service.CodeSameToken,
+		service.CodePoolNotFound,
+		service.CodePairMismatch,
+		service.CodeInsufficientLiquidity,
+		service.CodeInsufficientInput,
+		service.CodePoolNotFromFactory,
+		service.CodePendingUnavailable,
+		service.CodeInvalidSimulation,
+		service.CodeInvalidStep,
+		service.CodeInvalidBlockRange,
+		service.CodeUnknownChain,
+		service.CodeChainMismatch,
+		service.CodeNotERC20,
+		service.CodeUnknownToken,
+		service.CodeAmbiguousSymbol,
+		service.CodeMissingParameter,
+		service.CodeInvalidParameter,
+		service.CodeRateLimited,
+		service.CodeQuorumNotReached,
+		service.CodeRPCUnavailable,
+		service.CodeDeadlineExceeded,
+		service.CodeRequestCanceled,
+		service.CodeUnauthorized,
+		service.CodeQuotaExceeded,
+	}
+	if len(codes) != len(serviceProblems) {
+		t.Fatalf("serviceProblems maps %d codes, want %d", len(serviceProblems), len(codes))
+	}
+	for _, code := range codes {
+		p := serviceProblem(&service.Error{Code: code, Message: "detail"})
+		if p.Code != string(code) || p.Status == http.StatusInternalServerError {
+			t.Errorf("code %s maps to %d %s", code, p.Status, p.Code)
+		}
+	}
+
+	if p := serviceProblem(&service.Error{Code: "NEW_CODE"}); p.Status != http.StatusInternalServerError || p.Code != "INTERNAL_SERVER_ERROR" {
+		t.Fatalf("unmapped code maps to %d %s", p.Status, p.Code)
+	}
+	if p := serviceProblem(errors.New("dial tcp: connection refused")); p != ErrRPCUnavailable {
+		t.Fatalf("rpc failure maps to %d %s", p.Status, p.Code)
+	}
+}
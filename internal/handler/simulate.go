@@ -0,0 +1,224 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// SimulateHandler handles what-if simulations of swap, mint and burn
+// sequences.
+type SimulateHandler struct {
+	BaseHandler
+	chains *service.ChainSet
+}
+
+// NewSimulateHandler constructs a SimulateHandler with the provided logger and
+// estimate service.
+func NewSimulateHandler(logger *slog.Logger, svc *service.EstimateService) *SimulateHandler {
+	return NewChainSimulateHandler(logger, singleChain(svc))
+}
+
+// NewChainSimulateHandler constructs a SimulateHandler running simulations on
+// the default chain of chains, which may be replaced between requests.
+func NewChainSimulateHandler(logger *slog.Logger, chains *service.ChainSet) *SimulateHandler {
+	return &SimulateHandler{
+		BaseHandler: BaseHandler{
+			logger: logger,
+		},
+		chains: chains,
+	}
+}
+
+// SimulateRequest is the JSON body accepted by POST /simulate. Block is an
+// optional decimal block number; the latest block is used when empty.
+type SimulateRequest struct {
+	Block string         `json:"block"`
+	Steps []SimulateStep `json:"steps"`
+}
+
+// SimulateStep is a single step of a SimulateRequest. Type is one of swap,
+// mint or burn and determines which amount fields are required.
+type SimulateStep struct {
+	Type      string `json:"type"`
+	Pool      string `json:"pool"`
+	Src       string `json:"src,omitempty"`
+	Dst       string `json:"dst,omitempty"`
+	AmountIn  string `json:"amount_in,omitempty"`
+	Amount0   string `json:"amount0,omitempty"`
+	Amount1   string `json:"amount1,omitempty"`
+	Liquidity string `json:"liquidity,omitempty"`
+}
+
+// SimulateResponse is the JSON body returned by POST /simulate.
+type SimulateResponse struct {
+	Block string               `json:"block"`
+	Steps []SimulateStepResult `json:"steps"`
+	Pools []SimulatePoolState  `json:"pools"`
+}
+
+// SimulateStepResult is the output of one simulation step.
+type SimulateStepResult struct {
+	Type      string `json:"type"`
+	Pool      string `json:"pool"`
+	Dst       string `json:"dst,omitempty"`
+	AmountOut string `json:"amount_out,omitempty"`
+	Liquidity string `json:"liquidity,omitempty"`
+	Amount0   string `json:"amount0,omitempty"`
+	Amount1   string `json:"amount1,omitempty"`
+}
+
+// SimulatePoolState is the final state of a pool touched by the simulation.
+type SimulatePoolState struct {
+	Pool        string `json:"pool"`
+	Token0      string `json:"token0"`
+	Token1      string `json:"token1"`
+	Reserve0    string `json:"reserve0"`
+	Reserve1    string `json:"reserve1"`
+	TotalSupply string `json:"total_supply"`
+}
+
+// Handle returns a Fiber handler that decodes the simulation steps, runs them
+// against pool snapshots loaded at a single block and writes the per-step
+// outputs and final reserves as JSON.
+func (h *SimulateHandler) Handle() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var req SimulateRequest
+		if err := c.Bind().JSON(&req); err != nil {
+			h.logger.Debug("failed to bind simulate body", "err", err)
+			return ErrInvalidRequestBody
+		}
+
+		var blockNum *big.Int
+		if req.Block != "" {
+			bn, ok := new(big.Int).SetString(req.Block, 10)
+			if !ok || bn.Sign() < 0 {
+				return ErrInvalidBlock
+			}
+			blockNum = bn
+		}
+
+		steps := make([]service.SimulationStep, 0, len(req.Steps))
+		for i, s := range req.Steps {
+			step, err := parseStep(s)
+			if err != nil {
+				return newProblem(fiber.StatusBadRequest, problemCode(err, string(service.CodeInvalidStep)), fmt.Sprintf("step %d: %s", i, err.Error()))
+			}
+			steps = append(steps, step)
+		}
+
+		svc, release, err := h.chains.Acquire("", 0)
+		if err != nil {
+			return err
+		}
+		defer release()
+		res, err := svc.Simulate(requestContext(c), blockNum, steps)
+		if err != nil {
+			return h.handleSimulateError(c, err)
+		}
+
+		return c.JSON(newSimulateResponse(res))
+	}
+}
+
+func parseStep(s SimulateStep) (service.SimulationStep, error) {
+	step := service.SimulationStep{Kind: service.StepKind(s.Type)}
+
+	pool, err := parseAddress("pool", s.Pool, true)
+	if err != nil {
+		return step, err
+	}
+	step.Pool = pool
+
+	switch step.Kind {
+	case service.StepSwap:
+		if step.Src, err = parseAddress("src", s.Src, true); err != nil {
+			return step, err
+		}
+		if step.Dst, err = parseAddress("dst", s.Dst, false); err != nil {
+			return step, err
+		}
+		step.AmountIn, err = parseNamedAmount("amount_in", s.AmountIn)
+	case service.StepMint:
+		if step.Amount0, err = parseNamedAmount("amount0", s.Amount0); err != nil {
+			return step, err
+		}
+		step.Amount1, err = parseNamedAmount("amount1", s.Amount1)
+	case service.StepBurn:
+		step.Liquidity, err = parseNamedAmount("liquidity", s.Liquidity)
+	default:
+		return step, ErrInvalidStepType
+	}
+	return step, err
+}
+
+func parseNamedAmount(field, value string) (*big.Int, error) {
+	amount, err := parseAmount(value)
+	if err != nil {
+		return nil, newProblem(fiber.StatusBadRequest, problemCode(err, CodeInvalidParameter), "invalid "+field+": "+err.Error())
+	}
+	return amount, nil
+}
+
+func parseAddress(field, value string, required bool) (common.Address, error) {
+	if value == "" {
+		if required {
+			return common.Address{}, NewAddressRequired(field)
+		}
+		return common.Address{}, nil
+	}
+	if !common.IsHexAddress(value) {
+		return common.Address{}, NewInvalidAddress(field)
+	}
+	return common.HexToAddress(value), nil
+}
+
+func (h *SimulateHandler) handleSimulateError(c fiber.Ctx, err error) error {
+	var stepErr *service.StepError
+	if errors.As(err, &stepErr) {
+		code := service.CodeOf(stepErr)
+		if code == "" {
+			code = service.CodeInvalidStep
+		}
+		return newProblem(fiber.StatusUnprocessableEntity, string(code), stepErr.Error())
+	}
+	return h.serviceError(c, "simulation", err)
+}
+
+func newSimulateResponse(res *service.SimulationResult) SimulateResponse {
+	out := SimulateResponse{
+		Block: res.Block.String(),
+		Steps: make([]SimulateStepResult, 0, len(res.Steps)),
+		Pools: make([]SimulatePoolState, 0, len(res.Pools)),
+	}
+	for _, s := range res.Steps {
+		r := SimulateStepResult{Type: string(s.Kind), Pool: s.Pool.Hex()}
+		switch s.Kind {
+		case service.StepSwap:
+			r.Dst = s.Dst.Hex()
+			r.AmountOut = s.AmountOut.String()
+		case service.StepMint:
+			r.Liquidity = s.Liquidity.String()
+		case service.StepBurn:
+			r.Amount0 = s.Amount0.String()
+			r.Amount1 = s.Amount1.String()
+		}
+		out.Steps = append(out.Steps, r)
+	}
+	for _, p := range res.Pools {
+		out.Pools = append(out.Pools, SimulatePoolState{
+			Pool:        p.Pool.Hex(),
+			Token0:      p.Token0.Hex(),
+			Token1:      p.Token1.Hex(),
+			Reserve0:    p.Reserve0.String(),
+			Reserve1:    p.Reserve1.String(),
+			TotalSupply: p.TotalSupply.String(),
+		})
+	}
+	return out
+}
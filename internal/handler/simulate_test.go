@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+func newSimulateApp(t *testing.T) (*fiber.App, common.Address, common.Address, common.Address) {
+	t.Helper()
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0)}}}
+	ec := newInprocEthClient(t, fe)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ec))
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/simulate", NewSimulateHandler(logger, svc).Handle())
+	return app, pool, token0, token1
+}
+
+func postSimulate(t *testing.T, app *fiber.App, body string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/simulate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	return resp, responseText(resp, b)
+}
+
+func TestSimulateHandler_OK(t *testing.T) {
+	app, pool, token0, token1 := newSimulateApp(t)
+
+	body := `{"steps":[{"type":"swap","pool":"` + pool.Hex() + `","src":"` + token0.Hex() + `","amount_in":"1000"},` +
+		`{"type":"swap","pool":"` + pool.Hex() + `","src":"` + token1.Hex() + `","amount_in":"1000"}]}`
+	resp, raw := postSimulate(t, app, body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d (%s)", resp.StatusCode, raw)
+	}
+
+	var got SimulateResponse
+	if err := json.Unmarshal([]byte(raw), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if got.Block != "42" || len(got.Steps) != 2 || len(got.Pools) != 1 {
+		t.Fatalf("unexpected response: %+v", got)
+	}
+	if got.Steps[0].Dst != token1.Hex() || got.Steps[0].AmountOut != "1992" {
+		t.Fatalf("unexpected first step: %+v", got.Steps[0])
+	}
+	if got.Pools[0].Reserve0 != "1000501" {
+		t.Fatalf("unexpected final reserve0: %s", got.Pools[0].Reserve0)
+	}
+}
+
+func TestSimulateHandler_Errors(t *testing.T) {
+	app, pool, token0, _ := newSimulateApp(t)
+	wrong := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+
+	cases := []struct {
+		name string
+		body string
+		code int
+		msg  string
+	}{
+		{"bad_json", `{"steps":`, http.StatusBadRequest, ErrInvalidRequestBody.Message},
+		{"no_steps", `{"steps":[]}`, http.StatusBadRequest, service.ErrInvalidSimulation.Error()},
+		{"bad_type", `{"steps":[{"type":"flash","pool":"` + pool.Hex() + `"}]}`, http.StatusBadRequest, "step 0: " + ErrInvalidStepType.Message},
+		{"bad_amount", `{"steps":[{"type":"swap","pool":"` + pool.Hex() + `","src":"` + token0.Hex() + `","amount_in":"0"}]}`, http.StatusBadRequest, "step 0: invalid amount_in: amount must be greater than zero"},
+		{"pair_mismatch", `{"steps":[{"type":"swap","pool":"` + pool.Hex() + `","src":"` + wrong.Hex() + `","amount_in":"1"}]}`, http.StatusUnprocessableEntity, "step 0: " + service.ErrPairMismatch.Error()},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := postSimulate(t, app, tc.body)
+			if resp.StatusCode != tc.code {
+				t.Fatalf("unexpected status: got %d want %d (%s)", resp.StatusCode, tc.code, body)
+			}
+			if body != tc.msg {
+				t.Fatalf("unexpected body: got %q want %q", body, tc.msg)
+			}
+		})
+	}
+}
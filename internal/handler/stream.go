@@ -0,0 +1,452 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/limits"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+const (
+	// streamKeepAlive is how often a stream sends a keep-alive, so proxies
+	// keep an idle connection open and clients that went away are noticed.
+	streamKeepAlive = 15 * time.Second
+	// streamWriteTimeout is how long a write may block on a client that does
+	// not read before the connection is closed.
+	streamWriteTimeout = 10 * time.Second
+	// maxQueuedStreamEvents caps the acknowledgements and errors queued for a
+	// client that does not read. Quotes are conflated and never queue up.
+	maxQueuedStreamEvents = 64
+)
+
+// Types of StreamEvent.
+const (
+	streamEventSubscribed   = "subscribed"
+	streamEventUnsubscribed = "unsubscribed"
+	streamEventQuote        = "quote"
+	streamEventError        = "error"
+)
+
+// errSlowConsumer ends a stream whose client does not read its events.
+var errSlowConsumer = errors.New("client does not read its events")
+
+// errServerShutdown ends the streams of a server that is shutting down.
+var errServerShutdown = errors.New("server is shutting down")
+
+// StreamEvent is a message sent to a quote stream client. ID is the
+// subscription it concerns. Quote events carry Block and the amounts; error
+// events carry a Code and Message, and end their subscription if it exists.
+type StreamEvent struct {
+	Type      string `json:"type"`
+	ID        string `json:"id,omitempty"`
+	Block     string `json:"block,omitempty"`
+	AmountIn  string `json:"amount_in,omitempty"`
+	AmountOut string `json:"amount_out,omitempty"`
+	Code      string `json:"code,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// StreamConfig bounds the quote streams of a StreamHandler.
+type StreamConfig struct {
+	// MaxSubscriptions caps the subscriptions of one connection.
+	MaxSubscriptions int
+	// PollInterval is how often subscriptions check for a new block.
+	PollInterval time.Duration
+	// Gate, if set, admits every poll, so that streams share the
+	// concurrency cap with estimates. A shed poll is retried on the next one.
+	Gate *limits.Gate
+}
+
+// StreamHandler streams live quotes over Server-Sent Events or WebSocket.
+type StreamHandler struct {
+	BaseHandler
+	chains *service.ChainSet
+	cfg    StreamConfig
+}
+
+// NewStreamHandler constructs a StreamHandler routing each subscription to
+// the service of the chain it names.
+func NewStreamHandler(logger *slog.Logger, chains *service.ChainSet, cfg StreamConfig) *StreamHandler {
+	return &StreamHandler{
+		BaseHandler: BaseHandler{
+			logger: logger,
+		},
+		chains: chains,
+		cfg:    cfg,
+	}
+}
+
+// StreamRequest represents the supported query parameters for the
+// /quotes/stream endpoint. Each Subs entry is a "pool,src,dst,src_amount"
+// tuple; Chain and ChainID apply to all of them.
+type StreamRequest struct {
+	Subs    []string `query:"sub"`
+	Chain   string   `query:"chain"`
+	ChainID string   `query:"chain_id"`
+}
+
+// Handle returns a Fiber handler that streams a quote of every subscription
+// whenever a new block arrives. A WebSocket upgrade request gets a WebSocket
+// stream that also accepts subscribe and unsubscribe commands; any other
+// request gets a text/event-stream of the subscriptions in its query. Query
+// subscriptions are identified by their index.
+func (h *StreamHandler) Handle() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var req StreamRequest
+		if err := c.Bind().Query(&req); err != nil {
+			h.logger.Debug("failed to bind query parameters", "err", err)
+			return ErrInvalidQueryParameters
+		}
+
+		upgrade := isWebSocketUpgrade(c)
+		switch {
+		case len(req.Subs) == 0 && !upgrade:
+			return ErrSubscriptionRequired
+		case len(req.Subs) > h.cfg.MaxSubscriptions:
+			return NewSubscriptionLimit(h.cfg.MaxSubscriptions)
+		}
+
+		subs := make([]*quoteSubscription, len(req.Subs))
+		for i, tuple := range req.Subs {
+			sub, err := h.parseTuple(strconv.Itoa(i), tuple, req.Chain, req.ChainID)
+			if err != nil {
+				p := asProblem(err)
+				return newProblem(p.Status, p.Code, "sub["+strconv.Itoa(i)+"]: "+p.Message)
+			}
+			subs[i] = sub
+		}
+
+		if upgrade {
+			return h.serveWebSocket(c, subs)
+		}
+		return h.serveSSE(c, subs)
+	}
+}
+
+// parseTuple parses a "pool,src,dst,src_amount" subscription.
+func (h *StreamHandler) parseTuple(id, tuple, chain, chainID string) (*quoteSubscription, error) {
+	parts := strings.Split(tuple, ",")
+	if len(parts) != 4 {
+		return nil, ErrInvalidSubscription
+	}
+	return h.parseSubscription(id, &EstimateRequest{
+		Pool:     parts[0],
+		Src:      parts[1],
+		Dst:      parts[2],
+		AmountIn: parts[3],
+		Chain:    chain,
+		ChainID:  chainID,
+	})
+}
+
+// parseSubscription validates req like /estimate does.
+func (h *StreamHandler) parseSubscription(id string, req *EstimateRequest) (*quoteSubscription, error) {
+	if err := validateAddresses(req); err != nil {
+		return nil, err
+	}
+	amountIn, err := parseAmount(req.AmountIn)
+	if err != nil {
+		return nil, NewInvalidAmountIn(err)
+	}
+	svc, release, err := resolveChain(h.chains, req)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	src, dst, err := resolveTokens(svc, req)
+	if err != nil {
+		return nil, err
+	}
+	return &quoteSubscription{
+		id:       id,
+		chainID:  svc.Chain().ID,
+		pool:     common.HexToAddress(req.Pool),
+		src:      src,
+		dst:      dst,
+		amountIn: amountIn,
+	}, nil
+}
+
+// serveSSE streams the events of subs as text/event-stream.
+func (h *StreamHandler) serveSSE(c fiber.Ctx, subs []*quoteSubscription) error {
+	// c is released once the handler returns, before the body is written,
+	// so the stream keeps only what it needs of it.
+	ctx, serverDone, conn := requestContext(c), c.RequestCtx().Done(), c.RequestCtx().Conn()
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set("X-Accel-Buffering", "no")
+	return c.SendStreamWriter(func(w *bufio.Writer) {
+		s := h.newQuoteStream(ctx, serverDone)
+		defer s.close()
+		defer func() { _ = conn.SetWriteDeadline(time.Time{}) }()
+		for _, sub := range subs {
+			_ = s.subscribe(sub)
+		}
+		s.run(&sseWriter{w: w, conn: conn})
+	})
+}
+
+// streamWriter sends events over one transport.
+type streamWriter interface {
+	write(events []*StreamEvent) error
+	keepAlive() error
+}
+
+// sseWriter writes Server-Sent Events, named after the event type.
+type sseWriter struct {
+	w    *bufio.Writer
+	conn net.Conn
+}
+
+func (w *sseWriter) write(events []*StreamEvent) error {
+	for _, ev := range events {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		_, _ = w.w.WriteString("event: " + ev.Type + "\ndata: ")
+		_, _ = w.w.Write(data)
+		_, _ = w.w.WriteString("\n\n")
+	}
+	return w.flush()
+}
+
+func (w *sseWriter) keepAlive() error {
+	_, _ = w.w.WriteString(": keep-alive\n\n")
+	return w.flush()
+}
+
+func (w *sseWriter) flush() error {
+	_ = w.conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+	return w.w.Flush()
+}
+
+// quoteSubscription is a validated subscription to the quotes of a tuple.
+// It names its chain by ID rather than keeping the service, which a reload
+// may replace while the subscription lives.
+type quoteSubscription struct {
+	id             string
+	chainID        uint64
+	pool, src, dst common.Address
+	amountIn       *big.Int
+
+	cancel context.CancelFunc
+}
+
+// quoteStream holds the subscriptions of one connection and the events not
+// yet sent to it. It never blocks on the client: acknowledgements and errors
+// are queued up to maxQueuedStreamEvents, and only the latest unsent quote of
+// each subscription is kept, so a slow client skips blocks instead of
+// falling behind.
+type quoteStream struct {
+	h      *StreamHandler
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	notify chan struct{}
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool // set once close waits for the subscriptions
+	subs   map[string]*quoteSubscription
+	queued []*StreamEvent
+	quotes map[string]*StreamEvent
+	order  []string
+}
+
+// newQuoteStream returns a stream that ends when serverDone is closed.
+func (h *StreamHandler) newQuoteStream(ctx context.Context, serverDone <-chan struct{}) *quoteStream {
+	ctx, cancel := context.WithCancelCause(ctx)
+	s := &quoteStream{
+		h:      h,
+		ctx:    ctx,
+		cancel: cancel,
+		notify: make(chan struct{}, 1),
+		subs:   make(map[string]*quoteSubscription),
+		quotes: make(map[string]*StreamEvent),
+	}
+	go func() {
+		select {
+		case <-serverDone:
+			cancel(errServerShutdown)
+		case <-ctx.Done():
+		}
+	}()
+	return s
+}
+
+// subscribe starts streaming the quotes of sub.
+func (s *quoteStream) subscribe(sub *quoteSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return context.Cause(s.ctx)
+	}
+	if _, ok := s.subs[sub.id]; ok {
+		return ErrDuplicateSubscription
+	}
+	if len(s.subs) >= s.h.cfg.MaxSubscriptions {
+		return NewSubscriptionLimit(s.h.cfg.MaxSubscriptions)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	sub.cancel = cancel
+	s.subs[sub.id] = sub
+	s.enqueue(&StreamEvent{Type: streamEventSubscribed, ID: sub.id})
+	s.wg.Go(func() { s.watch(ctx, sub) })
+	return nil
+}
+
+// unsubscribe stops the subscription id and drops its unsent quote.
+func (s *quoteStream) unsubscribe(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return ErrUnknownSubscription
+	}
+	s.remove(sub)
+	s.enqueue(&StreamEvent{Type: streamEventUnsubscribed, ID: id})
+	return nil
+}
+
+// watch polls the quotes of sub until it is canceled or fails for good.
+func (s *quoteStream) watch(ctx context.Context, sub *quoteSubscription) {
+	admit := func(ctx context.Context) (func(), error) {
+		return s.h.cfg.Gate.Acquire(ctx, "quote stream")
+	}
+	err := s.h.chains.WatchQuote(ctx, sub.chainID, sub.pool, sub.src, sub.dst, sub.amountIn, s.h.cfg.PollInterval, admit, func(q *service.Quote) error {
+		s.publish(sub, &StreamEvent{
+			Type:      streamEventQuote,
+			ID:        sub.id,
+			Block:     q.Block.String(),
+			AmountIn:  q.AmountIn.String(),
+			AmountOut: q.AmountOut.String(),
+		})
+		return nil
+	})
+	if ctx.Err() != nil {
+		return
+	}
+
+	s.h.logger.Debug("quote subscription failed", "pool", sub.pool.Hex(), "err", err)
+	p := serviceProblem(err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[sub.id] == sub {
+		s.remove(sub)
+	}
+	s.enqueue(&StreamEvent{Type: streamEventError, ID: sub.id, Code: p.Code, Message: p.Message})
+}
+
+// reject reports a command that could not be applied.
+func (s *quoteStream) reject(id string, err error) {
+	p := asProblem(err)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enqueue(&StreamEvent{Type: streamEventError, ID: id, Code: p.Code, Message: p.Message})
+}
+
+// publish replaces the unsent quote of sub, if any, with ev.
+func (s *quoteStream) publish(sub *quoteSubscription, ev *StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs[sub.id] != sub {
+		return
+	}
+	if _, ok := s.quotes[sub.id]; !ok {
+		s.order = append(s.order, sub.id)
+	}
+	s.quotes[sub.id] = ev
+	s.signal()
+}
+
+// enqueue queues ev, or ends the stream if too many events are waiting.
+// s.mu must be held.
+func (s *quoteStream) enqueue(ev *StreamEvent) {
+	if len(s.queued) >= maxQueuedStreamEvents {
+		s.cancel(errSlowConsumer)
+		return
+	}
+	s.queued = append(s.queued, ev)
+	s.signal()
+}
+
+// remove stops sub and drops its unsent quote. s.mu must be held.
+func (s *quoteStream) remove(sub *quoteSubscription) {
+	sub.cancel()
+	delete(s.subs, sub.id)
+	if _, ok := s.quotes[sub.id]; ok {
+		delete(s.quotes, sub.id)
+		s.order = slices.DeleteFunc(s.order, func(id string) bool { return id == sub.id })
+	}
+}
+
+func (s *quoteStream) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// take returns the events waiting to be sent, queued ones first, and clears
+// them.
+func (s *quoteStream) take() []*StreamEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	events := s.queued
+	for _, id := range s.order {
+		events = append(events, s.quotes[id])
+	}
+	s.queued, s.order = nil, nil
+	clear(s.quotes)
+	return events
+}
+
+// run sends events to w until the stream ends or a write fails.
+func (s *quoteStream) run(w streamWriter) {
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-keepAlive.C:
+			if err := w.keepAlive(); err != nil {
+				s.cancel(err)
+				return
+			}
+		case <-s.notify:
+			if events := s.take(); len(events) > 0 {
+				if err := w.write(events); err != nil {
+					s.cancel(err)
+					return
+				}
+			}
+		}
+	}
+}
+
+// close ends every subscription and waits for them to stop.
+func (s *quoteStream) close() {
+	s.cancel(nil)
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.wg.Wait()
+	if err := context.Cause(s.ctx); errors.Is(err, errSlowConsumer) {
+		s.h.logger.Warn("quote stream closed", "err", err)
+	}
+}
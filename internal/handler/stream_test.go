@@ -0,0 +1,323 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gofiber/fiber/v3"
+	"github.com/gorilla/websocket"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// headEth reports a latest block that tests can advance.
+type headEth struct {
+	*fakeEth
+	head atomic.Uint64
+}
+
+func (f *headEth) BlockNumber(context.Context) (hexutil.Uint64, error) {
+	return hexutil.Uint64(f.head.Load()), nil
+}
+
+var (
+	streamToken0 = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	streamToken1 = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	streamPool   = common.HexToAddress("0x0000000000000000000000000000000000000abc")
+)
+
+// newStreamServer serves a StreamHandler on a local listener, since streams
+// outlive app.Test, and returns its base URL, the head to advance and the
+// chains the handler quotes on.
+func newStreamServer(t *testing.T, maxSubs int) (string, *atomic.Uint64, *service.ChainSet) {
+	t.Helper()
+	fe := &headEth{fakeEth: &fakeEth{storage: map[common.Address]map[common.Hash][]byte{streamPool: {
+		common.BigToHash(big.NewInt(6)): rightPadAddress(streamToken0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(streamToken1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}}
+	fe.head.Store(42)
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	rc := gethrpc.DialInProc(srv)
+	t.Cleanup(rc.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewEstimateService(logger, eth.NewClientReader(ethclient.NewClient(rc)))
+	chains := singleChain(svc)
+	h := NewStreamHandler(logger, chains, StreamConfig{MaxSubscriptions: maxSubs, PollInterval: 10 * time.Millisecond})
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/quotes/stream", h.Handle())
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	go func() { _ = app.Listener(ln, fiber.ListenConfig{DisableStartupMessage: true}) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+	return ln.Addr().String(), &fe.head, chains
+}
+
+func streamTuple(pool common.Address, amount string) string {
+	return pool.Hex() + "," + streamToken0.Hex() + "," + streamToken1.Hex() + "," + amount
+}
+
+func TestStreamSSE(t *testing.T) {
+	addr, head, _ := newStreamServer(t, 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/quotes/stream?sub="+streamTuple(streamPool, "1000"), nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("request error: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get(fiber.HeaderContentType) != "text/event-stream" {
+		t.Fatalf("unexpected response: %d %s", resp.StatusCode, resp.Header.Get(fiber.HeaderContentType))
+	}
+
+	r := bufio.NewReader(resp.Body)
+	next := func() (string, StreamEvent) {
+		t.Helper()
+		var name string
+		var ev StreamEvent
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev); err != nil {
+					t.Fatalf("decode event: %v", err)
+				}
+			case line == "" && name != "":
+				return name, ev
+			}
+		}
+	}
+
+	if name, ev := next(); name != streamEventSubscribed || ev.ID != "0" {
+		t.Fatalf("unexpected first event: %s %+v", name, ev)
+	}
+	for _, block := range []string{"42", "43"} {
+		name, ev := next()
+		if name != streamEventQuote || ev.ID != "0" || ev.Block != block || ev.AmountIn != "1000" || ev.AmountOut != "1992" {
+			t.Fatalf("unexpected quote: %s %+v, want block %s", name, ev, block)
+		}
+		head.Add(1)
+	}
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	addr, head, _ := newStreamServer(t, 2)
+
+	ws, resp, err := websocket.DefaultDialer.Dial("ws://"+addr+"/quotes/stream", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer ws.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected handshake status: %d", resp.StatusCode)
+	}
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	send := func(cmd StreamCommand) {
+		t.Helper()
+		if err := ws.WriteJSON(cmd); err != nil {
+			t.Fatalf("write command: %v", err)
+		}
+	}
+	// expect reads events until one matching want, skipping quotes of other
+	// subscriptions.
+	expect := func(want StreamEvent) StreamEvent {
+		t.Helper()
+		for {
+			var ev StreamEvent
+			if err := ws.ReadJSON(&ev); err != nil {
+				t.Fatalf("read event: %v (waiting for %+v)", err, want)
+			}
+			if ev.Type == want.Type && ev.ID == want.ID && (want.Code == "" || ev.Code == want.Code) && (want.Block == "" || ev.Block == want.Block) {
+				return ev
+			}
+			if ev.Type != streamEventQuote {
+				t.Fatalf("unexpected event %+v, waiting for %+v", ev, want)
+			}
+		}
+	}
+	subscribe := func(id string, pool common.Address) StreamCommand {
+		return StreamCommand{Op: streamOpSubscribe, ID: id, Pool: pool.Hex(), Src: streamToken0.Hex(), Dst: streamToken1.Hex(), AmountIn: "1000"}
+	}
+
+	send(subscribe("a", streamPool))
+	expect(StreamEvent{Type: streamEventSubscribed, ID: "a"})
+	if ev := expect(StreamEvent{Type: streamEventQuote, ID: "a"}); ev.Block != "42" || ev.AmountOut != "1992" {
+		t.Fatalf("unexpected quote: %+v", ev)
+	}
+	head.Add(1)
+	expect(StreamEvent{Type: streamEventQuote, ID: "a", Block: "43"})
+
+	// Invalid commands are rejected without closing the connection.
+	bad := subscribe("b", streamPool)
+	bad.Src = "0x123"
+	send(bad)
+	expect(StreamEvent{Type: streamEventError, ID: "b", Code: CodeInvalidParameter})
+	send(subscribe("a", streamPool))
+	expect(StreamEvent{Type: streamEventError, ID: "a", Code: CodeInvalidParameter})
+	send(StreamCommand{Op: "resubscribe", ID: "a"})
+	expect(StreamEvent{Type: streamEventError, ID: "a", Code: CodeInvalidParameter})
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("{")); err != nil {
+		t.Fatalf("write message: %v", err)
+	}
+	expect(StreamEvent{Type: streamEventError, Code: CodeInvalidBody})
+
+	// A subscription that cannot be quoted ends with an error.
+	send(subscribe("c", common.HexToAddress("0x0000000000000000000000000000000000000def")))
+	expect(StreamEvent{Type: streamEventSubscribed, ID: "c"})
+	expect(StreamEvent{Type: streamEventError, ID: "c", Code: string(service.CodePoolNotFound)})
+
+	send(subscribe("d", streamPool))
+	expect(StreamEvent{Type: streamEventSubscribed, ID: "d"})
+	send(subscribe("e", streamPool))
+	expect(StreamEvent{Type: streamEventError, ID: "e", Code: CodeSubscriptionLimit})
+
+	send(StreamCommand{Op: streamOpUnsubscribe, ID: "a"})
+	expect(StreamEvent{Type: streamEventUnsubscribed, ID: "a"})
+	send(subscribe("e", streamPool))
+	expect(StreamEvent{Type: streamEventSubscribed, ID: "e"})
+}
+
+func TestStreamFollowsReload(t *testing.T) {
+	addr, _, chains := newStreamServer(t, 1)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws://"+addr+"/quotes/stream", nil)
+	if err != nil {
+		t.Fatalf("dial error: %v", err)
+	}
+	defer ws.Close()
+	_ = ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	next := func() StreamEvent {
+		t.Helper()
+		var ev StreamEvent
+		if err := ws.ReadJSON(&ev); err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		return ev
+	}
+
+	if err := ws.WriteJSON(StreamCommand{Op: streamOpSubscribe, ID: "a", Pool: streamPool.Hex(), Src: streamToken0.Hex(), Dst: streamToken1.Hex(), AmountIn: "1000"}); err != nil {
+		t.Fatalf("write command: %v", err)
+	}
+	if ev := next(); ev.Type != streamEventSubscribed {
+		t.Fatalf("unexpected event: %+v", ev)
+	}
+	if ev := next(); ev.Type != streamEventQuote || ev.AmountOut != "1992" {
+		t.Fatalf("unexpected quote: %+v", ev)
+	}
+
+	// A reload that drops the chain ends the subscription instead of
+	// quoting on the retired service.
+	other := service.NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, service.WithChain(service.Chain{Name: "bsc", ID: 56}))
+	if _, err := chains.Replace(other); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	for {
+		ev := next()
+		if ev.Type == streamEventQuote {
+			continue
+		}
+		if ev.Type != streamEventError || ev.ID != "a" || ev.Code != string(service.CodeUnknownChain) {
+			t.Fatalf("unexpected event: %+v", ev)
+		}
+		return
+	}
+}
+
+func TestStreamValidation(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	svc := service.NewEstimateService(logger, eth.NewClientReader(newInprocEthClient(t, &fakeEth{})))
+	chains := singleChain(svc)
+	h := NewStreamHandler(logger, chains, StreamConfig{MaxSubscriptions: 1})
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/quotes/stream", h.Handle())
+
+	tuple := streamTuple(streamPool, "1000")
+	tests := []struct {
+		name  string
+		query string
+		code  string
+		body  string
+	}{
+		{name: "no subscription", query: "", code: CodeMissingParameter, body: ErrSubscriptionRequired.Message},
+		{name: "too many", query: "sub=" + tuple + "&sub=" + tuple, code: CodeSubscriptionLimit},
+		{name: "not a tuple", query: "sub=" + streamPool.Hex(), code: CodeInvalidParameter, body: "sub[0]: " + ErrInvalidSubscription.Message},
+		{name: "invalid amount", query: "sub=" + streamTuple(streamPool, "-1"), code: CodeInvalidParameter},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/quotes/stream?"+tc.query, nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			defer resp.Body.Close()
+			var p ProblemDetails
+			if err := json.NewDecoder(resp.Body).Decode(&p); err != nil {
+				t.Fatalf("decode problem: %v", err)
+			}
+			if resp.StatusCode != http.StatusBadRequest || p.Code != tc.code || (tc.body != "" && p.Detail != tc.body) {
+				t.Fatalf("unexpected response: %d %+v", resp.StatusCode, p)
+			}
+		})
+	}
+}
+
+func TestQuoteStreamConflatesQuotes(t *testing.T) {
+	h := NewStreamHandler(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, StreamConfig{MaxSubscriptions: 2})
+	s := h.newQuoteStream(context.Background(), nil)
+	defer s.close()
+
+	a := &quoteSubscription{id: "a", cancel: func() {}}
+	b := &quoteSubscription{id: "b", cancel: func() {}}
+	s.subs["a"], s.subs["b"] = a, b
+	s.publish(a, &StreamEvent{Type: streamEventQuote, ID: "a", Block: "1"})
+	s.publish(b, &StreamEvent{Type: streamEventQuote, ID: "b", Block: "1"})
+	s.publish(a, &StreamEvent{Type: streamEventQuote, ID: "a", Block: "2"})
+	s.reject("x", ErrInvalidStreamOp)
+
+	var got []string
+	for _, ev := range s.take() {
+		got = append(got, ev.Type+":"+ev.ID+":"+ev.Block)
+	}
+	if want := "error:x: quote:a:2 quote:b:1"; strings.Join(got, " ") != want {
+		t.Fatalf("unexpected events: %v, want %s", got, want)
+	}
+
+	// A client that never reads ends the stream instead of queuing forever.
+	for range maxQueuedStreamEvents + 1 {
+		s.reject("x", ErrInvalidStreamOp)
+	}
+	if context.Cause(s.ctx) != errSlowConsumer {
+		t.Fatalf("stream not ended for a slow consumer: %v", context.Cause(s.ctx))
+	}
+}
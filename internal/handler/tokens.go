@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+)
+
+// Bounds of the limit query parameter of /tokens.
+const (
+	defaultTokensLimit = 20
+	maxTokensLimit     = 100
+)
+
+// TokensHandler searches the token lists of the configured chains.
+type TokensHandler struct {
+	BaseHandler
+	chains *service.ChainSet
+}
+
+// NewTokensHandler constructs a TokensHandler searching the token list of
+// the chain each request names.
+func NewTokensHandler(logger *slog.Logger, chains *service.ChainSet) *TokensHandler {
+	return &TokensHandler{
+		BaseHandler: BaseHandler{
+			logger: logger,
+		},
+		chains: chains,
+	}
+}
+
+// TokensRequest represents the supported query parameters for the /tokens
+// endpoint.
+type TokensRequest struct {
+	Query   string `query:"q"`
+	Limit   string `query:"limit"`
+	Chain   string `query:"chain"`
+	ChainID string `query:"chain_id"`
+}
+
+// TokensResponse is the JSON body returned by /tokens.
+type TokensResponse struct {
+	Chain   string      `json:"chain"`
+	ChainID uint64      `json:"chain_id"`
+	Tokens  []TokenInfo `json:"tokens"`
+}
+
+// TokenInfo is a token of a chain's token list.
+type TokenInfo struct {
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals uint8  `json:"decimals"`
+}
+
+// Handle returns a Fiber handler that responds with the tokens of the
+// chain's token list matching q, by address, symbol or name. A chain without
+// a token list has no tokens.
+func (h *TokensHandler) Handle() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		var req TokensRequest
+		if err := c.Bind().Query(&req); err != nil {
+			h.logger.Debug("failed to bind query parameters", "err", err)
+			return ErrInvalidQueryParameters
+		}
+
+		limit := defaultTokensLimit
+		if req.Limit != "" {
+			n, err := strconv.Atoi(req.Limit)
+			if err != nil || n < 1 || n > maxTokensLimit {
+				return ErrInvalidLimit
+			}
+			limit = n
+		}
+
+		svc, release, err := resolveChain(h.chains, &EstimateRequest{Chain: req.Chain, ChainID: req.ChainID})
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		chain := svc.Chain()
+		resp := TokensResponse{Chain: chain.Name, ChainID: chain.ID, Tokens: []TokenInfo{}}
+		for _, t := range svc.TokenList().Search(req.Query, limit) {
+			resp.Tokens = append(resp.Tokens, TokenInfo{
+				Address:  t.Address.Hex(),
+				Symbol:   t.Symbol,
+				Name:     t.Name,
+				Decimals: t.Decimals,
+			})
+		}
+		return c.JSON(resp)
+	}
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"github.com/nulln0ne/uniswap-estimator/internal/tokenlist"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// newTokenListApp serves /estimate and /tokens on a chain whose pool trades
+// token0 (AAA) for token1 (BBB). Two other tokens share the symbol DUP.
+func newTokenListApp(t *testing.T) (app *fiber.App, pool, token0, token1 common.Address) {
+	t.Helper()
+	token0 = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool = common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	entry := func(addr, symbol, name string) string {
+		return fmt.Sprintf(`{"chainId":1,"address":%q,"symbol":%q,"name":%q,"decimals":18}`, common.HexToAddress(addr).Hex(), symbol, name)
+	}
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	list := `{"name":"Test","tokens":[` + strings.Join([]string{
+		entry("0xaa", "AAA", "Token A"),
+		entry("0xbb", "BBB", "Token B"),
+		entry("0xc1", "DUP", "Duplicate One"),
+		entry("0xc2", "DUP", "Duplicate Two"),
+	}, ",") + `]}`
+	if err := os.WriteFile(path, []byte(list), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tokens, err := tokenlist.Load(logger, 1, path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}
+	svc := service.NewEstimateService(logger, eth.NewClientReader(newInprocEthClient(t, fe)), service.WithTokenList(tokens))
+
+	app = fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/estimate", NewEstimateHandler(logger, svc).Handle())
+	app.Get("/tokens", NewTokensHandler(logger, singleChain(svc)).Handle())
+	return app, pool, token0, token1
+}
+
+func TestEstimateHandler_Symbols(t *testing.T) {
+	app, pool, token0, _ := newTokenListApp(t)
+
+	var a, b big.Int
+	out := uniswapv2.GetAmountOut(new(big.Int), &a, &b, big.NewInt(1000), big.NewInt(1_000_000), big.NewInt(2_000_000)).String()
+	// The USDC address with the case of its first letter flipped.
+	badChecksum := "0xa0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	unlisted := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	cases := []struct {
+		name string
+		src  string
+		dst  string
+		code int
+		body string
+	}{
+		{"symbols", "AAA", "BBB", http.StatusOK, out},
+		{"lowercase symbol", "aaa", "bbb", http.StatusOK, out},
+		{"symbol and address", token0.Hex(), "BBB", http.StatusOK, out},
+		{"same token", "AAA", strings.ToLower(token0.Hex()), http.StatusBadRequest, ErrSameAddresses.Message},
+		{"unknown symbol", "AAA", "ZZZ", http.StatusBadRequest, `invalid dst: unknown token symbol "ZZZ" on ethereum`},
+		{"lowercase address", strings.ToLower(token0.Hex()), "BBB", http.StatusOK, out},
+		{"bad checksum", badChecksum, "BBB", http.StatusBadRequest, "invalid checksum of src address"},
+		{"unlisted address", "AAA", unlisted.Hex(), http.StatusBadRequest, "invalid dst: unlisted token " + unlisted.Hex() + " on ethereum"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := "/estimate?pool=" + pool.Hex() + "&src=" + tc.src + "&dst=" + tc.dst + "&src_amount=1000"
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+			if err != nil {
+				t.Fatalf("app.Test error: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+			if resp.StatusCode != tc.code || responseText(resp, body) != tc.body {
+				t.Fatalf("unexpected response %d %q, want %d %q", resp.StatusCode, responseText(resp, body), tc.code, tc.body)
+			}
+		})
+	}
+
+	t.Run("ambiguous symbol", func(t *testing.T) {
+		target := "/estimate?pool=" + pool.Hex() + "&src=AAA&dst=dup&src_amount=1000"
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, target, nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		var p ProblemDetails
+		_ = json.NewDecoder(resp.Body).Decode(&p)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || p.Code != string(service.CodeAmbiguousSymbol) {
+			t.Fatalf("unexpected response %d %+v", resp.StatusCode, p)
+		}
+		for _, addr := range []string{"0xc1", "0xc2"} {
+			if !strings.Contains(p.Detail, common.HexToAddress(addr).Hex()) {
+				t.Errorf("detail %q does not list %s", p.Detail, common.HexToAddress(addr).Hex())
+			}
+		}
+	})
+}
+
+func TestTokensHandler(t *testing.T) {
+	app, _, token0, _ := newTokenListApp(t)
+
+	search := func(t *testing.T, query string) (int, TokensResponse) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/tokens"+query, nil))
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		defer resp.Body.Close()
+		var body TokensResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	status, body := search(t, "?q=aa")
+	want := TokenInfo{Address: token0.Hex(), Symbol: "AAA", Name: "Token A", Decimals: 18}
+	if status != http.StatusOK || body.Chain != "ethereum" || body.ChainID != 1 || len(body.Tokens) != 1 || body.Tokens[0] != want {
+		t.Fatalf("unexpected response %d %+v", status, body)
+	}
+
+	for query, want := range map[string]int{
+		"":                   4,
+		"?limit=2":           2,
+		"?q=duplicate":       2,
+		"?q=" + token0.Hex(): 1,
+		"?q=none":            0,
+	} {
+		if status, body := search(t, query); status != http.StatusOK || len(body.Tokens) != want {
+			t.Errorf("/tokens%s: %d with %d tokens, want %d", query, status, len(body.Tokens), want)
+		}
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?limit=x", "?chain=bsc"} {
+		if status, _ := search(t, query); status != http.StatusBadRequest {
+			t.Errorf("/tokens%s: status %d, want 400", query, status)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// requestContextKey stores the context of a request in its locals.
+type requestContextKey struct{}
+
+// requestContext returns the context carrying the request's span, or the
+// background context when tracing middleware is not installed.
+func requestContext(c fiber.Ctx) context.Context {
+	if ctx, ok := c.Locals(requestContextKey{}).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+// Tracing returns a middleware that runs every request in a server span. The
+// span continues the W3C trace context of the request headers, if any, and
+// is handed to handlers through requestContext.
+func Tracing() fiber.Handler {
+	return func(c fiber.Ctx) error {
+		self := c.Route()
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier{c})
+		ctx, span := tracing.Tracer().Start(ctx, c.Method(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Method()),
+				attribute.String("url.path", c.Path()),
+			))
+		defer span.End()
+		c.Locals(requestContextKey{}, ctx)
+
+		err := c.Next()
+
+		status := responseStatus(c, err)
+		if route := routePattern(c, self); route != unmatchedRoute {
+			span.SetName(c.Method() + " " + route)
+			span.SetAttributes(attribute.String("http.route", route))
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= fiber.StatusInternalServerError {
+			msg := http.StatusText(status)
+			if err != nil {
+				msg = err.Error()
+			}
+			span.SetStatus(codes.Error, msg)
+		}
+		return err
+	}
+}
+
+// headerCarrier adapts the request headers to a propagation.TextMapCarrier.
+type headerCarrier struct {
+	c fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	for k := range h.c.Request().Header.All() {
+		keys = append(keys, string(k))
+	}
+	return keys
+}
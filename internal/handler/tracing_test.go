@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v3"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/service"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func spanAttr(s tracetest.SpanStub, key string) attribute.Value {
+	for _, kv := range s.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	otel.SetTracerProvider(tp)
+	if _, err := tracing.Setup(context.Background(), tracing.Config{}); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	fe := &fakeEth{blockNumber: 42, storage: map[common.Address]map[common.Hash][]byte{pool: {
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rpcPool, err := eth.NewPool(logger, []eth.Endpoint{{Name: "inproc", Client: newInprocEthClient(t, fe)}}, eth.PoolConfig{Chain: "ethereum"})
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(Tracing())
+	app.Get("/estimate", NewEstimateHandler(logger, service.NewEstimateService(logger, rpcPool)).Handle())
+
+	const traceID, parentID = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest(http.MethodGet, "/estimate?pool="+pool.Hex()+"&src="+token0.Hex()+"&dst="+token1.Hex()+"&src_amount=1000", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-"+parentID+"-01")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status: %d", resp.StatusCode)
+	}
+
+	byName := make(map[string]tracetest.SpanStub)
+	for _, s := range exporter.GetSpans() {
+		if s.SpanContext.TraceID().String() != traceID {
+			continue
+		}
+		byName[s.Name] = s
+	}
+
+	server, ok := byName["GET /estimate"]
+	if !ok {
+		t.Fatalf("server span not recorded: %v", byName)
+	}
+	if server.SpanKind != trace.SpanKindServer || server.Parent.SpanID().String() != parentID || !server.Parent.IsRemote() {
+		t.Fatalf("server span does not continue the incoming trace: %+v", server.Parent)
+	}
+	if got := spanAttr(server, "http.response.status_code").AsInt64(); got != http.StatusOK {
+		t.Fatalf("unexpected status attribute: %d", got)
+	}
+
+	estimate, ok := byName["EstimateService.Estimate"]
+	if !ok || estimate.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Fatalf("estimate span missing or not a child of the server span")
+	}
+	if spanAttr(estimate, "pool").AsString() != pool.Hex() || spanAttr(estimate, "src").AsString() != token0.Hex() || spanAttr(estimate, "dst").AsString() != token1.Hex() {
+		t.Fatalf("unexpected estimate attributes: %v", estimate.Attributes)
+	}
+
+	for _, method := range []string{"eth_blockNumber", "eth_getStorageAt"} {
+		rpc, ok := byName[method]
+		if !ok || rpc.Parent.SpanID() != estimate.SpanContext.SpanID() || rpc.SpanKind != trace.SpanKindClient {
+			t.Fatalf("%s span missing or not a child of the estimate span", method)
+		}
+		if spanAttr(rpc, "server.address").AsString() != "inproc" {
+			t.Fatalf("unexpected %s attributes: %v", method, rpc.Attributes)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"github.com/gorilla/websocket"
+)
+
+// maxStreamCommandSize caps the size of a WebSocket command.
+const maxStreamCommandSize = 4096
+
+// Supported values of StreamCommand.Op.
+const (
+	streamOpSubscribe   = "subscribe"
+	streamOpUnsubscribe = "unsubscribe"
+)
+
+// StreamCommand is a message sent by a WebSocket client. Subscribe commands
+// carry the fields of an /estimate request under a client-chosen ID that is
+// unique within the connection; unsubscribe commands only need the ID.
+type StreamCommand struct {
+	Op       string `json:"op"`
+	ID       string `json:"id"`
+	Pool     string `json:"pool"`
+	Src      string `json:"src"`
+	Dst      string `json:"dst"`
+	AmountIn string `json:"src_amount"`
+	Chain    string `json:"chain"`
+	ChainID  uint64 `json:"chain_id"`
+}
+
+var upgrader = websocket.Upgrader{
+	// The API uses no cookies or other ambient credentials, so pages of any
+	// origin may connect, as they may send plain GET requests.
+	CheckOrigin: func(*http.Request) bool { return true },
+	// The handshake is validated before the connection is hijacked, so a
+	// failure here has nobody to report to.
+	Error: func(http.ResponseWriter, *http.Request, int, error) {},
+}
+
+// isWebSocketUpgrade reports whether c asks to upgrade to WebSocket.
+func isWebSocketUpgrade(c fiber.Ctx) bool {
+	if !strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket") {
+		return false
+	}
+	for token := range strings.SplitSeq(c.Get(fiber.HeaderConnection), ",") {
+		if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+			return true
+		}
+	}
+	return false
+}
+
+// serveWebSocket upgrades the connection of c and serves a quote stream on
+// it, starting with subs. fasthttp has no WebSocket support, so the
+// connection is hijacked and handed to the gorilla upgrader.
+func (h *StreamHandler) serveWebSocket(c fiber.Ctx, subs []*quoteSubscription) error {
+	if c.Method() != fiber.MethodGet || c.Get("Sec-WebSocket-Key") == "" || c.Get("Sec-WebSocket-Version") != "13" {
+		return ErrInvalidWebSocketHandshake
+	}
+
+	// c is released once the handler returns, before the hijacked connection
+	// is served, so the request is copied first.
+	r := &http.Request{Method: c.Method(), Host: c.Host(), Header: make(http.Header)}
+	for name, values := range c.GetReqHeaders() {
+		for _, v := range values {
+			r.Header.Add(name, v)
+		}
+	}
+	ctx, serverDone := requestContext(c), c.RequestCtx().Done()
+
+	c.Status(fiber.StatusSwitchingProtocols)
+	c.RequestCtx().HijackSetNoResponse(true)
+	c.RequestCtx().Hijack(func(conn net.Conn) {
+		ws, err := upgrader.Upgrade(&hijackedResponse{conn: conn}, r, nil)
+		if err != nil {
+			h.logger.Debug("websocket upgrade failed", "err", err)
+			return
+		}
+		defer ws.Close()
+
+		s := h.newQuoteStream(ctx, serverDone)
+		defer s.close()
+		for _, sub := range subs {
+			_ = s.subscribe(sub)
+		}
+		go h.readCommands(ws, s)
+		s.run(&wsWriter{ws: ws})
+
+		code := websocket.CloseNormalClosure
+		switch context.Cause(s.ctx) {
+		case errServerShutdown:
+			code = websocket.CloseGoingAway
+		case errSlowConsumer:
+			code = websocket.ClosePolicyViolation
+		}
+		_ = ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(time.Second))
+	})
+	return nil
+}
+
+// readCommands applies the commands of the client until the connection
+// fails. A client that neither sends commands nor answers pings for two
+// keep-alive periods is disconnected.
+func (h *StreamHandler) readCommands(ws *websocket.Conn, s *quoteStream) {
+	ws.SetReadLimit(maxStreamCommandSize)
+	_ = ws.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+	})
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			s.cancel(err)
+			return
+		}
+		_ = ws.SetReadDeadline(time.Now().Add(2 * streamKeepAlive))
+
+		var cmd StreamCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			s.reject("", ErrInvalidRequestBody)
+			continue
+		}
+		if err := h.apply(s, &cmd); err != nil {
+			s.reject(cmd.ID, err)
+		}
+	}
+}
+
+// apply runs cmd on s.
+func (h *StreamHandler) apply(s *quoteStream, cmd *StreamCommand) error {
+	if cmd.ID == "" {
+		return ErrSubscriptionIDRequired
+	}
+	switch cmd.Op {
+	case streamOpSubscribe:
+		req := &EstimateRequest{Pool: cmd.Pool, Src: cmd.Src, Dst: cmd.Dst, AmountIn: cmd.AmountIn, Chain: cmd.Chain}
+		if cmd.ChainID != 0 {
+			req.ChainID = strconv.FormatUint(cmd.ChainID, 10)
+		}
+		sub, err := h.parseSubscription(cmd.ID, req)
+		if err != nil {
+			return err
+		}
+		return s.subscribe(sub)
+	case streamOpUnsubscribe:
+		return s.unsubscribe(cmd.ID)
+	default:
+		return ErrInvalidStreamOp
+	}
+}
+
+// wsWriter sends events as WebSocket text messages.
+type wsWriter struct {
+	ws *websocket.Conn
+}
+
+func (w *wsWriter) write(events []*StreamEvent) error {
+	for _, ev := range events {
+		_ = w.ws.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err := w.ws.WriteJSON(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *wsWriter) keepAlive() error {
+	return w.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+}
+
+// hijackedResponse lets the gorilla upgrader take over a connection
+// hijacked from fasthttp.
+type hijackedResponse struct {
+	conn   net.Conn
+	header http.Header
+}
+
+func (w *hijackedResponse) Header() http.Header {
+	if w.header == nil {
+		w.header = make(http.Header)
+	}
+	return w.header
+}
+
+func (w *hijackedResponse) Write(b []byte) (int, error) { return w.conn.Write(b) }
+
+func (w *hijackedResponse) WriteHeader(int) {}
+
+func (w *hijackedResponse) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
@@ -0,0 +1,187 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+)
+
+// SyncTopic is the topic of the Uniswap V2 pair event
+// Sync(uint112 reserve0, uint112 reserve1), emitted whenever reserves change.
+var SyncTopic = crypto.Keccak256Hash([]byte("Sync(uint112,uint112)"))
+
+// reservesSlot is the storage slot holding the packed pair reserves.
+const reservesSlot = 8
+
+// Config configures an Indexer.
+type Config struct {
+	// Pools are the pair addresses to index.
+	Pools []common.Address
+	// StartBlock is the first block indexed for pools without stored history.
+	StartBlock uint64
+	// ChunkSize is the maximum block span of a single eth_getLogs request.
+	ChunkSize uint64
+	// Confirmations is how far behind the head indexing stays so that
+	// shallow reorgs never reach the store.
+	Confirmations uint64
+	// PollInterval is the delay between tail iterations.
+	PollInterval time.Duration
+}
+
+// Reader is the chain access of an Indexer. An eth.Pool spreads the reads
+// over its endpoints and meters them on its Limiter, against the same budget
+// as estimates; refused reads are retried on the next poll.
+type Reader interface {
+	eth.StateReader
+	eth.LogReader
+}
+
+// Indexer backfills Sync events for the configured pools from StartBlock and
+// then keeps tailing new blocks, persisting reserves in a Store.
+type Indexer struct {
+	logger *slog.Logger
+	reader Reader
+	store  *Store
+	cfg    Config
+}
+
+// New constructs an Indexer. Zero ChunkSize and PollInterval values are
+// replaced with defaults of 2000 blocks and 12 seconds.
+func New(logger *slog.Logger, reader Reader, store *Store, cfg Config) *Indexer {
+	if cfg.ChunkSize == 0 {
+		cfg.ChunkSize = 2000
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 12 * time.Second
+	}
+	return &Indexer{logger: logger, reader: reader, store: store, cfg: cfg}
+}
+
+// Run indexes until ctx is canceled. Errors are logged and retried on the next
+// poll.
+func (ix *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(ix.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := ix.SyncOnce(ctx); err != nil && ctx.Err() == nil {
+			ix.logger.Warn("indexer sync failed", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncOnce brings every pool up to the confirmed head.
+func (ix *Indexer) SyncOnce(ctx context.Context) error {
+	head, err := ix.reader.BlockNumber(ctx)
+	if err != nil {
+		return fmt.Errorf("block number: %w", err)
+	}
+	if head < ix.cfg.Confirmations {
+		return nil
+	}
+	target := head - ix.cfg.Confirmations
+
+	for _, pool := range ix.cfg.Pools {
+		if err := ix.syncPool(ctx, pool, target); err != nil {
+			return fmt.Errorf("pool %s: %w", pool.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// syncPool indexes pool up to target in ChunkSize steps. A pool without stored
+// history is seeded with its reserves at StartBlock read from storage.
+func (ix *Indexer) syncPool(ctx context.Context, pool common.Address, target uint64) error {
+	_, indexed, ok, err := ix.store.Range(pool)
+	if err != nil {
+		return err
+	}
+
+	next := indexed + 1
+	if !ok {
+		if ix.cfg.StartBlock > target {
+			return nil
+		}
+		seed, err := ix.seed(ctx, pool, ix.cfg.StartBlock)
+		if err != nil {
+			return err
+		}
+		if err := ix.store.Append(pool, []Record{seed}, ix.cfg.StartBlock); err != nil {
+			return err
+		}
+		next = ix.cfg.StartBlock + 1
+	}
+
+	for from := next; from <= target; {
+		to := min(from+ix.cfg.ChunkSize-1, target)
+		records, err := ix.fetchSyncs(ctx, pool, from, to)
+		if err != nil {
+			return err
+		}
+		if err := ix.store.Append(pool, records, to); err != nil {
+			return err
+		}
+		ix.logger.Debug("indexed range", "pool", pool.Hex(), "from", from, "to", to, "syncs", len(records))
+		from = to + 1
+	}
+	return nil
+}
+
+// seed reads the pool reserves at the end of block directly from storage.
+func (ix *Indexer) seed(ctx context.Context, pool common.Address, block uint64) (Record, error) {
+	key := common.BigToHash(big.NewInt(reservesSlot))
+	b, err := ix.reader.StorageAt(ctx, pool, key, new(big.Int).SetUint64(block))
+	if err != nil {
+		return Record{}, fmt.Errorf("seed reserves at %d: %w", block, err)
+	}
+	v := new(big.Int).SetBytes(b)
+	mask := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 112), big.NewInt(1))
+	r0 := new(big.Int).And(v, mask)
+	r1 := new(big.Int).And(new(big.Int).Rsh(v, 112), mask)
+	return Record{Block: block, Reserve0: r0, Reserve1: r1}, nil
+}
+
+// fetchSyncs returns the reserves after the last Sync event of every block in
+// [from, to] that emitted one, in block order.
+func (ix *Indexer) fetchSyncs(ctx context.Context, pool common.Address, from, to uint64) ([]Record, error) {
+	logs, err := ix.reader.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{pool},
+		Topics:    [][]common.Hash{{SyncTopic}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get logs %d-%d: %w", from, to, err)
+	}
+
+	var records []Record
+	for _, l := range logs {
+		if l.Removed || len(l.Data) != 64 {
+			continue
+		}
+		r := Record{
+			Block:    l.BlockNumber,
+			Reserve0: new(big.Int).SetBytes(l.Data[:32]),
+			Reserve1: new(big.Int).SetBytes(l.Data[32:]),
+		}
+		// Logs are ordered; a later Sync in the same block supersedes earlier ones.
+		if n := len(records); n > 0 && records[n-1].Block == r.Block {
+			records[n-1] = r
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, nil
+}
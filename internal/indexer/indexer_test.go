@@ -0,0 +1,204 @@
+package indexer
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math/big"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+)
+
+type logFilter struct {
+	FromBlock hexutil.Uint64   `json:"fromBlock"`
+	ToBlock   hexutil.Uint64   `json:"toBlock"`
+	Addresses []common.Address `json:"address"`
+	Topics    [][]common.Hash  `json:"topics"`
+}
+
+// fakeEth serves Sync logs for a single pool and records eth_getLogs ranges.
+type fakeEth struct {
+	mu      sync.Mutex
+	head    uint64
+	seed    []byte
+	syncs   []types.Log
+	queries [][2]uint64
+}
+
+func (f *fakeEth) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return hexutil.Uint64(f.head), nil
+}
+
+func (f *fakeEth) GetStorageAt(ctx context.Context, addr common.Address, position common.Hash, _ gethrpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	return f.seed, nil
+}
+
+func (f *fakeEth) GetLogs(ctx context.Context, q logFilter) ([]types.Log, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, [2]uint64{uint64(q.FromBlock), uint64(q.ToBlock)})
+	var out []types.Log
+	for _, l := range f.syncs {
+		if l.BlockNumber >= uint64(q.FromBlock) && l.BlockNumber <= uint64(q.ToBlock) {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+func syncLog(pool common.Address, block uint64, r0, r1 int64) types.Log {
+	data := make([]byte, 64)
+	big.NewInt(r0).FillBytes(data[:32])
+	big.NewInt(r1).FillBytes(data[32:])
+	return types.Log{Address: pool, Topics: []common.Hash{SyncTopic}, Data: data, BlockNumber: block}
+}
+
+func packReserves(r0, r1 int64) []byte {
+	v := new(big.Int).Lsh(big.NewInt(r1), 112)
+	v.Or(v, big.NewInt(r0))
+	out := make([]byte, 32)
+	v.FillBytes(out)
+	return out
+}
+
+func dialFake(t *testing.T, fe *fakeEth) *ethclient.Client {
+	t.Helper()
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	rc := gethrpc.DialInProc(srv)
+	t.Cleanup(rc.Close)
+	return ethclient.NewClient(rc)
+}
+
+func newTestIndexer(t *testing.T, fe *fakeEth, cfg Config) (*Indexer, *Store) {
+	t.Helper()
+	return newReaderIndexer(t, eth.NewClientReader(dialFake(t, fe)), cfg)
+}
+
+func newReaderIndexer(t *testing.T, reader Reader, cfg Config) (*Indexer, *Store) {
+	t.Helper()
+	store, err := OpenStore(filepath.Join(t.TempDir(), "reserves.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return New(logger, reader, store, cfg), store
+}
+
+func TestIndexer_BackfillAndTail(t *testing.T) {
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	fe := &fakeEth{
+		head: 130,
+		seed: packReserves(1_000, 2_000),
+		syncs: []types.Log{
+			syncLog(pool, 105, 1_100, 1_900),
+			syncLog(pool, 105, 1_200, 1_800), // last Sync in a block wins
+			syncLog(pool, 112, 1_300, 1_700),
+			syncLog(pool, 125, 1_400, 1_600),
+		},
+	}
+	ix, store := newTestIndexer(t, fe, Config{Pools: []common.Address{pool}, StartBlock: 100, ChunkSize: 5, Confirmations: 10})
+
+	if err := ix.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("SyncOnce: %v", err)
+	}
+
+	start, head, ok, err := store.Range(pool)
+	if err != nil || !ok || start != 100 || head != 120 {
+		t.Fatalf("unexpected range: %d-%d ok=%v err=%v", start, head, ok, err)
+	}
+	// Blocks 101..120 in chunks of 5.
+	if len(fe.queries) != 4 || fe.queries[0] != [2]uint64{101, 105} || fe.queries[3] != [2]uint64{116, 120} {
+		t.Fatalf("unexpected getLogs ranges: %v", fe.queries)
+	}
+
+	cases := []struct {
+		block  uint64
+		r0, r1 int64
+		ok     bool
+	}{
+		{99, 0, 0, false},
+		{100, 1_000, 2_000, true},
+		{104, 1_000, 2_000, true},
+		{105, 1_200, 1_800, true},
+		{111, 1_200, 1_800, true},
+		{112, 1_300, 1_700, true},
+		{120, 1_300, 1_700, true},
+		{121, 0, 0, false},
+	}
+	for _, tc := range cases {
+		r0, r1, ok, err := store.ReservesAt(pool, tc.block)
+		if err != nil || ok != tc.ok {
+			t.Fatalf("block %d: ok=%v err=%v want ok=%v", tc.block, ok, err, tc.ok)
+		}
+		if ok && (r0.Int64() != tc.r0 || r1.Int64() != tc.r1) {
+			t.Fatalf("block %d: got %s/%s want %d/%d", tc.block, r0, r1, tc.r0, tc.r1)
+		}
+	}
+
+	// Tail: the head advances and the next pass only fetches new blocks.
+	fe.mu.Lock()
+	fe.head = 140
+	fe.queries = nil
+	fe.mu.Unlock()
+	if err := ix.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("SyncOnce: %v", err)
+	}
+	if len(fe.queries) != 2 || fe.queries[0] != [2]uint64{121, 125} {
+		t.Fatalf("unexpected tail ranges: %v", fe.queries)
+	}
+	r0, _, ok, _ := store.ReservesAt(pool, 130)
+	if !ok || r0.Int64() != 1_400 {
+		t.Fatalf("unexpected tailed reserves: %v ok=%v", r0, ok)
+	}
+}
+
+func TestIndexer_StartBeyondHead(t *testing.T) {
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	fe := &fakeEth{head: 50, seed: packReserves(1, 1)}
+	ix, store := newTestIndexer(t, fe, Config{Pools: []common.Address{pool}, StartBlock: 100})
+
+	if err := ix.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("SyncOnce: %v", err)
+	}
+	if _, _, ok, _ := store.Range(pool); ok {
+		t.Fatalf("pool must not be indexed before its start block is confirmed")
+	}
+}
+
+func TestIndexer_PoolFailover(t *testing.T) {
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	fe := &fakeEth{head: 120, seed: packReserves(1_000, 2_000), syncs: []types.Log{syncLog(pool, 105, 1_100, 1_900)}}
+
+	// The first endpoint is down, so every read, logs included, is served
+	// by the second.
+	down := dialFake(t, &fakeEth{})
+	down.Close()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	p, err := eth.NewPool(logger, []eth.Endpoint{{Name: "down", Client: down}, {Name: "up", Client: dialFake(t, fe)}}, eth.PoolConfig{})
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	ix, store := newReaderIndexer(t, p, Config{Pools: []common.Address{pool}, StartBlock: 100})
+
+	if err := ix.SyncOnce(context.Background()); err != nil {
+		t.Fatalf("SyncOnce: %v", err)
+	}
+	if r0, _, ok, err := store.ReservesAt(pool, 110); err != nil || !ok || r0.Int64() != 1_100 {
+		t.Fatalf("unexpected reserves %v ok=%v err=%v", r0, ok, err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package indexer backfills and tails Uniswap V2 Sync events into a local
+// embedded store so historical reserves can be served without an archive node.
+package indexer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	bolt "go.etcd.io/bbolt"
+)
+
+// reserveSize is the encoded width of a uint112 reserve.
+const reserveSize = 14
+
+var (
+	// metaBucket maps a pool address to its indexed range (start, head).
+	metaBucket = []byte("meta")
+	// reservesBucket holds one nested bucket per pool mapping big-endian block
+	// numbers to the reserves set by the last Sync event in that block.
+	reservesBucket = []byte("reserves")
+)
+
+// Record is the state of a pool after the last Sync event of a block.
+type Record struct {
+	Block    uint64
+	Reserve0 *big.Int
+	Reserve1 *big.Int
+}
+
+// Store persists pool reserve history in a bbolt database file.
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens (creating if needed) the store at path.
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open indexer store %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(metaBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(reservesBucket)
+		return err
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("init indexer store: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close releases the database file.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Range returns the inclusive block range indexed for pool. ok is false if the
+// pool has not been indexed yet.
+func (s *Store) Range(pool common.Address) (start, head uint64, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(metaBucket).Get(pool.Bytes())
+		if len(v) != 16 {
+			return nil
+		}
+		start, head, ok = binary.BigEndian.Uint64(v[:8]), binary.BigEndian.Uint64(v[8:]), true
+		return nil
+	})
+	return start, head, ok, err
+}
+
+// Append stores records for pool and advances its indexed head to head in a
+// single transaction. The first call for a pool also fixes its start block,
+// which must be covered by a record so lookups have a base state.
+func (s *Store) Append(pool common.Address, records []Record, head uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		start := head
+		if v := meta.Get(pool.Bytes()); len(v) == 16 {
+			start = binary.BigEndian.Uint64(v[:8])
+			if prev := binary.BigEndian.Uint64(v[8:]); head < prev {
+				return fmt.Errorf("indexer head for %s moved backwards: %d < %d", pool.Hex(), head, prev)
+			}
+		} else if len(records) > 0 {
+			start = records[0].Block
+		}
+
+		b, err := tx.Bucket(reservesBucket).CreateBucketIfNotExists(pool.Bytes())
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			v, err := encodeReserves(r.Reserve0, r.Reserve1)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(blockKey(r.Block), v); err != nil {
+				return err
+			}
+		}
+
+		m := make([]byte, 16)
+		binary.BigEndian.PutUint64(m[:8], start)
+		binary.BigEndian.PutUint64(m[8:], head)
+		return meta.Put(pool.Bytes(), m)
+	})
+}
+
+// ReservesAt returns the reserves of pool as of the end of block. ok is false
+// when block lies outside the indexed range.
+func (s *Store) ReservesAt(pool common.Address, block uint64) (reserve0, reserve1 *big.Int, ok bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(metaBucket).Get(pool.Bytes())
+		if len(v) != 16 {
+			return nil
+		}
+		start, head := binary.BigEndian.Uint64(v[:8]), binary.BigEndian.Uint64(v[8:])
+		if block < start || block > head {
+			return nil
+		}
+
+		b := tx.Bucket(reservesBucket).Bucket(pool.Bytes())
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		key := blockKey(block)
+		k, val := c.Seek(key)
+		switch {
+		case k == nil:
+			k, val = c.Last()
+		case binary.BigEndian.Uint64(k) > block:
+			k, val = c.Prev()
+		}
+		if k == nil {
+			return nil
+		}
+		reserve0, reserve1 = decodeReserves(val)
+		ok = true
+		return nil
+	})
+	return reserve0, reserve1, ok, err
+}
+
+func blockKey(block uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, block)
+	return k
+}
+
+var errReserveOverflow = errors.New("reserve does not fit in uint112")
+
+func encodeReserves(r0, r1 *big.Int) ([]byte, error) {
+	if r0.Sign() < 0 || r1.Sign() < 0 || r0.BitLen() > 112 || r1.BitLen() > 112 {
+		return nil, errReserveOverflow
+	}
+	v := make([]byte, 2*reserveSize)
+	r0.FillBytes(v[:reserveSize])
+	r1.FillBytes(v[reserveSize:])
+	return v, nil
+}
+
+func decodeReserves(v []byte) (*big.Int, *big.Int) {
+	return new(big.Int).SetBytes(v[:reserveSize]), new(big.Int).SetBytes(v[reserveSize:])
+}
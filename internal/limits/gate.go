@@ -0,0 +1,117 @@
+// Package limits caps the work the server takes on at once. A Gate is
+// shared by the HTTP and gRPC APIs, so that neither can starve the other of
+// RPC capacity.
+package limits
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+)
+
+// ErrOverloaded is returned for a request shed because the concurrency cap
+// and its queue are full, or because it waited in the queue too long.
+var ErrOverloaded = errors.New("server overloaded, retry later")
+
+// ConcurrencyConfig configures a Gate.
+type ConcurrencyConfig struct {
+	// Limit is the number of requests served at once; zero disables the cap.
+	Limit int
+	// Queue is the number of requests that may wait for a slot. Requests
+	// arriving while it is full are shed at once.
+	Queue int
+	// QueueTimeout bounds the wait for a slot; zero leaves only the request
+	// deadline.
+	QueueTimeout time.Duration
+}
+
+// Gate caps the requests served at once across everything sharing it: HTTP
+// routes, gRPC calls and quote stream polls. Requests over the cap wait in a
+// queue of bounded length and time. A nil Gate, or one without a limit, lets
+// every request through.
+type Gate struct {
+	logger  *slog.Logger
+	cfg     ConcurrencyConfig
+	slots   chan struct{}
+	waiting atomic.Int64
+}
+
+// NewGate returns a Gate configured by cfg.
+func NewGate(logger *slog.Logger, cfg ConcurrencyConfig) *Gate {
+	g := &Gate{logger: logger, cfg: cfg}
+	if cfg.Limit > 0 {
+		g.slots = make(chan struct{}, cfg.Limit)
+	}
+	return g
+}
+
+// Acquire takes a slot for the request of ctx, queueing while none is free,
+// and returns the function giving it back. It returns ErrOverloaded if the
+// request is shed, or the error of ctx if it ends first. route names the
+// request in logs.
+func (g *Gate) Acquire(ctx context.Context, route string) (release func(), err error) {
+	if g == nil || g.slots == nil {
+		return func() {}, nil
+	}
+	if err := g.acquire(ctx, route); err != nil {
+		return nil, err
+	}
+	metrics.AddInFlight(1)
+	return sync.OnceFunc(func() {
+		metrics.AddInFlight(-1)
+		<-g.slots
+	}), nil
+}
+
+// Queued returns the number of requests waiting for a slot.
+func (g *Gate) Queued() int {
+	if g == nil {
+		return 0
+	}
+	return int(g.waiting.Load())
+}
+
+func (g *Gate) acquire(ctx context.Context, route string) error {
+	select {
+	case g.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if g.waiting.Add(1) > int64(g.cfg.Queue) {
+		g.waiting.Add(-1)
+		return g.shed(route, metrics.RejectQueueFull)
+	}
+	metrics.AddQueued(1)
+	defer func() {
+		g.waiting.Add(-1)
+		metrics.AddQueued(-1)
+	}()
+
+	var timeout <-chan time.Time
+	if g.cfg.QueueTimeout > 0 {
+		t := time.NewTimer(g.cfg.QueueTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	select {
+	case g.slots <- struct{}{}:
+		return nil
+	case <-timeout:
+		return g.shed(route, metrics.RejectQueueTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shed refuses the request of route for reason.
+func (g *Gate) shed(route, reason string) error {
+	g.logger.Warn("request shed", "reason", reason, "route", route)
+	metrics.HTTPRejected(reason)
+	return ErrOverloaded
+}
@@ -0,0 +1,82 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestGate(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	g := NewGate(logger, ConcurrencyConfig{Limit: 1, Queue: 1})
+
+	release, err := g.Acquire(context.Background(), "first")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	// The next request waits in the queue, and the one after is shed.
+	queued := make(chan error, 1)
+	go func() {
+		done, err := g.Acquire(context.Background(), "queued")
+		if err == nil {
+			done()
+		}
+		queued <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for g.Queued() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("request not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := g.Acquire(context.Background(), "shed"); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Acquire with a full queue: %v, want ErrOverloaded", err)
+	}
+
+	// Releasing twice gives back one slot only.
+	release()
+	release()
+	if err := <-queued; err != nil {
+		t.Fatalf("queued Acquire: %v", err)
+	}
+	if g.Queued() != 0 {
+		t.Fatalf("%d requests still queued", g.Queued())
+	}
+}
+
+func TestGateQueueEnds(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	g := NewGate(logger, ConcurrencyConfig{Limit: 1, Queue: 1, QueueTimeout: 20 * time.Millisecond})
+	release, err := g.Acquire(context.Background(), "first")
+	if err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	defer release()
+
+	if _, err := g.Acquire(context.Background(), "timeout"); !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("Acquire past the queue timeout: %v, want ErrOverloaded", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := g.Acquire(ctx, "canceled"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Acquire with a canceled context: %v, want context.Canceled", err)
+	}
+}
+
+func TestGateDisabled(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	for name, g := range map[string]*Gate{"nil": nil, "no limit": NewGate(logger, ConcurrencyConfig{})} {
+		for range 3 {
+			release, err := g.Acquire(context.Background(), name)
+			if err != nil {
+				t.Fatalf("%s gate: Acquire: %v", name, err)
+			}
+			defer release()
+		}
+	}
+}
@@ -10,12 +10,25 @@ import (
 // NewLogger returns a slog.Logger configured to write text logs to stdout at
 // the provided level. Supported levels: debug, info, warn, error.
 func NewLogger(level string) *slog.Logger {
-	lvl := parseLevel(level)
+	logger, _ := NewLeveledLogger(level)
+	return logger
+}
+
+// NewLeveledLogger is like NewLogger but also returns the level variable of
+// the logger, so that the level can be changed at runtime with SetLevel.
+func NewLeveledLogger(level string) (*slog.Logger, *slog.LevelVar) {
+	lvl := new(slog.LevelVar)
+	SetLevel(lvl, level)
 	handler := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})
-	return slog.New(handler)
+	return slog.New(handler), lvl
+}
+
+// SetLevel sets lvl to the named level.
+func SetLevel(lvl *slog.LevelVar, level string) {
+	lvl.Set(parseLevel(level))
 }
 
-func parseLevel(level string) slog.Leveler {
+func parseLevel(level string) slog.Level {
 	switch strings.ToLower(strings.TrimSpace(level)) {
 	case "debug":
 		return slog.LevelDebug
@@ -0,0 +1,256 @@
+// Package metrics defines the Prometheus metrics of the service. The handler,
+// service and eth packages record through the functions of this package, and
+// Handler serves everything recorded for scraping.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "uniswap_estimator"
+
+// Results of RPC calls and cache lookups.
+const (
+	resultOK       = "ok"
+	resultError    = "error"
+	resultCanceled = "canceled"
+	resultHit      = "hit"
+	resultMiss     = "miss"
+)
+
+// Results of API key checks reported by APIKeyRequest.
+const (
+	APIKeyAllowed       = "allowed"
+	APIKeyMissing       = "missing"
+	APIKeyInvalid       = "invalid"
+	APIKeyRateLimited   = "rate_limited"
+	APIKeyQuotaExceeded = "quota_exceeded"
+)
+
+// Reasons of HTTP requests refused by the traffic limits, reported by
+// HTTPRejected.
+const (
+	RejectClientRateLimited = "client_rate_limited"
+	RejectQueueFull         = "queue_full"
+	RejectQueueTimeout      = "queue_timeout"
+)
+
+// Results of endpoint votes in quorum reads, reported by QuorumVote.
+const (
+	// QuorumAgreed is a vote for the value the read returned.
+	QuorumAgreed = "agreed"
+	// QuorumDiverged is a vote for another value, or a failed call, in a
+	// read that reached quorum.
+	QuorumDiverged = "diverged"
+	// QuorumNotReached is any vote of a read that did not reach quorum.
+	QuorumNotReached = "not_reached"
+)
+
+// Caches reported by CacheLookup.
+const (
+	// CacheStaleQuote is the pool state served while RPC reads are rate
+	// limited.
+	CacheStaleQuote = "stale_quote"
+	// CacheReserveStore is the reserve history of the indexer.
+	CacheReserveStore = "reserve_store"
+	// CacheEstimateResponse is the /estimate responses of the latest block,
+	// including conditional requests answered with 304 Not Modified.
+	CacheEstimateResponse = "estimate_response"
+	// CacheTokenMetadata is the decimals and symbols of tokens.
+	CacheTokenMetadata = "token_metadata"
+)
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	httpRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rejected_total",
+		Help:      "HTTP requests refused by the per-client rate limit or shed by the concurrency cap, by reason.",
+	}, []string{"reason"})
+
+	httpInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "limited_in_flight",
+		Help:      "Requests and stream polls being served under the concurrency cap.",
+	})
+
+	httpQueued = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "limited_queued",
+		Help:      "Requests and stream polls waiting for the concurrency cap.",
+	})
+
+	estimates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "estimates_total",
+		Help:      "Swap estimates by chain, mode and outcome.",
+	}, []string{"chain", "mode", "outcome"})
+
+	rpcCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "calls_total",
+		Help:      "RPC calls sent to endpoints by chain, method, endpoint and result.",
+	}, []string{"chain", "method", "endpoint", "result"})
+
+	rpcDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "call_duration_seconds",
+		Help:      "RPC call latency by chain, method and endpoint.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"chain", "method", "endpoint"})
+
+	rpcRateLimited = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "rate_limited_total",
+		Help:      "RPC calls refused by the compute-unit limiter by chain and method.",
+	}, []string{"chain", "method"})
+
+	rpcQuorumVotes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "quorum_votes_total",
+		Help:      "Endpoint answers to quorum reads by chain, endpoint and result (agreed, diverged or not_reached).",
+	}, []string{"chain", "endpoint", "result"})
+
+	cacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "cache",
+		Name:      "lookups_total",
+		Help:      "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	apiKeyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "auth",
+		Name:      "requests_total",
+		Help:      "API requests by key name and result of the key check. Requests without a valid key have an empty key.",
+	}, []string{"key", "result"})
+
+	headBlock = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "rpc",
+		Name:      "head_block",
+		Help:      "Latest block number reported by each endpoint's health check.",
+	}, []string{"chain", "endpoint"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests, httpDuration, httpRejected, httpInFlight, httpQueued,
+		estimates,
+		rpcCalls, rpcDuration, rpcRateLimited, rpcQuorumVotes,
+		cacheLookups,
+		apiKeyRequests,
+		headBlock,
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHTTP records a served HTTP request. route is the route pattern, not
+// the request path, to bound the number of series.
+func ObserveHTTP(route, method string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(d.Seconds())
+}
+
+// HTTPRejected records an HTTP request refused for reason.
+func HTTPRejected(reason string) {
+	httpRejected.WithLabelValues(reason).Inc()
+}
+
+// AddInFlight adds n to the requests served under the concurrency cap.
+func AddInFlight(n int) {
+	httpInFlight.Add(float64(n))
+}
+
+// AddQueued adds n to the requests waiting for the concurrency cap.
+func AddQueued(n int) {
+	httpQueued.Add(float64(n))
+}
+
+// ObserveEstimate records the outcome of an estimate, "ok" or a short error
+// name.
+func ObserveEstimate(chain, mode, outcome string) {
+	estimates.WithLabelValues(chain, mode, outcome).Inc()
+}
+
+// ObserveRPC records an RPC call to endpoint. canceled marks attempts
+// abandoned because the caller went away or another attempt won; their
+// latency is not observed.
+func ObserveRPC(chain, method, endpoint string, d time.Duration, err error, canceled bool) {
+	result := resultOK
+	switch {
+	case canceled:
+		rpcCalls.WithLabelValues(chain, method, endpoint, resultCanceled).Inc()
+		return
+	case err != nil:
+		result = resultError
+	}
+	rpcCalls.WithLabelValues(chain, method, endpoint, result).Inc()
+	rpcDuration.WithLabelValues(chain, method, endpoint).Observe(d.Seconds())
+}
+
+// RPCRateLimited records an RPC call refused by the limiter.
+func RPCRateLimited(chain, method string) {
+	rpcRateLimited.WithLabelValues(chain, method).Inc()
+}
+
+// QuorumVote records the result of endpoint's answer to a quorum read.
+func QuorumVote(chain, endpoint, result string) {
+	rpcQuorumVotes.WithLabelValues(chain, endpoint, result).Inc()
+}
+
+// CacheLookup records a hit or miss of cache.
+func CacheLookup(cache string, hit bool) {
+	result := resultMiss
+	if hit {
+		result = resultHit
+	}
+	cacheLookups.WithLabelValues(cache, result).Inc()
+}
+
+// APIKeyRequest records the result of checking the API key of a request. key
+// is the name of the key, empty unless it was valid.
+func APIKeyRequest(key, result string) {
+	apiKeyRequests.WithLabelValues(key, result).Inc()
+}
+
+// SetHeadBlock records the latest block endpoint reported.
+func SetHeadBlock(chain, endpoint string, block uint64) {
+	headBlock.WithLabelValues(chain, endpoint).Set(float64(block))
+}
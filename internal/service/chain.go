@@ -0,0 +1,266 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// Factory is a Uniswap V2 style pair factory deployed on a chain.
+type Factory struct {
+	Name    string
+	Address common.Address
+	// InitCodeHash is the keccak256 of the pair creation code, used to check
+	// that a pool claiming this factory was really deployed by it. A zero hash
+	// skips the check.
+	InitCodeHash common.Hash
+	// FeeBps is the swap fee of the factory's pairs in basis points.
+	FeeBps uint32
+}
+
+// Chain describes the network an EstimateService quotes on.
+type Chain struct {
+	Name string
+	ID   uint64
+	// Factories are the known factories. When set, the factory of every
+	// quoted pool is read to pick its fee and verify its address.
+	Factories []Factory
+	// DefaultFeeBps applies to pools of unknown factories.
+	DefaultFeeBps uint32
+	// BaseTokens are the chain's common quote tokens, e.g. the wrapped native
+	// token and major stablecoins.
+	BaseTokens []common.Address
+	// BlockTime is the expected interval between blocks; zero if unknown.
+	BlockTime time.Duration
+}
+
+// defaultChain is used when no chain is configured, matching the original
+// single-chain Ethereum deployment.
+var defaultChain = Chain{Name: "ethereum", ID: 1, DefaultFeeBps: 30}
+
+// chainParams is a Chain with fees precomputed for lookups by factory.
+type chainParams struct {
+	Chain
+	defaultFee uniswapv2.Fee
+	factories  map[common.Address]factoryParams
+}
+
+type factoryParams struct {
+	Factory
+	fee uniswapv2.Fee
+}
+
+func newChainParams(c Chain) chainParams {
+	p := chainParams{
+		Chain:      c,
+		defaultFee: uniswapv2.NewFee(c.DefaultFeeBps),
+		factories:  make(map[common.Address]factoryParams, len(c.Factories)),
+	}
+	for _, f := range c.Factories {
+		p.factories[f.Address] = factoryParams{Factory: f, fee: uniswapv2.NewFee(f.FeeBps)}
+	}
+	return p
+}
+
+// WithChain sets the chain the service quotes on, with its factories and
+// fees. Without it the service assumes Ethereum mainnet Uniswap V2 pools with
+// a 0.3% fee.
+func WithChain(c Chain) Option {
+	return func(e *EstimateService) {
+		e.chain = newChainParams(c)
+	}
+}
+
+// Chain returns the chain the service quotes on.
+func (e *EstimateService) Chain() Chain {
+	return e.chain.Chain
+}
+
+// applyFactory sets the fee of state from the pool's factory and checks that
+// pool is the pair address the factory derives for the tokens. Pools of
+// unknown factories keep the default fee.
+func (c *chainParams) applyFactory(state *poolState, pool, factory common.Address) error {
+	f, ok := c.factories[factory]
+	if !ok {
+		return nil
+	}
+	if f.InitCodeHash != (common.Hash{}) && pairAddress(f.Address, f.InitCodeHash, state.token0, state.token1) != pool {
+		return ErrPoolNotFromFactory
+	}
+	state.fee = f.fee
+	return nil
+}
+
+// pairAddress computes the CREATE2 address of the pair of token0 and token1
+// deployed by factory, as UniswapV2Library.pairFor does.
+func pairAddress(factory common.Address, initCodeHash common.Hash, token0, token1 common.Address) common.Address {
+	salt := crypto.Keccak256Hash(token0.Bytes(), token1.Bytes())
+	return crypto.CreateAddress2(factory, salt, initCodeHash.Bytes())
+}
+
+// ChainSet routes requests to the EstimateService of a chain by name or ID.
+// Its services can be replaced atomically while requests are being served.
+// Requests that Acquire a service hold it until they release it, so that the
+// owner of replaced services learns when they can be closed.
+type ChainSet struct {
+	cur atomic.Pointer[chainIndex]
+}
+
+// chainIndex is one generation of the services of a ChainSet. It counts the
+// requests holding it and closes released once it was replaced and the last
+// of them let go.
+type chainIndex struct {
+	def    *EstimateService
+	all    []*EstimateService
+	byName map[string]*EstimateService
+	byID   map[uint64]*EstimateService
+
+	refs     atomic.Int64
+	replaced atomic.Bool
+	idle     sync.Once
+	released chan struct{}
+}
+
+func newChainIndex(services []*EstimateService) (*chainIndex, error) {
+	if len(services) == 0 {
+		return nil, ErrUnknownChain
+	}
+	idx := &chainIndex{
+		def:    services[0],
+		all:    services,
+		byName: make(map[string]*EstimateService, len(services)),
+		byID:   make(map[uint64]*EstimateService, len(services)),
+
+		released: make(chan struct{}),
+	}
+	for _, svc := range services {
+		c := svc.Chain()
+		name := strings.ToLower(c.Name)
+		if _, dup := idx.byName[name]; dup {
+			return nil, ErrDuplicateChain
+		}
+		if _, dup := idx.byID[c.ID]; dup {
+			return nil, ErrDuplicateChain
+		}
+		idx.byName[name], idx.byID[c.ID] = svc, svc
+	}
+	return idx, nil
+}
+
+// NewChainSet builds a ChainSet from services quoting on distinct chains. The
+// first service is used for requests that do not name a chain.
+func NewChainSet(services ...*EstimateService) (*ChainSet, error) {
+	idx, err := newChainIndex(services)
+	if err != nil {
+		return nil, err
+	}
+	s := &ChainSet{}
+	s.cur.Store(idx)
+	return s, nil
+}
+
+// Replace atomically swaps the services of s, with the same rules as
+// NewChainSet. Requests already holding a service keep using it. The returned
+// channel is closed once no request holds the replaced services any more. On
+// error s is left unchanged.
+func (s *ChainSet) Replace(services ...*EstimateService) (released <-chan struct{}, err error) {
+	idx, err := newChainIndex(services)
+	if err != nil {
+		return nil, err
+	}
+	old := s.cur.Swap(idx)
+	old.replaced.Store(true)
+	if old.refs.Load() == 0 {
+		old.idle.Do(func() { close(old.released) })
+	}
+	return old.released, nil
+}
+
+// hold returns the current generation of s, counted as held until release.
+func (s *ChainSet) hold() *chainIndex {
+	for {
+		idx := s.cur.Load()
+		idx.refs.Add(1)
+		// A Replace between the load and the count may already have found
+		// idx idle; only a generation that is still current is safe to use.
+		if s.cur.Load() == idx {
+			return idx
+		}
+		idx.release()
+	}
+}
+
+func (idx *chainIndex) release() {
+	if idx.refs.Add(-1) == 0 && idx.replaced.Load() {
+		idx.idle.Do(func() { close(idx.released) })
+	}
+}
+
+// Acquire resolves a service like Resolve and holds it until release is
+// called, even if s is replaced meanwhile. release must be called exactly
+// once unless err is set.
+func (s *ChainSet) Acquire(name string, id uint64) (svc *EstimateService, release func(), err error) {
+	idx := s.hold()
+	if svc, err = idx.resolve(name, id); err != nil {
+		idx.release()
+		return nil, nil, err
+	}
+	return svc, sync.OnceFunc(idx.release), nil
+}
+
+// AcquireAll returns every service in configuration order and holds them
+// until release is called.
+func (s *ChainSet) AcquireAll() (services []*EstimateService, release func()) {
+	idx := s.hold()
+	return idx.all, sync.OnceFunc(idx.release)
+}
+
+// Default returns the service used when no chain is named. Unlike Acquire it
+// does not hold the service.
+func (s *ChainSet) Default() *EstimateService {
+	return s.cur.Load().def
+}
+
+// Services returns every service in configuration order.
+func (s *ChainSet) Services() []*EstimateService {
+	return s.cur.Load().all
+}
+
+// Resolve returns the service for the chain with the given name (case
+// insensitive) or ID. Zero values mean "not given"; if neither is given the
+// default service is returned. It returns ErrUnknownChain for chains that are
+// not configured and ErrChainMismatch if name and id denote different chains.
+func (s *ChainSet) Resolve(name string, id uint64) (*EstimateService, error) {
+	return s.cur.Load().resolve(name, id)
+}
+
+func (idx *chainIndex) resolve(name string, id uint64) (*EstimateService, error) {
+	var byName, byID *EstimateService
+	if name != "" {
+		var ok bool
+		if byName, ok = idx.byName[strings.ToLower(name)]; !ok {
+			return nil, ErrUnknownChain
+		}
+	}
+	if id != 0 {
+		var ok bool
+		if byID, ok = idx.byID[id]; !ok {
+			return nil, ErrUnknownChain
+		}
+	}
+	switch {
+	case byName != nil && byID != nil && byName != byID:
+		return nil, ErrChainMismatch
+	case byName != nil:
+		return byName, nil
+	case byID != nil:
+		return byID, nil
+	default:
+		return idx.def, nil
+	}
+}
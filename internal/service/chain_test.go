@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// Uniswap V2 on Ethereum mainnet and its USDC/WETH pair.
+var (
+	uniswapFactory  = common.HexToAddress("0x5C69bEe701ef814a2B6a3EDD4B1652CB9cc5aA6f")
+	uniswapInitHash = common.HexToHash("0x96e8ac4277198ff8b6f785478aa9a39f403cb768dd02cbee326c3e7da348845f")
+	usdc            = common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	weth            = common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")
+	usdcWethPair    = common.HexToAddress("0xB4e16d0168e52d35CaCD2c6185b44281Ec28C9Dc")
+)
+
+func TestPairAddress(t *testing.T) {
+	if got := pairAddress(uniswapFactory, uniswapInitHash, usdc, weth); got != usdcWethPair {
+		t.Fatalf("unexpected pair address: got %s want %s", got.Hex(), usdcWethPair.Hex())
+	}
+}
+
+func TestEstimate_FactoryFeeAndVerification(t *testing.T) {
+	t.Parallel()
+
+	spoofed := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	other := common.HexToAddress("0x0000000000000000000000000000000000000def")
+	pairStorage := func(factory common.Address) map[common.Hash][]byte {
+		return map[common.Hash][]byte{
+			common.BigToHash(big.NewInt(5)): rightPadAddress(factory),
+			common.BigToHash(big.NewInt(6)): rightPadAddress(usdc),
+			common.BigToHash(big.NewInt(7)): rightPadAddress(weth),
+			common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+		}
+	}
+	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{
+		usdcWethPair: pairStorage(uniswapFactory),
+		spoofed:      pairStorage(uniswapFactory),
+		other:        pairStorage(common.HexToAddress("0x00000000000000000000000000000000000000ff")),
+	}}
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), eth.NewClientReader(newInprocEthClient(t, fe)), WithChain(Chain{
+		Name:          "test",
+		ID:            1337,
+		Factories:     []Factory{{Name: "uniswap", Address: uniswapFactory, InitCodeHash: uniswapInitHash, FeeBps: 25}},
+		DefaultFeeBps: 30,
+	}))
+
+	var dst, t1, t2 big.Int
+	amountIn := big.NewInt(10_000)
+	r0, r1 := big.NewInt(1_000_000), big.NewInt(2_000_000)
+
+	out, err := svc.Estimate(context.Background(), usdcWethPair, usdc, weth, amountIn)
+	if err != nil {
+		t.Fatalf("Estimate error: %v", err)
+	}
+	if want := uniswapv2.GetAmountOutFee(&dst, &t1, &t2, amountIn, r0, r1, uniswapv2.NewFee(25)); out.Cmp(want) != 0 {
+		t.Fatalf("factory fee not applied: got %s want %s", out, want)
+	}
+
+	// A pool of an unknown factory uses the default fee.
+	out, err = svc.Estimate(context.Background(), other, usdc, weth, amountIn)
+	if err != nil {
+		t.Fatalf("Estimate error: %v", err)
+	}
+	if want := uniswapv2.GetAmountOut(&dst, &t1, &t2, amountIn, r0, r1); out.Cmp(want) != 0 {
+		t.Fatalf("default fee not applied: got %s want %s", out, want)
+	}
+
+	// A contract claiming a known factory at the wrong address is rejected.
+	if _, err := svc.Estimate(context.Background(), spoofed, usdc, weth, amountIn); !errors.Is(err, ErrPoolNotFromFactory) {
+		t.Fatalf("expected ErrPoolNotFromFactory, got %v", err)
+	}
+}
+
+func TestChainSet_Resolve(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	eth1 := NewEstimateService(logger, nil, WithChain(Chain{Name: "ethereum", ID: 1}))
+	bsc := NewEstimateService(logger, nil, WithChain(Chain{Name: "bsc", ID: 56}))
+	set, err := NewChainSet(eth1, bsc)
+	if err != nil {
+		t.Fatalf("NewChainSet: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		id   uint64
+		want *EstimateService
+		err  error
+	}{
+		{want: eth1},
+		{name: "BSC", want: bsc},
+		{id: 56, want: bsc},
+		{name: "ethereum", id: 1, want: eth1},
+		{name: "ethereum", id: 56, err: ErrChainMismatch},
+		{name: "polygon", err: ErrUnknownChain},
+		{id: 137, err: ErrUnknownChain},
+	}
+	for _, tc := range tests {
+		got, err := set.Resolve(tc.name, tc.id)
+		if err != tc.err || got != tc.want {
+			t.Fatalf("Resolve(%q, %d) = %p, %v; want %p, %v", tc.name, tc.id, got, err, tc.want, tc.err)
+		}
+	}
+
+	if _, err := NewChainSet(eth1, NewEstimateService(logger, nil, WithChain(Chain{Name: "mainnet", ID: 1}))); err != ErrDuplicateChain {
+		t.Fatalf("expected ErrDuplicateChain, got %v", err)
+	}
+
+	// A rejected replacement leaves the set unchanged.
+	if _, err := set.Replace(bsc, bsc); err != ErrDuplicateChain {
+		t.Fatalf("expected ErrDuplicateChain, got %v", err)
+	}
+	if set.Default() != eth1 {
+		t.Fatalf("set changed by a failed Replace")
+	}
+	polygon := NewEstimateService(logger, nil, WithChain(Chain{Name: "polygon", ID: 137}))
+	if _, err := set.Replace(polygon, bsc); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if set.Default() != polygon || len(set.Services()) != 2 {
+		t.Fatalf("unexpected services after Replace")
+	}
+	if _, err := set.Resolve("ethereum", 0); err != ErrUnknownChain {
+		t.Fatalf("expected ErrUnknownChain for a removed chain, got %v", err)
+	}
+}
+
+func TestChainSet_Acquire(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	eth1 := NewEstimateService(logger, nil, WithChain(Chain{Name: "ethereum", ID: 1}))
+	bsc := NewEstimateService(logger, nil, WithChain(Chain{Name: "bsc", ID: 56}))
+	set, err := NewChainSet(eth1, bsc)
+	if err != nil {
+		t.Fatalf("NewChainSet: %v", err)
+	}
+
+	if _, _, err := set.Acquire("polygon", 0); err != ErrUnknownChain {
+		t.Fatalf("expected ErrUnknownChain, got %v", err)
+	}
+	svc, release, err := set.Acquire("bsc", 0)
+	if err != nil || svc != bsc {
+		t.Fatalf("Acquire(bsc) = %p, %v", svc, err)
+	}
+	all, releaseAll := set.AcquireAll()
+	if len(all) != 2 {
+		t.Fatalf("AcquireAll = %d services", len(all))
+	}
+
+	released, err := set.Replace(NewEstimateService(logger, nil, WithChain(Chain{Name: "polygon", ID: 137})))
+	if err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	isReleased := func() bool {
+		select {
+		case <-released:
+			return true
+		default:
+			return false
+		}
+	}
+	// The replaced services stay held until their last holder lets go;
+	// releasing twice does not count twice.
+	release()
+	release()
+	if isReleased() {
+		t.Fatal("replaced services released while still held")
+	}
+	releaseAll()
+	if !isReleased() {
+		t.Fatal("replaced services not released")
+	}
+
+	// Services nobody holds are released at once.
+	released, err = set.Replace(eth1)
+	if err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if !isReleased() {
+		t.Fatal("idle services not released")
+	}
+}
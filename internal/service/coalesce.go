@@ -0,0 +1,44 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/sync/singleflight"
+)
+
+// sharedReadTimeout bounds a coalesced read, which is detached from the
+// cancellation of the request that started it.
+const sharedReadTimeout = 15 * time.Second
+
+// coalesce runs fn once for all concurrent callers using the same key and
+// hands every caller the shared result, which must not be modified. The read
+// keeps running if the caller that started it goes away, so one canceled
+// request does not fail the others; each caller still stops waiting when its
+// own ctx is done.
+func coalesce[T any](ctx context.Context, g *singleflight.Group, key string, fn func(context.Context) (T, error)) (T, error) {
+	ch := g.DoChan(key, func() (any, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sharedReadTimeout)
+		defer cancel()
+		return fn(ctx)
+	})
+
+	var zero T
+	select {
+	case res := <-ch:
+		if res.Err != nil {
+			return zero, res.Err
+		}
+		return res.Val.(T), nil
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// slotsKey identifies a read of slots of pool at blockNum.
+func slotsKey(kind string, pool common.Address, blockNum *big.Int, slots []uint64) string {
+	return fmt.Sprintf("%s/%s/%v/%s", kind, pool.Hex(), slots, blockNum.String())
+}
@@ -1,13 +1,170 @@
 package service
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// Code is a stable, machine-readable identifier of an error reported to API
+// clients. Codes are part of the API and are never renamed.
+type Code string
+
+// Codes of the errors returned by the service.
+const (
+	CodeSameToken             Code = "SAME_TOKEN"
+	CodePoolNotFound          Code = "POOL_NOT_FOUND"
+	CodePairMismatch          Code = "PAIR_MISMATCH"
+	CodeInsufficientLiquidity Code = "INSUFFICIENT_LIQUIDITY"
+	CodeInsufficientInput     Code = "INSUFFICIENT_INPUT"
+	CodePoolNotFromFactory    Code = "POOL_NOT_FROM_FACTORY"
+	CodePendingUnavailable    Code = "PENDING_UNAVAILABLE"
+	CodeInvalidSimulation     Code = "INVALID_SIMULATION"
+	CodeInvalidStep           Code = "INVALID_STEP"
+	CodeInvalidBlockRange     Code = "INVALID_BLOCK_RANGE"
+	CodeUnknownChain          Code = "UNKNOWN_CHAIN"
+	CodeChainMismatch         Code = "CHAIN_MISMATCH"
+	CodeNotERC20              Code = "NOT_ERC20"
+	CodeUnknownToken          Code = "UNKNOWN_TOKEN"
+	CodeAmbiguousSymbol       Code = "AMBIGUOUS_SYMBOL"
+)
+
+// Codes of failures that do not come from the service's own checks, shared by
+// the HTTP and gRPC APIs.
+const (
+	CodeMissingParameter Code = "MISSING_PARAMETER"
+	CodeInvalidParameter Code = "INVALID_PARAMETER"
+	CodeRateLimited      Code = "RATE_LIMITED"
+	CodeQuorumNotReached Code = "QUORUM_NOT_REACHED"
+	CodeRPCUnavailable   Code = "RPC_UNAVAILABLE"
+	CodeDeadlineExceeded Code = "DEADLINE_EXCEEDED"
+	CodeRequestCanceled  Code = "REQUEST_CANCELED"
+	CodeUnauthorized     Code = "UNAUTHORIZED"
+	CodeQuotaExceeded    Code = "QUOTA_EXCEEDED"
+)
+
+// Error is a service error identified by a stable Code. The sentinel errors
+// of this package are *Error values: match them with errors.Is and read the
+// code of a wrapped one with errors.As or CodeOf.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// CodeOf returns the code of the first *Error in err's tree, or an empty Code
+// if there is none. The uniswapv2 math errors returned by simulation steps
+// are reported as CodeInsufficientLiquidity and CodeInsufficientInput.
+func CodeOf(err error) Code {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e.Code
+	case errors.Is(err, uniswapv2.ErrInsufficientLiquidity):
+		return CodeInsufficientLiquidity
+	case errors.Is(err, uniswapv2.ErrInsufficientInput):
+		return CodeInsufficientInput
+	default:
+		return ""
+	}
+}
+
+// ErrorCode returns the code of an error returned by the service. Errors
+// without a Code come from the RPC endpoints: context, rate limit and quorum
+// failures have their own codes and everything else is CodeRPCUnavailable.
+func ErrorCode(err error) Code {
+	if code := CodeOf(err); code != "" {
+		return code
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return CodeRequestCanceled
+	case errors.Is(err, eth.ErrRateLimited):
+		return CodeRateLimited
+	case errors.Is(err, eth.ErrQuorumNotReached):
+		return CodeQuorumNotReached
+	default:
+		return CodeRPCUnavailable
+	}
+}
 
 // ErrSameToken indicates src and dst token addresses are equal.
-var ErrSameToken = errors.New("src and dst are equal")
+var ErrSameToken = newError(CodeSameToken, "src and dst are equal")
+
+// ErrPoolNotFound indicates an address whose token0 and token1 slots are both
+// empty, so no pair is deployed there.
+var ErrPoolNotFound = newError(CodePoolNotFound, "pool not found")
 
 // ErrPairMismatch indicates the provided src/dst tokens do not match the
 // pool's token0/token1 pair.
-var ErrPairMismatch = errors.New("pair does not match src/dst")
+var ErrPairMismatch = newError(CodePairMismatch, "pair does not match src/dst")
 
 // ErrEmptyReserves indicates one or both reserves are zero for the pool.
-var ErrEmptyReserves = errors.New("empty reserves")
+var ErrEmptyReserves = newError(CodeInsufficientLiquidity, "empty reserves")
+
+// ErrPendingUnavailable indicates pending-block estimates were requested but
+// no mempool subscription is configured.
+var ErrPendingUnavailable = newError(CodePendingUnavailable, "pending estimates are not enabled")
+
+// ErrInvalidSimulation indicates a simulation request with no steps or more
+// than MaxSimulationSteps steps.
+var ErrInvalidSimulation = newError(CodeInvalidSimulation, "simulation must have between 1 and "+strconv.Itoa(MaxSimulationSteps)+" steps")
+
+// ErrInvalidStep indicates a simulation step with an unknown kind or missing
+// amounts.
+var ErrInvalidStep = newError(CodeInvalidStep, "invalid simulation step")
+
+// ErrInvalidHistoryRange indicates a history query with an empty or reversed
+// block range, a zero step, or more than MaxHistoryPoints points.
+var ErrInvalidHistoryRange = newError(CodeInvalidBlockRange, "invalid block range: require from <= to, step > 0 and at most "+strconv.Itoa(MaxHistoryPoints)+" points")
+
+// ErrPoolNotFromFactory indicates a pool whose factory slot names a known
+// factory that would not have deployed a pair at the pool's address.
+var ErrPoolNotFromFactory = newError(CodePoolNotFromFactory, "pool is not a pair of its factory")
+
+// ErrUnknownChain indicates a request for a chain that is not configured.
+var ErrUnknownChain = newError(CodeUnknownChain, "unknown chain")
+
+// ErrChainMismatch indicates a request naming a chain and a chain ID that
+// belong to different chains.
+var ErrChainMismatch = newError(CodeChainMismatch, "chain and chain_id do not match")
+
+// ErrNotERC20 indicates a token address without an ERC-20 decimals()
+// function, such as an account without code.
+var ErrNotERC20 = newError(CodeNotERC20, "token is not an ERC-20")
+
+// ErrUnknownToken indicates a token symbol that is not in the chain's token
+// list.
+var ErrUnknownToken = newError(CodeUnknownToken, "unknown token symbol")
+
+// ErrUnlistedToken indicates a token address missing from the chain's token
+// list. It shares the code of ErrUnknownToken.
+var ErrUnlistedToken = newError(CodeUnknownToken, "unlisted token")
+
+// ErrAmbiguousSymbol indicates a token symbol shared by several tokens of the
+// chain's token list, which must be told apart by address.
+var ErrAmbiguousSymbol = newError(CodeAmbiguousSymbol, "ambiguous token symbol")
+
+// ErrDuplicateChain indicates two services configured with the same chain
+// name or ID.
+var ErrDuplicateChain = errors.New("duplicate chain")
+
+// ErrNodeSyncing indicates a node that reports it is still syncing, so its
+// state is not current.
+var ErrNodeSyncing = errors.New("node is syncing")
+
+// ErrStaleHead indicates a node whose latest block is older than allowed,
+// e.g. because it stopped importing blocks.
+var ErrStaleHead = errors.New("latest block is too old")
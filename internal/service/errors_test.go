@@ -0,0 +1,38 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+func TestCodeOf(t *testing.T) {
+	wrapped := fmt.Errorf("read pool: %w", ErrPairMismatch)
+	if !errors.Is(wrapped, ErrPairMismatch) {
+		t.Fatalf("errors.Is does not match a wrapped sentinel")
+	}
+	var e *Error
+	if !errors.As(wrapped, &e) || e != ErrPairMismatch {
+		t.Fatalf("errors.As does not find the sentinel: %v", e)
+	}
+
+	cases := []struct {
+		err  error
+		want Code
+	}{
+		{wrapped, CodePairMismatch},
+		{ErrEmptyReserves, CodeInsufficientLiquidity},
+		{&StepError{Index: 2, Err: uniswapv2.ErrInsufficientLiquidity}, CodeInsufficientLiquidity},
+		{&StepError{Index: 0, Err: uniswapv2.ErrInsufficientInput}, CodeInsufficientInput},
+		{&StepError{Index: 1, Err: ErrInvalidStep}, CodeInvalidStep},
+		{errors.New("connection refused"), ""},
+		{nil, ""},
+	}
+	for _, tc := range cases {
+		if got := CodeOf(tc.err); got != tc.want {
+			t.Errorf("CodeOf(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
@@ -2,30 +2,89 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 
 	"log/slog"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+	"github.com/nulln0ne/uniswap-estimator/internal/tokenlist"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
 	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 )
 
 // EstimateService provides Uniswap V2 output amount estimations by reading
 // on-chain pair storage directly.
 type EstimateService struct {
 	BaseService
-	ethereumClient *ethclient.Client
+	reader   eth.StateReader
+	mempool  *Mempool
+	history  historyLimits
+	reserves ReserveSource
+	quorum   *eth.Quorum
+	stale    *staleCache
+	chain    chainParams
+	tokens   tokenCache
+	listed   *tokenlist.List
+
+	// reads coalesces identical concurrent RPC reads.
+	reads singleflight.Group
+}
+
+// Option configures optional EstimateService behavior.
+type Option func(*EstimateService)
+
+// WithMempool enables pending-block estimates backed by the given mempool.
+func WithMempool(m *Mempool) Option {
+	return func(e *EstimateService) {
+		e.mempool = m
+	}
+}
+
+// ReserveSource serves pool reserves from a local index, such as the Sync
+// event store maintained by the indexer package. ok is false when the block is
+// not covered by the index.
+type ReserveSource interface {
+	ReservesAt(pool common.Address, block uint64) (reserve0, reserve1 *big.Int, ok bool, err error)
+}
+
+// WithReserveSource makes reserve reads consult src before falling back to
+// storage reads over RPC.
+func WithReserveSource(src ReserveSource) Option {
+	return func(e *EstimateService) {
+		e.reserves = src
+	}
+}
+
+// WithQuorum makes single-block pool reads (estimates, pending estimates and
+// simulations) require agreement between several RPC endpoints at the same
+// block hash. Reserves are then always read over RPC, bypassing any
+// ReserveSource.
+func WithQuorum(q *eth.Quorum) Option {
+	return func(e *EstimateService) {
+		e.quorum = q
+	}
 }
 
 // NewEstimateService constructs an EstimateService using the provided logger
-// and Ethereum client.
-func NewEstimateService(logger *slog.Logger, ec ethclient.Client) *EstimateService {
-	return &EstimateService{
-		BaseService:    BaseService{logger: logger},
-		ethereumClient: &ec,
+// and chain state reader.
+func NewEstimateService(logger *slog.Logger, reader eth.StateReader, opts ...Option) *EstimateService {
+	e := &EstimateService{
+		BaseService: BaseService{logger: logger},
+		reader:      reader,
+		history:     defaultHistoryLimits(),
+		chain:       newChainParams(defaultChain),
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	return e
 }
 
 // contract UniswapV2Pair is IUniswapV2Pair, UniswapV2ERC20 {
@@ -43,57 +102,209 @@ func NewEstimateService(logger *slog.Logger, ec ethclient.Client) *EstimateServi
 //     uint112 private reserve1;           // uses single storage slot, accessible via getReserves
 //     uint32  private blockTimestampLast; // uses single storage slot, accessible via getReserves
 
+// factorySlot is the storage slot of the pair's factory address.
+const factorySlot = 5
+
+// poolState is a snapshot of the pair storage relevant to swap estimation.
+type poolState struct {
+	token0, token1     common.Address
+	reserve0, reserve1 *big.Int
+	fee                uniswapv2.Fee
+}
+
+// orient returns the reserves of the pool in swap direction src -> dst.
+func (p *poolState) orient(src, dst common.Address) (reserveIn, reserveOut *big.Int, err error) {
+	switch {
+	case src == p.token0 && dst == p.token1:
+		reserveIn, reserveOut = p.reserve0, p.reserve1
+	case src == p.token1 && dst == p.token0:
+		reserveIn, reserveOut = p.reserve1, p.reserve0
+	default:
+		return nil, nil, ErrPairMismatch
+	}
+
+	if reserveIn.Sign() == 0 || reserveOut.Sign() == 0 {
+		return nil, nil, ErrEmptyReserves
+	}
+	return reserveIn, reserveOut, nil
+}
+
 // Estimate computes the expected output amount for swapping amountIn of src to
 // dst in the provided pool at the latest block. It validates the token pair,
 // reads reserves from storage and applies the Uniswap V2 formula.
-func (e *EstimateService) Estimate(ctx context.Context, pool, src, dst common.Address, amountIn *big.Int) (*big.Int, error) {
+func (e *EstimateService) Estimate(ctx context.Context, pool, src, dst common.Address, amountIn *big.Int) (_ *big.Int, err error) {
+	ctx, span := e.startEstimateSpan(ctx, "EstimateService.Estimate", pool, src, dst, amountIn)
+	defer func() {
+		e.observeEstimate("latest", err)
+		tracing.End(span, err)
+	}()
 	e.logger.Debug("estimating swap", "pool", pool.Hex(), "src", src.Hex(), "dst", dst.Hex(), "in", amountIn.String())
 
-	if src == dst {
-		return nil, ErrSameToken
+	q, err := e.quote(ctx, pool, src, dst, amountIn)
+	if err != nil {
+		return nil, err
+	}
+	e.logger.Debug("amount out computed", "out", q.AmountOut.String())
+	return q.AmountOut, nil
+}
+
+// startEstimateSpan starts the span of an estimate of amountIn from src to dst
+// in pool.
+func (e *EstimateService) startEstimateSpan(ctx context.Context, name string, pool, src, dst common.Address, amountIn *big.Int) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, name, trace.WithAttributes(
+		attribute.String("chain", e.chain.Name),
+		attribute.String("pool", pool.Hex()),
+		attribute.String("src", src.Hex()),
+		attribute.String("dst", dst.Hex()),
+		attribute.String("amount_in", amountIn.String()),
+	))
+}
+
+// observeEstimate records the outcome of an estimate in mode.
+func (e *EstimateService) observeEstimate(mode string, err error) {
+	metrics.ObserveEstimate(e.chain.Name, mode, estimateOutcome(err))
+}
+
+// estimateOutcome names the outcome of an estimate for metrics.
+func estimateOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, ErrSameToken):
+		return "same_token"
+	case errors.Is(err, ErrPoolNotFound):
+		return "pool_not_found"
+	case errors.Is(err, ErrPairMismatch):
+		return "pair_mismatch"
+	case errors.Is(err, ErrEmptyReserves):
+		return "empty_reserves"
+	case errors.Is(err, ErrPoolNotFromFactory):
+		return "pool_not_from_factory"
+	case errors.Is(err, ErrPendingUnavailable):
+		return "pending_unavailable"
+	case errors.Is(err, eth.ErrRateLimited):
+		return "rate_limited"
+	case errors.Is(err, eth.ErrQuorumNotReached):
+		return "quorum_not_reached"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "rpc_error"
 	}
+}
 
-	bn, err := e.ethereumClient.BlockNumber(ctx)
+func (e *EstimateService) latestBlock(ctx context.Context) (*big.Int, error) {
+	bn, err := coalesce(ctx, &e.reads, "blockNumber", e.reader.BlockNumber)
 	if err != nil {
 		return nil, fmt.Errorf("block number: %w", err)
 	}
-	blockNum := new(big.Int).SetUint64(bn)
+	return new(big.Int).SetUint64(bn), nil
+}
 
-	token0, token1, err := e.loadTokens(ctx, pool, blockNum)
-	if err != nil {
-		return nil, err
+// loadPool reads token addresses and reserves of the pair at blockNum. Slots
+// that must come from RPC are fetched in a single batch, verified by the
+// quorum when one is configured.
+func (e *EstimateService) loadPool(ctx context.Context, pool common.Address, blockNum *big.Int) (*poolState, error) {
+	return e.readPool(ctx, pool, blockNum, true)
+}
+
+// readPool reads the pair tokens and, if the chain has known factories, the
+// pool factory to select the fee. With withReserves it also loads the
+// reserves, from the ReserveSource when it covers blockNum. It returns
+// ErrPoolNotFound if both token slots are empty.
+func (e *EstimateService) readPool(ctx context.Context, pool common.Address, blockNum *big.Int, withReserves bool) (*poolState, error) {
+	state := &poolState{fee: e.chain.defaultFee}
+
+	stored := false
+	if withReserves && e.quorum == nil {
+		state.reserve0, state.reserve1, stored = e.storedReserves(pool, blockNum)
 	}
 
-	// reserves (uint112 | uint112 | uint32) are packed into a single 32‑byte slot (slot 8)
-	br, err := e.readSlot(ctx, pool, blockNum, 8)
+	slots := []uint64{6, 7}
+	factoryIdx, reservesIdx := -1, -1
+	if len(e.chain.factories) > 0 {
+		factoryIdx = len(slots)
+		slots = append(slots, factorySlot)
+	}
+	if withReserves && !stored {
+		reservesIdx = len(slots)
+		slots = append(slots, 8)
+	}
+
+	var values [][]byte
+	var err error
+	if e.quorum != nil {
+		values, err = coalesce(ctx, &e.reads, slotsKey("quorum", pool, blockNum, slots), func(ctx context.Context) ([][]byte, error) {
+			return e.quorum.BatchStorageAt(ctx, slotRequests(pool, slots...), blockNum)
+		})
+		if err != nil {
+			err = fmt.Errorf("quorum read (pool %s, block %s): %w", pool.Hex(), blockNum.String(), err)
+		}
+	} else {
+		values, err = e.readSlots(ctx, pool, blockNum, slots...)
+	}
 	if err != nil {
 		return nil, err
 	}
-	reserve0, reserve1 := parseReserves(br)
 
-	var reserveIn, reserveOut *big.Int
-	switch {
-	case src == token0 && dst == token1:
-		reserveIn, reserveOut = reserve0, reserve1
-	case src == token1 && dst == token0:
-		reserveIn, reserveOut = reserve1, reserve0
-	default:
-		return nil, ErrPairMismatch
+	state.token0 = common.BytesToAddress(values[0])
+	state.token1 = common.BytesToAddress(values[1])
+	if state.token0 == (common.Address{}) && state.token1 == (common.Address{}) {
+		return nil, ErrPoolNotFound
+	}
+	if reservesIdx >= 0 {
+		state.reserve0, state.reserve1 = parseReserves(values[reservesIdx])
 	}
+	if factoryIdx >= 0 {
+		if err := e.chain.applyFactory(state, pool, common.BytesToAddress(values[factoryIdx])); err != nil {
+			return nil, err
+		}
+	}
+	return state, nil
+}
 
-	if reserveIn.Sign() == 0 || reserveOut.Sign() == 0 {
-		return nil, ErrEmptyReserves
+// loadReserves reads reserve0 and reserve1 of the pair at blockNum, preferring
+// the configured ReserveSource.
+func (e *EstimateService) loadReserves(ctx context.Context, pool common.Address, blockNum *big.Int) (*big.Int, *big.Int, error) {
+	if r0, r1, ok := e.storedReserves(pool, blockNum); ok {
+		return r0, r1, nil
 	}
+	return e.readReserves(ctx, pool, blockNum)
+}
 
-	var outAmt, tmp1, tmp2 big.Int
-	out := uniswapv2.GetAmountOut(&outAmt, &tmp1, &tmp2, amountIn, reserveIn, reserveOut)
-	e.logger.Debug("amount out computed", "out", out.String())
-	return out, nil
+// storedReserves looks reserves up in the ReserveSource. Lookup failures are
+// logged and treated as a miss so estimates fall back to RPC.
+func (e *EstimateService) storedReserves(pool common.Address, blockNum *big.Int) (*big.Int, *big.Int, bool) {
+	if e.reserves == nil || !blockNum.IsUint64() {
+		return nil, nil, false
+	}
+	r0, r1, ok, err := e.reserves.ReservesAt(pool, blockNum.Uint64())
+	if err != nil {
+		e.logger.Warn("reserve source lookup failed", "pool", pool.Hex(), "block", blockNum.String(), "err", err)
+		ok = false
+	}
+	metrics.CacheLookup(metrics.CacheReserveStore, ok)
+	return r0, r1, ok
+}
+
+// readReserves reads reserve0 and reserve1 of the pair at blockNum over RPC.
+func (e *EstimateService) readReserves(ctx context.Context, pool common.Address, blockNum *big.Int) (*big.Int, *big.Int, error) {
+	// reserves (uint112 | uint112 | uint32) are packed into a single 32‑byte slot (slot 8)
+	br, err := e.readSlot(ctx, pool, blockNum, 8)
+	if err != nil {
+		return nil, nil, err
+	}
+	reserve0, reserve1 := parseReserves(br)
+	return reserve0, reserve1, nil
 }
 
 func (e *EstimateService) readSlot(ctx context.Context, pool common.Address, blockNum *big.Int, slot uint64) ([]byte, error) {
 	key := common.BigToHash(new(big.Int).SetUint64(slot))
-	b, err := e.ethereumClient.StorageAt(ctx, pool, key, blockNum)
+	b, err := coalesce(ctx, &e.reads, slotsKey("slot", pool, blockNum, []uint64{slot}), func(ctx context.Context) ([]byte, error) {
+		return e.reader.StorageAt(ctx, pool, key, blockNum)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("storageAt slot %d (pool %s, block %s): %w",
 			slot, pool.Hex(), blockNum.String(), err)
@@ -101,21 +312,25 @@ func (e *EstimateService) readSlot(ctx context.Context, pool common.Address, blo
 	return b, nil
 }
 
-// loadTokens reads token0 and token1 from Uniswap V2 pair storage (slots 6 and 7).
-func (e *EstimateService) loadTokens(ctx context.Context, pool common.Address, blockNum *big.Int) (common.Address, common.Address, error) {
-	b0, err := e.readSlot(ctx, pool, blockNum, 6)
+// readSlots reads several storage slots of pool at blockNum in one batch.
+// Concurrent identical reads share a single RPC request.
+func (e *EstimateService) readSlots(ctx context.Context, pool common.Address, blockNum *big.Int, slots ...uint64) ([][]byte, error) {
+	values, err := coalesce(ctx, &e.reads, slotsKey("slots", pool, blockNum, slots), func(ctx context.Context) ([][]byte, error) {
+		return e.reader.BatchStorageAt(ctx, slotRequests(pool, slots...), blockNum)
+	})
 	if err != nil {
-		return common.Address{}, common.Address{}, err
+		return nil, fmt.Errorf("storageAt slots %v (pool %s, block %s): %w",
+			slots, pool.Hex(), blockNum.String(), err)
 	}
-	token0 := common.BytesToAddress(b0)
+	return values, nil
+}
 
-	b1, err := e.readSlot(ctx, pool, blockNum, 7)
-	if err != nil {
-		return common.Address{}, common.Address{}, err
+func slotRequests(pool common.Address, slots ...uint64) []eth.StorageRequest {
+	reqs := make([]eth.StorageRequest, len(slots))
+	for i, slot := range slots {
+		reqs[i] = eth.StorageRequest{Account: pool, Key: common.BigToHash(new(big.Int).SetUint64(slot))}
 	}
-	token1 := common.BytesToAddress(b1)
-
-	return token0, token1, nil
+	return reqs
 }
 
 // parseReserves unpacks two uint112 reserves from the 32‑byte storage word
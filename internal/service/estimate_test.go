@@ -2,21 +2,33 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"math/big"
 	"net/http/httptest"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/ethclient"
 	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"golang.org/x/sync/singleflight"
 )
 
 type fakeEth struct {
 	blockNumber uint64
 	// storage[address][positionHash] = 32-byte value
 	storage map[common.Address]map[common.Hash][]byte
+	// delay is applied to every storage read, which is counted in
+	// storageReads.
+	delay        time.Duration
+	storageReads atomic.Int64
 }
 
 func (f *fakeEth) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
@@ -24,6 +36,10 @@ func (f *fakeEth) BlockNumber(ctx context.Context) (hexutil.Uint64, error) {
 }
 
 func (f *fakeEth) GetStorageAt(ctx context.Context, addr common.Address, position common.Hash, _ gethrpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	f.storageReads.Add(1)
+	if f.delay > 0 {
+		time.Sleep(f.delay)
+	}
 	if m, ok := f.storage[addr]; ok {
 		if v, ok2 := m[position]; ok2 {
 			return hexutil.Bytes(v), nil
@@ -33,6 +49,14 @@ func (f *fakeEth) GetStorageAt(ctx context.Context, addr common.Address, positio
 	return hexutil.Bytes(make([]byte, 32)), nil
 }
 
+func (f *fakeEth) GetBlockByNumber(ctx context.Context, number gethrpc.BlockNumber, full bool) (*types.Header, error) {
+	n := f.blockNumber
+	if number >= 0 {
+		n = uint64(number)
+	}
+	return &types.Header{Number: new(big.Int).SetUint64(n), Difficulty: big.NewInt(0)}, nil
+}
+
 func newInprocEthClient(t *testing.T, fe *fakeEth) *ethclient.Client {
 	t.Helper()
 	srv := gethrpc.NewServer()
@@ -40,7 +64,13 @@ func newInprocEthClient(t *testing.T, fe *fakeEth) *ethclient.Client {
 	if err := srv.RegisterName("eth", fe); err != nil {
 		t.Fatalf("register rpc service: %v", err)
 	}
+	return newInprocClient(t, srv)
+}
+
+func newInprocClient(t *testing.T, srv *gethrpc.Server) *ethclient.Client {
+	t.Helper()
 	c := gethrpc.DialInProc(srv)
+	t.Cleanup(c.Close)
 	return ethclient.NewClient(c)
 }
 
@@ -94,7 +124,7 @@ func TestEstimate_Success(t *testing.T) {
 	ec := newInprocEthClient(t, fe)
 
 	logger := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
-	svc := NewEstimateService(logger, *ec)
+	svc := NewEstimateService(logger, eth.NewClientReader(ec))
 
 	out, err := svc.Estimate(context.Background(), pool, token0, token1, amountIn)
 	if err != nil {
@@ -132,7 +162,7 @@ func TestEstimate_PairMismatch(t *testing.T) {
 	}
 	ec := newInprocEthClient(t, fe)
 	logger := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
-	svc := NewEstimateService(logger, *ec)
+	svc := NewEstimateService(logger, eth.NewClientReader(ec))
 
 	_, err := svc.Estimate(context.Background(), pool, token0, wrong, big.NewInt(1))
 	if err == nil || err != ErrPairMismatch {
@@ -149,7 +179,7 @@ func TestEstimate_SameToken(t *testing.T) {
 	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1, 1, 0)}}}
 	ec := newInprocEthClient(t, fe)
 	logger := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
-	svc := NewEstimateService(logger, *ec)
+	svc := NewEstimateService(logger, eth.NewClientReader(ec))
 
 	_, err := svc.Estimate(context.Background(), pool, token, token, big.NewInt(1))
 	if err == nil || err != ErrSameToken {
@@ -167,10 +197,273 @@ func TestEstimate_EmptyReserves(t *testing.T) {
 	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(0, 0, 0)}}}
 	ec := newInprocEthClient(t, fe)
 	logger := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
-	svc := NewEstimateService(logger, *ec)
+	svc := NewEstimateService(logger, eth.NewClientReader(ec))
 
 	_, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1))
 	if err == nil || err != ErrEmptyReserves {
 		t.Fatalf("expected ErrEmptyReserves, got %v", err)
 	}
 }
+
+// snapshotReader is an offline StateReader serving a fixed storage snapshot.
+type snapshotReader struct {
+	block   uint64
+	storage map[common.Hash][]byte
+}
+
+func (s *snapshotReader) BlockNumber(context.Context) (uint64, error) { return s.block, nil }
+
+func (s *snapshotReader) StorageAt(_ context.Context, _ common.Address, key common.Hash, _ *big.Int) ([]byte, error) {
+	return s.storage[key], nil
+}
+
+func (s *snapshotReader) BatchStorageAt(ctx context.Context, reqs []eth.StorageRequest, bn *big.Int) ([][]byte, error) {
+	out := make([][]byte, len(reqs))
+	for i, r := range reqs {
+		out[i], _ = s.StorageAt(ctx, r.Account, r.Key, bn)
+	}
+	return out, nil
+}
+
+func (s *snapshotReader) HeaderByNumber(context.Context, *big.Int) (*types.Header, error) {
+	return &types.Header{Number: new(big.Int).SetUint64(s.block)}, nil
+}
+
+func TestEstimate_CustomStateReader(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	reader := &snapshotReader{block: 5, storage: map[common.Hash][]byte{
+		common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0),
+		common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1),
+		common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil)), reader)
+
+	out, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1_000))
+	if err != nil {
+		t.Fatalf("Estimate error: %v", err)
+	}
+	if out.Int64() != 1992 {
+		t.Fatalf("unexpected amountOut: got %s want 1992", out)
+	}
+}
+
+func TestEstimate_Quorum(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	node := func(r0, r1 uint64) *fakeEth {
+		return &fakeEth{blockNumber: 100, storage: map[common.Address]map[common.Hash][]byte{
+			pool: {
+				common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0),
+				common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1),
+				common.BigToHash(new(big.Int).SetUint64(8)): packReserves(r0, r1, 0),
+			},
+		}}
+	}
+	logger := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	newService := func(threshold int, nodes ...*fakeEth) *EstimateService {
+		endpoints := make([]eth.Endpoint, len(nodes))
+		for i, fe := range nodes {
+			endpoints[i] = eth.Endpoint{Name: fmt.Sprintf("node%d", i), Client: newInprocEthClient(t, fe)}
+		}
+		p, err := eth.NewPool(logger, endpoints, eth.PoolConfig{})
+		if err != nil {
+			t.Fatalf("NewPool: %v", err)
+		}
+		q, err := eth.NewQuorum(logger, p, len(nodes), threshold)
+		if err != nil {
+			t.Fatalf("NewQuorum: %v", err)
+		}
+		return NewEstimateService(logger, p, WithQuorum(q))
+	}
+
+	// A stale node is outvoted.
+	svc := newService(2, node(1_000_000, 2_000_000), node(900_000, 2_100_000), node(1_000_000, 2_000_000))
+	out, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1_000))
+	if err != nil {
+		t.Fatalf("Estimate error: %v", err)
+	}
+	if out.Int64() != 1992 {
+		t.Fatalf("unexpected amountOut: got %s want 1992", out)
+	}
+
+	// Without a majority no quote is returned.
+	svc = newService(3, node(1_000_000, 2_000_000), node(900_000, 2_100_000), node(1_000_000, 2_000_000))
+	if _, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1_000)); !errors.Is(err, eth.ErrQuorumNotReached) {
+		t.Fatalf("expected ErrQuorumNotReached, got %v", err)
+	}
+}
+
+func TestEstimate_StaleFallbackWhenRateLimited(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	fe := &fakeEth{blockNumber: 100, storage: map[common.Address]map[common.Hash][]byte{
+		pool: {
+			common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0),
+			common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1),
+			common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0),
+		},
+	}}
+	logger := slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil))
+	newService := func(opts ...Option) *EstimateService {
+		// Enough budget for exactly one estimate: a block number and three slots.
+		limiter := eth.NewLimiter(eth.LimiterConfig{DailyBudget: 10 + 3*17})
+		p, err := eth.NewPool(logger, []eth.Endpoint{{Name: "node", Client: newInprocEthClient(t, fe)}}, eth.PoolConfig{Limiter: limiter})
+		if err != nil {
+			t.Fatalf("NewPool: %v", err)
+		}
+		return NewEstimateService(logger, p, opts...)
+	}
+
+	svc := newService(WithStaleFallback(time.Minute))
+	for i := range 2 {
+		out, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1_000))
+		if err != nil {
+			t.Fatalf("Estimate %d error: %v", i, err)
+		}
+		if out.Int64() != 1992 {
+			t.Fatalf("Estimate %d: got %s want 1992", i, out)
+		}
+	}
+
+	svc = newService()
+	if _, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1_000)); err != nil {
+		t.Fatalf("first Estimate error: %v", err)
+	}
+	if _, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1_000)); !errors.Is(err, eth.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited without fallback, got %v", err)
+	}
+}
+
+func newPoolNode(pool, token0, token1 common.Address, delay time.Duration) *fakeEth {
+	return &fakeEth{blockNumber: 100, delay: delay, storage: map[common.Address]map[common.Hash][]byte{
+		pool: {
+			common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0),
+			common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1),
+			common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 2_000_000, 0),
+		},
+	}}
+}
+
+func TestEstimate_CoalescesConcurrentReads(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	fe := newPoolNode(pool, token0, token1, 100*time.Millisecond)
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(httptest.NewRecorder(), nil)), eth.NewClientReader(newInprocEthClient(t, fe)))
+
+	const n = 32
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out, err := svc.Estimate(context.Background(), pool, token0, token1, big.NewInt(1_000))
+			if err == nil && out.Int64() != 1992 {
+				err = fmt.Errorf("unexpected amountOut %s", out)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Estimate error: %v", err)
+		}
+	}
+
+	// One batch of three slots serves every estimate.
+	if got := fe.storageReads.Load(); got != 3 {
+		t.Fatalf("expected a single batched read of 3 slots, got %d storage reads", got)
+	}
+}
+
+func TestCoalesce_CallerCancellation(t *testing.T) {
+	t.Parallel()
+
+	var group singleflight.Group
+	var calls atomic.Int64
+	started, release := make(chan struct{}), make(chan struct{})
+	read := func(ctx context.Context) (int, error) {
+		calls.Add(1)
+		close(started)
+		<-release
+		return 42, ctx.Err()
+	}
+
+	// The caller that started the read gives up; the read itself keeps going.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := coalesce(ctx, &group, "k", read)
+		first <- err
+	}()
+	<-started
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled for the canceled caller, got %v", err)
+	}
+
+	// A later caller joins the in-flight read and gets its result.
+	second := make(chan error, 1)
+	go func() {
+		v, err := coalesce(context.Background(), &group, "k", read)
+		if err == nil && v != 42 {
+			err = fmt.Errorf("unexpected shared result %d", v)
+		}
+		second <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := <-second; err != nil {
+		t.Fatalf("shared read failed: %v", err)
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one read, got %d", got)
+	}
+}
+
+// BenchmarkEstimate_Concurrent issues parallel estimates for one pool against
+// a node with 1ms storage latency and reports the storage reads per estimate.
+func BenchmarkEstimate_Concurrent(b *testing.B) {
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	fe := newPoolNode(pool, token0, token1, time.Millisecond)
+
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		b.Fatalf("register rpc service: %v", err)
+	}
+	c := gethrpc.DialInProc(srv)
+	defer c.Close()
+	svc := NewEstimateService(slog.New(slog.DiscardHandler), eth.NewClientReader(ethclient.NewClient(c)))
+	amountIn := big.NewInt(1_000)
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := svc.Estimate(context.Background(), pool, token0, token1, amountIn); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+	b.ReportMetric(float64(fe.storageReads.Load())/float64(b.N), "reads/op")
+}
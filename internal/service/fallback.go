@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+)
+
+// maxStaleEntries bounds the number of pools remembered for stale fallbacks.
+const maxStaleEntries = 10_000
+
+// staleEntry is the last pool state read at the latest block.
+type staleEntry struct {
+	block *big.Int
+	state *poolState
+	at    time.Time
+}
+
+// staleCache remembers the latest state of recently quoted pools so quotes
+// can still be served, for at most maxAge, while RPC reads are rate limited.
+// A nil *staleCache never serves anything.
+type staleCache struct {
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	entries map[common.Address]staleEntry
+}
+
+// WithStaleFallback serves quotes from pool state read within maxAge when
+// fresh reads are refused by the RPC rate limiter.
+func WithStaleFallback(maxAge time.Duration) Option {
+	return func(e *EstimateService) {
+		if maxAge <= 0 {
+			e.stale = nil
+			return
+		}
+		e.stale = &staleCache{maxAge: maxAge, entries: make(map[common.Address]staleEntry)}
+	}
+}
+
+func (c *staleCache) put(pool common.Address, block *big.Int, state *poolState) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[pool]; !ok && len(c.entries) >= maxStaleEntries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[pool] = staleEntry{block: block, state: state, at: time.Now()}
+}
+
+func (c *staleCache) get(pool common.Address) (staleEntry, bool) {
+	if c == nil {
+		return staleEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[pool]
+	if !ok || time.Since(entry.at) > c.maxAge {
+		return staleEntry{}, false
+	}
+	return entry, true
+}
+
+// latestPool loads pool at the latest block. If the reads are rate limited it
+// falls back to the last state remembered by the stale cache.
+func (e *EstimateService) latestPool(ctx context.Context, pool common.Address) (*big.Int, *poolState, error) {
+	blockNum, err := e.latestBlock(ctx)
+	var state *poolState
+	if err == nil {
+		state, err = e.loadPool(ctx, pool, blockNum)
+	}
+	if err != nil {
+		if errors.Is(err, eth.ErrRateLimited) && e.stale != nil {
+			entry, ok := e.stale.get(pool)
+			metrics.CacheLookup(metrics.CacheStaleQuote, ok)
+			if ok {
+				e.logger.Info("rpc rate limited, serving stale pool state",
+					"pool", pool.Hex(), "block", entry.block.String(), "age", time.Since(entry.at).Round(time.Millisecond))
+				return entry.block, entry.state, nil
+			}
+		}
+		return nil, nil, err
+	}
+	e.stale.put(pool, blockNum, state)
+	return blockNum, state, nil
+}
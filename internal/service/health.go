@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+)
+
+// ChainStatus is a readiness snapshot of the node serving a chain.
+type ChainStatus struct {
+	Chain   string
+	ChainID uint64
+	// Block and BlockTime describe the latest block the node returned.
+	Block     uint64
+	BlockTime time.Time
+	// HeadLag is how far BlockTime is behind the wall clock.
+	HeadLag time.Duration
+	// Syncing is set when the node reports that it is catching up.
+	Syncing bool
+}
+
+// Status checks that the chain's node answers and follows the chain. It
+// returns ErrNodeSyncing when the node reports it is syncing and ErrStaleHead
+// when its latest block is more than maxHeadLag old; a zero maxHeadLag skips
+// the age check. The status is filled as far as it could be read. Its reads
+// are not charged on the rate limiter of a MeteredReader.
+func (e *EstimateService) Status(ctx context.Context, maxHeadLag time.Duration) (ChainStatus, error) {
+	st := ChainStatus{Chain: e.chain.Name, ChainID: e.chain.ID}
+
+	reader := e.reader
+	if m, ok := reader.(eth.MeteredReader); ok {
+		reader = m.Unmetered()
+	}
+	head, err := reader.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return st, err
+	}
+	st.Block = head.Number.Uint64()
+	st.BlockTime = time.Unix(int64(head.Time), 0).UTC()
+	st.HeadLag = max(time.Since(st.BlockTime), 0)
+
+	if sr, ok := reader.(eth.SyncReader); ok {
+		progress, err := sr.SyncProgress(ctx)
+		if err != nil {
+			return st, err
+		}
+		if progress != nil && !progress.Done() {
+			st.Syncing = true
+			return st, ErrNodeSyncing
+		}
+	}
+
+	if maxHeadLag > 0 && st.HeadLag > maxHeadLag {
+		return st, ErrStaleHead
+	}
+	return st, nil
+}
+
+// Head identifies the latest block of a chain.
+type Head struct {
+	Number *big.Int
+	Hash   common.Hash
+	Time   time.Time
+}
+
+// Head returns the latest block the chain's node reports. Concurrent calls
+// share one read.
+func (e *EstimateService) Head(ctx context.Context) (*Head, error) {
+	header, err := coalesce(ctx, &e.reads, "head", func(ctx context.Context) (*types.Header, error) {
+		return e.reader.HeaderByNumber(ctx, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("latest header: %w", err)
+	}
+	return &Head{
+		Number: header.Number,
+		Hash:   header.Hash(),
+		Time:   time.Unix(int64(header.Time), 0).UTC(),
+	}, nil
+}
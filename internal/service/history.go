@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+	"golang.org/x/time/rate"
+)
+
+// MaxHistoryPoints bounds the number of blocks a single history query may
+// cover.
+const MaxHistoryPoints = 10_000
+
+// Default history read limits used when WithHistoryLimits is not given.
+const (
+	defaultHistoryConcurrency = 8
+	defaultHistoryReadsPerSec = 25
+)
+
+// historyLimits bounds the storage reads issued by history queries. The rate
+// limiter is shared by all queries of a service.
+type historyLimits struct {
+	concurrency int
+	limiter     *rate.Limiter
+}
+
+func defaultHistoryLimits() historyLimits {
+	return newHistoryLimits(defaultHistoryConcurrency, defaultHistoryReadsPerSec)
+}
+
+func newHistoryLimits(concurrency int, readsPerSec float64) historyLimits {
+	if concurrency <= 0 {
+		concurrency = defaultHistoryConcurrency
+	}
+	limit := rate.Limit(readsPerSec)
+	if readsPerSec <= 0 {
+		limit = rate.Inf
+	}
+	return historyLimits{
+		concurrency: concurrency,
+		limiter:     rate.NewLimiter(limit, concurrency),
+	}
+}
+
+// WithHistoryLimits sets how many blocks a history query reads concurrently
+// and the maximum number of storage reads per second across all history
+// queries. A non-positive rate disables rate limiting.
+func WithHistoryLimits(concurrency int, readsPerSec float64) Option {
+	return func(e *EstimateService) {
+		e.history = newHistoryLimits(concurrency, readsPerSec)
+	}
+}
+
+// HistoryQuery describes a fixed-size swap replayed at every Step-th block in
+// the inclusive range [From, To].
+type HistoryQuery struct {
+	Pool     common.Address
+	Src      common.Address
+	Dst      common.Address
+	AmountIn *big.Int
+	From     uint64
+	To       uint64
+	Step     uint64
+}
+
+// Validate checks the block range and returns ErrSameToken or
+// ErrInvalidHistoryRange for malformed queries.
+func (q HistoryQuery) Validate() error {
+	if q.Src == q.Dst {
+		return ErrSameToken
+	}
+	if q.Step == 0 || q.From > q.To || (q.To-q.From)/q.Step >= MaxHistoryPoints {
+		return ErrInvalidHistoryRange
+	}
+	return nil
+}
+
+// HistoryPoint is the estimate at a single block. Err is set instead of
+// AmountOut when the estimate could not be computed at that block, e.g.
+// because the pool had no reserves yet.
+type HistoryPoint struct {
+	Block     uint64
+	AmountOut *big.Int
+	Err       error
+}
+
+// EstimateHistory computes the estimate for q at every Step-th block between
+// From and To and passes the points to emit in block order. It is
+// PrepareHistory followed by History.Stream.
+func (e *EstimateService) EstimateHistory(ctx context.Context, q HistoryQuery, emit func(HistoryPoint) error) error {
+	h, err := e.PrepareHistory(ctx, q)
+	if err != nil {
+		return err
+	}
+	return h.Stream(ctx, emit)
+}
+
+// History is a validated history query whose pool has been read, ready to
+// stream.
+type History struct {
+	e    *EstimateService
+	q    HistoryQuery
+	pair *poolState
+}
+
+// PrepareHistory validates q and reads the tokens and fee of its pool at To,
+// so that a pool that does not exist or does not trade Src for Dst fails
+// before any point is produced, with ErrPoolNotFound or ErrPairMismatch.
+func (e *EstimateService) PrepareHistory(ctx context.Context, q HistoryQuery) (*History, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	pair, err := e.readPool(ctx, q.Pool, new(big.Int).SetUint64(q.To), false)
+	if err != nil {
+		return nil, err
+	}
+	if (q.Src != pair.token0 || q.Dst != pair.token1) && (q.Src != pair.token1 || q.Dst != pair.token0) {
+		return nil, ErrPairMismatch
+	}
+	return &History{e: e, q: q, pair: pair}, nil
+}
+
+// Stream passes the point of every Step-th block to emit in block order.
+//
+// Every point costs a single reserves read, served from the ReserveSource
+// when it covers the block. RPC reads run concurrently and are rate limited
+// according to WithHistoryLimits. Per-block failures are reported through
+// HistoryPoint.Err; the stream stops early only if ctx is canceled or emit
+// returns an error.
+func (h *History) Stream(ctx context.Context, emit func(HistoryPoint) error) error {
+	e, q := h.e, h.q
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each pending point owns a buffered channel; the queue preserves block
+	// order while its capacity bounds the number of in-flight reads.
+	queue := make(chan chan HistoryPoint, e.history.concurrency)
+	go func() {
+		defer close(queue)
+		for bn := q.From; bn <= q.To; bn += q.Step {
+			ch := make(chan HistoryPoint, 1)
+			select {
+			case queue <- ch:
+			case <-ctx.Done():
+				return
+			}
+			go func(bn uint64) {
+				ch <- e.historyPoint(ctx, q, h.pair, bn)
+			}(bn)
+			if q.To-bn < q.Step {
+				return
+			}
+		}
+	}()
+
+	for ch := range queue {
+		p := <-ch
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := emit(p); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (e *EstimateService) historyPoint(ctx context.Context, q HistoryQuery, pair *poolState, bn uint64) HistoryPoint {
+	p := HistoryPoint{Block: bn}
+	blockNum := new(big.Int).SetUint64(bn)
+
+	// Only reads that reach the RPC endpoint count against the rate limit.
+	reserve0, reserve1, ok := e.storedReserves(q.Pool, blockNum)
+	if !ok {
+		if err := e.history.limiter.Wait(ctx); err != nil {
+			p.Err = err
+			return p
+		}
+		var err error
+		reserve0, reserve1, err = e.readReserves(ctx, q.Pool, blockNum)
+		if err != nil {
+			p.Err = err
+			return p
+		}
+	}
+
+	state := poolState{token0: pair.token0, token1: pair.token1, reserve0: reserve0, reserve1: reserve1, fee: pair.fee}
+	reserveIn, reserveOut, err := state.orient(q.Src, q.Dst)
+	if err != nil {
+		p.Err = err
+		return p
+	}
+
+	var tmp1, tmp2 big.Int
+	p.AmountOut = uniswapv2.GetAmountOutFee(new(big.Int), &tmp1, &tmp2, q.AmountIn, reserveIn, reserveOut, state.fee)
+	return p
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// fakeHistoryEth serves reserves that depend on the requested block: the pool
+// is empty before block 5 and reserve0 grows by 1000 per block afterwards.
+type fakeHistoryEth struct {
+	*fakeEth
+}
+
+func historyReserves(bn uint64) (uint64, uint64) {
+	if bn < 5 {
+		return 0, 0
+	}
+	return 1_000_000 + bn*1_000, 2_000_000
+}
+
+func (f *fakeHistoryEth) GetStorageAt(ctx context.Context, addr common.Address, position common.Hash, block gethrpc.BlockNumberOrHash) (hexutil.Bytes, error) {
+	if position == common.BigToHash(big.NewInt(8)) {
+		bn, _ := block.Number()
+		r0, r1 := historyReserves(uint64(bn))
+		return packReserves(r0, r1, 0), nil
+	}
+	return f.fakeEth.GetStorageAt(ctx, addr, position, block)
+}
+
+func TestEstimateHistory_OrderedPoints(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &fakeHistoryEth{fakeEth: &fakeEth{
+		blockNumber: 100,
+		storage: map[common.Address]map[common.Hash][]byte{
+			pool: {
+				common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0),
+				common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1),
+			},
+		},
+	}}
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	ec := newInprocClient(t, srv)
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), eth.NewClientReader(ec), WithHistoryLimits(3, 0))
+
+	amountIn := big.NewInt(1_000)
+	q := HistoryQuery{Pool: pool, Src: token0, Dst: token1, AmountIn: amountIn, From: 1, To: 31, Step: 3}
+
+	var points []HistoryPoint
+	err := svc.EstimateHistory(context.Background(), q, func(p HistoryPoint) error {
+		points = append(points, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("EstimateHistory error: %v", err)
+	}
+
+	if len(points) != 11 {
+		t.Fatalf("unexpected point count: got %d want 11", len(points))
+	}
+	for i, p := range points {
+		wantBlock := uint64(1 + 3*i)
+		if p.Block != wantBlock {
+			t.Fatalf("point %d: got block %d want %d", i, p.Block, wantBlock)
+		}
+		r0, r1 := historyReserves(wantBlock)
+		if r0 == 0 {
+			if !errors.Is(p.Err, ErrEmptyReserves) {
+				t.Fatalf("block %d: expected ErrEmptyReserves, got %v", p.Block, p.Err)
+			}
+			continue
+		}
+		var dst, t1, t2 big.Int
+		want := uniswapv2.GetAmountOut(&dst, &t1, &t2, amountIn, new(big.Int).SetUint64(r0), new(big.Int).SetUint64(r1))
+		if p.Err != nil || p.AmountOut.Cmp(want) != 0 {
+			t.Fatalf("block %d: got %v (%v) want %s", p.Block, p.AmountOut, p.Err, want)
+		}
+	}
+}
+
+func TestEstimateHistory_Validation(t *testing.T) {
+	t.Parallel()
+
+	a := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	b := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	cases := []struct {
+		name string
+		q    HistoryQuery
+		err  error
+	}{
+		{"same_token", HistoryQuery{Src: a, Dst: a, From: 1, To: 2, Step: 1}, ErrSameToken},
+		{"zero_step", HistoryQuery{Src: a, Dst: b, From: 1, To: 2}, ErrInvalidHistoryRange},
+		{"reversed", HistoryQuery{Src: a, Dst: b, From: 3, To: 2, Step: 1}, ErrInvalidHistoryRange},
+		{"too_many", HistoryQuery{Src: a, Dst: b, From: 0, To: MaxHistoryPoints, Step: 1}, ErrInvalidHistoryRange},
+		{"max", HistoryQuery{Src: a, Dst: b, From: 0, To: MaxHistoryPoints - 1, Step: 1}, nil},
+	}
+	for _, tc := range cases {
+		if err := tc.q.Validate(); err != tc.err {
+			t.Fatalf("%s: got %v want %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+// stubReserveSource covers blocks [from, to] with constant reserves.
+type stubReserveSource struct {
+	from, to uint64
+	r0, r1   int64
+}
+
+func (s stubReserveSource) ReservesAt(_ common.Address, block uint64) (*big.Int, *big.Int, bool, error) {
+	if block < s.from || block > s.to {
+		return nil, nil, false, nil
+	}
+	return big.NewInt(s.r0), big.NewInt(s.r1), true, nil
+}
+
+func TestEstimateHistory_UsesReserveSource(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	// RPC storage has empty reserves, so only indexed blocks yield estimates.
+	fe := &fakeEth{blockNumber: 100, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1)}}}
+	ec := newInprocEthClient(t, fe)
+	src := stubReserveSource{from: 10, to: 20, r0: 1_000_000, r1: 2_000_000}
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), eth.NewClientReader(ec), WithReserveSource(src))
+
+	q := HistoryQuery{Pool: pool, Src: token0, Dst: token1, AmountIn: big.NewInt(1_000), From: 15, To: 25, Step: 5}
+	var points []HistoryPoint
+	if err := svc.EstimateHistory(context.Background(), q, func(p HistoryPoint) error {
+		points = append(points, p)
+		return nil
+	}); err != nil {
+		t.Fatalf("EstimateHistory error: %v", err)
+	}
+
+	if len(points) != 3 {
+		t.Fatalf("unexpected point count: %d", len(points))
+	}
+	for _, p := range points[:2] {
+		if p.Err != nil || p.AmountOut.Int64() != 1992 {
+			t.Fatalf("block %d: expected indexed estimate, got %v (%v)", p.Block, p.AmountOut, p.Err)
+		}
+	}
+	if !errors.Is(points[2].Err, ErrEmptyReserves) {
+		t.Fatalf("block 25: expected RPC fallback with empty reserves, got %v", points[2].Err)
+	}
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+)
+
+// mempoolResubscribeDelay is the pause between subscription attempts after the
+// pending transaction or head stream fails.
+const mempoolResubscribeDelay = 2 * time.Second
+
+// Mempool tracks pending Router02 swap transactions observed since the last
+// block. It is reset whenever a new head arrives: transactions seen before the
+// head are either included (and thus reflected in latest reserves) or still
+// pending, and dropping them avoids double counting included swaps.
+type Mempool struct {
+	BaseService
+	router common.Address
+
+	mu    sync.RWMutex
+	seq   uint64
+	swaps map[common.Hash]pendingSwap
+}
+
+// pendingSwap is a decoded swap together with its ordering keys.
+type pendingSwap struct {
+	hash     common.Hash
+	gasPrice *big.Int
+	seq      uint64
+	swap     *routerSwap
+}
+
+// NewMempool constructs an empty Mempool that accepts swaps sent to router.
+func NewMempool(logger *slog.Logger, router common.Address) *Mempool {
+	return &Mempool{
+		BaseService: BaseService{logger: logger},
+		router:      router,
+		swaps:       make(map[common.Hash]pendingSwap),
+	}
+}
+
+// Add records tx if it is a Router02 swap call and reports whether it was
+// accepted.
+func (m *Mempool) Add(tx *types.Transaction) bool {
+	if tx.To() == nil || *tx.To() != m.router {
+		return false
+	}
+	swap, err := decodeRouterSwap(tx)
+	if err != nil {
+		return false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.swaps[tx.Hash()]; ok {
+		return false
+	}
+	m.seq++
+	m.swaps[tx.Hash()] = pendingSwap{hash: tx.Hash(), gasPrice: tx.GasPrice(), seq: m.seq, swap: swap}
+	return true
+}
+
+// Reset drops all tracked swaps.
+func (m *Mempool) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.swaps = make(map[common.Hash]pendingSwap)
+}
+
+// Len returns the number of tracked swaps.
+func (m *Mempool) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.swaps)
+}
+
+// swapsFor returns swaps whose path crosses the token0/token1 pair, ordered by
+// gas price (highest first) and then by arrival.
+func (m *Mempool) swapsFor(token0, token1 common.Address) []pendingSwap {
+	m.mu.RLock()
+	out := make([]pendingSwap, 0, len(m.swaps))
+	for _, ps := range m.swaps {
+		if hopIndex(ps.swap.Path, token0, token1) >= 0 {
+			out = append(out, ps)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		if c := out[i].gasPrice.Cmp(out[j].gasPrice); c != 0 {
+			return c > 0
+		}
+		return out[i].seq < out[j].seq
+	})
+	return out
+}
+
+// Run subscribes to pending transactions and new heads on ec and feeds them
+// into the mempool until ctx is canceled. Subscription failures are logged and
+// retried after a short delay.
+func (m *Mempool) Run(ctx context.Context, ec *ethclient.Client) {
+	for {
+		err := m.subscribe(ctx, ec)
+		if ctx.Err() != nil {
+			return
+		}
+		m.logger.Warn("mempool subscription failed", "err", err)
+		m.Reset()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(mempoolResubscribeDelay):
+		}
+	}
+}
+
+func (m *Mempool) subscribe(ctx context.Context, ec *ethclient.Client) error {
+	txs := make(chan *types.Transaction, 256)
+	txSub, err := eth.SubscribePendingTransactions(ctx, ec, txs)
+	if err != nil {
+		return fmt.Errorf("subscribe pending transactions: %w", err)
+	}
+	defer txSub.Unsubscribe()
+
+	heads := make(chan *types.Header, 16)
+	headSub, err := ec.SubscribeNewHead(ctx, heads)
+	if err != nil {
+		return fmt.Errorf("subscribe new heads: %w", err)
+	}
+	defer headSub.Unsubscribe()
+
+	m.logger.Info("mempool subscription established")
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-txSub.Err():
+			return fmt.Errorf("pending transactions: %w", err)
+		case err := <-headSub.Err():
+			return fmt.Errorf("new heads: %w", err)
+		case tx := <-txs:
+			if m.Add(tx) {
+				m.logger.Debug("pending swap tracked", "tx", tx.Hash().Hex())
+			}
+		case h := <-heads:
+			m.logger.Debug("new head, resetting mempool", "block", h.Number.String())
+			m.Reset()
+		}
+	}
+}
+
+// hopIndex returns the index i such that path[i], path[i+1] is the
+// token0/token1 pair in either order, or -1 if the path does not cross it.
+func hopIndex(path []common.Address, token0, token1 common.Address) int {
+	for i := 0; i+1 < len(path); i++ {
+		a, b := path[i], path[i+1]
+		if (a == token0 && b == token1) || (a == token1 && b == token0) {
+			return i
+		}
+	}
+	return -1
+}
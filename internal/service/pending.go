@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// PendingEstimate holds the estimate at the latest block alongside the
+// estimate after applying tracked pending swaps to the pool reserves.
+type PendingEstimate struct {
+	Block        *big.Int
+	Latest       *big.Int
+	Pending      *big.Int
+	AppliedSwaps int
+}
+
+// EstimatePending computes the latest estimate and a pending estimate in which
+// Router02 swaps from the mempool that cross the pool's pair are applied, in
+// gas-price order, to a copy of the latest reserves.
+//
+// Only hops whose amounts are known without reading other pools are applied:
+// the first hop of an exact-input path and the last hop of an exact-output
+// path. Single-hop swaps that would revert on their slippage limit or that are
+// past their deadline are skipped.
+func (e *EstimateService) EstimatePending(ctx context.Context, pool, src, dst common.Address, amountIn *big.Int) (_ *PendingEstimate, err error) {
+	ctx, span := e.startEstimateSpan(ctx, "EstimateService.EstimatePending", pool, src, dst, amountIn)
+	defer func() {
+		e.observeEstimate("pending", err)
+		tracing.End(span, err)
+	}()
+	if e.mempool == nil {
+		return nil, ErrPendingUnavailable
+	}
+	if src == dst {
+		return nil, ErrSameToken
+	}
+
+	blockNum, state, err := e.latestPool(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+
+	reserveIn, reserveOut, err := state.orient(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	var outAmt, tmp1, tmp2 big.Int
+	latest := new(big.Int).Set(uniswapv2.GetAmountOutFee(&outAmt, &tmp1, &tmp2, amountIn, reserveIn, reserveOut, state.fee))
+
+	pendingState := state.clone()
+	applied := 0
+	now := big.NewInt(time.Now().Unix())
+	for _, ps := range e.mempool.swapsFor(state.token0, state.token1) {
+		if ps.swap.Deadline.Cmp(now) < 0 {
+			continue
+		}
+		if pendingState.applySwap(ps.swap) {
+			applied++
+		}
+	}
+
+	reserveIn, reserveOut, err = pendingState.orient(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	pending := new(big.Int).Set(uniswapv2.GetAmountOutFee(&outAmt, &tmp1, &tmp2, amountIn, reserveIn, reserveOut, state.fee))
+
+	e.logger.Debug("pending estimate computed", "latest", latest.String(), "pending", pending.String(), "applied", applied)
+	return &PendingEstimate{
+		Block:        blockNum,
+		Latest:       latest,
+		Pending:      pending,
+		AppliedSwaps: applied,
+	}, nil
+}
+
+// clone returns a deep copy of the pool state.
+func (p *poolState) clone() *poolState {
+	return &poolState{
+		token0:   p.token0,
+		token1:   p.token1,
+		reserve0: new(big.Int).Set(p.reserve0),
+		reserve1: new(big.Int).Set(p.reserve1),
+		fee:      p.fee,
+	}
+}
+
+// applySwap applies the pool's hop of a router swap to the reserves in place
+// and reports whether it was applied.
+func (p *poolState) applySwap(s *routerSwap) bool {
+	i := hopIndex(s.Path, p.token0, p.token1)
+	if i < 0 {
+		return false
+	}
+	singleHop := len(s.Path) == 2
+
+	reserveIn, reserveOut, err := p.orient(s.Path[i], s.Path[i+1])
+	if err != nil {
+		return false
+	}
+
+	var res, tmp1, tmp2 big.Int
+	var amountIn, amountOut *big.Int
+	if s.ExactIn {
+		if i != 0 {
+			return false
+		}
+		amountIn = s.AmountIn
+		amountOut = new(big.Int).Set(uniswapv2.GetAmountOutFee(&res, &tmp1, &tmp2, amountIn, reserveIn, reserveOut, p.fee))
+		if singleHop && amountOut.Cmp(s.AmountOutMin) < 0 {
+			return false
+		}
+	} else {
+		if i != len(s.Path)-2 || s.AmountOut.Cmp(reserveOut) >= 0 {
+			return false
+		}
+		amountOut = s.AmountOut
+		amountIn = new(big.Int).Set(uniswapv2.GetAmountInFee(&res, &tmp1, &tmp2, amountOut, reserveIn, reserveOut, p.fee))
+		if singleHop && amountIn.Cmp(s.AmountInMax) > 0 {
+			return false
+		}
+	}
+	if amountIn.Sign() <= 0 || amountOut.Sign() <= 0 {
+		return false
+	}
+
+	reserveIn.Add(reserveIn, amountIn)
+	reserveOut.Sub(reserveOut, amountOut)
+	return true
+}
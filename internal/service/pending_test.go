@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// fakeMempoolEth extends fakeEth with newPendingTransactions and newHeads
+// subscriptions fed from channels.
+type fakeMempoolEth struct {
+	*fakeEth
+	txs   chan *types.Transaction
+	heads chan *types.Header
+}
+
+func (f *fakeMempoolEth) NewPendingTransactions(ctx context.Context, _ *bool) (*gethrpc.Subscription, error) {
+	return feed(ctx, f.txs)
+}
+
+func (f *fakeMempoolEth) NewHeads(ctx context.Context) (*gethrpc.Subscription, error) {
+	return feed(ctx, f.heads)
+}
+
+func feed[T any](ctx context.Context, ch <-chan T) (*gethrpc.Subscription, error) {
+	notifier, ok := gethrpc.NotifierFromContext(ctx)
+	if !ok {
+		return nil, gethrpc.ErrNotificationsUnsupported
+	}
+	sub := notifier.CreateSubscription()
+	go func() {
+		for {
+			select {
+			case v := <-ch:
+				_ = notifier.Notify(sub.ID, v)
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+	return sub, nil
+}
+
+func newInprocMempoolClient(t *testing.T, fe *fakeMempoolEth) *ethclient.Client {
+	t.Helper()
+	srv := gethrpc.NewServer()
+	if err := srv.RegisterName("eth", fe); err != nil {
+		t.Fatalf("register rpc service: %v", err)
+	}
+	return newInprocClient(t, srv)
+}
+
+func signedRouterTx(t *testing.T, key *ecdsa.PrivateKey, nonce uint64, router common.Address, gasPrice int64, value *big.Int, method string, args ...any) *types.Transaction {
+	t.Helper()
+	data, err := router02ABI.Pack(method, args...)
+	if err != nil {
+		t.Fatalf("pack %s: %v", method, err)
+	}
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		To:       &router,
+		Value:    value,
+		Gas:      200_000,
+		GasPrice: big.NewInt(gasPrice),
+		Data:     data,
+	})
+	signed, err := types.SignTx(tx, types.HomesteadSigner{}, key)
+	if err != nil {
+		t.Fatalf("sign tx: %v", err)
+	}
+	return signed
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestEstimatePending_AppliesMempoolSwaps(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	router := common.HexToAddress("0x0000000000000000000000000000000000000def")
+	r0, r1 := uint64(1_000_000), uint64(2_000_000)
+
+	fe := &fakeMempoolEth{
+		fakeEth: &fakeEth{
+			blockNumber: 10,
+			storage: map[common.Address]map[common.Hash][]byte{
+				pool: {
+					common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0),
+					common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1),
+					common.BigToHash(new(big.Int).SetUint64(8)): packReserves(r0, r1, 0),
+				},
+			},
+		},
+		txs:   make(chan *types.Transaction, 16),
+		heads: make(chan *types.Header, 1),
+	}
+	ec := newInprocMempoolClient(t, fe)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	deadline := big.NewInt(time.Now().Add(time.Hour).Unix())
+	to := crypto.PubkeyToAddress(key.PublicKey)
+
+	// Lower gas price: exact-output swap buying token0 with token1.
+	exactOut := signedRouterTx(t, key, 0, router, 10, big.NewInt(0), "swapTokensForExactTokens",
+		big.NewInt(5_000), big.NewInt(1_000_000), []common.Address{token1, token0}, to, deadline)
+	// Higher gas price: exact-input swap selling token0 for token1.
+	exactIn := signedRouterTx(t, key, 1, router, 50, big.NewInt(0), "swapExactTokensForTokens",
+		big.NewInt(100_000), big.NewInt(0), []common.Address{token0, token1}, to, deadline)
+	// Unrelated path: must be ignored.
+	unrelated := signedRouterTx(t, key, 2, router, 99, big.NewInt(0), "swapExactTokensForTokens",
+		big.NewInt(100_000), big.NewInt(0), []common.Address{token0, other}, to, deadline)
+	// Slippage limit cannot be met: would revert and must be skipped.
+	reverting := signedRouterTx(t, key, 3, router, 70, big.NewInt(0), "swapExactTokensForTokens",
+		big.NewInt(1_000), big.NewInt(1_000_000), []common.Address{token0, token1}, to, deadline)
+	// Not sent to the router: ignored on ingestion.
+	elsewhere := signedRouterTx(t, key, 4, other, 80, big.NewInt(0), "swapExactTokensForTokens",
+		big.NewInt(100_000), big.NewInt(0), []common.Address{token0, token1}, to, deadline)
+
+	for _, tx := range []*types.Transaction{exactOut, exactIn, unrelated, reverting, elsewhere} {
+		fe.txs <- tx
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	mempool := NewMempool(logger, router)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go mempool.Run(ctx, ec)
+	waitFor(t, func() bool { return mempool.Len() == 4 })
+
+	svc := NewEstimateService(logger, eth.NewClientReader(ec), WithMempool(mempool))
+	amountIn := big.NewInt(1_000)
+	got, err := svc.EstimatePending(context.Background(), pool, token0, token1, amountIn)
+	if err != nil {
+		t.Fatalf("EstimatePending error: %v", err)
+	}
+
+	// Expected: apply exactIn first (higher gas price), then exactOut.
+	var a, b, c big.Int
+	res0, res1 := new(big.Int).SetUint64(r0), new(big.Int).SetUint64(r1)
+	latest := new(big.Int).Set(uniswapv2.GetAmountOut(&a, &b, &c, amountIn, res0, res1))
+
+	out := new(big.Int).Set(uniswapv2.GetAmountOut(&a, &b, &c, big.NewInt(100_000), res0, res1))
+	res0.Add(res0, big.NewInt(100_000))
+	res1.Sub(res1, out)
+	in := new(big.Int).Set(uniswapv2.GetAmountIn(&a, &b, &c, big.NewInt(5_000), res1, res0))
+	res1.Add(res1, in)
+	res0.Sub(res0, big.NewInt(5_000))
+	pending := uniswapv2.GetAmountOut(&a, &b, &c, amountIn, res0, res1)
+
+	if got.Latest.Cmp(latest) != 0 {
+		t.Fatalf("unexpected latest: got %s want %s", got.Latest, latest)
+	}
+	if got.Pending.Cmp(pending) != 0 {
+		t.Fatalf("unexpected pending: got %s want %s", got.Pending, pending)
+	}
+	if got.AppliedSwaps != 2 {
+		t.Fatalf("unexpected applied swaps: got %d want 2", got.AppliedSwaps)
+	}
+
+	// A new head resets the tracked swaps.
+	fe.heads <- &types.Header{Number: big.NewInt(11), Difficulty: big.NewInt(0)}
+	waitFor(t, func() bool { return mempool.Len() == 0 })
+}
+
+func TestEstimatePending_Disabled(t *testing.T) {
+	t.Parallel()
+
+	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{}}
+	ec := newInprocEthClient(t, fe)
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), eth.NewClientReader(ec))
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	_, err := svc.EstimatePending(context.Background(), pool, token0, token1, big.NewInt(1))
+	if err != ErrPendingUnavailable {
+		t.Fatalf("expected ErrPendingUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/tracing"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Quote is a swap estimate together with the block whose reserves it is
+// based on.
+type Quote struct {
+	Block     *big.Int
+	AmountIn  *big.Int
+	AmountOut *big.Int
+}
+
+// Quote computes the output of swapping amountIn of src to dst in pool at the
+// latest block, like Estimate, and reports the block it was computed at.
+func (e *EstimateService) Quote(ctx context.Context, pool, src, dst common.Address, amountIn *big.Int) (_ *Quote, err error) {
+	ctx, span := e.startEstimateSpan(ctx, "EstimateService.Quote", pool, src, dst, amountIn)
+	defer func() {
+		e.observeEstimate("latest", err)
+		tracing.End(span, err)
+	}()
+	return e.quote(ctx, pool, src, dst, amountIn)
+}
+
+// QuoteIn computes the amount of src that must be swapped in pool at the
+// latest block to receive amountOut of dst. It returns
+// uniswapv2.ErrInsufficientLiquidity if the pool holds no more than amountOut
+// of dst.
+func (e *EstimateService) QuoteIn(ctx context.Context, pool, src, dst common.Address, amountOut *big.Int) (_ *Quote, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "EstimateService.QuoteIn", trace.WithAttributes(
+		attribute.String("chain", e.chain.Name),
+		attribute.String("pool", pool.Hex()),
+		attribute.String("src", src.Hex()),
+		attribute.String("dst", dst.Hex()),
+		attribute.String("amount_out", amountOut.String()),
+	))
+	defer func() {
+		e.observeEstimate("exact_out", err)
+		tracing.End(span, err)
+	}()
+
+	if src == dst {
+		return nil, ErrSameToken
+	}
+	blockNum, state, err := e.latestPool(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	reserveIn, reserveOut, err := state.orient(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	if amountOut.Cmp(reserveOut) >= 0 {
+		return nil, uniswapv2.ErrInsufficientLiquidity
+	}
+
+	var tmp1, tmp2 big.Int
+	in := uniswapv2.GetAmountInFee(new(big.Int), &tmp1, &tmp2, amountOut, reserveIn, reserveOut, state.fee)
+	return &Quote{Block: blockNum, AmountIn: in, AmountOut: new(big.Int).Set(amountOut)}, nil
+}
+
+// quote computes the output of amountIn at the latest block.
+func (e *EstimateService) quote(ctx context.Context, pool, src, dst common.Address, amountIn *big.Int) (*Quote, error) {
+	if src == dst {
+		return nil, ErrSameToken
+	}
+	blockNum, state, err := e.latestPool(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	return state.quote(blockNum, src, dst, amountIn)
+}
+
+// quote applies the Uniswap V2 formula to the reserves of p.
+func (p *poolState) quote(blockNum *big.Int, src, dst common.Address, amountIn *big.Int) (*Quote, error) {
+	reserveIn, reserveOut, err := p.orient(src, dst)
+	if err != nil {
+		return nil, err
+	}
+	var tmp1, tmp2 big.Int
+	out := uniswapv2.GetAmountOutFee(new(big.Int), &tmp1, &tmp2, amountIn, reserveIn, reserveOut, p.fee)
+	return &Quote{Block: blockNum, AmountIn: amountIn, AmountOut: out}, nil
+}
+
+// WatchQuote polls the latest block number every interval and calls emit
+// with a quote of amountIn from src to dst for every new block, starting with
+// the current one.
+//
+// It returns when ctx ends, when emit returns an error, or when a quote fails
+// with an error that has a Code, such as ErrPairMismatch, since polling again
+// would not change it. Other failures, usually RPC errors, are logged and the
+// block is retried on the next poll.
+func (e *EstimateService) WatchQuote(ctx context.Context, pool, src, dst common.Address, amountIn *big.Int, interval time.Duration, emit func(*Quote) error) error {
+	return watchQuote(ctx, e.logger, pool, src, dst, interval, emit, func(ctx context.Context, last *big.Int) (*Quote, error) {
+		return e.watchedQuote(ctx, pool, src, dst, amountIn, last)
+	})
+}
+
+// WatchQuote is EstimateService.WatchQuote on the chain with the given ID. The
+// chain's service is acquired again for every poll, so that the watch follows
+// a Replace instead of polling replaced services. It fails with
+// ErrUnknownChain once the chain is no longer configured. When admit is set,
+// every poll first takes a slot from it and gives it back when done; a poll
+// admit refuses is retried like a failed one.
+func (s *ChainSet) WatchQuote(ctx context.Context, chainID uint64, pool, src, dst common.Address, amountIn *big.Int, interval time.Duration, admit func(context.Context) (release func(), err error), emit func(*Quote) error) error {
+	svc, release, err := s.Acquire("", chainID)
+	if err != nil {
+		return err
+	}
+	logger := svc.logger
+	release()
+
+	return watchQuote(ctx, logger, pool, src, dst, interval, emit, func(ctx context.Context, last *big.Int) (*Quote, error) {
+		if admit != nil {
+			done, err := admit(ctx)
+			if err != nil {
+				return nil, err
+			}
+			defer done()
+		}
+		svc, release, err := s.Acquire("", chainID)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		return svc.watchedQuote(ctx, pool, src, dst, amountIn, last)
+	})
+}
+
+// watchQuote runs the polling loop of WatchQuote, reading quotes with poll.
+func watchQuote(ctx context.Context, logger *slog.Logger, pool, src, dst common.Address, interval time.Duration, emit func(*Quote) error, poll func(ctx context.Context, last *big.Int) (*Quote, error)) error {
+	if src == dst {
+		return ErrSameToken
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *big.Int
+	for {
+		q, err := poll(ctx, last)
+		switch {
+		case err != nil && (CodeOf(err) != "" || ctx.Err() != nil):
+			return err
+		case err != nil:
+			logger.Warn("quote watch poll failed", "pool", pool.Hex(), "err", err)
+		case q != nil:
+			last = q.Block
+			if err := emit(q); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// watchedQuote quotes amountIn at the latest block, or returns a nil Quote if
+// the latest block is not past last.
+func (e *EstimateService) watchedQuote(ctx context.Context, pool, src, dst common.Address, amountIn, last *big.Int) (_ *Quote, err error) {
+	blockNum, err := e.latestBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && blockNum.Cmp(last) <= 0 {
+		return nil, nil
+	}
+
+	defer func() { e.observeEstimate("watch", err) }()
+	state, err := e.loadPool(ctx, pool, blockNum)
+	if err != nil {
+		return nil, err
+	}
+	return state.quote(blockNum, src, dst, amountIn)
+}
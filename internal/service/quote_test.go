@@ -0,0 +1,156 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// headReader is a snapshotReader whose latest block can advance.
+type headReader struct {
+	snapshotReader
+	head atomic.Uint64
+}
+
+func (h *headReader) BlockNumber(context.Context) (uint64, error) { return h.head.Load(), nil }
+
+func TestQuoteIn(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	reader := &snapshotReader{block: 5, storage: map[common.Hash][]byte{
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), reader)
+
+	q, err := svc.QuoteIn(context.Background(), pool, token0, token1, big.NewInt(1992))
+	if err != nil {
+		t.Fatalf("QuoteIn error: %v", err)
+	}
+	if q.Block.Uint64() != 5 || q.AmountIn.Int64() != 1000 || q.AmountOut.Int64() != 1992 {
+		t.Fatalf("unexpected quote: block %s in %s out %s", q.Block, q.AmountIn, q.AmountOut)
+	}
+
+	// The input found must buy at least amountOut.
+	back, err := svc.Estimate(context.Background(), pool, token0, token1, q.AmountIn)
+	if err != nil || back.Cmp(q.AmountOut) < 0 {
+		t.Fatalf("Estimate(%s) = %v, %v; want at least %s", q.AmountIn, back, err, q.AmountOut)
+	}
+
+	if _, err := svc.QuoteIn(context.Background(), pool, token0, token1, big.NewInt(2_000_000)); !errors.Is(err, uniswapv2.ErrInsufficientLiquidity) {
+		t.Fatalf("expected ErrInsufficientLiquidity, got %v", err)
+	}
+}
+
+func TestWatchQuote(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	other := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	reader := &headReader{snapshotReader: snapshotReader{storage: map[common.Hash][]byte{
+		common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+		common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+		common.BigToHash(big.NewInt(8)): packReserves(1_000_000, 2_000_000, 0),
+	}}}
+	reader.head.Store(10)
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), reader)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var blocks []uint64
+	err := svc.WatchQuote(ctx, pool, token0, token1, big.NewInt(1_000), time.Millisecond, func(q *Quote) error {
+		blocks = append(blocks, q.Block.Uint64())
+		if q.AmountOut.Int64() != 1992 {
+			t.Errorf("unexpected amountOut %s", q.AmountOut)
+		}
+		if len(blocks) == 3 {
+			cancel()
+			return nil
+		}
+		// Polls before the head moves must not emit.
+		time.Sleep(5 * time.Millisecond)
+		reader.head.Add(1)
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if len(blocks) != 3 || blocks[0] != 10 || blocks[1] != 11 || blocks[2] != 12 {
+		t.Fatalf("unexpected blocks: %v", blocks)
+	}
+
+	err = svc.WatchQuote(context.Background(), pool, token0, other, big.NewInt(1_000), time.Millisecond, func(*Quote) error {
+		t.Fatalf("emit called for a mismatched pair")
+		return nil
+	})
+	if !errors.Is(err, ErrPairMismatch) {
+		t.Fatalf("expected ErrPairMismatch, got %v", err)
+	}
+}
+
+func TestChainSet_WatchQuote(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	newService := func(reserve1 uint64, head uint64) *EstimateService {
+		reader := &headReader{snapshotReader: snapshotReader{storage: map[common.Hash][]byte{
+			common.BigToHash(big.NewInt(6)): rightPadAddress(token0),
+			common.BigToHash(big.NewInt(7)): rightPadAddress(token1),
+			common.BigToHash(big.NewInt(8)): packReserves(1_000_000, reserve1, 0),
+		}}}
+		reader.head.Store(head)
+		return NewEstimateService(logger, reader, WithChain(Chain{Name: "ethereum", ID: 1, DefaultFeeBps: 30}))
+	}
+	set, err := NewChainSet(newService(2_000_000, 10))
+	if err != nil {
+		t.Fatalf("NewChainSet: %v", err)
+	}
+
+	// Every poll is admitted and gives its slot back.
+	var admitted, released int
+	admit := func(context.Context) (func(), error) {
+		admitted++
+		return func() { released++ }, nil
+	}
+
+	// Each quote swaps in new services: first for the same chain, whose
+	// reserves the watch must pick up, then without the chain at all.
+	var outs []int64
+	err = set.WatchQuote(context.Background(), 1, pool, token0, token1, big.NewInt(1_000), time.Millisecond, admit, func(q *Quote) error {
+		outs = append(outs, q.AmountOut.Int64())
+		next := newService(4_000_000, q.Block.Uint64()+1)
+		if len(outs) == 2 {
+			next = NewEstimateService(logger, nil, WithChain(Chain{Name: "bsc", ID: 56}))
+		}
+		if _, err := set.Replace(next); err != nil {
+			t.Fatalf("Replace: %v", err)
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrUnknownChain) {
+		t.Fatalf("expected ErrUnknownChain, got %v", err)
+	}
+	if len(outs) != 2 || outs[0] != 1992 || outs[1] != 3984 {
+		t.Fatalf("unexpected quotes: %v", outs)
+	}
+	if admitted != 3 || released != 3 {
+		t.Fatalf("polls admitted %d times and released %d times, want 3", admitted, released)
+	}
+}
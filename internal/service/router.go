@@ -0,0 +1,97 @@
+package service
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	gethabi "github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// router02SwapABI lists the Router02 swap entrypoints decoded from pending
+// transactions. Liquidity management calls are intentionally omitted.
+const router02SwapABI = `[
+{"name":"swapExactTokensForTokens","type":"function","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapTokensForExactTokens","type":"function","inputs":[{"name":"amountOut","type":"uint256"},{"name":"amountInMax","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapExactETHForTokens","type":"function","stateMutability":"payable","inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapTokensForExactETH","type":"function","inputs":[{"name":"amountOut","type":"uint256"},{"name":"amountInMax","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapExactTokensForETH","type":"function","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapETHForExactTokens","type":"function","stateMutability":"payable","inputs":[{"name":"amountOut","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapExactTokensForTokensSupportingFeeOnTransferTokens","type":"function","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapExactETHForTokensSupportingFeeOnTransferTokens","type":"function","stateMutability":"payable","inputs":[{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]},
+{"name":"swapExactTokensForETHSupportingFeeOnTransferTokens","type":"function","inputs":[{"name":"amountIn","type":"uint256"},{"name":"amountOutMin","type":"uint256"},{"name":"path","type":"address[]"},{"name":"to","type":"address"},{"name":"deadline","type":"uint256"}]}
+]`
+
+var router02ABI = func() gethabi.ABI {
+	parsed, err := gethabi.JSON(strings.NewReader(router02SwapABI))
+	if err != nil {
+		panic("service: invalid Router02 ABI: " + err.Error())
+	}
+	return parsed
+}()
+
+// errNotRouterSwap is returned by decodeRouterSwap for calls that are not one
+// of the supported Router02 swap methods.
+var errNotRouterSwap = errors.New("not a router swap")
+
+// routerSwap is a decoded Router02 swap call.
+//
+// For exact-input swaps AmountIn and AmountOutMin are set; for exact-output
+// swaps AmountOut and AmountInMax are set. ETH-funded variants take their
+// input (or maximum input) from the transaction value.
+type routerSwap struct {
+	ExactIn      bool
+	AmountIn     *big.Int
+	AmountOutMin *big.Int
+	AmountOut    *big.Int
+	AmountInMax  *big.Int
+	Path         []common.Address
+	Deadline     *big.Int
+}
+
+// decodeRouterSwap decodes tx calldata as a Router02 swap call.
+func decodeRouterSwap(tx *types.Transaction) (*routerSwap, error) {
+	data := tx.Data()
+	if len(data) < 4 {
+		return nil, errNotRouterSwap
+	}
+	method, err := router02ABI.MethodById(data[:4])
+	if err != nil {
+		return nil, errNotRouterSwap
+	}
+	args := make(map[string]any, len(method.Inputs))
+	if err := method.Inputs.UnpackIntoMap(args, data[4:]); err != nil {
+		return nil, err
+	}
+
+	s := &routerSwap{
+		Path:     args["path"].([]common.Address),
+		Deadline: args["deadline"].(*big.Int),
+	}
+	switch method.Name {
+	case "swapExactTokensForTokens", "swapExactTokensForETH",
+		"swapExactTokensForTokensSupportingFeeOnTransferTokens", "swapExactTokensForETHSupportingFeeOnTransferTokens":
+		s.ExactIn = true
+		s.AmountIn = args["amountIn"].(*big.Int)
+		s.AmountOutMin = args["amountOutMin"].(*big.Int)
+	case "swapExactETHForTokens", "swapExactETHForTokensSupportingFeeOnTransferTokens":
+		s.ExactIn = true
+		s.AmountIn = tx.Value()
+		s.AmountOutMin = args["amountOutMin"].(*big.Int)
+	case "swapTokensForExactTokens", "swapTokensForExactETH":
+		s.AmountOut = args["amountOut"].(*big.Int)
+		s.AmountInMax = args["amountInMax"].(*big.Int)
+	case "swapETHForExactTokens":
+		s.AmountOut = args["amountOut"].(*big.Int)
+		s.AmountInMax = tx.Value()
+	default:
+		return nil, errNotRouterSwap
+	}
+
+	if len(s.Path) < 2 {
+		return nil, errNotRouterSwap
+	}
+	return s, nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+// MaxSimulationSteps bounds the number of steps accepted by Simulate.
+const MaxSimulationSteps = 100
+
+// totalSupplySlot is the storage slot of UniswapV2ERC20.totalSupply.
+const totalSupplySlot = 0
+
+// StepKind identifies the operation performed by a simulation step.
+type StepKind string
+
+// Supported simulation step kinds.
+const (
+	StepSwap StepKind = "swap"
+	StepMint StepKind = "mint"
+	StepBurn StepKind = "burn"
+)
+
+// SimulationStep is a single operation applied to a pool snapshot.
+//
+// Swap steps use Src and AmountIn (Dst is optional and only validated). Mint
+// steps use Amount0 and Amount1. Burn steps use Liquidity.
+type SimulationStep struct {
+	Kind      StepKind
+	Pool      common.Address
+	Src       common.Address
+	Dst       common.Address
+	AmountIn  *big.Int
+	Amount0   *big.Int
+	Amount1   *big.Int
+	Liquidity *big.Int
+}
+
+// StepResult is the outcome of a simulation step. Swap steps set Dst and
+// AmountOut, mint steps set Liquidity, and burn steps set Amount0 and Amount1.
+type StepResult struct {
+	Kind      StepKind
+	Pool      common.Address
+	Dst       common.Address
+	AmountOut *big.Int
+	Liquidity *big.Int
+	Amount0   *big.Int
+	Amount1   *big.Int
+}
+
+// PoolSnapshot is the final state of a pool touched by a simulation.
+type PoolSnapshot struct {
+	Pool        common.Address
+	Token0      common.Address
+	Token1      common.Address
+	Reserve0    *big.Int
+	Reserve1    *big.Int
+	TotalSupply *big.Int
+}
+
+// SimulationResult holds per-step outputs and final pool states of a
+// simulation. Pools are listed in order of first use.
+type SimulationResult struct {
+	Block *big.Int
+	Steps []StepResult
+	Pools []PoolSnapshot
+}
+
+// StepError reports the step at which a simulation failed.
+type StepError struct {
+	Index int
+	Err   error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d: %v", e.Index, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// simPool is a pool snapshot being mutated by a simulation.
+type simPool struct {
+	token0, token1 common.Address
+	pair           uniswapv2.Pair
+}
+
+// Simulate applies steps in order to in-memory snapshots of the referenced
+// pools, all loaded at blockNum (or the latest block when nil), and returns
+// the output of every step together with the final pool states.
+//
+// Failures caused by the steps themselves are returned as *StepError wrapping
+// one of ErrInvalidStep, ErrPairMismatch, uniswapv2.ErrInsufficientInput or
+// uniswapv2.ErrInsufficientLiquidity.
+func (e *EstimateService) Simulate(ctx context.Context, blockNum *big.Int, steps []SimulationStep) (*SimulationResult, error) {
+	if len(steps) == 0 || len(steps) > MaxSimulationSteps {
+		return nil, ErrInvalidSimulation
+	}
+
+	if blockNum == nil {
+		latest, err := e.latestBlock(ctx)
+		if err != nil {
+			return nil, err
+		}
+		blockNum = latest
+	}
+
+	pools, order, err := e.loadSimulationPools(ctx, blockNum, steps)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]StepResult, 0, len(steps))
+	for i, step := range steps {
+		res, err := applyStep(pools[step.Pool], step)
+		if err != nil {
+			return nil, &StepError{Index: i, Err: err}
+		}
+		results = append(results, res)
+	}
+
+	snapshots := make([]PoolSnapshot, 0, len(order))
+	for _, addr := range order {
+		p := pools[addr]
+		snapshots = append(snapshots, PoolSnapshot{
+			Pool:        addr,
+			Token0:      p.token0,
+			Token1:      p.token1,
+			Reserve0:    p.pair.Reserve0,
+			Reserve1:    p.pair.Reserve1,
+			TotalSupply: p.pair.TotalSupply,
+		})
+	}
+
+	e.logger.Debug("simulation completed", "block", blockNum.String(), "steps", len(steps), "pools", len(order))
+	return &SimulationResult{Block: blockNum, Steps: results, Pools: snapshots}, nil
+}
+
+// loadSimulationPools loads every pool referenced by steps at blockNum. The
+// total supply is only read for pools that are minted into or burned from.
+func (e *EstimateService) loadSimulationPools(ctx context.Context, blockNum *big.Int, steps []SimulationStep) (map[common.Address]*simPool, []common.Address, error) {
+	needSupply := make(map[common.Address]bool)
+	var order []common.Address
+	for _, step := range steps {
+		if _, seen := needSupply[step.Pool]; !seen {
+			order = append(order, step.Pool)
+		}
+		needSupply[step.Pool] = needSupply[step.Pool] || step.Kind == StepMint || step.Kind == StepBurn
+	}
+
+	pools := make(map[common.Address]*simPool, len(order))
+	for _, addr := range order {
+		state, err := e.loadPool(ctx, addr, blockNum)
+		if err != nil {
+			return nil, nil, err
+		}
+		supply := new(big.Int)
+		if needSupply[addr] {
+			b, err := e.readSlot(ctx, addr, blockNum, totalSupplySlot)
+			if err != nil {
+				return nil, nil, err
+			}
+			supply.SetBytes(b)
+		}
+		pools[addr] = &simPool{
+			token0: state.token0,
+			token1: state.token1,
+			pair:   uniswapv2.Pair{Reserve0: state.reserve0, Reserve1: state.reserve1, TotalSupply: supply, Fee: state.fee},
+		}
+	}
+	return pools, order, nil
+}
+
+func applyStep(p *simPool, step SimulationStep) (StepResult, error) {
+	res := StepResult{Kind: step.Kind, Pool: step.Pool}
+	switch step.Kind {
+	case StepSwap:
+		if step.AmountIn == nil {
+			return res, ErrInvalidStep
+		}
+		var zeroForOne bool
+		switch step.Src {
+		case p.token0:
+			zeroForOne, res.Dst = true, p.token1
+		case p.token1:
+			zeroForOne, res.Dst = false, p.token0
+		default:
+			return res, ErrPairMismatch
+		}
+		if step.Dst != (common.Address{}) && step.Dst != res.Dst {
+			return res, ErrPairMismatch
+		}
+		out, err := p.pair.Swap(zeroForOne, step.AmountIn)
+		if err != nil {
+			return res, err
+		}
+		res.AmountOut = out
+	case StepMint:
+		if step.Amount0 == nil || step.Amount1 == nil {
+			return res, ErrInvalidStep
+		}
+		liquidity, err := p.pair.Mint(step.Amount0, step.Amount1)
+		if err != nil {
+			return res, err
+		}
+		res.Liquidity = liquidity
+	case StepBurn:
+		if step.Liquidity == nil {
+			return res, ErrInvalidStep
+		}
+		a0, a1, err := p.pair.Burn(step.Liquidity)
+		if err != nil {
+			return res, err
+		}
+		res.Amount0, res.Amount1 = a0, a1
+	default:
+		return res, ErrInvalidStep
+	}
+	return res, nil
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/pkg/uniswapv2"
+)
+
+func TestSimulate_SequenceAcrossPools(t *testing.T) {
+	t.Parallel()
+
+	tokenA := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tokenB := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	tokenC := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	poolAB := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+	poolBC := common.HexToAddress("0x0000000000000000000000000000000000000bcd")
+
+	fe := &fakeEth{
+		blockNumber: 77,
+		storage: map[common.Address]map[common.Hash][]byte{
+			poolAB: {
+				common.BigToHash(new(big.Int).SetUint64(0)): u256Bytes(big.NewInt(1_000_000)),
+				common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(tokenA),
+				common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(tokenB),
+				common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000_000, 1_000_000, 0),
+			},
+			poolBC: {
+				common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(tokenB),
+				common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(tokenC),
+				common.BigToHash(new(big.Int).SetUint64(8)): packReserves(5_000_000, 2_000_000, 0),
+			},
+		},
+	}
+	ec := newInprocEthClient(t, fe)
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), eth.NewClientReader(ec))
+
+	steps := []SimulationStep{
+		{Kind: StepSwap, Pool: poolAB, Src: tokenA, AmountIn: big.NewInt(10_000)},
+		{Kind: StepMint, Pool: poolAB, Amount0: big.NewInt(100_000), Amount1: big.NewInt(100_000)},
+		{Kind: StepSwap, Pool: poolBC, Src: tokenC, Dst: tokenB, AmountIn: big.NewInt(50_000)},
+		{Kind: StepBurn, Pool: poolAB, Liquidity: big.NewInt(50_000)},
+	}
+	res, err := svc.Simulate(context.Background(), nil, steps)
+	if err != nil {
+		t.Fatalf("Simulate error: %v", err)
+	}
+
+	ab := uniswapv2.Pair{Reserve0: big.NewInt(1_000_000), Reserve1: big.NewInt(1_000_000), TotalSupply: big.NewInt(1_000_000)}
+	bc := uniswapv2.Pair{Reserve0: big.NewInt(5_000_000), Reserve1: big.NewInt(2_000_000), TotalSupply: new(big.Int)}
+	out0, _ := ab.Swap(true, big.NewInt(10_000))
+	liq, _ := ab.Mint(big.NewInt(100_000), big.NewInt(100_000))
+	out2, _ := bc.Swap(false, big.NewInt(50_000))
+	burn0, burn1, _ := ab.Burn(big.NewInt(50_000))
+
+	if res.Block.Uint64() != 77 {
+		t.Fatalf("unexpected block: %s", res.Block)
+	}
+	if got := res.Steps[0]; got.AmountOut.Cmp(out0) != 0 || got.Dst != tokenB {
+		t.Fatalf("step 0: got %s to %s want %s to %s", got.AmountOut, got.Dst.Hex(), out0, tokenB.Hex())
+	}
+	if got := res.Steps[1].Liquidity; got.Cmp(liq) != 0 {
+		t.Fatalf("step 1: got %s want %s", got, liq)
+	}
+	if got := res.Steps[2].AmountOut; got.Cmp(out2) != 0 {
+		t.Fatalf("step 2: got %s want %s", got, out2)
+	}
+	if got := res.Steps[3]; got.Amount0.Cmp(burn0) != 0 || got.Amount1.Cmp(burn1) != 0 {
+		t.Fatalf("step 3: got %s/%s want %s/%s", got.Amount0, got.Amount1, burn0, burn1)
+	}
+
+	if len(res.Pools) != 2 || res.Pools[0].Pool != poolAB || res.Pools[1].Pool != poolBC {
+		t.Fatalf("unexpected pools: %+v", res.Pools)
+	}
+	if p := res.Pools[0]; p.Reserve0.Cmp(ab.Reserve0) != 0 || p.Reserve1.Cmp(ab.Reserve1) != 0 || p.TotalSupply.Cmp(ab.TotalSupply) != 0 {
+		t.Fatalf("unexpected final AB state: %s/%s/%s", p.Reserve0, p.Reserve1, p.TotalSupply)
+	}
+	if p := res.Pools[1]; p.Reserve0.Cmp(bc.Reserve0) != 0 || p.Reserve1.Cmp(bc.Reserve1) != 0 {
+		t.Fatalf("unexpected final BC state: %s/%s", p.Reserve0, p.Reserve1)
+	}
+}
+
+func TestSimulate_StepErrors(t *testing.T) {
+	t.Parallel()
+
+	token0 := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	token1 := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	wrong := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	pool := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	fe := &fakeEth{blockNumber: 1, storage: map[common.Address]map[common.Hash][]byte{pool: {common.BigToHash(new(big.Int).SetUint64(6)): rightPadAddress(token0), common.BigToHash(new(big.Int).SetUint64(7)): rightPadAddress(token1), common.BigToHash(new(big.Int).SetUint64(8)): packReserves(1_000, 1_000, 0)}}}
+	ec := newInprocEthClient(t, fe)
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), eth.NewClientReader(ec))
+
+	if _, err := svc.Simulate(context.Background(), nil, nil); err != ErrInvalidSimulation {
+		t.Fatalf("expected ErrInvalidSimulation, got %v", err)
+	}
+
+	_, err := svc.Simulate(context.Background(), big.NewInt(1), []SimulationStep{
+		{Kind: StepSwap, Pool: pool, Src: token0, AmountIn: big.NewInt(10)},
+		{Kind: StepSwap, Pool: pool, Src: wrong, AmountIn: big.NewInt(10)},
+	})
+	var stepErr *StepError
+	if !errors.As(err, &stepErr) || stepErr.Index != 1 || !errors.Is(err, ErrPairMismatch) {
+		t.Fatalf("expected step 1 pair mismatch, got %v", err)
+	}
+
+	// The pool has zero total supply, so burning must fail.
+	_, err = svc.Simulate(context.Background(), nil, []SimulationStep{
+		{Kind: StepBurn, Pool: pool, Liquidity: big.NewInt(1)},
+	})
+	if !errors.Is(err, uniswapv2.ErrInsufficientLiquidity) {
+		t.Fatalf("expected ErrInsufficientLiquidity, got %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/metrics"
+	"github.com/nulln0ne/uniswap-estimator/internal/tokenlist"
+)
+
+// Selectors of the ERC-20 metadata functions.
+var (
+	decimalsSelector = []byte{0x31, 0x3c, 0xe5, 0x67} // decimals()
+	symbolSelector   = []byte{0x95, 0xd8, 0x9b, 0x41} // symbol()
+)
+
+const (
+	// maxTokenEntries bounds the number of tokens whose metadata is cached.
+	maxTokenEntries = 10_000
+	// maxSymbolLen bounds the length in bytes of a symbol worth reporting.
+	maxSymbolLen = 32
+)
+
+// errCallsUnsupported is returned for token metadata when the chain reader
+// cannot execute contract calls.
+var errCallsUnsupported = errors.New("state reader does not support contract calls")
+
+// Token is the ERC-20 metadata of a token.
+type Token struct {
+	Address  common.Address
+	Decimals uint8
+	// Symbol is empty when the token reports none or an unreadable one.
+	Symbol string
+}
+
+// tokenCache remembers token metadata, which does not change once a token
+// is deployed.
+type tokenCache struct {
+	mu      sync.Mutex
+	entries map[common.Address]*Token
+}
+
+func (c *tokenCache) get(token common.Address) (*Token, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.entries[token]
+	return t, ok
+}
+
+func (c *tokenCache) put(t *Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[common.Address]*Token)
+	}
+	if _, ok := c.entries[t.Address]; !ok && len(c.entries) >= maxTokenEntries {
+		for k := range c.entries {
+			delete(c.entries, k)
+			break
+		}
+	}
+	c.entries[t.Address] = t
+}
+
+// Token returns the decimals and symbol of token, read with eth_call at the
+// latest block and then cached. Symbols are decoded from an ABI string or,
+// for early tokens such as MKR, from a bytes32. It returns ErrNotERC20 when
+// token does not implement decimals(); a missing symbol is left empty.
+func (e *EstimateService) Token(ctx context.Context, token common.Address) (*Token, error) {
+	if t, ok := e.tokens.get(token); ok {
+		metrics.CacheLookup(metrics.CacheTokenMetadata, true)
+		return t, nil
+	}
+	metrics.CacheLookup(metrics.CacheTokenMetadata, false)
+
+	caller, ok := e.reader.(eth.CallReader)
+	if !ok {
+		return nil, errCallsUnsupported
+	}
+	t, err := coalesce(ctx, &e.reads, "token:"+token.Hex(), func(ctx context.Context) (*Token, error) {
+		return readToken(ctx, caller, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.tokens.put(t)
+	return t, nil
+}
+
+// readToken calls the ERC-20 metadata functions of token.
+func readToken(ctx context.Context, caller eth.CallReader, token common.Address) (*Token, error) {
+	out, err := caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: decimalsSelector}, nil)
+	if errors.Is(err, eth.ErrExecutionReverted) {
+		return nil, ErrNotERC20
+	}
+	if err != nil {
+		return nil, fmt.Errorf("token decimals: %w", err)
+	}
+	decimals, ok := decodeDecimals(out)
+	if !ok {
+		return nil, ErrNotERC20
+	}
+
+	t := &Token{Address: token, Decimals: decimals}
+	out, err = caller.CallContract(ctx, ethereum.CallMsg{To: &token, Data: symbolSelector}, nil)
+	switch {
+	case err == nil:
+		t.Symbol = decodeSymbol(out)
+	case errors.Is(err, eth.ErrExecutionReverted):
+		// symbol() is optional in ERC-20.
+	default:
+		return nil, fmt.Errorf("token symbol: %w", err)
+	}
+	return t, nil
+}
+
+// decodeDecimals decodes the return data of decimals(), a uint8 padded to
+// 32 bytes. Accounts without code return no data.
+func decodeDecimals(out []byte) (uint8, bool) {
+	if len(out) < 32 {
+		return 0, false
+	}
+	v := new(big.Int).SetBytes(out[:32])
+	if !v.IsUint64() || v.Uint64() > 255 {
+		return 0, false
+	}
+	return uint8(v.Uint64()), true
+}
+
+// decodeSymbol decodes the return data of symbol(): an ABI-encoded string,
+// or a zero-padded bytes32 for tokens that predate the string convention.
+// Malformed, overlong or unprintable symbols decode as empty.
+func decodeSymbol(out []byte) string {
+	var raw []byte
+	switch {
+	case len(out) == 32:
+		raw = bytes.TrimRight(out, "\x00")
+	case len(out) >= 64:
+		offset := new(big.Int).SetBytes(out[:32])
+		if !offset.IsUint64() || offset.Uint64() > uint64(len(out)-32) {
+			return ""
+		}
+		start := offset.Uint64() + 32
+		n := new(big.Int).SetBytes(out[start-32 : start])
+		if !n.IsUint64() || n.Uint64() > uint64(len(out))-start {
+			return ""
+		}
+		raw = out[start : start+n.Uint64()]
+	default:
+		return ""
+	}
+
+	symbol := strings.TrimSpace(string(raw))
+	if len(symbol) > maxSymbolLen || !utf8.ValidString(symbol) || strings.ContainsFunc(symbol, func(r rune) bool { return !unicode.IsPrint(r) }) {
+		return ""
+	}
+	return symbol
+}
+
+// ParseUnits converts a decimal amount such as "1.5" to the raw units of a
+// token with decimals, here 1500000000000000000 for 18. It fails on anything
+// but digits with an optional fraction, and on more significant fractional
+// digits than decimals.
+func ParseUnits(amount string, decimals uint8) (*big.Int, error) {
+	whole, frac, _ := strings.Cut(amount, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return nil, errors.New("want a decimal number such as 1.5")
+	}
+	frac = strings.TrimRight(frac, "0")
+	if len(frac) > int(decimals) {
+		return nil, fmt.Errorf("token has %d decimals", decimals)
+	}
+	v, _ := new(big.Int).SetString(whole+frac+strings.Repeat("0", int(decimals)-len(frac)), 10)
+	return v, nil
+}
+
+// FormatUnits formats raw units of a token with decimals as a decimal
+// amount without trailing zeros, e.g. "1.5".
+func FormatUnits(amount *big.Int, decimals uint8) string {
+	s := amount.String()
+	d := int(decimals)
+	if d == 0 {
+		return s
+	}
+	if len(s) <= d {
+		s = strings.Repeat("0", d-len(s)+1) + s
+	}
+	whole, frac := s[:len(s)-d], strings.TrimRight(s[len(s)-d:], "0")
+	if frac == "" {
+		return whole
+	}
+	return whole + "." + frac
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// WithTokenList makes the tokens of list known by symbol on the chain.
+func WithTokenList(list *tokenlist.List) Option {
+	return func(e *EstimateService) {
+		e.listed = list
+	}
+}
+
+// TokenList returns the token list of the chain, nil if it has none.
+func (e *EstimateService) TokenList() *tokenlist.List {
+	return e.listed
+}
+
+// CheckListed returns an error wrapping ErrUnlistedToken if the chain has a
+// token list and token is not in it. Without a list every token is known.
+func (e *EstimateService) CheckListed(token common.Address) error {
+	if e.listed == nil {
+		return nil
+	}
+	if _, ok := e.listed.ByAddress(token); !ok {
+		return fmt.Errorf("%w %s on %s", ErrUnlistedToken, token.Hex(), e.chain.Name)
+	}
+	return nil
+}
+
+// ResolveSymbol returns the address of the token with symbol in the chain's
+// token list, ignoring case. It returns an error wrapping ErrUnknownToken
+// when no token has symbol, and one wrapping ErrAmbiguousSymbol, which lists
+// the candidates, when several do.
+func (e *EstimateService) ResolveSymbol(symbol string) (common.Address, error) {
+	tokens := e.listed.BySymbol(symbol)
+	switch len(tokens) {
+	case 0:
+		return common.Address{}, fmt.Errorf("%w %q on %s", ErrUnknownToken, symbol, e.chain.Name)
+	case 1:
+		return tokens[0].Address, nil
+	}
+	candidates := make([]string, len(tokens))
+	for i, t := range tokens {
+		candidates[i] = fmt.Sprintf("%s (%s)", t.Address.Hex(), t.Name)
+	}
+	return common.Address{}, fmt.Errorf("%w %q on %s, use the address of one of %s", ErrAmbiguousSymbol, symbol, e.chain.Name, strings.Join(candidates, ", "))
+}
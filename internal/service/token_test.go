@@ -0,0 +1,237 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/nulln0ne/uniswap-estimator/internal/eth"
+	"github.com/nulln0ne/uniswap-estimator/internal/tokenlist"
+)
+
+// callReader is a snapshotReader answering eth_call with the return data of
+// the token metadata functions. Tokens missing from the map revert.
+type callReader struct {
+	snapshotReader
+	decimals map[common.Address][]byte
+	symbols  map[common.Address][]byte
+	calls    atomic.Int64
+}
+
+func (r *callReader) CallContract(_ context.Context, msg ethereum.CallMsg, _ *big.Int) ([]byte, error) {
+	r.calls.Add(1)
+	outputs := r.symbols
+	if bytes.Equal(msg.Data, decimalsSelector) {
+		outputs = r.decimals
+	}
+	out, ok := outputs[*msg.To]
+	if !ok {
+		return nil, eth.ErrExecutionReverted
+	}
+	return out, nil
+}
+
+// abiString ABI-encodes s as the only return value of a function.
+func abiString(s string) []byte {
+	out := u256Bytes(big.NewInt(32))
+	out = append(out, u256Bytes(big.NewInt(int64(len(s))))...)
+	padded := make([]byte, (len(s)+31)/32*32)
+	copy(padded, s)
+	return append(out, padded...)
+}
+
+func TestToken(t *testing.T) {
+	t.Parallel()
+
+	usdc := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	mkr := common.HexToAddress("0x9f8F72aA9304c8B593d555F12eF6589cC3A579A2")
+	noSymbol := common.HexToAddress("0x00000000000000000000000000000000000000cc")
+	eoa := common.HexToAddress("0x00000000000000000000000000000000000000dd")
+	mkrSymbol := make([]byte, 32)
+	copy(mkrSymbol, "MKR")
+	reader := &callReader{
+		decimals: map[common.Address][]byte{
+			usdc:     u256Bytes(big.NewInt(6)),
+			mkr:      u256Bytes(big.NewInt(18)),
+			noSymbol: u256Bytes(big.NewInt(8)),
+			eoa:      {},
+		},
+		symbols: map[common.Address][]byte{usdc: abiString("USDC"), mkr: mkrSymbol},
+	}
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), reader)
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		token    common.Address
+		decimals uint8
+		symbol   string
+	}{
+		{usdc, 6, "USDC"},
+		{mkr, 18, "MKR"},
+		{noSymbol, 8, ""},
+	} {
+		tok, err := svc.Token(ctx, tc.token)
+		if err != nil {
+			t.Fatalf("Token(%s) error: %v", tc.token, err)
+		}
+		if tok.Decimals != tc.decimals || tok.Symbol != tc.symbol {
+			t.Errorf("Token(%s) = %d %q, want %d %q", tc.token, tok.Decimals, tok.Symbol, tc.decimals, tc.symbol)
+		}
+	}
+
+	calls := reader.calls.Load()
+	if _, err := svc.Token(ctx, usdc); err != nil || reader.calls.Load() != calls {
+		t.Fatalf("cached metadata read again: %v", err)
+	}
+
+	for _, token := range []common.Address{eoa, common.HexToAddress("0x00000000000000000000000000000000000000ee")} {
+		if _, err := svc.Token(ctx, token); !errors.Is(err, ErrNotERC20) {
+			t.Errorf("Token(%s) error = %v, want ErrNotERC20", token, err)
+		}
+	}
+}
+
+func TestDecodeSymbol(t *testing.T) {
+	t.Parallel()
+
+	bytes32 := make([]byte, 32)
+	copy(bytes32, "MKR")
+	badOffset := abiString("USDC")
+	badOffset[31] = 0xff
+	badLength := abiString("USDC")
+	badLength[63] = 0xff
+
+	for name, tc := range map[string]struct {
+		out  []byte
+		want string
+	}{
+		"string":       {abiString("WETH"), "WETH"},
+		"long string":  {abiString("Wrapped Ether on a long symbol!!"), "Wrapped Ether on a long symbol!!"},
+		"bytes32":      {bytes32, "MKR"},
+		"empty":        {nil, ""},
+		"bad offset":   {badOffset, ""},
+		"bad length":   {badLength, ""},
+		"too long":     {abiString("THIS SYMBOL IS LONGER THAN 32 BYTES"), ""},
+		"unprintable":  {abiString("A\x00B"), ""},
+		"invalid utf8": {abiString("\xff\xfe"), ""},
+	} {
+		if got := decodeSymbol(tc.out); got != tc.want {
+			t.Errorf("%s: decodeSymbol = %q, want %q", name, got, tc.want)
+		}
+	}
+}
+
+func TestParseUnits(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		in       string
+		decimals uint8
+		want     string
+	}{
+		{"1.5", 18, "1500000000000000000"},
+		{"1.5", 6, "1500000"},
+		{"1", 0, "1"},
+		{".5", 1, "5"},
+		{"2.", 2, "200"},
+		{"0.000001", 6, "1"},
+		{"1.50000000", 2, "150"},
+	} {
+		got, err := ParseUnits(tc.in, tc.decimals)
+		if err != nil || got.String() != tc.want {
+			t.Errorf("ParseUnits(%q, %d) = %v, %v; want %s", tc.in, tc.decimals, got, err, tc.want)
+			continue
+		}
+		if back, _ := ParseUnits(FormatUnits(got, tc.decimals), tc.decimals); back.Cmp(got) != 0 {
+			t.Errorf("FormatUnits(%s, %d) = %q does not parse back", got, tc.decimals, FormatUnits(got, tc.decimals))
+		}
+	}
+
+	for _, in := range []string{"", ".", "-1", "1e18", "1,5", "1.2.3", " 1", "0.0000001"} {
+		if _, err := ParseUnits(in, 6); err == nil {
+			t.Errorf("ParseUnits(%q, 6) succeeded", in)
+		}
+	}
+}
+
+func TestFormatUnits(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		amount   int64
+		decimals uint8
+		want     string
+	}{
+		{1_500_000, 6, "1.5"},
+		{1, 6, "0.000001"},
+		{2_000_000, 6, "2"},
+		{0, 18, "0"},
+		{42, 0, "42"},
+	} {
+		if got := FormatUnits(big.NewInt(tc.amount), tc.decimals); got != tc.want {
+			t.Errorf("FormatUnits(%d, %d) = %q, want %q", tc.amount, tc.decimals, got, tc.want)
+		}
+	}
+}
+
+func TestResolveSymbol(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	err := os.WriteFile(path, []byte(`{"tokens":[
+		{"chainId":1,"address":"0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2","symbol":"WETH","name":"Wrapped Ether","decimals":18},
+		{"chainId":1,"address":"0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48","symbol":"USDC","name":"USD Coin","decimals":6},
+		{"chainId":1,"address":"0x7EA2be2df7BA6E54B1A9C70676f668455E329d29","symbol":"USDC","name":"Bridged USDC","decimals":6}
+	]}`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := tokenlist.Load(slog.New(slog.NewTextHandler(io.Discard, nil)), 1, path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	svc := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), &snapshotReader{}, WithTokenList(list))
+
+	if addr, err := svc.ResolveSymbol("weth"); err != nil || addr != common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2") {
+		t.Fatalf("ResolveSymbol(weth) = %s, %v", addr.Hex(), err)
+	}
+	if _, err := svc.ResolveSymbol("DAI"); !errors.Is(err, ErrUnknownToken) {
+		t.Fatalf("ResolveSymbol(DAI) error = %v, want ErrUnknownToken", err)
+	}
+	_, err = svc.ResolveSymbol("USDC")
+	if CodeOf(err) != CodeAmbiguousSymbol {
+		t.Fatalf("ResolveSymbol(USDC) error = %v, want CodeAmbiguousSymbol", err)
+	}
+	for _, want := range []string{"0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48 (USD Coin)", "0x7EA2be2df7BA6E54B1A9C70676f668455E329d29 (Bridged USDC)"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ambiguity error %q does not list %s", err, want)
+		}
+	}
+
+	if err := svc.CheckListed(common.HexToAddress("0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2")); err != nil {
+		t.Fatalf("CheckListed(WETH) = %v", err)
+	}
+	dai := common.HexToAddress("0x6B175474E89094C44Da98b954EedeAC495271d0F")
+	if err := svc.CheckListed(dai); !errors.Is(err, ErrUnlistedToken) || CodeOf(err) != CodeUnknownToken {
+		t.Fatalf("CheckListed(DAI) = %v, want ErrUnlistedToken", err)
+	}
+
+	// Without a token list no symbol is known, and every address is.
+	plain := NewEstimateService(slog.New(slog.NewTextHandler(io.Discard, nil)), &snapshotReader{})
+	if _, err := plain.ResolveSymbol("WETH"); !errors.Is(err, ErrUnknownToken) {
+		t.Fatalf("ResolveSymbol without a list error = %v, want ErrUnknownToken", err)
+	}
+	if err := plain.CheckListed(dai); err != nil {
+		t.Fatalf("CheckListed without a list = %v", err)
+	}
+}
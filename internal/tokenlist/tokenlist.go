@@ -0,0 +1,189 @@
+// Package tokenlist loads token lists in the Uniswap token list format
+// (https://tokenlists.org) and looks their tokens up by symbol, address or
+// name.
+package tokenlist
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Token is a token listed for a chain.
+type Token struct {
+	Address  common.Address
+	Symbol   string
+	Name     string
+	Decimals uint8
+}
+
+// List holds the tokens of one chain, merged from any number of token list
+// files. A nil *List lists no tokens.
+type List struct {
+	// tokens are sorted by symbol, case-insensitively, then address.
+	tokens    []Token
+	bySymbol  map[string][]Token
+	byAddress map[common.Address]Token
+}
+
+// file is the part of the token list schema that is read.
+type file struct {
+	Name   string      `json:"name"`
+	Tokens []tokenInfo `json:"tokens"`
+}
+
+type tokenInfo struct {
+	ChainID  uint64 `json:"chainId"`
+	Address  string `json:"address"`
+	Symbol   string `json:"symbol"`
+	Name     string `json:"name"`
+	Decimals *int   `json:"decimals"`
+}
+
+// Load reads the token list files at paths and returns their tokens on the
+// chain chainID; tokens of other chains are skipped. Invalid tokens, e.g.
+// with an address lacking its EIP-55 checksum, are logged and skipped so
+// that one bad entry does not discard the list. A token listed by several
+// files is kept as the first one lists it. Files that cannot be read or
+// parsed fail the load.
+func Load(logger *slog.Logger, chainID uint64, paths ...string) (*List, error) {
+	l := &List{bySymbol: make(map[string][]Token), byAddress: make(map[common.Address]Token)}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("token list: %w", err)
+		}
+		if err := l.add(logger.With("path", path), chainID, data); err != nil {
+			return nil, fmt.Errorf("token list %s: %w", path, err)
+		}
+	}
+	slices.SortFunc(l.tokens, compareTokens)
+	for _, t := range l.tokens {
+		key := strings.ToUpper(t.Symbol)
+		l.bySymbol[key] = append(l.bySymbol[key], t)
+	}
+	return l, nil
+}
+
+// add adds the valid tokens on chainID of the token list in data, logging
+// the others.
+func (l *List) add(logger *slog.Logger, chainID uint64, data []byte) error {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	if f.Tokens == nil {
+		return errors.New("no tokens array")
+	}
+
+	for i, ti := range f.Tokens {
+		if ti.ChainID != chainID {
+			continue
+		}
+		t, err := ti.token()
+		if err != nil {
+			logger.Warn("invalid token skipped", "index", i, "err", err)
+			continue
+		}
+		if _, ok := l.byAddress[t.Address]; ok {
+			continue
+		}
+		l.byAddress[t.Address] = t
+		l.tokens = append(l.tokens, t)
+	}
+	return nil
+}
+
+// token validates ti.
+func (ti tokenInfo) token() (Token, error) {
+	if !common.IsHexAddress(ti.Address) || !strings.HasPrefix(ti.Address, "0x") {
+		return Token{}, fmt.Errorf("invalid address %q", ti.Address)
+	}
+	addr := common.HexToAddress(ti.Address)
+	if addr.Hex() != ti.Address {
+		return Token{}, fmt.Errorf("address %q is not checksummed, want %s", ti.Address, addr.Hex())
+	}
+	if ti.Symbol == "" || strings.ContainsAny(ti.Symbol, " \t\n,") {
+		return Token{}, fmt.Errorf("invalid symbol %q of %s", ti.Symbol, ti.Address)
+	}
+	if ti.Decimals == nil || *ti.Decimals < 0 || *ti.Decimals > 255 {
+		return Token{}, fmt.Errorf("invalid decimals of %s", ti.Address)
+	}
+	return Token{Address: addr, Symbol: ti.Symbol, Name: ti.Name, Decimals: uint8(*ti.Decimals)}, nil
+}
+
+func compareTokens(a, b Token) int {
+	return cmp.Or(
+		strings.Compare(strings.ToUpper(a.Symbol), strings.ToUpper(b.Symbol)),
+		a.Address.Cmp(b.Address),
+	)
+}
+
+// Len returns the number of tokens in l.
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	return len(l.tokens)
+}
+
+// BySymbol returns the tokens whose symbol is symbol, ignoring case. More
+// than one token can share a symbol, e.g. bridged versions of a token.
+func (l *List) BySymbol(symbol string) []Token {
+	if l == nil {
+		return nil
+	}
+	return l.bySymbol[strings.ToUpper(symbol)]
+}
+
+// ByAddress returns the token at addr.
+func (l *List) ByAddress(addr common.Address) (Token, bool) {
+	if l == nil {
+		return Token{}, false
+	}
+	t, ok := l.byAddress[addr]
+	return t, ok
+}
+
+// Search returns up to limit tokens matching query: the token at query if it
+// is an address, then tokens whose symbol equals query, starts with it or
+// whose name contains it, all ignoring case. An empty query matches every
+// token. Tokens are ordered by symbol within each group.
+func (l *List) Search(query string, limit int) []Token {
+	if l == nil || limit <= 0 {
+		return nil
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return slices.Clone(l.tokens[:min(limit, len(l.tokens))])
+	}
+	if common.IsHexAddress(query) {
+		if t, ok := l.byAddress[common.HexToAddress(query)]; ok {
+			return []Token{t}
+		}
+		return nil
+	}
+
+	q := strings.ToUpper(query)
+	var exact, prefix, named []Token
+	for _, t := range l.tokens {
+		symbol := strings.ToUpper(t.Symbol)
+		switch {
+		case symbol == q:
+			exact = append(exact, t)
+		case strings.HasPrefix(symbol, q):
+			prefix = append(prefix, t)
+		case strings.Contains(strings.ToUpper(t.Name), q):
+			named = append(named, t)
+		}
+	}
+	found := append(append(exact, prefix...), named...)
+	return found[:min(limit, len(found))]
+}
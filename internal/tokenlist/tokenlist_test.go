@@ -0,0 +1,177 @@
+package tokenlist
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	usdc        = "0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48"
+	weth        = "0xC02aaA39b223FE8D0A0e5C4F27eAD9083C756Cc2"
+	usdcBridged = "0x7EA2be2df7BA6E54B1A9C70676f668455E329d29"
+	bscUSDC     = "0x8AC76a51cc950d9822D68b83fE1Ad97B32Cd580d"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func writeList(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "list.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	first := writeList(t, `{"name":"Default","tokens":[
+		{"chainId":1,"address":"`+weth+`","symbol":"WETH","name":"Wrapped Ether","decimals":18},
+		{"chainId":1,"address":"`+usdc+`","symbol":"USDC","name":"USD Coin","decimals":6},
+		{"chainId":56,"address":"`+bscUSDC+`","symbol":"USDC","name":"USD Coin","decimals":18}
+	]}`)
+	second := writeList(t, `{"name":"Extended","tokens":[
+		{"chainId":1,"address":"`+usdc+`","symbol":"USDC","name":"USDC again","decimals":6},
+		{"chainId":1,"address":"`+usdcBridged+`","symbol":"usdc","name":"Bridged USDC","decimals":6}
+	]}`)
+
+	l, err := Load(discard, 1, first, second)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if l.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", l.Len())
+	}
+
+	weths := l.BySymbol("weth")
+	if len(weths) != 1 || weths[0].Address != common.HexToAddress(weth) || weths[0].Decimals != 18 {
+		t.Fatalf("BySymbol(weth) = %+v", weths)
+	}
+	// Both spellings of the symbol match, and the first list wins for a
+	// token listed twice.
+	usdcs := l.BySymbol("USDC")
+	if len(usdcs) != 2 {
+		t.Fatalf("BySymbol(USDC) = %+v", usdcs)
+	}
+	if tok, ok := l.ByAddress(common.HexToAddress(usdc)); !ok || tok.Name != "USD Coin" {
+		t.Fatalf("ByAddress(%s) = %+v, %v", usdc, tok, ok)
+	}
+	if _, ok := l.ByAddress(common.HexToAddress(bscUSDC)); ok {
+		t.Fatal("token of another chain loaded")
+	}
+
+	bsc, err := Load(discard, 56, first)
+	if err != nil || bsc.Len() != 1 || bsc.BySymbol("USDC")[0].Decimals != 18 {
+		t.Fatalf("Load(56) = %+v, %v", bsc, err)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		content string
+		want    string
+	}{
+		"not json":  {`[`, "unexpected end"},
+		"no tokens": {`{"name":"Empty"}`, "no tokens array"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := writeList(t, tc.content)
+			_, err := Load(discard, 1, path)
+			if err == nil || !strings.Contains(err.Error(), tc.want) || !strings.Contains(err.Error(), path) {
+				t.Fatalf("Load error = %v, want one about %s mentioning %q", err, path, tc.want)
+			}
+		})
+	}
+	if _, err := Load(discard, 1, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Fatal("Load of a missing file succeeded")
+	}
+}
+
+func TestLoadSkipsInvalidTokens(t *testing.T) {
+	for name, tc := range map[string]struct {
+		entry string
+		want  string
+	}{
+		"checksum":   {`{"chainId":1,"address":"` + strings.ToLower(usdc) + `","symbol":"USDC","decimals":6}`, "not checksummed, want " + usdc},
+		"address":    {`{"chainId":1,"address":"0x1234","symbol":"USDC","decimals":6}`, "invalid address"},
+		"symbol":     {`{"chainId":1,"address":"` + usdc + `","symbol":"US DC","decimals":6}`, "invalid symbol"},
+		"decimals":   {`{"chainId":1,"address":"` + usdc + `","symbol":"USDC"}`, "invalid decimals"},
+		"big digits": {`{"chainId":1,"address":"` + usdc + `","symbol":"USDC","decimals":256}`, "invalid decimals"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			// The valid token next to the invalid one is still loaded.
+			path := writeList(t, `{"tokens":[`+tc.entry+`,
+				{"chainId":1,"address":"`+weth+`","symbol":"WETH","decimals":18}]}`)
+			var logs bytes.Buffer
+			l, err := Load(slog.New(slog.NewTextHandler(&logs, nil)), 1, path)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if l.Len() != 1 || len(l.BySymbol("WETH")) != 1 {
+				t.Fatalf("loaded %d tokens, want WETH only", l.Len())
+			}
+			if out := logs.String(); !strings.Contains(out, "invalid token skipped") || !strings.Contains(out, tc.want) || !strings.Contains(out, path) {
+				t.Fatalf("skipped token not logged with its path and %q: %s", tc.want, out)
+			}
+		})
+	}
+
+	// Invalid tokens of other chains are ignored silently.
+	path := writeList(t, `{"tokens":[{"chainId":56,"address":"0x1234","symbol":"X","decimals":6}]}`)
+	var logs bytes.Buffer
+	if _, err := Load(slog.New(slog.NewTextHandler(&logs, nil)), 1, path); err != nil || logs.Len() != 0 {
+		t.Fatalf("Load: %v, logs %q", err, logs.String())
+	}
+}
+
+func TestSearch(t *testing.T) {
+	path := writeList(t, `{"tokens":[
+		{"chainId":1,"address":"`+weth+`","symbol":"WETH","name":"Wrapped Ether","decimals":18},
+		{"chainId":1,"address":"`+usdc+`","symbol":"USDC","name":"USD Coin","decimals":6},
+		{"chainId":1,"address":"`+usdcBridged+`","symbol":"USDC.e","name":"Bridged USDC","decimals":6},
+		{"chainId":1,"address":"0xdAC17F958D2ee523a2206206994597C13D831ec7","symbol":"USDT","name":"Tether USD","decimals":6}
+	]}`)
+	l, err := Load(discard, 1, path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	symbols := func(tokens []Token) string {
+		s := make([]string, len(tokens))
+		for i, t := range tokens {
+			s[i] = t.Symbol
+		}
+		return strings.Join(s, ",")
+	}
+	for _, tc := range []struct {
+		query string
+		limit int
+		want  string
+	}{
+		{"", 10, "USDC,USDC.e,USDT,WETH"},
+		{"", 2, "USDC,USDC.e"},
+		{"usdc", 10, "USDC,USDC.e"},
+		{"usd", 10, "USDC,USDC.e,USDT"},
+		{"wrapped", 10, "WETH"},
+		{"ether", 10, "USDT,WETH"},
+		{"usd", 1, "USDC"},
+		{strings.ToLower(weth), 10, "WETH"},
+		{"0x0000000000000000000000000000000000000001", 10, ""},
+		{"dai", 10, ""},
+	} {
+		if got := symbols(l.Search(tc.query, tc.limit)); got != tc.want {
+			t.Errorf("Search(%q, %d) = %s, want %s", tc.query, tc.limit, got, tc.want)
+		}
+	}
+
+	var none *List
+	if none.Len() != 0 || none.BySymbol("USDC") != nil || none.Search("", 10) != nil {
+		t.Fatal("nil List lists tokens")
+	}
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSetup_ExportsToTracesPath(t *testing.T) {
+	for _, tc := range []struct {
+		name, base, want string
+	}{
+		{"root", "", "/v1/traces"},
+		{"trailing slash", "/", "/v1/traces"},
+		{"base path", "/otlp", "/otlp/v1/traces"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			paths := make(chan string, 1)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				select {
+				case paths <- r.URL.Path:
+				default:
+				}
+			}))
+			defer srv.Close()
+
+			shutdown, err := Setup(context.Background(), Config{Endpoint: srv.URL + tc.base, SampleRatio: 1})
+			if err != nil {
+				t.Fatalf("Setup: %v", err)
+			}
+			_, span := Tracer().Start(context.Background(), "test")
+			span.End()
+			if err := shutdown(context.Background()); err != nil {
+				t.Fatalf("shutdown: %v", err)
+			}
+
+			select {
+			case got := <-paths:
+				if got != tc.want {
+					t.Fatalf("exported to %q, want %q", got, tc.want)
+				}
+			default:
+				t.Fatal("no spans exported")
+			}
+		})
+	}
+}
+
+func TestSetup_InvalidEndpoint(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Endpoint: "localhost:4318"}); err == nil {
+		t.Fatal("expected error for an endpoint without scheme")
+	}
+}
@@ -9,6 +9,22 @@ var (
 	feeDen = big.NewInt(1000)
 )
 
+// Fee is a swap fee expressed as the fraction Mul/Den of the input that is
+// kept for the swap, e.g. 997/1000 for the 0.3% Uniswap V2 fee.
+type Fee struct {
+	Mul *big.Int
+	Den *big.Int
+}
+
+// DefaultFee is the 0.3% Uniswap V2 fee.
+var DefaultFee = Fee{Mul: feeMul, Den: feeDen}
+
+// NewFee returns the Fee for a fee of bps basis points, e.g. 25 for the 0.25%
+// charged by PancakeSwap V2.
+func NewFee(bps uint32) Fee {
+	return Fee{Mul: big.NewInt(10_000 - int64(bps)), Den: big.NewInt(10_000)}
+}
+
 // GetAmountOut computes the output amount for a constant-product AMM swap
 // using the Uniswap V2 formula with a 0.3% fee (997/1000).
 //
@@ -23,10 +39,16 @@ var (
 //	denominator     = reserveIn*1000 + amountInWithFee
 //	amountOut       = numerator / denominator
 func GetAmountOut(dst, t1, t2 *big.Int, amountIn, reserveIn, reserveOut *big.Int) *big.Int {
+	return GetAmountOutFee(dst, t1, t2, amountIn, reserveIn, reserveOut, DefaultFee)
+}
+
+// GetAmountOutFee is GetAmountOut with the fee multiplier 997/1000 replaced by
+// fee.Mul/fee.Den.
+func GetAmountOutFee(dst, t1, t2 *big.Int, amountIn, reserveIn, reserveOut *big.Int, fee Fee) *big.Int {
 	// t1 = amountIn * 997
-	t1.Mul(amountIn, feeMul)
+	t1.Mul(amountIn, fee.Mul)
 	// dst = reserveIn * 1000 (will use as denominator temp)
-	dst.Mul(reserveIn, feeDen)
+	dst.Mul(reserveIn, fee.Den)
 	// t2 = dst + t1  (denominator in t2; avoids z==y alias later)
 	t2.Add(dst, t1)
 	// dst = t1 * reserveOut (numerator)
@@ -35,3 +57,36 @@ func GetAmountOut(dst, t1, t2 *big.Int, amountIn, reserveIn, reserveOut *big.Int
 	dst.QuoRem(dst, t2, t1)
 	return dst
 }
+
+var one = big.NewInt(1)
+
+// GetAmountIn computes the input amount required to receive amountOut from a
+// constant-product AMM swap using the Uniswap V2 formula with a 0.3% fee.
+//
+// Scratch values follow the same convention as GetAmountOut. The caller must
+// ensure amountOut is strictly less than reserveOut; otherwise the swap is
+// impossible and the result is undefined.
+//
+// The formula is:
+//
+//	numerator   = reserveIn * amountOut * 1000
+//	denominator = (reserveOut - amountOut) * 997
+//	amountIn    = numerator / denominator + 1
+func GetAmountIn(dst, t1, t2 *big.Int, amountOut, reserveIn, reserveOut *big.Int) *big.Int {
+	return GetAmountInFee(dst, t1, t2, amountOut, reserveIn, reserveOut, DefaultFee)
+}
+
+// GetAmountInFee is GetAmountIn with the fee multiplier 997/1000 replaced by
+// fee.Mul/fee.Den.
+func GetAmountInFee(dst, t1, t2 *big.Int, amountOut, reserveIn, reserveOut *big.Int, fee Fee) *big.Int {
+	// t1 = reserveIn * amountOut * 1000 (numerator)
+	t1.Mul(reserveIn, amountOut)
+	t1.Mul(t1, fee.Den)
+	// t2 = (reserveOut - amountOut) * 997 (denominator)
+	t2.Sub(reserveOut, amountOut)
+	t2.Mul(t2, fee.Mul)
+	// dst = t1 / t2 + 1; remainder goes into t1
+	dst.QuoRem(t1, t2, t1)
+	dst.Add(dst, one)
+	return dst
+}
@@ -29,3 +29,52 @@ func TestGetAmountOut(t *testing.T) {
 		t.Fatalf("amountOut should be positive")
 	}
 }
+
+func TestGetAmountIn(t *testing.T) {
+	rIn := big.NewInt(1_000_000)
+	rOut := big.NewInt(2_000_000)
+	amountOut := big.NewInt(1_000)
+
+	var dst, t1, t2 big.Int
+	in := GetAmountIn(&dst, &t1, &t2, amountOut, rIn, rOut)
+
+	numerator := new(big.Int).Mul(rIn, amountOut)
+	numerator.Mul(numerator, big.NewInt(1000))
+	denominator := new(big.Int).Sub(rOut, amountOut)
+	denominator.Mul(denominator, big.NewInt(997))
+	expected := new(big.Int).Div(numerator, denominator)
+	expected.Add(expected, big.NewInt(1))
+
+	if in.Cmp(expected) != 0 {
+		t.Fatalf("unexpected: got %s want %s", in, expected)
+	}
+
+	// Swapping the computed input must yield at least the requested output.
+	var o, s1, s2 big.Int
+	if got := GetAmountOut(&o, &s1, &s2, in, rIn, rOut); got.Cmp(amountOut) < 0 {
+		t.Fatalf("round trip: got %s want >= %s", got, amountOut)
+	}
+}
+
+func TestGetAmountOutFee(t *testing.T) {
+	rIn := big.NewInt(1_000_000)
+	rOut := big.NewInt(2_000_000)
+	amountIn := big.NewInt(10_000)
+
+	var dst, t1, t2 big.Int
+	def := new(big.Int).Set(GetAmountOut(&dst, &t1, &t2, amountIn, rIn, rOut))
+	if got := GetAmountOutFee(&dst, &t1, &t2, amountIn, rIn, rOut, NewFee(30)); got.Cmp(def) != 0 {
+		t.Fatalf("30 bps fee: got %s want %s", got, def)
+	}
+
+	// 0.25%: 10000*9975*2000000 / (1000000*10000 + 10000*9975) = 19752
+	if got := GetAmountOutFee(&dst, &t1, &t2, amountIn, rIn, rOut, NewFee(25)); got.Int64() != 19752 {
+		t.Fatalf("25 bps fee: got %s want 19752", got)
+	}
+
+	// GetAmountInFee inverts GetAmountOutFee for the same fee.
+	out := big.NewInt(19_752)
+	if got := GetAmountInFee(&dst, &t1, &t2, out, rIn, rOut, NewFee(25)); got.Cmp(amountIn) > 0 {
+		t.Fatalf("amountIn for %s out: got %s, want at most %s", out, got, amountIn)
+	}
+}
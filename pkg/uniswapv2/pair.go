@@ -0,0 +1,120 @@
+package uniswapv2
+
+import (
+	"errors"
+	"math/big"
+)
+
+// MinimumLiquidity is the amount of LP tokens permanently locked by the first
+// mint of a Uniswap V2 pair.
+var MinimumLiquidity = big.NewInt(1000)
+
+// ErrInsufficientLiquidity is returned when an operation would leave a pair
+// with no usable reserves or would mint or burn zero liquidity.
+var ErrInsufficientLiquidity = errors.New("insufficient liquidity")
+
+// ErrInsufficientInput is returned when a swap or mint is given a non-positive
+// amount.
+var ErrInsufficientInput = errors.New("insufficient input amount")
+
+// Pair is an in-memory snapshot of a Uniswap V2 pair that can be mutated by
+// swaps, mints and burns. The protocol fee (feeTo/kLast) is not modeled, so
+// mints and burns match on-chain results only while the fee is switched off.
+type Pair struct {
+	Reserve0    *big.Int
+	Reserve1    *big.Int
+	TotalSupply *big.Int
+	// Fee is the swap fee; the zero value means DefaultFee.
+	Fee Fee
+}
+
+// Swap sells amountIn of token0 (zeroForOne) or token1 into the pair, updates
+// the reserves and returns the output amount.
+func (p *Pair) Swap(zeroForOne bool, amountIn *big.Int) (*big.Int, error) {
+	if amountIn.Sign() <= 0 {
+		return nil, ErrInsufficientInput
+	}
+	reserveIn, reserveOut := p.Reserve0, p.Reserve1
+	if !zeroForOne {
+		reserveIn, reserveOut = p.Reserve1, p.Reserve0
+	}
+	if reserveIn.Sign() == 0 || reserveOut.Sign() == 0 {
+		return nil, ErrInsufficientLiquidity
+	}
+
+	fee := p.Fee
+	if fee.Mul == nil {
+		fee = DefaultFee
+	}
+	var t1, t2 big.Int
+	out := GetAmountOutFee(new(big.Int), &t1, &t2, amountIn, reserveIn, reserveOut, fee)
+	if out.Sign() == 0 {
+		return nil, ErrInsufficientLiquidity
+	}
+	reserveIn.Add(reserveIn, amountIn)
+	reserveOut.Sub(reserveOut, out)
+	return out, nil
+}
+
+// Mint deposits amount0 and amount1, updates reserves and total supply, and
+// returns the liquidity minted. As on-chain, liquidity is the smaller of the
+// two proportional shares, or sqrt(amount0*amount1) - MinimumLiquidity for the
+// first deposit.
+func (p *Pair) Mint(amount0, amount1 *big.Int) (*big.Int, error) {
+	if amount0.Sign() <= 0 || amount1.Sign() <= 0 {
+		return nil, ErrInsufficientInput
+	}
+
+	var liquidity *big.Int
+	if p.TotalSupply.Sign() == 0 {
+		liquidity = new(big.Int).Mul(amount0, amount1)
+		liquidity.Sqrt(liquidity)
+		liquidity.Sub(liquidity, MinimumLiquidity)
+		if liquidity.Sign() <= 0 {
+			return nil, ErrInsufficientLiquidity
+		}
+		// MINIMUM_LIQUIDITY is minted to the zero address.
+		p.TotalSupply.Add(p.TotalSupply, MinimumLiquidity)
+	} else {
+		if p.Reserve0.Sign() == 0 || p.Reserve1.Sign() == 0 {
+			return nil, ErrInsufficientLiquidity
+		}
+		l0 := new(big.Int).Mul(amount0, p.TotalSupply)
+		l0.Quo(l0, p.Reserve0)
+		l1 := new(big.Int).Mul(amount1, p.TotalSupply)
+		l1.Quo(l1, p.Reserve1)
+		liquidity = l0
+		if l1.Cmp(l0) < 0 {
+			liquidity = l1
+		}
+		if liquidity.Sign() <= 0 {
+			return nil, ErrInsufficientLiquidity
+		}
+	}
+
+	p.Reserve0.Add(p.Reserve0, amount0)
+	p.Reserve1.Add(p.Reserve1, amount1)
+	p.TotalSupply.Add(p.TotalSupply, liquidity)
+	return liquidity, nil
+}
+
+// Burn redeems liquidity for a pro-rata share of the reserves, updates the
+// pair and returns the withdrawn amounts.
+func (p *Pair) Burn(liquidity *big.Int) (amount0, amount1 *big.Int, err error) {
+	if liquidity.Sign() <= 0 || liquidity.Cmp(p.TotalSupply) > 0 {
+		return nil, nil, ErrInsufficientLiquidity
+	}
+
+	amount0 = new(big.Int).Mul(liquidity, p.Reserve0)
+	amount0.Quo(amount0, p.TotalSupply)
+	amount1 = new(big.Int).Mul(liquidity, p.Reserve1)
+	amount1.Quo(amount1, p.TotalSupply)
+	if amount0.Sign() == 0 || amount1.Sign() == 0 {
+		return nil, nil, ErrInsufficientLiquidity
+	}
+
+	p.Reserve0.Sub(p.Reserve0, amount0)
+	p.Reserve1.Sub(p.Reserve1, amount1)
+	p.TotalSupply.Sub(p.TotalSupply, liquidity)
+	return amount0, amount1, nil
+}
@@ -0,0 +1,70 @@
+package uniswapv2
+
+import (
+	"math/big"
+	"testing"
+)
+
+func newPair(r0, r1, supply int64) *Pair {
+	return &Pair{Reserve0: big.NewInt(r0), Reserve1: big.NewInt(r1), TotalSupply: big.NewInt(supply)}
+}
+
+func TestPairSwap(t *testing.T) {
+	p := newPair(1_000_000, 2_000_000, 0)
+	out, err := p.Swap(true, big.NewInt(1_000))
+	if err != nil {
+		t.Fatalf("swap: %v", err)
+	}
+
+	var dst, t1, t2 big.Int
+	expected := GetAmountOut(&dst, &t1, &t2, big.NewInt(1_000), big.NewInt(1_000_000), big.NewInt(2_000_000))
+	if out.Cmp(expected) != 0 {
+		t.Fatalf("unexpected out: got %s want %s", out, expected)
+	}
+	if p.Reserve0.Int64() != 1_001_000 || p.Reserve1.Cmp(new(big.Int).Sub(big.NewInt(2_000_000), out)) != 0 {
+		t.Fatalf("unexpected reserves: %s/%s", p.Reserve0, p.Reserve1)
+	}
+
+	if _, err := newPair(0, 1, 0).Swap(true, big.NewInt(1)); err != ErrInsufficientLiquidity {
+		t.Fatalf("expected ErrInsufficientLiquidity, got %v", err)
+	}
+	if _, err := p.Swap(false, big.NewInt(0)); err != ErrInsufficientInput {
+		t.Fatalf("expected ErrInsufficientInput, got %v", err)
+	}
+}
+
+func TestPairMintBurn(t *testing.T) {
+	p := newPair(0, 0, 0)
+	liq, err := p.Mint(big.NewInt(4_000_000), big.NewInt(1_000_000))
+	if err != nil {
+		t.Fatalf("initial mint: %v", err)
+	}
+	// sqrt(4e12) - 1000
+	if liq.Int64() != 1_999_000 || p.TotalSupply.Int64() != 2_000_000 {
+		t.Fatalf("unexpected initial mint: liquidity %s supply %s", liq, p.TotalSupply)
+	}
+
+	// Unbalanced deposit: the smaller share wins.
+	liq, err = p.Mint(big.NewInt(400_000), big.NewInt(200_000))
+	if err != nil {
+		t.Fatalf("second mint: %v", err)
+	}
+	if liq.Int64() != 200_000 {
+		t.Fatalf("unexpected liquidity: got %s want 200000", liq)
+	}
+
+	a0, a1, err := p.Burn(big.NewInt(220_000))
+	if err != nil {
+		t.Fatalf("burn: %v", err)
+	}
+	if a0.Int64() != 440_000 || a1.Int64() != 120_000 {
+		t.Fatalf("unexpected burn amounts: %s/%s", a0, a1)
+	}
+	if p.TotalSupply.Int64() != 1_980_000 {
+		t.Fatalf("unexpected supply: %s", p.TotalSupply)
+	}
+
+	if _, _, err := p.Burn(big.NewInt(10_000_000)); err != ErrInsufficientLiquidity {
+		t.Fatalf("expected ErrInsufficientLiquidity, got %v", err)
+	}
+}